@@ -3,15 +3,23 @@ package main
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -22,10 +30,13 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/pavelanni/examiner/internal/handler"
+	"github.com/pavelanni/examiner/internal/handler/views"
 	appI18n "github.com/pavelanni/examiner/internal/i18n"
 	"github.com/pavelanni/examiner/internal/llm"
 	"github.com/pavelanni/examiner/internal/llm/prompts"
+	"github.com/pavelanni/examiner/internal/metrics"
 	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/report"
 	"github.com/pavelanni/examiner/internal/store"
 	"github.com/pavelanni/examiner/internal/userutil"
 )
@@ -45,7 +56,7 @@ func rootCmd() *cobra.Command {
 	}
 
 	serve := serveCmd()
-	root.AddCommand(serve, exportCmd(), prepCmd())
+	root.AddCommand(serve, exportCmd(), reportCmd(), prepCmd(), importRosterCmd(), validateCmd(), diffCmd(), repairCmd(), archiveCmd())
 
 	// Make "serve" the default when no subcommand is given.
 	root.RunE = serve.RunE
@@ -65,20 +76,72 @@ func serveCmd() *cobra.Command {
 	f := cmd.Flags()
 	f.StringP("addr", "a", ":8080", "HTTP listen address")
 	f.String("db", "examiner.db", "SQLite database path")
-	f.StringSliceP("questions", "q", []string{"questions/physics_en.json"}, "Paths to questions JSON files (repeatable)")
+	f.StringSliceP("questions", "q", []string{"questions/physics_en.json"}, "Paths to questions JSON or CSV files (repeatable)")
 	f.String("llm-url", "http://localhost:11434/v1", "OpenAI-compatible API base URL")
 	f.String("llm-key", "ollama", "API key for LLM")
-	f.String("llm-model", "llama3.2", "LLM model name")
-	f.StringP("lang", "l", "en", "UI language (en, ru)")
+	f.String("llm-model", "llama3.2", "LLM model name, or a per-difficulty mapping such as easy=llama3.2,hard=qwen2.5:14b")
+	f.Int("llm-max-retries", llm.DefaultMaxRetries, "Retries for LLM calls that fail with a network error or 5xx status (0 = no retries)")
+	f.Duration("llm-retry-delay", llm.DefaultRetryDelay, "Wait before the first LLM retry; doubles on each further attempt")
+	f.Float64("llm-eval-temp", llm.DefaultEvalTemperature, "Sampling temperature for answer evaluation (0.0-2.0)")
+	f.Float64("llm-grade-temp", llm.DefaultGradeTemperature, "Sampling temperature for final grading (0.0-2.0)")
+	f.String("prompts-dir", "", "Directory of prompt templates (eval_<variant>.txt, grade_<variant>.txt) overriding the built-in ones")
+	f.String("llm-record", "", "Append every LLM request and response to this file")
+	f.String("llm-replay", "", "Serve LLM responses from a file written by --llm-record instead of calling the backend")
+	f.Duration("llm-timeout", 60*time.Second, "Deadline for each LLM evaluation or grading call (0 = none)")
+	f.Duration("llm-ping-ttl", llm.DefaultPingCacheTTL, "How long an LLM health check result is reused before the backend is asked again (0 = always ask)")
+	f.Bool("llm-warmup", false, "Send a throwaway completion at startup to load the model into memory")
+	f.StringP("lang", "l", "en", "UI and LLM prompt language (en, ru)")
+	f.String("lang-fallback", appI18n.FallbackEnglish, "When --lang has no translations: en (warn and use English) or error")
 	f.IntP("num-questions", "n", 0, "Number of questions per exam (0 = all available)")
 	f.StringP("difficulty", "d", "", "Filter questions by difficulty (easy, medium, hard)")
 	f.StringP("topic", "t", "", "Filter questions by topic")
+	f.String("tag", "", "Filter questions by tag")
+	f.String("insufficient-questions", model.InsufficientClamp, "When a topic has fewer than --num-questions: error, clamp, or pad-other-topics")
+	f.Bool("strict-topics", false, "Reject question imports with empty or inconsistently spelled topics instead of warning")
+	f.Int("import-log-limit", defaultImportLogLimit, "Log up to this many topic problems per questions file, then one line counting the rest")
+	f.String("student-identifier", model.StudentIdentifierDisplayName, "How teacher pages identify students: display_name, external_id, or username")
+	f.Float64("low-confidence-threshold", 0.5, "Flag sessions on the review list whose LLM grades have a confidence below this (0-1, 0 disables)")
 	f.Int("max-followups", 3, "Maximum follow-up questions per answer")
+	f.Bool("no-followups", false, "Single-answer mode: skip per-answer LLM evaluation and complete each question after one answer")
+	f.Bool("stream-feedback", false, "Stream LLM feedback to the exam page as it is generated")
+	f.Int("answer-rate-limit", 0, "Answer submissions allowed per student and minute before 429 Too Many Requests (0 = unlimited)")
+	f.Int("min-answer-chars", 0, "Reject answers shorter than this many characters after trimming whitespace (0 = off)")
+	f.Float64("max-question-similarity", 0, "Reject answers more similar to the question text than this, from 0 to 1, e.g. 0.8 (0 = off)")
+	f.Int("max-clarifications", 0, "Clarification requests a student may send per question before answering; they are not graded (0 = off)")
+	f.Duration("answer-edit-window", 0, "How long a submitted answer can still be changed before it is evaluated (0 = evaluate at once)")
 	f.Int("time-limit", 0, "Exam time limit in minutes (0 = no limit)")
+	f.Duration("max-exam-duration", 0, "Hard ceiling on any exam regardless of blueprint, e.g. 90m; overdue exams are auto-submitted (0 = none)")
 	f.Bool("shuffle", true, "Randomize question order")
+	f.Bool("avoid-repeats", false, "On a retake, draw questions the student has not seen before; repeat only when the bank runs out")
+	f.Bool("exam-closed", false, "Start with the exam closed: students can see results but not start exams or answer until an admin opens it")
+	f.StringSlice("required-topics", nil, "Topics every exam must include at least one question on (comma-separated or repeated)")
+	f.Int("topic-variety", 0, "Prefer questions on topics the student did not practice in their last N sessions (0 = off)")
+	f.String("report-font", "", "TrueType font for PDF transcripts (default: first of the common DejaVu/Liberation/Arial paths)")
+	f.Bool("submission-receipts", false, "Show students a receipt code on submit that GET /verify/{code} confirms")
+	f.Bool("staff-dashboard", true, "Show teachers and admins a dashboard of pending reviews and recent submissions on the home page")
+	f.Bool("confirm-start", false, "Show a preview with the locked question set before starting an exam")
+	f.Int("grade-retries", 1, "Extra grading attempts on submit for questions whose grading call failed")
 	f.String("base-path", "", "URL prefix for sub-path deployments (e.g. /ru)")
 	f.Bool("secure-cookies", true, "Set Secure flag on session cookies")
+	f.Duration("session-ttl", store.DefaultAuthSessionTTL, "How long a login stays valid (e.g. 4h for an in-class exam)")
+	f.Duration("session-cleanup-interval", time.Hour, "How often expired login sessions are deleted (0 disables)")
+	f.Bool("metrics", false, "Serve Prometheus metrics (exams, LLM latency and tokens) on /metrics")
+	f.Duration("shutdown-timeout", 2*time.Minute, "On SIGINT/SIGTERM, how long in-flight requests such as exam grading may run before connections are closed")
+	f.String("csp", handler.DefaultContentSecurityPolicy, "Content-Security-Policy header (empty = disabled); frame-ancestors is set by --frame-ancestors")
+	f.String("frame-ancestors", handler.DefaultFrameAncestors, "CSP frame-ancestors sources; add LMS origins to allow embedding")
 	f.String("prompt-variant", string(prompts.PromptStandard), "Grading prompt variant (strict, standard, lenient)")
+	f.Bool("cite-rubric", false, "Instruct the LLM to tie feedback to specific rubric criteria")
+	f.Bool("match-answer-language", false, "Detect the language of each answer and instruct the LLM to give feedback in it")
+	f.Bool("normalize-answers", false, "Normalize Unicode, interior whitespace and quotes in answers sent to the LLM (stored answers stay raw)")
+	f.Float64("score-out-of-range-factor", llm.DefaultOutOfRangeFactor, "Retry grading when the LLM score exceeds this multiple of max points (0 = only clamp)")
+	f.String("difficulty-mix", "", "Questions per difficulty in each exam, e.g. easy=2,medium=3,hard=1 (replaces --difficulty and --num-questions)")
+	f.String("grade-scale", "", "Map percentage grades to your grading scale on the results page, e.g. 90:A,80:B,70:C,60:D,0:F or 85:5,70:4,50:3,0:2")
+	f.String("difficulty-weights", "", "Scale each difficulty's share of the overall grade, e.g. easy=1,medium=1.5,hard=2 (unlisted difficulties count 1)")
+	f.Float64("pass-threshold", 0, "Grade percentage required to pass; shows a pass/fail message on results (0 = disabled)")
+	f.String("pass-message", "", "Custom message shown to passing students (default: localized text)")
+	f.String("fail-message", "", "Custom message shown to failing students (default: localized text)")
+	f.String("pass-link", "", "Optional next-steps link shown to passing students")
+	f.String("fail-link", "", "Optional next-steps link shown to failing students")
 	f.String("admin-password", "", "Initial admin password (or set EXAMINER_ADMIN_PASSWORD)")
 	f.String("log-level", "info", "Log level (debug, info, warn, error)")
 	f.String("log-format", "text", "Log format (text, json)")
@@ -88,7 +151,7 @@ func serveCmd() *cobra.Command {
 func exportCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "export",
-		Short: "Export exam results as JSON",
+		Short: "Export exam results as JSON, a grade CSV, an LMS gradebook CSV or a session transcript",
 		RunE:  runExport,
 	}
 	f := cmd.Flags()
@@ -98,6 +161,33 @@ func exportCmd() *cobra.Command {
 	f.String("date", "", "Exam date in YYYY-MM-DD format (read from DB if omitted)")
 	f.String("prompt-variant", "", "Prompt variant (read from DB if omitted)")
 	f.StringP("output", "o", "-", "Output file path (- for stdout)")
+	f.String("format", "json", "Output format: json (full results), csv (one grade row per session), lms (gradebook CSV) or transcript (printable HTML of --session-id)")
+	f.Int64("session-id", 0, "Session to export with --format transcript")
+	f.StringP("lang", "l", "en", "Language of --format transcript")
+	f.String("lms", model.LMSCanvas, "LMS column layout for --format lms: canvas or moodle")
+	f.String("cohort", "", "Only export sessions of this cohort (class section)")
+	f.String("conversation-format", model.ConversationFlat, "Conversation layout: flat (chronological) or grouped (by follow-up round)")
+	f.String("student-identifier", model.StudentIdentifierDisplayName, "Student field used as each result's label: display_name, external_id, or username")
+	f.Bool("include-tokens", false, "Include LLM token counts per question and per message in the JSON export")
+	f.String("grade-scale", "", "Add each result's grade on this scale as scaled_grade in the JSON export, e.g. 90:A,80:B,70:C,60:D,0:F")
+	f.String("log-level", "info", "Log level (debug, info, warn, error)")
+	f.String("log-format", "text", "Log format (text, json)")
+
+	return cmd
+}
+
+func reportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Write a printable PDF report for one exam session",
+		RunE:  runReport,
+	}
+	f := cmd.Flags()
+	f.String("db", "examiner.db", "SQLite database path")
+	f.Int64("session-id", 0, "Exam session ID (required)")
+	f.StringP("out", "o", "report.pdf", "Output PDF path")
+	f.String("font", "", "TrueType font with the needed scripts (default: first of the common DejaVu/Liberation/Arial paths)")
+	f.StringP("lang", "l", "en", "Language of the report labels")
 	f.String("log-level", "info", "Log level (debug, info, warn, error)")
 	f.String("log-format", "text", "Log format (text, json)")
 
@@ -121,6 +211,90 @@ func prepCmd() *cobra.Command {
 	return cmd
 }
 
+func importRosterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import-roster",
+		Short: "Add students from a roster CSV to an existing exam database",
+		RunE:  runImportRoster,
+	}
+	f := cmd.Flags()
+	f.String("db", "examiner.db", "SQLite database path")
+	f.String("roster", "", "Path to roster CSV (required)")
+	f.String("creds", "", "Credentials CSV to append to (default: <db name>-creds.csv next to --db)")
+	f.String("password-prefix", "", "Prefix for generated passwords (default: first 4 letters of the exam subject)")
+	f.String("log-level", "info", "Log level (debug, info, warn, error)")
+	f.String("log-format", "text", "Log format (text, json)")
+
+	_ = cmd.MarkFlagRequired("roster")
+
+	return cmd
+}
+
+func validateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "validate",
+		Short:        "Check questions JSON or CSV files without importing them",
+		RunE:         runValidate,
+		SilenceUsage: true,
+	}
+	f := cmd.Flags()
+	f.StringSliceP("questions", "q", nil, "Paths to questions JSON or CSV files (repeatable)")
+	f.Bool("strict-topics", false, "Treat empty or inconsistently spelled topics as errors instead of warnings")
+	f.String("log-level", "info", "Log level (debug, info, warn, error)")
+	f.String("log-format", "text", "Log format (text, json)")
+
+	return cmd
+}
+
+func diffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <before.json> <after.json>",
+		Short: "Compare per-question LLM scores of two JSON exports",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runDiff,
+	}
+	f := cmd.Flags()
+	f.String("log-level", "info", "Log level (debug, info, warn, error)")
+	f.String("log-format", "text", "Log format (text, json)")
+
+	return cmd
+}
+
+func repairCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Find and delete orphaned threads, messages, scores and grades",
+		RunE:  runRepair,
+	}
+	f := cmd.Flags()
+	f.String("db", "examiner.db", "SQLite database path")
+	f.Bool("dry-run", false, "Only list the orphans; do not delete them")
+	f.String("log-level", "info", "Log level (debug, info, warn, error)")
+	f.String("log-format", "text", "Log format (text, json)")
+
+	return cmd
+}
+
+func archiveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "archive",
+		Short: "Copy a finished exam's questions, users and sessions into a new database",
+		RunE:  runArchive,
+	}
+	f := cmd.Flags()
+	f.String("db", "examiner.db", "SQLite database path")
+	f.String("out", "", "Path of the archive database to create (required)")
+	f.String("exam-id", "", "Exam identifier; must match the database's exam_id (required)")
+	f.Bool("prune", false, "Delete the archived sessions from --db after copying")
+	f.String("log-level", "info", "Log level (debug, info, warn, error)")
+	f.String("log-format", "text", "Log format (text, json)")
+
+	_ = cmd.MarkFlagRequired("out")
+	_ = cmd.MarkFlagRequired("exam-id")
+
+	return cmd
+}
+
 func setupLogging(cmd *cobra.Command) {
 	v := viperForCmd(cmd)
 
@@ -171,6 +345,15 @@ func viperForCmd(cmd *cobra.Command) *viper.Viper {
 	return v
 }
 
+// observer returns m as an llm.CallObserver, or nil when metrics are off, so
+// the LLM client does not hold a typed nil.
+func observer(m *metrics.Metrics) llm.CallObserver {
+	if m == nil {
+		return nil
+	}
+	return m
+}
+
 func runServe(cmd *cobra.Command, _ []string) error {
 	setupLogging(cmd)
 	v := viperForCmd(cmd)
@@ -181,6 +364,12 @@ func runServe(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("open database: %w", err)
 	}
 	defer db.Close()
+	db.SetAuthSessionTTL(v.GetDuration("session-ttl"))
+	if v.GetBool("exam-closed") {
+		if err := db.SetExamOpen(false); err != nil {
+			return fmt.Errorf("close exam: %w", err)
+		}
+	}
 
 	// Seed default admin user if no users exist.
 	if err := seedAdmin(db, v.GetString("admin-password")); err != nil {
@@ -188,7 +377,7 @@ func runServe(cmd *cobra.Command, _ []string) error {
 	}
 
 	// Load questions from all specified files.
-	if err := loadQuestions(db, v.GetStringSlice("questions"), v.GetInt("max-followups"), v.GetInt("time-limit")); err != nil {
+	if err := loadQuestions(db, v.GetStringSlice("questions"), v.GetInt("max-followups"), v.GetInt("time-limit"), v.GetBool("strict-topics"), v.GetInt("import-log-limit")); err != nil {
 		return fmt.Errorf("load questions: %w", err)
 	}
 
@@ -197,6 +386,10 @@ func runServe(cmd *cobra.Command, _ []string) error {
 	if err := appI18n.Init(lang); err != nil {
 		return fmt.Errorf("init i18n: %w", err)
 	}
+	lang, err = appI18n.Resolve(lang, v.GetString("lang-fallback"))
+	if err != nil {
+		return fmt.Errorf("init i18n: %w", err)
+	}
 
 	// Create LLM client.
 	promptVariant := strings.ToLower(strings.TrimSpace(v.GetString("prompt-variant")))
@@ -204,11 +397,31 @@ func runServe(cmd *cobra.Command, _ []string) error {
 		slog.Warn("invalid prompt-variant, using standard", "variant", promptVariant)
 		promptVariant = string(prompts.PromptStandard)
 	}
+	var appMetrics *metrics.Metrics
+	if v.GetBool("metrics") {
+		appMetrics = metrics.New()
+	}
 	llmClient, err := llm.New(
 		v.GetString("llm-url"),
 		v.GetString("llm-key"),
 		v.GetString("llm-model"),
 		promptVariant,
+		llm.Options{
+			OutOfRangeFactor: v.GetFloat64("score-out-of-range-factor"),
+			CiteRubric:       v.GetBool("cite-rubric"),
+			MatchLanguage:    v.GetBool("match-answer-language"),
+			NormalizeAnswers: v.GetBool("normalize-answers"),
+			MaxRetries:       v.GetInt("llm-max-retries"),
+			RetryDelay:       v.GetDuration("llm-retry-delay"),
+			EvalTemperature:  float32(v.GetFloat64("llm-eval-temp")),
+			GradeTemperature: float32(v.GetFloat64("llm-grade-temp")),
+			PromptsDir:       v.GetString("prompts-dir"),
+			PromptLanguage:   lang,
+			RecordFile:       v.GetString("llm-record"),
+			ReplayFile:       v.GetString("llm-replay"),
+			PingCacheTTL:     v.GetDuration("llm-ping-ttl"),
+			Observer:         observer(appMetrics),
+		},
 	)
 	if err != nil {
 		return fmt.Errorf("create LLM client: %w", err)
@@ -217,6 +430,14 @@ func runServe(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("LLM health check: %w", err)
 	}
 	slog.Info("LLM endpoint OK", "url", v.GetString("llm-url"), "model", v.GetString("llm-model"))
+	if v.GetBool("llm-warmup") {
+		latency, err := llmClient.Warmup(context.Background())
+		if err != nil {
+			slog.Warn("LLM warmup failed, continuing", "error", err, "latency", latency)
+		} else {
+			slog.Info("LLM warmup complete", "model", v.GetString("llm-model"), "latency", latency)
+		}
+	}
 
 	// Normalize base path.
 	basePath := strings.TrimRight(v.GetString("base-path"), "/")
@@ -224,25 +445,148 @@ func runServe(cmd *cobra.Command, _ []string) error {
 		basePath = "/" + basePath
 	}
 
+	insufficient := strings.ToLower(strings.TrimSpace(v.GetString("insufficient-questions")))
+	if !model.IsValidInsufficientPolicy(insufficient) {
+		slog.Warn("invalid insufficient-questions policy, using clamp", "policy", insufficient)
+		insufficient = model.InsufficientClamp
+	}
+
+	studentIdentifier := strings.ToLower(strings.TrimSpace(v.GetString("student-identifier")))
+	if !model.IsValidStudentIdentifier(studentIdentifier) {
+		slog.Warn("invalid student-identifier, using display_name", "identifier", studentIdentifier)
+		studentIdentifier = model.StudentIdentifierDisplayName
+	}
+
+	difficultyWeights, err := model.ParseDifficultyWeights(v.GetString("difficulty-weights"))
+	if err != nil {
+		return fmt.Errorf("invalid difficulty-weights: %w", err)
+	}
+
+	var requiredTopics []string
+	for _, topic := range v.GetStringSlice("required-topics") {
+		if topic = strings.TrimSpace(topic); topic != "" && !slices.Contains(requiredTopics, topic) {
+			requiredTopics = append(requiredTopics, topic)
+		}
+	}
+
+	gradeScale, err := model.ParseGradeScale(v.GetString("grade-scale"))
+	if err != nil {
+		return fmt.Errorf("invalid grade-scale: %w", err)
+	}
+
+	difficultyMix, err := model.ParseDifficultyMix(v.GetString("difficulty-mix"))
+	if err != nil {
+		return fmt.Errorf("invalid difficulty-mix: %w", err)
+	}
+	if len(difficultyMix) > 0 && v.GetString("difficulty") != "" {
+		return fmt.Errorf("--difficulty-mix and --difficulty cannot be combined")
+	}
+	if len(difficultyMix) > 0 && len(requiredTopics) > 0 {
+		return fmt.Errorf("--difficulty-mix and --required-topics cannot be combined")
+	}
+	maxSimilarity := v.GetFloat64("max-question-similarity")
+	if maxSimilarity < 0 || maxSimilarity > 1 {
+		return fmt.Errorf("--max-question-similarity must be between 0 and 1, got %g", maxSimilarity)
+	}
+
 	examCfg := model.ExamConfig{
 		NumQuestions:  v.GetInt("num-questions"),
 		Difficulty:    v.GetString("difficulty"),
 		Topic:         v.GetString("topic"),
+		Tag:           strings.ToLower(strings.TrimSpace(v.GetString("tag"))),
 		MaxFollowups:  v.GetInt("max-followups"),
+		NoFollowups:   v.GetBool("no-followups"),
 		Shuffle:       v.GetBool("shuffle"),
+		ConfirmStart:  v.GetBool("confirm-start"),
+		GradeRetries:  v.GetInt("grade-retries"),
 		BasePath:      basePath,
 		SecureCookies: v.GetBool("secure-cookies"),
 		PromptVariant: promptVariant,
+
+		MaxExamDuration: v.GetDuration("max-exam-duration"),
+		LLMTimeout:      v.GetDuration("llm-timeout"),
+
+		StreamFeedback:   v.GetBool("stream-feedback"),
+		AnswerEditWindow: v.GetDuration("answer-edit-window"),
+		AnswerRateLimit:  v.GetInt("answer-rate-limit"),
+		MinAnswerChars:   v.GetInt("min-answer-chars"),
+
+		MaxQuestionSimilarity: maxSimilarity,
+		MaxClarifications:     v.GetInt("max-clarifications"),
+
+		ContentSecurityPolicy: v.GetString("csp"),
+		FrameAncestors:        v.GetString("frame-ancestors"),
+
+		InsufficientQuestions: insufficient,
+
+		AvoidRepeats: v.GetBool("avoid-repeats"),
+
+		TopicVariety: v.GetInt("topic-variety"),
+
+		RequiredTopics: requiredTopics,
+
+		DifficultyMix: difficultyMix,
+
+		StrictTopics: v.GetBool("strict-topics"),
+
+		StudentIdentifier: studentIdentifier,
+
+		StaffDashboard: v.GetBool("staff-dashboard"),
+
+		ReportFont: v.GetString("report-font"),
+
+		SubmissionReceipts: v.GetBool("submission-receipts"),
+
+		LowConfidenceThreshold: v.GetFloat64("low-confidence-threshold"),
+
+		DifficultyWeights: difficultyWeights,
+
+		GradeScale: gradeScale,
+
+		PassThreshold: v.GetFloat64("pass-threshold"),
+		PassMessage:   v.GetString("pass-message"),
+		FailMessage:   v.GetString("fail-message"),
+		PassLink:      v.GetString("pass-link"),
+		FailLink:      v.GetString("fail-link"),
 	}
 
 	h, err := handler.New(db, llmClient, examCfg)
 	if err != nil {
 		return fmt.Errorf("create handler: %w", err)
 	}
+	if appMetrics != nil {
+		h.SetMetrics(appMetrics)
+	}
+
+	// Background jobs stop when the server is interrupted. Deferred in this
+	// order, stop runs first, then the jobs are waited on, and only then is
+	// the database closed.
+	var jobs sync.WaitGroup
+	defer jobs.Wait()
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Finish grading exams that were being graded when the server last
+	// stopped. The list is taken before serving, so exams submitted from now
+	// on are graded once, by their own request.
+	ungraded, err := h.UngradedSessions()
+	if err != nil {
+		return fmt.Errorf("list sessions stuck in grading: %w", err)
+	}
+	jobs.Go(func() { h.RecoverGradingSessions(ctx, ungraded) })
+
+	// Submit exams whose time ran out while the student was away.
+	jobs.Go(func() { h.RunOverdueSweep(ctx, time.Minute) })
+
+	// Keep auth_sessions from growing with logins that have expired.
+	if interval := v.GetDuration("session-cleanup-interval"); interval > 0 {
+		jobs.Go(func() { db.RunSessionCleanup(ctx, interval) })
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(h.SecurityHeaders)
 	r.Use(appI18n.Middleware(lang))
 
 	if basePath != "" {
@@ -267,11 +611,34 @@ func runServe(cmd *cobra.Command, _ []string) error {
 		"num_questions", examCfg.NumQuestions,
 		"difficulty", examCfg.Difficulty,
 		"topic", examCfg.Topic,
+		"tag", examCfg.Tag,
 		"max_followups", examCfg.MaxFollowups,
+		"no_followups", examCfg.NoFollowups,
 		"shuffle", examCfg.Shuffle,
 		"base_path", basePath,
 	)
-	return http.ListenAndServe(addr, r)
+	srv := &http.Server{Addr: addr, Handler: r}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		grace := v.GetDuration("shutdown-timeout")
+		slog.Info("shutting down server, draining in-flight requests", "timeout", grace)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			// Requests still running (e.g. a long grading loop) are cut off;
+			// their sessions may be left in grading status.
+			slog.Error("shutdown timed out, closing remaining connections", "error", err)
+			_ = srv.Close()
+		}
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	// Let in-flight requests finish before the deferred db.Close runs.
+	<-shutdownDone
+	return nil
 }
 
 func runExport(cmd *cobra.Command, _ []string) error {
@@ -284,6 +651,11 @@ func runExport(cmd *cobra.Command, _ []string) error {
 	}
 	defer db.Close()
 
+	// A transcript covers one session and needs no exam metadata.
+	if v.GetString("format") == "transcript" {
+		return writeTranscript(cmd.Context(), db, v)
+	}
+
 	// Read metadata from DB as defaults; CLI flags override.
 	info, err := db.GetExamInfo()
 	if err != nil {
@@ -321,10 +693,48 @@ func runExport(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("date is required (set via --date flag or store metadata)")
 	}
 
-	results, err := db.ExportAllSessions()
+	w, closeOutput, err := createOutput(v.GetString("output"))
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	gradeScale, err := model.ParseGradeScale(v.GetString("grade-scale"))
+	if err != nil {
+		return fmt.Errorf("invalid grade-scale: %w", err)
+	}
+
+	format := v.GetString("format")
+	switch format {
+	case "json", "csv":
+	case "lms":
+		return writeLMSGrades(db, w, v.GetString("lms"), examID, v.GetString("cohort"))
+	default:
+		return fmt.Errorf("unknown export format %q (want json, csv, lms or transcript)", format)
+	}
+
+	identifier := v.GetString("student-identifier")
+	if !model.IsValidStudentIdentifier(identifier) {
+		return fmt.Errorf("unknown student identifier %q (want display_name, external_id or username)", identifier)
+	}
+	results, err := db.ExportAllSessions(v.GetString("cohort"), identifier)
 	if err != nil {
 		return fmt.Errorf("export sessions: %w", err)
 	}
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(model.GradeCSVRows(results)); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+		return nil
+	}
+	if !v.GetBool("include-tokens") {
+		model.OmitTokenCounts(results)
+	}
+	model.ApplyGradeScale(results, gradeScale)
+	if err := model.ApplyConversationFormat(results, v.GetString("conversation-format")); err != nil {
+		return err
+	}
 
 	// Use DB metadata for num_questions; fall back to first result.
 	numQuestions := info.NumQuestions
@@ -346,19 +756,6 @@ func runExport(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("marshal JSON: %w", err)
 	}
 
-	outPath := v.GetString("output")
-	var w io.Writer
-	if outPath == "" || outPath == "-" {
-		w = os.Stdout
-	} else {
-		f, err := os.Create(outPath)
-		if err != nil {
-			return fmt.Errorf("create output file: %w", err)
-		}
-		defer f.Close()
-		w = f
-	}
-
 	_, err = w.Write(data)
 	if err != nil {
 		return fmt.Errorf("write output: %w", err)
@@ -369,7 +766,81 @@ func runExport(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
-func loadQuestions(db *store.Store, paths []string, maxFollowups int, timeLimit int) error {
+// createOutput opens the export destination: path, or stdout for "" and "-".
+func createOutput(path string) (io.Writer, func(), error) {
+	if path == "" || path == "-" {
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create output file: %w", err)
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// writeTranscript writes the printable HTML transcript of --session-id, the
+// same page teachers open at /review/{id}/transcript.
+func writeTranscript(ctx context.Context, db *store.Store, v *viper.Viper) error {
+	sessionID := v.GetInt64("session-id")
+	if sessionID <= 0 {
+		return fmt.Errorf("--session-id is required with --format transcript")
+	}
+	identifier := v.GetString("student-identifier")
+	if !model.IsValidStudentIdentifier(identifier) {
+		return fmt.Errorf("unknown student identifier %q (want display_name, external_id or username)", identifier)
+	}
+	lang := v.GetString("lang")
+	if err := appI18n.Init(lang); err != nil {
+		return fmt.Errorf("init i18n: %w", err)
+	}
+
+	view, err := db.GetSessionView(sessionID)
+	if err != nil {
+		return fmt.Errorf("load session %d: %w", sessionID, err)
+	}
+	var student model.User
+	if u, err := db.GetUserByID(view.Session.StudentID); err != nil {
+		return fmt.Errorf("load student: %w", err)
+	} else if u != nil {
+		student = *u
+	}
+
+	w, closeOutput, err := createOutput(v.GetString("output"))
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+	if err := views.TranscriptPage(*view, student, identifier).Render(appI18n.WithLanguage(ctx, lang), w); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	return nil
+}
+
+// writeLMSGrades writes the latest grade per student as a gradebook CSV for
+// the given LMS, using the exam ID as the assignment column name.
+func writeLMSGrades(db *store.Store, w io.Writer, lms, examID, cohort string) error {
+	records, err := db.ListGradeRecords(examID, cohort)
+	if err != nil {
+		return fmt.Errorf("list grades: %w", err)
+	}
+	rows, err := model.LMSGradeRows(records, lms, examID)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("write CSV: %w", err)
+	}
+	return nil
+}
+
+// defaultImportLogLimit is the default --import-log-limit.
+const defaultImportLogLimit = 100
+
+// loadQuestions imports each questions file not imported before, in one
+// transaction per file. The first logLimit topic problems of a file are
+// logged one by one, followed by a single line counting the rest.
+func loadQuestions(db *store.Store, paths []string, maxFollowups int, timeLimit int, strictTopics bool, logLimit int) error {
 	count, err := db.QuestionCount()
 	if err != nil {
 		return err
@@ -408,30 +879,52 @@ func loadQuestions(db *store.Store, paths []string, maxFollowups int, timeLimit
 			continue
 		}
 
-		var questions []model.QuestionImport
-		if err := json.Unmarshal(data, &questions); err != nil {
+		questions, err := model.ParseQuestions(path, data)
+		if err != nil {
 			return fmt.Errorf("parse %s: %w", path, err)
 		}
 
+		bank, err := db.ListDistinctTopics()
+		if err != nil {
+			return fmt.Errorf("list topics: %w", err)
+		}
+		problems := model.CheckTopics(questions, bank, strictTopics)
+		for i, p := range problems {
+			if i == logLimit {
+				slog.Warn("more question topic problems not logged", "path", path, "more", len(problems)-logLimit)
+				break
+			}
+			slog.Warn("question topic problem", "path", path, "problem", p.String())
+		}
+		if model.InvalidQuestionCount(problems) > 0 {
+			return fmt.Errorf("%s: %d questions have topic problems (--strict-topics)", path, model.InvalidQuestionCount(problems))
+		}
+
+		batch := make([]model.Question, 0, len(questions))
 		for _, qi := range questions {
-			_, err := db.InsertQuestion(model.Question{
-				CourseID:    1,
-				Text:        qi.Text,
-				Difficulty:  qi.Difficulty,
-				Topic:       qi.Topic,
-				Rubric:      qi.Rubric,
-				ModelAnswer: qi.ModelAnswer,
-				MaxPoints:   qi.MaxPoints,
+			batch = append(batch, model.Question{
+				CourseID:     1,
+				Text:         qi.Text,
+				Difficulty:   qi.Difficulty,
+				Topic:        qi.Topic,
+				Rubric:       qi.Rubric,
+				ModelAnswer:  qi.ModelAnswer,
+				MaxPoints:    qi.MaxPoints,
+				Weight:       qi.Weight,
+				GradeModel:   qi.GradeModel,
+				Tags:         qi.Tags,
+				MaxFollowups: qi.MaxFollowups,
 			})
-			if err != nil {
-				return fmt.Errorf("insert question from %s: %w", path, err)
-			}
+		}
+		inserted, err := db.InsertQuestions(batch)
+		if err != nil {
+			return fmt.Errorf("insert questions from %s: %w", path, err)
 		}
 
 		if err := db.SetImportedFileHash(path, hash); err != nil {
 			return fmt.Errorf("record import for %s: %w", path, err)
 		}
-		slog.Info("imported questions", "path", path, "count", len(questions))
+		slog.Info("imported questions", "path", path, "count", len(questions), "new", inserted)
 	}
 
 	// Always update blueprint settings to match current CLI flags.
@@ -452,6 +945,209 @@ func sha256sum(data []byte) string {
 	return hex.EncodeToString(h[:])
 }
 
+func runReport(cmd *cobra.Command, _ []string) error {
+	setupLogging(cmd)
+	v := viperForCmd(cmd)
+
+	sessionID := v.GetInt64("session-id")
+	if sessionID <= 0 {
+		return fmt.Errorf("--session-id is required")
+	}
+
+	font, err := report.LoadFont(v.GetString("font"))
+	if err != nil {
+		return fmt.Errorf("%w (see --font)", err)
+	}
+	lang := v.GetString("lang")
+	if err := appI18n.Init(lang); err != nil {
+		return fmt.Errorf("init i18n: %w", err)
+	}
+
+	db, err := store.New(v.GetString("db"))
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	view, err := db.GetSessionView(sessionID)
+	if err != nil {
+		return fmt.Errorf("load session %d: %w", sessionID, err)
+	}
+	student, err := db.GetUserByID(view.Session.StudentID)
+	if err != nil {
+		return fmt.Errorf("load student: %w", err)
+	}
+
+	outPath := v.GetString("out")
+	f, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("create output file: %w", err)
+	}
+	if err := report.WriteSessionPDF(appI18n.WithLanguage(cmd.Context(), lang), f, font, view, student); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write report: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close output file: %w", err)
+	}
+
+	slog.Info("report written", "session_id", sessionID, "path", outPath)
+	return nil
+}
+
+func runValidate(cmd *cobra.Command, _ []string) error {
+	setupLogging(cmd)
+	v := viperForCmd(cmd)
+
+	paths := v.GetStringSlice("questions")
+	if len(paths) == 0 {
+		return fmt.Errorf("--questions is required")
+	}
+
+	out := cmd.OutOrStdout()
+	var failed []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		questions, err := model.ParseQuestions(path, data)
+		if err != nil {
+			fmt.Fprintf(out, "%s: parse error: %v\n", path, err)
+			failed = append(failed, path)
+			continue
+		}
+
+		problems := model.ValidateQuestions(questions)
+		problems = append(problems, model.CheckTopics(questions, nil, v.GetBool("strict-topics"))...)
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Index < problems[j].Index })
+		for _, p := range problems {
+			fmt.Fprintf(out, "%s: %s\n", path, p)
+		}
+		invalid := model.InvalidQuestionCount(problems)
+		fmt.Fprintf(out, "%s: %d of %d questions passed\n", path, len(questions)-invalid, len(questions))
+		if invalid > 0 {
+			failed = append(failed, path)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("invalid questions in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	setupLogging(cmd)
+
+	var exports [2]model.ExamExport
+	for i, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		if err := json.Unmarshal(data, &exports[i]); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	deltas, matched := model.DiffExports(exports[0], exports[1])
+
+	score := func(s *float64) string {
+		if s == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f", *s)
+	}
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "EXTERNAL ID\tSESSION\tBEFORE\tAFTER\tDELTA\tQUESTION")
+	for _, d := range deltas {
+		question := d.Question
+		if r := []rune(question); len(r) > 60 {
+			question = string(r[:57]) + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%+.1f\t%s\n",
+			d.ExternalID, d.SessionNumber, score(d.Before), score(d.After), d.Delta(), question)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "\n%d questions in both exports, %d differences\n", matched, len(deltas))
+	return nil
+}
+
+func runRepair(cmd *cobra.Command, _ []string) error {
+	setupLogging(cmd)
+	v := viperForCmd(cmd)
+
+	db, err := store.New(v.GetString("db"))
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	counts, err := db.FindOrphans()
+	if err != nil {
+		return fmt.Errorf("find orphans: %w", err)
+	}
+	out := cmd.OutOrStdout()
+	printOrphans := func(c model.OrphanCounts) error {
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tORPHANS")
+		fmt.Fprintf(tw, "threads\t%d\n", c.Threads)
+		fmt.Fprintf(tw, "messages\t%d\n", c.Messages)
+		fmt.Fprintf(tw, "scores\t%d\n", c.Scores)
+		fmt.Fprintf(tw, "reviews\t%d\n", c.Reviews)
+		fmt.Fprintf(tw, "grades\t%d\n", c.Grades)
+		return tw.Flush()
+	}
+	if err := printOrphans(counts); err != nil {
+		return err
+	}
+
+	switch {
+	case counts.Total() == 0:
+		fmt.Fprintln(out, "\nNo orphaned records found.")
+	case v.GetBool("dry-run"):
+		fmt.Fprintf(out, "\nDry run: %d orphaned records left in place.\n", counts.Total())
+	default:
+		deleted, err := db.DeleteOrphans()
+		if err != nil {
+			return fmt.Errorf("delete orphans: %w", err)
+		}
+		fmt.Fprintf(out, "\nDeleted %d orphaned records.\n", deleted.Total())
+	}
+	return nil
+}
+
+func runArchive(cmd *cobra.Command, _ []string) error {
+	setupLogging(cmd)
+	v := viperForCmd(cmd)
+
+	db, err := store.New(v.GetString("db"))
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	out := v.GetString("out")
+	counts, err := db.ArchiveExam(v.GetString("exam-id"), out)
+	if err != nil {
+		return fmt.Errorf("archive exam: %w", err)
+	}
+	w := cmd.OutOrStdout()
+	fmt.Fprintf(w, "Archived %d sessions, %d questions and %d users to %s.\n", counts.Sessions, counts.Questions, counts.Users, out)
+
+	if v.GetBool("prune") {
+		n, err := db.PruneSessions()
+		if err != nil {
+			return fmt.Errorf("prune sessions: %w", err)
+		}
+		fmt.Fprintf(w, "Deleted %d sessions from %s.\n", n, v.GetString("db"))
+	}
+	return nil
+}
+
 func runPrep(cmd *cobra.Command, _ []string) error {
 	setupLogging(cmd)
 	v := viperForCmd(cmd)
@@ -555,7 +1251,7 @@ func runPrep(cmd *cobra.Command, _ []string) error {
 	if maxFollowups == 0 {
 		maxFollowups = 3
 	}
-	if err := loadQuestions(db, []string{questionsPath}, maxFollowups, manifest.TimeLimit); err != nil {
+	if err := loadQuestions(db, []string{questionsPath}, maxFollowups, manifest.TimeLimit, false, defaultImportLogLimit); err != nil {
 		return fmt.Errorf("load questions: %w", err)
 	}
 
@@ -608,6 +1304,76 @@ func runPrep(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
+func runImportRoster(cmd *cobra.Command, _ []string) error {
+	setupLogging(cmd)
+	v := viperForCmd(cmd)
+
+	dbPath := v.GetString("db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	db, err := store.New(dbPath)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	existing, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("list users: %w", err)
+	}
+
+	prefix := v.GetString("password-prefix")
+	if prefix == "" {
+		info, err := db.GetExamInfo()
+		if err != nil {
+			return fmt.Errorf("read exam metadata: %w", err)
+		}
+		prefix = strings.ToLower(info.Subject)
+		if len(prefix) > 4 {
+			prefix = prefix[:4]
+		}
+	}
+
+	rosterFile, err := os.Open(v.GetString("roster"))
+	if err != nil {
+		return fmt.Errorf("open roster: %w", err)
+	}
+	defer rosterFile.Close()
+
+	var skipped int
+	creds, err := userutil.ImportCSV(rosterFile, db, userutil.ImportConfig{
+		Role:           model.UserRoleStudent,
+		PasswordPrefix: prefix,
+		Existing:       existing,
+		OnSkip: func(userID string) {
+			slog.Debug("student already exists, skipping", "user_id", userID)
+			skipped++
+		},
+	})
+	// Record the credentials of students created before any error, so a
+	// partial import does not leave accounts nobody can log in to.
+	credsPath := v.GetString("creds")
+	if credsPath == "" {
+		credsPath = strings.TrimSuffix(dbPath, filepath.Ext(dbPath)) + "-creds.csv"
+	}
+	if len(creds) > 0 {
+		if werr := userutil.AppendCredentialsCSV(credsPath, creds); werr != nil {
+			return fmt.Errorf("write credentials CSV: %w", werr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("import roster: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Added %d students, skipped %d already present.\n", len(creds), skipped)
+	if len(creds) > 0 {
+		fmt.Fprintf(out, "Credentials: %s\n", credsPath)
+	}
+	return nil
+}
+
 func seedAdmin(db *store.Store, password string) error {
 	count, err := db.UserCount()
 	if err != nil {
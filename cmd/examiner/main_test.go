@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/store"
+)
+
+// runExaminer runs the examiner command with args and returns its output.
+func runExaminer(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := rootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+// readCredentials returns the rows of a credentials CSV, header included.
+func readCredentials(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open credentials: %v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read credentials: %v", err)
+	}
+	return rows
+}
+
+func TestRunPrep(t *testing.T) {
+	questions, err := filepath.Abs("../../questions/physics_en.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "phys.yaml")
+	if err := os.WriteFile(manifest, []byte("exam_id: phys-test\n"+
+		"subject: Physics\n"+
+		"date: 2026-03-15\n"+
+		"questions: "+questions+"\n"+
+		"roster: roster.csv\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	roster := "\ufeffsection,Email,Display_Name,Student_ID\n" +
+		"A, anna@example.edu ,Anna Smirnova,S-001\n" +
+		"B,,Boris Orlov,S-002\n"
+	if err := os.WriteFile(filepath.Join(dir, "roster.csv"), []byte(roster), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := runExaminer(t, "prep", "--manifest", manifest, "--output-dir", dir, "--log-level", "error"); err != nil {
+		t.Fatalf("prep: %v\n%s", err, out)
+	}
+
+	rows := readCredentials(t, filepath.Join(dir, "phys-test-creds.csv"))
+	if len(rows) != 4 || rows[1][2] != "admin" || rows[2][0] != "S-001" || rows[3][0] != "S-002" {
+		t.Fatalf("credentials = %v, want a header, admin, S-001 and S-002", rows)
+	}
+
+	db, err := store.New(filepath.Join(dir, "phys-test.db"))
+	if err != nil {
+		t.Fatalf("open prepared database: %v", err)
+	}
+	defer db.Close()
+	info, err := db.GetExamInfo()
+	if err != nil || info.ExamID != "phys-test" || info.Subject != "Physics" {
+		t.Errorf("exam info = %+v (err %v), want phys-test/Physics", info, err)
+	}
+	if n, err := db.QuestionCount(); err != nil || n == 0 {
+		t.Errorf("QuestionCount = %d (err %v), want the loaded questions", n, err)
+	}
+	u, err := db.GetUserByUsername(rows[2][2])
+	if err != nil || u == nil {
+		t.Fatalf("GetUserByUsername(%q) = %v, %v", rows[2][2], u, err)
+	}
+	if u.ExternalID != "S-001" || u.DisplayName != "Anna Smirnova" || u.Email != "anna@example.edu" {
+		t.Errorf("student = %q/%q/%q, want S-001/Anna Smirnova/anna@example.edu", u.ExternalID, u.DisplayName, u.Email)
+	}
+}
+
+func TestRunImportRoster(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "phys.db")
+	db, err := store.New(dbPath)
+	if err != nil {
+		t.Fatalf("create database: %v", err)
+	}
+	if err := db.SetExamInfo(model.ExamInfo{ExamID: "phys", Subject: "Physics", Date: "2026-03-15"}); err != nil {
+		t.Fatalf("SetExamInfo: %v", err)
+	}
+	if _, err := db.CreateUser(model.User{Username: "asmirnov", ExternalID: "S-001", DisplayName: "Anna Smirnova", PasswordHash: "x", Role: model.UserRoleStudent, Active: true}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	db.Close()
+
+	writeRoster := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	credsPath := filepath.Join(dir, "phys-creds.csv")
+
+	roster := writeRoster("roster.csv", "student_id,display_name\nS-001,Anna Smirnova\nS-002,Boris Orlov\n")
+	out, err := runExaminer(t, "import-roster", "--db", dbPath, "--roster", roster, "--log-level", "error")
+	if err != nil {
+		t.Fatalf("import-roster: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Added 1 students, skipped 1 already present.") || !strings.Contains(out, credsPath) {
+		t.Errorf("output = %q, want the added/skipped counts and the credentials path", out)
+	}
+	rows := readCredentials(t, credsPath)
+	if len(rows) != 2 || rows[1][0] != "S-002" || !strings.HasPrefix(rows[1][3], "phys-") {
+		t.Fatalf("credentials = %v, want a header and S-002 with a phys- password", rows)
+	}
+
+	// S-004 appears twice: the second row fails on the unique external ID,
+	// and S-003 and the first S-004 must still be written out.
+	roster = writeRoster("partial.csv", "student_id,display_name\nS-003,Vera Pavlova\nS-004,Gleb Ivanov\nS-004,Gleb Ivanov\n")
+	if out, err := runExaminer(t, "import-roster", "--db", dbPath, "--roster", roster, "--log-level", "error"); err == nil {
+		t.Fatalf("import-roster should fail on the duplicate row\n%s", out)
+	}
+	rows = readCredentials(t, credsPath)
+	if len(rows) != 4 || rows[2][0] != "S-003" || rows[3][0] != "S-004" {
+		t.Errorf("credentials = %v, want S-003 and S-004 appended after a partial import", rows)
+	}
+}
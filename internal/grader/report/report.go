@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/pavelanni/examiner/internal/grader/store"
+	"github.com/pavelanni/examiner/internal/model"
 )
 
 // Generate produces a Markdown report for a student's graded session.
@@ -31,10 +32,7 @@ func Generate(data store.ReviewData) string {
 		if len(q.Messages) > 0 {
 			b.WriteString("### Conversation\n\n")
 			for _, m := range q.Messages {
-				role := "Student"
-				if m.Role == "assistant" {
-					role = "Examiner"
-				}
+				role := model.Role(m.Role).Label()
 				if !m.Timestamp.IsZero() {
 					fmt.Fprintf(&b, "**%s** (%s):\n",
 						role, m.Timestamp.Format("15:04"))
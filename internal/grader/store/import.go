@@ -92,8 +92,12 @@ func (s *Store) ImportExam(exp model.ExamExport) error {
 				return fmt.Errorf("question last insert id: %w", err)
 			}
 
-			// Insert conversation messages.
-			for _, msg := range qr.Conversation {
+			// Insert conversation messages (grouped exports are flattened first).
+			conversation := qr.Conversation
+			if len(conversation) == 0 {
+				conversation = model.FlattenConversation(qr.Rounds)
+			}
+			for _, msg := range conversation {
 				if _, err := tx.Exec(`INSERT INTO conversation_messages (question_id, role, content, timestamp)
 					VALUES (?, ?, ?, ?)`,
 					questionID, msg.Role, msg.Content, msg.At); err != nil {
@@ -2,31 +2,57 @@ package handler
 
 import (
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pavelanni/examiner/internal/handler/views"
+	appI18n "github.com/pavelanni/examiner/internal/i18n"
 	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/store"
+	"github.com/pavelanni/examiner/internal/userutil"
 )
 
+// resetPasswordPrefix starts passwords generated by an admin reset.
+const resetPasswordPrefix = "reset"
+
 // handleAdminUsersPage serves the admin users management page.
 func (h *Handler) handleAdminUsersPage(w http.ResponseWriter, r *http.Request) {
+	h.renderAdminUsers(w, r, "")
+}
+
+// renderAdminUsers renders the users page with an optional flash message.
+func (h *Handler) renderAdminUsers(w http.ResponseWriter, r *http.Request, flash string) {
 	users, err := h.store.ListUsers()
 	if err != nil {
 		slog.Error("failed to list users", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	ungraded, err := h.store.SessionsMissingGrades()
+	if err != nil {
+		slog.Error("failed to list sessions missing grades", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	open, err := h.store.ExamOpen()
+	if err != nil {
+		slog.Error("failed to read exam open setting", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := views.AdminUsersPage(users, "").Render(r.Context(), w); err != nil {
+	if err := views.AdminUsersPage(users, ungraded, open, flash).Render(r.Context(), w); err != nil {
 		slog.Error("render error", "error", err)
 	}
 }
@@ -36,6 +62,7 @@ func (h *Handler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	externalID := r.FormValue("external_id")
 	displayName := r.FormValue("display_name")
+	cohort := strings.TrimSpace(r.FormValue("cohort"))
 	password := r.FormValue("password")
 	role := r.FormValue("role")
 
@@ -59,6 +86,7 @@ func (h *Handler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		Username:     username,
 		ExternalID:   externalID,
 		DisplayName:  displayName,
+		Cohort:       cohort,
 		PasswordHash: string(hash),
 		Role:         model.UserRole(role),
 		Active:       true,
@@ -90,10 +118,298 @@ func (h *Handler) handleToggleUserActive(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, h.path("/admin/users"), http.StatusSeeOther)
 }
 
+// handleSetUserCohort moves a user to another cohort. Sessions they already
+// started keep their old cohort.
+func (h *Handler) handleSetUserCohort(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+	err = h.store.SetUserCohort(id, strings.TrimSpace(r.FormValue("cohort")))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to set user cohort", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, h.path("/admin/users"), http.StatusSeeOther)
+}
+
+// handleResetPassword replaces a user's password with a generated one, signs
+// them out everywhere, and shows the new password to the admin once.
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+	admin := model.UserFromContext(r.Context())
+	if id == admin.ID {
+		// Resetting would sign the admin out before they saw the password.
+		http.Error(w, "use /account/password to change your own password", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.store.GetUserByID(id)
+	if err != nil {
+		slog.Error("failed to get user", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if target == nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	password, err := userutil.RandomPassword(resetPasswordPrefix, 8)
+	if err != nil {
+		slog.Error("failed to generate password", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.Error("failed to hash password", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.UpdatePassword(id, string(hash)); err != nil {
+		slog.Error("failed to update password", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.DeleteUserAuthSessions(id); err != nil {
+		slog.Error("failed to delete auth sessions", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("admin reset password", "admin_id", admin.ID, "user_id", id)
+
+	flash := appI18n.Td(r.Context(), "PasswordReset", map[string]any{"Username": target.Username, "Password": password})
+	// The page carries a plaintext password; keep it out of caches and history.
+	w.Header().Set("Cache-Control", "no-store")
+	h.renderAdminUsers(w, r, flash)
+}
+
+// handleStudentHistory shows one student's sessions, grades and per-topic trend.
+func (h *Handler) handleStudentHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	hist, err := h.store.StudentHistory(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to build student history", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := views.StudentHistoryPage(hist, h.config.StudentIdentifier).Render(r.Context(), w); err != nil {
+		slog.Error("render error", "error", err)
+	}
+}
+
 // handleAdminQuestionsPage serves the admin questions management page.
+// A non-empty "q" query parameter searches the question bank.
 func (h *Handler) handleAdminQuestionsPage(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	results, err := h.store.SearchQuestions(query)
+	if err != nil {
+		slog.Error("failed to search questions", "query", query, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	truncated := len(results) == store.SearchQuestionsLimit
+	if err := views.AdminQuestionsPage("", false, query, results, truncated, h.unusedQuestions(), h.fixedQuestions()).Render(r.Context(), w); err != nil {
+		slog.Error("render error", "error", err)
+	}
+}
+
+// unusedQuestions lists the questions no session has drawn yet. Errors are
+// logged and leave the list empty so the page still renders.
+func (h *Handler) unusedQuestions() []model.Question {
+	questions, err := h.store.UnusedQuestions()
+	if err != nil {
+		slog.Error("failed to list unused questions", "error", err)
+	}
+	return questions
+}
+
+// fixedQuestions lists the exam blueprint's fixed question set. Errors are
+// logged and leave the list empty so the page still renders.
+func (h *Handler) fixedQuestions() []model.Question {
+	questions, err := h.store.BlueprintQuestions(1)
+	if err != nil {
+		slog.Error("failed to list blueprint questions", "error", err)
+	}
+	return questions
+}
+
+// handleSetBlueprintQuestions replaces the exam blueprint's fixed question
+// set with the IDs in the question_ids field (separated by commas or
+// spaces), in the order given. An empty field removes the fixed set.
+func (h *Handler) handleSetBlueprintQuestions(w http.ResponseWriter, r *http.Request) {
+	render := func(msg string, isErr bool) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if isErr {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		if err := views.AdminQuestionsPage(msg, isErr, "", nil, false, h.unusedQuestions(), h.fixedQuestions()).Render(r.Context(), w); err != nil {
+			slog.Error("render error", "error", err)
+		}
+	}
+
+	fields := strings.FieldsFunc(r.FormValue("question_ids"), func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	})
+	ids := make([]int64, 0, len(fields))
+	listed := make(map[int64]bool, len(fields))
+	for _, f := range fields {
+		id, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			render(appI18n.Td(r.Context(), "FixedQuestionsBadID", map[string]any{"ID": f}), true)
+			return
+		}
+		if listed[id] {
+			render(appI18n.Td(r.Context(), "FixedQuestionsDuplicate", map[string]any{"ID": f}), true)
+			return
+		}
+		if _, err := h.store.GetQuestion(id); errors.Is(err, sql.ErrNoRows) {
+			render(appI18n.Td(r.Context(), "FixedQuestionsBadID", map[string]any{"ID": f}), true)
+			return
+		} else if err != nil {
+			slog.Error("failed to get question", "question_id", id, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		listed[id] = true
+		ids = append(ids, id)
+	}
+
+	if err := h.store.SetBlueprintQuestions(1, ids); err != nil {
+		slog.Error("failed to set blueprint questions", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("set fixed exam questions", "count", len(ids))
+	if len(ids) == 0 {
+		render(appI18n.T(r.Context(), "FixedQuestionsCleared"), false)
+		return
+	}
+	render(appI18n.Tp(r.Context(), "FixedQuestionsSaved", len(ids)), false)
+}
+
+// handleEditQuestionPage serves the edit form for one question.
+func (h *Handler) handleEditQuestionPage(w http.ResponseWriter, r *http.Request) {
+	q, ok := h.questionFromURL(w, r)
+	if !ok {
+		return
+	}
+	h.renderQuestionEdit(w, r, q, "", false)
+}
+
+// handleUpdateQuestion saves the edit form. Only the question row changes:
+// threads that already used the question keep their messages and scores.
+func (h *Handler) handleUpdateQuestion(w http.ResponseWriter, r *http.Request) {
+	q, ok := h.questionFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	q.Text = strings.TrimSpace(r.FormValue("text"))
+	q.Difficulty = model.Difficulty(r.FormValue("difficulty"))
+	q.Topic = strings.TrimSpace(r.FormValue("topic"))
+	q.Rubric = strings.TrimSpace(r.FormValue("rubric"))
+	q.ModelAnswer = strings.TrimSpace(r.FormValue("model_answer"))
+	q.GradeModel = strings.TrimSpace(r.FormValue("grade_model"))
+	q.Tags = model.ParseTags(r.FormValue("tags"))
+	q.MaxPoints, _ = strconv.Atoi(r.FormValue("max_points"))
+	if v := strings.TrimSpace(r.FormValue("weight")); v != "" {
+		weight, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "invalid weight", http.StatusBadRequest)
+			return
+		}
+		q.Weight = weight
+	}
+	// A blank limit falls back to the blueprint's.
+	q.MaxFollowups = nil
+	if v := strings.TrimSpace(r.FormValue("max_followups")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid max_followups", http.StatusBadRequest)
+			return
+		}
+		q.MaxFollowups = &n
+	}
+
+	var problems []string
+	for _, p := range model.ValidateQuestions([]model.QuestionImport{{
+		Text: q.Text, Difficulty: q.Difficulty, MaxPoints: q.MaxPoints,
+		Rubric: q.Rubric, ModelAnswer: q.ModelAnswer, MaxFollowups: q.MaxFollowups,
+	}}) {
+		if !p.Warning {
+			problems = append(problems, p.Message)
+		}
+	}
+	if len(problems) > 0 {
+		h.renderQuestionEdit(w, r, q, strings.Join(problems, "; "), true)
+		return
+	}
+
+	if err := h.store.UpdateQuestion(q); err != nil {
+		slog.Error("failed to update question", "id", q.ID, "error", err)
+		h.renderQuestionEdit(w, r, q, err.Error(), true)
+		return
+	}
+	user := model.UserFromContext(r.Context())
+	slog.Info("admin edited question", "admin_id", user.ID, "question_id", q.ID)
+	h.renderQuestionEdit(w, r, q, appI18n.T(r.Context(), "QuestionSaved"), false)
+}
+
+// questionFromURL loads the question named by the questionID URL parameter,
+// writing an error response if that fails.
+func (h *Handler) questionFromURL(w http.ResponseWriter, r *http.Request) (model.Question, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "questionID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid question ID", http.StatusBadRequest)
+		return model.Question{}, false
+	}
+	q, err := h.store.GetQuestion(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "question not found", http.StatusNotFound)
+		return model.Question{}, false
+	}
+	if err != nil {
+		slog.Error("failed to get question", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return model.Question{}, false
+	}
+	return q, true
+}
+
+// renderQuestionEdit renders the edit form for q, warning when exam threads
+// already use the question.
+func (h *Handler) renderQuestionEdit(w http.ResponseWriter, r *http.Request, q model.Question, flash string, flashErr bool) {
+	threads, err := h.store.QuestionThreadCount(q.ID)
+	if err != nil {
+		slog.Error("failed to count question threads", "id", q.ID, "error", err)
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := views.AdminQuestionsPage("", false).Render(r.Context(), w); err != nil {
+	if err := views.AdminQuestionEditPage(q, threads, flash, flashErr).Render(r.Context(), w); err != nil {
 		slog.Error("render error", "error", err)
 	}
 }
@@ -129,27 +445,51 @@ func (h *Handler) handleUploadQuestions(w http.ResponseWriter, r *http.Request)
 	}
 	if storedHash == hash {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		if err := views.AdminQuestionsPage("UploadDuplicate", true).Render(r.Context(), w); err != nil {
+		if err := views.AdminQuestionsPage(appI18n.T(r.Context(), "UploadDuplicate"), true, "", nil, false, h.unusedQuestions(), h.fixedQuestions()).Render(r.Context(), w); err != nil {
 			slog.Error("render error", "error", err)
 		}
 		return
 	}
 
-	var questions []model.QuestionImport
-	if err := json.Unmarshal(data, &questions); err != nil {
-		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+	questions, err := model.ParseQuestions(header.Filename, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bank, err := h.store.ListDistinctTopics()
+	if err != nil {
+		slog.Error("failed to list topics", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	var topicNotes []string
+	problems := model.CheckTopics(questions, bank, h.config.StrictTopics)
+	for _, p := range problems {
+		topicNotes = append(topicNotes, p.String())
+	}
+	if model.InvalidQuestionCount(problems) > 0 {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		msg := "Import rejected, fix the topics: " + strings.Join(topicNotes, "; ")
+		if err := views.AdminQuestionsPage(msg, true, "", nil, false, h.unusedQuestions(), h.fixedQuestions()).Render(r.Context(), w); err != nil {
+			slog.Error("render error", "error", err)
+		}
 		return
 	}
 
 	for _, qi := range questions {
 		_, err := h.store.InsertQuestion(model.Question{
-			CourseID:    1,
-			Text:        qi.Text,
-			Difficulty:  qi.Difficulty,
-			Topic:       qi.Topic,
-			Rubric:      qi.Rubric,
-			ModelAnswer: qi.ModelAnswer,
-			MaxPoints:   qi.MaxPoints,
+			CourseID:     1,
+			Text:         qi.Text,
+			Difficulty:   qi.Difficulty,
+			Topic:        qi.Topic,
+			Rubric:       qi.Rubric,
+			ModelAnswer:  qi.ModelAnswer,
+			MaxPoints:    qi.MaxPoints,
+			Weight:       qi.Weight,
+			GradeModel:   qi.GradeModel,
+			Tags:         qi.Tags,
+			MaxFollowups: qi.MaxFollowups,
 		})
 		if err != nil {
 			slog.Error("failed to insert question", "error", err)
@@ -166,7 +506,99 @@ func (h *Handler) handleUploadQuestions(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	msg := fmt.Sprintf("Successfully imported %d questions.", len(questions))
-	if err := views.AdminQuestionsPage(msg, false).Render(r.Context(), w); err != nil {
+	if len(topicNotes) > 0 {
+		msg += " Topic warnings: " + strings.Join(topicNotes, "; ")
+	}
+	if err := views.AdminQuestionsPage(msg, false, "", nil, false, h.unusedQuestions(), h.fixedQuestions()).Render(r.Context(), w); err != nil {
 		slog.Error("render error", "error", err)
 	}
 }
+
+// handleDeleteSession deletes one session and everything recorded in it,
+// then returns to the student's history page.
+func (h *Handler) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid session ID", http.StatusBadRequest)
+		return
+	}
+	sess, err := h.store.GetSession(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get session", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.DeleteSession(id); err != nil {
+		slog.Error("failed to delete session", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user := model.UserFromContext(r.Context())
+	slog.Info("admin deleted session", "admin_id", user.ID, "session_id", id, "status", sess.Status)
+
+	http.Redirect(w, r, h.path(fmt.Sprintf("/admin/users/%d", sess.StudentID)), http.StatusSeeOther)
+}
+
+// handlePurgeSessions deletes all sessions with the selected status, e.g.
+// in-progress sessions left over from a demo. The form must be confirmed.
+func (h *Handler) handlePurgeSessions(w http.ResponseWriter, r *http.Request) {
+	status := model.SessionStatus(r.FormValue("status"))
+	if !model.IsValidSessionStatus(status) {
+		http.Error(w, "invalid session status", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("confirm") != "yes" {
+		http.Error(w, "purge must be confirmed", http.StatusBadRequest)
+		return
+	}
+
+	n, err := h.store.DeleteSessionsByStatus(status)
+	if err != nil {
+		slog.Error("failed to purge sessions", "status", status, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user := model.UserFromContext(r.Context())
+	slog.Info("admin purged sessions", "admin_id", user.ID, "status", status, "count", n)
+
+	h.renderAdminUsers(w, r, appI18n.Tp(r.Context(), "SessionsPurged", int(n)))
+}
+
+// handleReloadPrompts reads the LLM prompt templates again, so edits in
+// --prompts-dir take effect without a restart.
+func (h *Handler) handleReloadPrompts(w http.ResponseWriter, r *http.Request) {
+	if err := h.llm.ReloadPrompts(); err != nil {
+		slog.Error("failed to reload prompts", "error", err)
+		h.renderAdminUsers(w, r, appI18n.Td(r.Context(), "PromptsReloadFailed", map[string]any{"Error": err.Error()}))
+		return
+	}
+	user := model.UserFromContext(r.Context())
+	slog.Info("admin reloaded prompts", "admin_id", user.ID)
+
+	h.renderAdminUsers(w, r, appI18n.T(r.Context(), "PromptsReloaded"))
+}
+
+// handleSetExamOpen opens or closes the exam for all students. While it is
+// closed, students cannot start exams or answer, but can still see their
+// results.
+func (h *Handler) handleSetExamOpen(w http.ResponseWriter, r *http.Request) {
+	open := r.FormValue("open") == "1"
+	if err := h.store.SetExamOpen(open); err != nil {
+		slog.Error("failed to set exam open setting", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user := model.UserFromContext(r.Context())
+	slog.Info("admin changed exam access", "admin_id", user.ID, "open", open)
+
+	flash := "ExamOpenedFlash"
+	if !open {
+		flash = "ExamClosedFlash"
+	}
+	h.renderAdminUsers(w, r, appI18n.T(r.Context(), flash))
+}
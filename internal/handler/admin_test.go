@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/llm"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestSetUserCohort(t *testing.T) {
+	f := newRouterFixture(t)
+	path := "/admin/users/" + itoa(f.student.ID) + "/cohort"
+
+	page := f.do(t, f.admin, http.MethodGet, "/admin/users").Body.String()
+	if !strings.Contains(page, `action="`+path+`"`) {
+		t.Fatalf("user list should offer a cohort form: %s", page)
+	}
+
+	form := url.Values{"cohort": {" B "}}
+	if rec := f.doForm(t, f.teacher, http.MethodPost, path, form); rec.Code != http.StatusForbidden {
+		t.Errorf("teachers should not set cohorts, got %d", rec.Code)
+	}
+	rec := f.doForm(t, f.admin, http.MethodPost, path, form)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/users" {
+		t.Fatalf("expected a redirect to the user list, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if u, err := f.store.GetUserByID(f.student.ID); err != nil || u.Cohort != "B" {
+		t.Errorf("cohort = %q (err %v), want B", u.Cohort, err)
+	}
+	if rec := f.doForm(t, f.admin, http.MethodPost, "/admin/users/9999/cohort", form); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user should be 404, got %d", rec.Code)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, err := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	path := "/admin/sessions/" + itoa(sessID) + "/delete"
+
+	if rec := f.do(t, f.admin, http.MethodGet, "/admin/users/9999"); rec.Code != http.StatusNotFound {
+		t.Errorf("history of an unknown user should be 404, got %d", rec.Code)
+	}
+	history := f.do(t, f.admin, http.MethodGet, "/admin/users/"+itoa(f.student.ID)).Body.String()
+	if !strings.Contains(history, `action="`+path+`"`) {
+		t.Fatalf("student history should offer a delete button: %s", history)
+	}
+
+	if rec := f.do(t, f.teacher, http.MethodPost, path); rec.Code != http.StatusForbidden {
+		t.Errorf("teachers should not delete sessions, got %d", rec.Code)
+	}
+	rec := f.do(t, f.admin, http.MethodPost, path)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/users/"+itoa(f.student.ID) {
+		t.Fatalf("expected a redirect to the student's history, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if n, _ := f.store.CountSessions(model.SessionFilter{}); n != 0 {
+		t.Errorf("expected the session deleted, %d left", n)
+	}
+	if rec := f.do(t, f.admin, http.MethodPost, path); rec.Code != http.StatusNotFound {
+		t.Errorf("deleting again should be 404, got %d", rec.Code)
+	}
+}
+
+func TestAdminUsersPageListsUngradedSessions(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+
+	body := f.do(t, f.admin, http.MethodGet, "/admin/users").Body.String()
+	if strings.Contains(body, `id="ungraded-sessions"`) {
+		t.Error("the section should be hidden when every session has a grade")
+	}
+
+	sessID, _ := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	if err := f.store.UpdateSessionStatus(sessID, model.StatusSubmitted); err != nil {
+		t.Fatalf("UpdateSessionStatus: %v", err)
+	}
+	body = f.do(t, f.admin, http.MethodGet, "/admin/users").Body.String()
+	if !strings.Contains(body, `id="ungraded-sessions"`) || !strings.Contains(body, `href="/review/`+itoa(sessID)+`"`) || !strings.Contains(body, "No grade recorded") {
+		t.Errorf("expected the submitted session listed without a grade: %s", body)
+	}
+}
+
+func TestReloadPrompts(t *testing.T) {
+	f := newRouterFixture(t)
+	c, err := llm.New("http://localhost", "test", "stub", "standard", llm.Options{})
+	if err != nil {
+		t.Fatalf("llm.New: %v", err)
+	}
+	f.handler.llm = c
+
+	rec := f.do(t, f.admin, http.MethodPost, "/admin/prompts/reload")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Prompt templates reloaded.") {
+		t.Errorf("expected the reload confirmed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := f.do(t, f.teacher, http.MethodPost, "/admin/prompts/reload"); rec.Code != http.StatusForbidden {
+		t.Errorf("teachers must not reload prompts, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,626 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/llm"
+	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/store"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// answerFixture is an in-progress exam session with a single open thread.
+type answerFixture struct {
+	store     *store.Store
+	user      *model.User
+	sessionID int64
+	threadID  int64
+	llmCalls  *int
+	prompts   *[]string // System prompts the stub LLM received
+	llmClient *llm.Client
+	accept    string // Accept header for answer requests, if set
+	htmx      bool   // Send the HX-Request header
+	stream    bool   // Post to the streaming endpoint
+	evaluate  bool   // Post to the evaluate endpoint
+	clarify   bool   // Post text as a clarification request instead
+	text      string // Answer text, if not the default
+	gone      bool   // The client disconnects before the response
+}
+
+func newAnswerFixture(t *testing.T, needFollowup bool) *answerFixture {
+	t.Helper()
+	return newAnswerFixtureWithFollowup(t, needFollowup, "Why?")
+}
+
+// newAnswerFixtureWithFollowup is newAnswerFixture with the follow-up
+// question the stub LLM returns.
+func newAnswerFixtureWithFollowup(t *testing.T, needFollowup bool, followup string) *answerFixture {
+	t.Helper()
+	if err := i18n.Init("en"); err != nil {
+		t.Fatalf("Init(en): %v", err)
+	}
+
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	qID, err := s.InsertQuestion(model.Question{CourseID: 1, Text: "What is inertia?", Difficulty: model.Difficulty("easy"), Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam", MaxFollowups: 3})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	userID, err := s.CreateUser(model.User{Username: "student", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	sessionID, err := s.CreateSession(bpID, userID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, err := s.GetThreadsForSession(sessionID)
+	if err != nil || len(threads) != 1 {
+		t.Fatalf("GetThreadsForSession: %v (%d threads)", err, len(threads))
+	}
+
+	calls := 0
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		content := fmt.Sprintf(`{"score": 5, "max_points": 10, "feedback": "ok", "need_followup": %t, "followup_question": %q}`, needFollowup, followup)
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Messages) > 0 {
+			prompts = append(prompts, req.Messages[0].Content)
+		}
+		if req.ResponseFormat == nil {
+			content = "Linear motion is enough."
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, piece := range []string{content[:30], content[30:45], content[45:]} {
+				chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+					Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: piece}}},
+				})
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			usage, _ := json.Marshal(openai.ChatCompletionStreamResponse{Usage: &openai.Usage{TotalTokens: 42}})
+			fmt.Fprintf(w, "data: %s\n\n", usage)
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}},
+			},
+			Usage: openai.Usage{TotalTokens: 42},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := llm.New(srv.URL, "test", "stub", "standard", llm.Options{})
+	if err != nil {
+		t.Fatalf("llm.New: %v", err)
+	}
+
+	return &answerFixture{
+		store:     s,
+		user:      &model.User{ID: userID, Role: model.UserRoleStudent},
+		sessionID: sessionID,
+		threadID:  threads[0].ID,
+		llmCalls:  &calls,
+		prompts:   &prompts,
+		llmClient: c,
+	}
+}
+
+func (f *answerFixture) answer(t *testing.T, cfg model.ExamConfig, lang string) *httptest.ResponseRecorder {
+	t.Helper()
+	// The streaming endpoint only exists with --stream-feedback.
+	cfg.StreamFeedback = cfg.StreamFeedback || f.stream
+	h := &Handler{store: f.store, llm: f.llmClient, config: cfg}
+
+	text := f.text
+	if text == "" {
+		text = "An object keeps its state of motion."
+	}
+	form := url.Values{"answer": {text}}
+	if f.clarify {
+		form = url.Values{"clarification": {text}}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if f.accept != "" {
+		req.Header.Set("Accept", f.accept)
+	}
+	if f.htmx {
+		req.Header.Set("HX-Request", "true")
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("sessionID", strconv.FormatInt(f.sessionID, 10))
+	rctx.URLParams.Add("threadID", strconv.FormatInt(f.threadID, 10))
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = model.ContextWithUser(ctx, f.user)
+	ctx = i18n.WithLocalizer(ctx, i18n.NewLocalizer(lang))
+	if f.gone {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		cancel()
+	}
+
+	rec := httptest.NewRecorder()
+	switch {
+	case f.clarify:
+		h.handleClarify(rec, req.WithContext(ctx))
+	case f.stream:
+		h.handleAnswerStream(rec, req.WithContext(ctx))
+	case f.evaluate:
+		h.handleEvaluateAnswer(rec, req.WithContext(ctx))
+	default:
+		h.handleAnswer(rec, req.WithContext(ctx))
+	}
+	return rec
+}
+
+func TestHandleAnswerNoFollowups(t *testing.T) {
+	f := newAnswerFixture(t, true)
+
+	rec := f.answer(t, model.ExamConfig{MaxFollowups: 3, NoFollowups: true}, "en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if *f.llmCalls != 0 {
+		t.Errorf("expected no LLM evaluation in single-answer mode, got %d calls", *f.llmCalls)
+	}
+
+	thread, err := f.store.GetThread(f.threadID)
+	if err != nil {
+		t.Fatalf("GetThread: %v", err)
+	}
+	if thread.Status != model.ThreadCompleted {
+		t.Errorf("expected thread completed after one answer, got %q", thread.Status)
+	}
+	messages, err := f.store.GetMessages(f.threadID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Role != model.RoleStudent {
+		t.Errorf("expected only the student answer to be stored, got %+v", messages)
+	}
+}
+
+func TestHandleAnswerFollowup(t *testing.T) {
+	f := newAnswerFixture(t, true)
+
+	rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if *f.llmCalls != 1 {
+		t.Errorf("expected one LLM evaluation, got %d calls", *f.llmCalls)
+	}
+
+	thread, err := f.store.GetThread(f.threadID)
+	if err != nil {
+		t.Fatalf("GetThread: %v", err)
+	}
+	if thread.Status != model.ThreadAnswered {
+		t.Errorf("expected thread awaiting follow-up, got %q", thread.Status)
+	}
+	if !strings.Contains(rec.Body.String(), "Why?") {
+		t.Error("response should include the follow-up question")
+	}
+	messages, err := f.store.GetMessages(f.threadID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 2 || messages[1].Role != model.RoleLLM || messages[1].TokenCount != 42 {
+		t.Errorf("expected the LLM reply stored with its token usage (42), got %+v", messages)
+	}
+}
+
+func TestHandleAnswerQuestionFollowupLimit(t *testing.T) {
+	zero := 0
+	for _, tc := range []struct {
+		name   string
+		limit  *int
+		stream bool
+		want   string
+	}{
+		{"blueprint limit", nil, false, "you MAY ask ONE follow-up"},
+		{"question allows none", &zero, false, "Maximum follow-up questions reached"},
+		{"question allows none, streamed", &zero, true, "Maximum follow-up questions reached"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newAnswerFixture(t, false)
+			f.stream = tc.stream
+			thread, err := f.store.GetThread(f.threadID)
+			if err != nil {
+				t.Fatalf("GetThread: %v", err)
+			}
+			q, err := f.store.GetQuestion(thread.QuestionID)
+			if err != nil {
+				t.Fatalf("GetQuestion: %v", err)
+			}
+			q.MaxFollowups = tc.limit
+			if err := f.store.UpdateQuestion(q); err != nil {
+				t.Fatalf("UpdateQuestion: %v", err)
+			}
+
+			if rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en"); rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if len(*f.prompts) != 1 || !strings.Contains((*f.prompts)[0], tc.want) {
+				t.Errorf("evaluation prompt should contain %q, got %q", tc.want, *f.prompts)
+			}
+		})
+	}
+}
+
+func TestHandleAnswerMinAnswerChars(t *testing.T) {
+	cfg := model.ExamConfig{MaxFollowups: 3, MinAnswerChars: 10}
+
+	// Seven Cyrillic letters are 14 bytes but only 7 characters.
+	f := newAnswerFixture(t, false)
+	f.text = "  Инерция  "
+	rec := f.answer(t, cfg, "ru")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a short answer, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "не меньше 10 символов") {
+		t.Errorf("expected the localized minimum-length message, got %q", rec.Body.String())
+	}
+	if messages, _ := f.store.GetMessages(f.threadID); len(messages) != 0 || *f.llmCalls != 0 {
+		t.Errorf("a rejected answer should be neither stored nor evaluated, got %d messages and %d LLM calls", len(messages), *f.llmCalls)
+	}
+
+	f.accept = "application/json"
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "at least 10 characters") {
+		t.Errorf("expected a plain 400 for JSON clients, got %d: %q", rec.Code, rec.Body.String())
+	}
+
+	f.accept = ""
+	f.text = "Инерция — свойство тела"
+	if rec := f.answer(t, cfg, "ru"); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for a long enough answer, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleAnswerRepeatsQuestion(t *testing.T) {
+	f := newAnswerFixture(t, false)
+	f.text = "what is inertia"
+	if rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("the check is off by default; expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	cfg := model.ExamConfig{MaxFollowups: 3, MaxQuestionSimilarity: 0.8}
+	f = newAnswerFixture(t, false)
+	f.text = "What is inertia"
+	rec := f.answer(t, cfg, "en")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "in your own words") {
+		t.Fatalf("expected 400 asking for the student's own words, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if messages, _ := f.store.GetMessages(f.threadID); len(messages) != 0 || *f.llmCalls != 0 {
+		t.Errorf("a pasted question should be neither stored nor evaluated, got %d messages and %d LLM calls", len(messages), *f.llmCalls)
+	}
+
+	f.text = "Inertia is a body's resistance to changes in its motion."
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for an answer in the student's own words, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleAnswerFollowupWithoutQuestion(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%t", stream), func(t *testing.T) {
+			f := newAnswerFixtureWithFollowup(t, true, "  ")
+			f.stream = stream
+
+			if rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en"); rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			thread, err := f.store.GetThread(f.threadID)
+			if err != nil {
+				t.Fatalf("GetThread: %v", err)
+			}
+			if thread.Status != model.ThreadCompleted {
+				t.Errorf("a follow-up request without a question should complete the thread, got %q", thread.Status)
+			}
+			messages, _ := f.store.GetMessages(f.threadID)
+			if len(messages) != 2 || messages[1].Followup != "" {
+				t.Errorf("expected the feedback stored without a follow-up, got %+v", messages)
+			}
+		})
+	}
+}
+
+func TestHandleAnswerFollowupLabelLocalized(t *testing.T) {
+	f := newAnswerFixture(t, true)
+
+	rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "ru")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "Уточняющий вопрос:") {
+		t.Error("follow-up should be labeled in the active language")
+	}
+	if strings.Contains(body, "**") || strings.Contains(body, "Follow-up question:") {
+		t.Error("follow-up label should not be hardcoded English markdown")
+	}
+
+	messages, err := f.store.GetMessages(f.threadID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	llmMsg := messages[len(messages)-1]
+	if llmMsg.Content != "ok" || llmMsg.Followup != "Why?" {
+		t.Errorf("feedback and follow-up should be stored separately, got %+v", llmMsg)
+	}
+}
+
+func TestHandleAnswerEditWindow(t *testing.T) {
+	f := newAnswerFixture(t, true)
+	cfg := model.ExamConfig{MaxFollowups: 3, AnswerEditWindow: time.Minute}
+
+	f.text = "Inertia is mass."
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	f.text = "Inertia is resistance to changes in motion."
+	rec := f.answer(t, cfg, "en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if *f.llmCalls != 0 {
+		t.Errorf("answers inside the edit window must not be evaluated, got %d calls", *f.llmCalls)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "/evaluate") || !strings.Contains(body, "Save changes") {
+		t.Error("the thread should offer the edit form and schedule the evaluation")
+	}
+	messages, err := f.store.GetMessages(f.threadID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Content != f.text {
+		t.Fatalf("the replacement should overwrite the answer, got %+v", messages)
+	}
+
+	// While another request holds the evaluation, it is neither evaluated
+	// again nor editable.
+	if ok, err := f.store.ClaimEvaluation(messages[0].ID, time.Now().Add(-time.Hour)); err != nil || !ok {
+		t.Fatalf("ClaimEvaluation: %v, %v", ok, err)
+	}
+	f.evaluate = true
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusConflict || *f.llmCalls != 0 {
+		t.Errorf("a claimed answer must not be evaluated again, got %d and %d calls", rec.Code, *f.llmCalls)
+	}
+	f.evaluate = false
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "can no longer be changed") {
+		t.Errorf("an answer being evaluated must not be edited, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := f.store.ReleaseEvaluation(messages[0].ID); err != nil {
+		t.Fatalf("ReleaseEvaluation: %v", err)
+	}
+
+	f.evaluate = true
+	for range 2 {
+		if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+			t.Fatalf("evaluate: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	if *f.llmCalls != 1 {
+		t.Errorf("expected exactly one evaluation, got %d calls", *f.llmCalls)
+	}
+	messages, _ = f.store.GetMessages(f.threadID)
+	if len(messages) != 2 || messages[0].Content != f.text || messages[1].Role != model.RoleLLM {
+		t.Errorf("expected the edited answer and one evaluation, got %+v", messages)
+	}
+}
+
+func TestHandleAnswerJSONClaimsEvaluation(t *testing.T) {
+	f := newAnswerFixture(t, true)
+	cfg := model.ExamConfig{MaxFollowups: 3, AnswerEditWindow: time.Minute}
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The page's scheduled evaluation arrives while an API client's edit
+	// of the same answer is being evaluated.
+	calls := 0
+	var scheduled *httptest.ResponseRecorder
+	f.llmClient = newStubLLM(t, func(*http.Request, string) string {
+		calls++
+		if scheduled == nil {
+			g := *f
+			g.accept, g.evaluate = "", true
+			scheduled = g.answer(t, cfg, "en")
+		}
+		return `{"score": 5, "max_points": 10, "feedback": "ok", "need_followup": false}`
+	})
+	f.accept = "application/json"
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if scheduled == nil || scheduled.Code != http.StatusConflict {
+		t.Errorf("the scheduled evaluation should find the answer claimed, got %v", scheduled)
+	}
+	if calls != 1 {
+		t.Errorf("expected exactly one evaluation, got %d calls", calls)
+	}
+}
+
+func TestHandleAnswerEditWindowClosed(t *testing.T) {
+	f := newAnswerFixture(t, true)
+	cfg := model.ExamConfig{MaxFollowups: 3, AnswerEditWindow: time.Millisecond}
+
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	time.Sleep(5 * time.Millisecond)
+	f.text = "A late second answer."
+	rec := f.answer(t, cfg, "en")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "can no longer be changed") {
+		t.Errorf("expected 400 once the edit window has passed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if messages, _ := f.store.GetMessages(f.threadID); len(messages) != 1 || messages[0].Content == f.text {
+		t.Errorf("the late answer must be neither stored nor merged, got %+v", messages)
+	}
+}
+
+func TestHandleAnswerJSON(t *testing.T) {
+	f := newAnswerFixture(t, true)
+	f.accept = "application/json"
+
+	rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+
+	var got answerResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+	}
+	want := answerResponse{ThreadStatus: model.ThreadAnswered, Feedback: "ok", NeedFollowup: true, FollowupQuestion: "Why?"}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleAnswerJSONOwnerOnly(t *testing.T) {
+	f := newAnswerFixture(t, true)
+	f.accept = "application/json"
+	f.user = &model.User{ID: f.user.ID + 100, Role: model.UserRoleAdmin}
+
+	rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-owner, got %d", rec.Code)
+	}
+	if *f.llmCalls != 0 {
+		t.Error("non-owner answers must not reach the LLM")
+	}
+}
+
+func TestHandleAnswerLLMTimeout(t *testing.T) {
+	f := newAnswerFixture(t, true)
+	f.llmClient = newStubLLM(t, func(r *http.Request, _ string) string {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return ""
+	})
+	cfg := model.ExamConfig{MaxFollowups: 3, LLMTimeout: 20 * time.Millisecond}
+
+	rec := f.answer(t, cfg, "en")
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "taking too long") {
+		t.Errorf("expected a friendly timeout message, got %q", rec.Body.String())
+	}
+
+	f.htmx = true
+	rec = f.answer(t, cfg, "en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("htmx: expected 200 so the notice is swapped in, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	evaluate := fmt.Sprintf(`hx-post="/exam/%d/answer/%d/evaluate"`, f.sessionID, f.threadID)
+	if !strings.Contains(body, "taking too long") || !strings.Contains(body, evaluate) {
+		t.Errorf("htmx response should show the notice above a button retrying the evaluation: %s", body)
+	}
+	if strings.Contains(body, "answer-input") {
+		t.Error("retrying must not post the answer a second time")
+	}
+
+	thread, err := f.store.GetThread(f.threadID)
+	if err != nil {
+		t.Fatalf("GetThread: %v", err)
+	}
+	if thread.Status == model.ThreadCompleted {
+		t.Error("a timed-out evaluation must not complete the thread")
+	}
+
+	f.llmClient = newStubLLM(t, func(*http.Request, string) string {
+		return `{"score": 5, "max_points": 10, "feedback": "ok"}`
+	})
+	f.evaluate = true
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("retry: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if messages, _ := f.store.GetMessages(f.threadID); model.AwaitingEvaluation(messages) {
+		t.Errorf("the retry should evaluate the stored answer, got %+v", messages)
+	}
+}
+
+func TestExamPageProgress(t *testing.T) {
+	f := newRouterFixture(t)
+	var ids []int64
+	for _, text := range []string{"Q1", "Q2", "Q3"} {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, ids)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, _ := f.store.GetThreadsForSession(sessionID)
+	if err := f.store.UpdateThreadStatus(threads[0].ID, model.ThreadCompleted); err != nil {
+		t.Fatalf("UpdateThreadStatus: %v", err)
+	}
+
+	body := f.do(t, f.student, http.MethodGet, fmt.Sprintf("/exam/%d", sessionID)).Body.String()
+	if !strings.Contains(body, "1 of 3 answered") || !strings.Contains(body, `<progress value="1" max="3">`) {
+		t.Errorf("expected the progress summary: %s", body)
+	}
+	if !strings.Contains(body, fmt.Sprintf(`<a href="#thread-%d" class="answered">1</a>`, threads[0].ID)) {
+		t.Error("the answered question should be marked in the navigation")
+	}
+	next := fmt.Sprintf(`href="#thread-%d"`, threads[1].ID)
+	if strings.Count(body, next) != 3 {
+		t.Errorf("the second question should be linked from the navigation, as next and as previous, got %d links", strings.Count(body, next))
+	}
+}
+
+func TestHandleAnswerRefreshesProgress(t *testing.T) {
+	f := newAnswerFixture(t, false)
+
+	rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `id="exam-progress"`) || !strings.Contains(body, `hx-swap-oob="outerHTML"`) {
+		t.Fatalf("the thread partial should carry an out-of-band progress update: %s", body)
+	}
+	if !strings.Contains(body, "1 of 1 answered") || !strings.Contains(body, fmt.Sprintf(`<a href="#thread-%d" class="answered">1</a>`, f.threadID)) {
+		t.Errorf("the progress should count the answered question: %s", body)
+	}
+}
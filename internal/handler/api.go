@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// apiSessionList is the JSON body of GET /api/sessions.
+type apiSessionList struct {
+	Sessions []model.ExamSession `json:"sessions"`
+	Page     int                 `json:"page"`
+	Size     int                 `json:"size"`
+	Total    int                 `json:"total"`
+}
+
+// Stable error codes of the JSON API. Clients should branch on these rather
+// than on messages, which may change.
+const (
+	apiCodeUnauthorized = "unauthorized"
+	apiCodeForbidden    = "forbidden"
+	apiCodeNotFound     = "not_found"
+	apiCodeValidation   = "validation"
+	apiCodeInternal     = "internal"
+)
+
+// apiError is the body of every JSON API error response:
+// {"error": {"code": "...", "message": "..."}}.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+// apiErrorDetail describes one API error.
+type apiErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeAPIError writes a JSON error envelope with the given status.
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(apiError{Error: apiErrorDetail{Code: code, Message: message}}); err != nil {
+		slog.Error("failed to encode JSON error", "error", err)
+	}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode JSON response", "error", err)
+	}
+}
+
+// handleAPISessions lists sessions as JSON, newest first and paginated like
+// the review dashboard. Optional cohort and status query parameters filter
+// the list.
+func (h *Handler) handleAPISessions(w http.ResponseWriter, r *http.Request) {
+	filter := model.SessionFilter{Cohort: r.URL.Query().Get("cohort")}
+	if status := r.URL.Query().Get("status"); status != "" {
+		if !model.IsValidSessionStatus(model.SessionStatus(status)) {
+			writeAPIError(w, http.StatusBadRequest, apiCodeValidation, "invalid session status")
+			return
+		}
+		filter.Statuses = []model.SessionStatus{model.SessionStatus(status)}
+	}
+
+	sessions, page, err := h.sessionPage(r, filter)
+	if err != nil {
+		slog.Error("failed to list sessions", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, err.Error())
+		return
+	}
+	if sessions == nil {
+		sessions = []model.ExamSession{}
+	}
+	writeJSON(w, apiSessionList{Sessions: sessions, Page: page.Number, Size: page.Size, Total: page.Total})
+}
+
+// handleAPISession returns one session with its threads, messages, scores
+// and grade as JSON.
+func (h *Handler) handleAPISession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiCodeValidation, "invalid session ID")
+		return
+	}
+
+	view, err := h.store.GetSessionView(sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, apiCodeNotFound, "session not found")
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get session view", "session_id", sessionID, "error", err)
+		writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, err.Error())
+		return
+	}
+	writeJSON(w, view)
+}
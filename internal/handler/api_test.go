@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestAPISessions(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	inProgress, _ := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	graded, _ := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	threads, _ := f.store.GetThreadsForSession(graded)
+	f.store.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "An answer"})
+	f.store.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 7, LLMFeedback: "Good"})
+	f.store.UpsertGrade(model.Grade{SessionID: graded, LLMGrade: 70})
+	f.store.UpdateSessionStatus(graded, model.StatusGraded)
+
+	rec := f.do(t, f.teacher, http.MethodGet, "/api/sessions")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("expected JSON, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var list apiSessionList
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if list.Total != 2 || len(list.Sessions) != 2 || list.Sessions[0].ID != graded || list.Sessions[1].ID != inProgress {
+		t.Errorf("expected both sessions newest first, got %+v", list)
+	}
+
+	rec = f.do(t, f.admin, http.MethodGet, "/api/sessions?status=graded")
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || list.Total != 1 || list.Sessions[0].Status != model.StatusGraded {
+		t.Errorf("status filter: got %+v, %v", list, err)
+	}
+	if rec := f.do(t, f.admin, http.MethodGet, "/api/sessions?status=bogus"); rec.Code != http.StatusBadRequest {
+		t.Errorf("an unknown status should be rejected, got %d", rec.Code)
+	}
+
+	rec = f.do(t, f.teacher, http.MethodGet, "/api/sessions/"+itoa(graded))
+	var view model.SessionView
+	if err := json.Unmarshal(rec.Body.Bytes(), &view); err != nil {
+		t.Fatalf("decode session: %v: %s", err, rec.Body.String())
+	}
+	if view.Session.ID != graded || len(view.Threads) != 1 || view.Threads[0].Messages[0].Content != "An answer" ||
+		view.Threads[0].Score.LLMScore != 7 || view.Grade == nil || view.Grade.LLMGrade != 70 {
+		t.Errorf("unexpected session view: %+v", view)
+	}
+
+	if rec := f.do(t, f.teacher, http.MethodGet, "/api/sessions/9999"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing session, got %d", rec.Code)
+	}
+	for _, path := range []string{"/api/sessions", "/api/sessions/" + itoa(graded)} {
+		if rec := f.do(t, f.student, http.MethodGet, path); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: students should get 403, got %d", path, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Accept", "application/json")
+	anon := httptest.NewRecorder()
+	f.router.ServeHTTP(anon, req)
+	if anon.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated JSON clients should get 401, got %d", anon.Code)
+	}
+}
+
+func TestAPIErrorEnvelope(t *testing.T) {
+	f := newRouterFixture(t)
+
+	tests := []struct {
+		name   string
+		user   *model.User
+		path   string
+		status int
+		code   string
+	}{
+		{"student", f.student, "/api/sessions", http.StatusForbidden, apiCodeForbidden},
+		{"missing session", f.teacher, "/api/sessions/9999", http.StatusNotFound, apiCodeNotFound},
+		{"bad session ID", f.teacher, "/api/sessions/abc", http.StatusBadRequest, apiCodeValidation},
+		{"bad status", f.admin, "/api/sessions?status=bogus", http.StatusBadRequest, apiCodeValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := f.do(t, tt.user, http.MethodGet, tt.path)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Errorf("expected a JSON error, got %q", ct)
+			}
+			var body apiError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode error: %v: %s", err, rec.Body.String())
+			}
+			if body.Error.Code != tt.code || body.Error.Message == "" {
+				t.Errorf("expected code %q with a message, got %+v", tt.code, body.Error)
+			}
+		})
+	}
+
+	// Non-API pages keep plain-text errors.
+	if rec := f.do(t, f.student, http.MethodGet, "/review"); rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("expected a plain 403 for /review, got %d %q", rec.Code, rec.Body.String())
+	}
+}
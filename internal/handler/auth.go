@@ -19,6 +19,9 @@ const (
 	csrfCookieName    = "csrf_token"
 )
 
+// minPasswordLength is the shortest password a user may choose.
+const minPasswordLength = 8
+
 // generateCSRFToken generates a new CSRF token.
 func generateCSRFToken() (string, error) {
 	b := make([]byte, 32)
@@ -115,6 +118,9 @@ func (h *Handler) requireAuth(next http.Handler) http.Handler {
 		}
 
 		ctx := model.ContextWithUser(r.Context(), user)
+		if target := h.impersonationTarget(r, user); target != nil {
+			ctx = model.ContextWithImpersonator(model.ContextWithUser(r.Context(), target), user)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -128,19 +134,51 @@ func requireRole(allowed ...model.UserRole) func(http.Handler) http.Handler {
 				http.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
-			for _, role := range allowed {
-				if user.Role == role {
-					next.ServeHTTP(w, r)
-					return
-				}
+			if !hasRole(user, allowed) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAPIRole is requireRole for JSON API routes: it rejects requests
+// with a JSON error envelope instead of plain text.
+func requireAPIRole(allowed ...model.UserRole) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := model.UserFromContext(r.Context())
+			if user == nil {
+				writeAPIError(w, http.StatusUnauthorized, apiCodeUnauthorized, "unauthorized")
+				return
 			}
-			http.Error(w, "forbidden", http.StatusForbidden)
+			if !hasRole(user, allowed) {
+				writeAPIError(w, http.StatusForbidden, apiCodeForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// redirectToLogin redirects the user to the login page.
+// hasRole reports whether user has one of the allowed roles.
+func hasRole(user *model.User, allowed []model.UserRole) bool {
+	for _, role := range allowed {
+		if user.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectToLogin redirects the user to the login page. Clients asking for
+// JSON get a 401 with the API error envelope instead.
 func (h *Handler) redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		writeAPIError(w, http.StatusUnauthorized, apiCodeUnauthorized, "unauthorized")
+		return
+	}
 	loginPath := h.path("/login")
 	if r.Header.Get("HX-Request") == "true" {
 		w.Header().Set("HX-Redirect", loginPath)
@@ -220,6 +258,14 @@ func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		Secure:   h.config.SecureCookies,
 	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     impersonationCookieName,
+		Value:    "",
+		Path:     logoutCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.config.SecureCookies,
+	})
 	http.SetCookie(w, &http.Cookie{
 		Name:     csrfCookieName,
 		Value:    "",
@@ -239,3 +285,61 @@ func (h *Handler) renderLoginError(w http.ResponseWriter, r *http.Request) {
 		slog.Error("render error", "error", err)
 	}
 }
+
+// handlePasswordPage serves the form for changing one's own password.
+func (h *Handler) handlePasswordPage(w http.ResponseWriter, r *http.Request) {
+	h.renderPasswordPage(w, r, http.StatusOK, "", false)
+}
+
+// handleChangePassword checks the current password, stores the new one and
+// signs the user out of every other session.
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := model.UserFromContext(r.Context())
+	current := r.FormValue("current_password")
+	newPassword := r.FormValue("new_password")
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)); err != nil {
+		h.renderPasswordPage(w, r, http.StatusBadRequest, appI18n.T(r.Context(), "PasswordWrong"), true)
+		return
+	}
+	if len([]rune(newPassword)) < minPasswordLength {
+		h.renderPasswordPage(w, r, http.StatusBadRequest,
+			appI18n.Td(r.Context(), "PasswordTooShort", map[string]any{"Min": minPasswordLength}), true)
+		return
+	}
+	if newPassword != r.FormValue("confirm_password") {
+		h.renderPasswordPage(w, r, http.StatusBadRequest, appI18n.T(r.Context(), "PasswordMismatch"), true)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		slog.Error("failed to hash password", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.UpdatePassword(user.ID, string(hash)); err != nil {
+		slog.Error("failed to update password", "user_id", user.ID, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// The password may have leaked; keep only the session that changed it.
+	cookie, err := r.Cookie(sessionCookieName)
+	if err == nil {
+		if err := h.store.DeleteOtherAuthSessions(user.ID, cookie.Value); err != nil {
+			slog.Error("failed to delete other sessions", "user_id", user.ID, "error", err)
+		}
+	}
+
+	h.renderPasswordPage(w, r, http.StatusOK, appI18n.T(r.Context(), "PasswordChanged"), false)
+}
+
+// renderPasswordPage renders the password form with an optional flash message.
+func (h *Handler) renderPasswordPage(w http.ResponseWriter, r *http.Request, status int, flashMsg string, flashErr bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := views.PasswordPage(flashMsg, flashErr).Render(r.Context(), w); err != nil {
+		slog.Error("render error", "error", err)
+	}
+}
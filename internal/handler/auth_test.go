@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestChangePassword(t *testing.T) {
+	f := newRouterFixture(t)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("generated1"), bcrypt.MinCost)
+	if err := f.store.UpdatePassword(f.student.ID, string(hash)); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	otherDevice, _ := f.store.CreateAuthSession(f.student.ID)
+
+	if rec := f.do(t, f.student, http.MethodGet, "/account/password"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "current_password") {
+		t.Fatalf("expected the password form, got %d", rec.Code)
+	}
+
+	tests := []struct {
+		name, current, next, confirm, want string
+	}{
+		{"wrong current", "guess", "correct horse", "correct horse", "current password is incorrect"},
+		{"too short", "generated1", "short", "short", "at least 8 characters"},
+		{"mismatch", "generated1", "correct horse", "correct hose", "do not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"current_password": {tt.current}, "new_password": {tt.next}, "confirm_password": {tt.confirm}}
+			rec := f.doForm(t, f.student, http.MethodPost, "/account/password", form)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("expected 400 with %q, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if sess, _ := f.store.GetAuthSession(otherDevice); sess == nil {
+		t.Fatal("a rejected change should not sign out other sessions")
+	}
+
+	form := url.Values{"current_password": {"generated1"}, "new_password": {"correct horse"}, "confirm_password": {"correct horse"}}
+	rec := f.doForm(t, f.student, http.MethodPost, "/account/password", form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Password changed") {
+		t.Fatalf("expected the password changed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	u, _ := f.store.GetUserByID(f.student.ID)
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte("correct horse")) != nil {
+		t.Error("the new password should be stored")
+	}
+	if sess, _ := f.store.GetAuthSession(otherDevice); sess != nil {
+		t.Error("other sessions should be signed out after the change")
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	f := newRouterFixture(t)
+	studentSession, _ := f.store.CreateAuthSession(f.student.ID)
+	path := "/admin/users/" + itoa(f.student.ID) + "/reset-password"
+
+	if rec := f.do(t, f.teacher, http.MethodPost, path); rec.Code != http.StatusForbidden {
+		t.Errorf("teachers should not reset passwords, got %d", rec.Code)
+	}
+
+	rec := f.do(t, f.admin, http.MethodPost, path)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("the page showing the password must not be cached")
+	}
+	m := regexp.MustCompile(`New password for student: (reset-[a-z0-9]+)`).FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatalf("expected the new password shown, got: %s", rec.Body.String())
+	}
+	u, _ := f.store.GetUserByID(f.student.ID)
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(m[1])) != nil {
+		t.Error("the shown password should be the stored one")
+	}
+	if sess, _ := f.store.GetAuthSession(studentSession); sess != nil {
+		t.Error("the student's sessions should be signed out")
+	}
+
+	if rec := f.do(t, f.admin, http.MethodPost, "/admin/users/"+itoa(f.admin.ID)+"/reset-password"); rec.Code != http.StatusBadRequest {
+		t.Errorf("admins should not reset their own password here, got %d", rec.Code)
+	}
+	if rec := f.do(t, f.admin, http.MethodPost, "/admin/users/9999/reset-password"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing user, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestStartExamUsesFixedQuestions(t *testing.T) {
+	f := newRouterFixture(t)
+	if _, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"}); err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	var ids []int64
+	for _, text := range []string{"Q1", "Q2", "Q3"} {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	// The filters match nothing, so only the fixed set can start an exam.
+	f.handler.config.Topic = "Optics"
+
+	rec := f.doForm(t, f.admin, http.MethodPost, "/admin/blueprint/questions", url.Values{"question_ids": {"999"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "No question with ID 999") {
+		t.Errorf("unknown question: expected 400 with the error, got %d", rec.Code)
+	}
+	fixed := fmt.Sprintf("%d, %d %d", ids[2], ids[0], ids[2])
+	if rec := f.doForm(t, f.admin, http.MethodPost, "/admin/blueprint/questions", url.Values{"question_ids": {fixed}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("duplicate question: expected 400, got %d", rec.Code)
+	}
+	fixed = fmt.Sprintf("%d, %d", ids[2], ids[0])
+	rec = f.doForm(t, f.admin, http.MethodPost, "/admin/blueprint/questions", url.Values{"question_ids": {fixed}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Fixed question set saved: 2 questions.") {
+		t.Fatalf("saving the set: expected 200 and the confirmation, got %d", rec.Code)
+	}
+	if rec := f.doForm(t, f.teacher, http.MethodPost, "/admin/blueprint/questions", url.Values{"question_ids": {fixed}}); rec.Code != http.StatusForbidden {
+		t.Errorf("teacher: expected 403, got %d", rec.Code)
+	}
+
+	rec = f.do(t, f.student, http.MethodPost, "/exam/start")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("start: expected 303, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var sessionID int64
+	if _, err := fmt.Sscanf(rec.Header().Get("Location"), "/exam/%d", &sessionID); err != nil {
+		t.Fatalf("unexpected redirect %q", rec.Header().Get("Location"))
+	}
+	threads, err := f.store.GetThreadsForSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetThreadsForSession: %v", err)
+	}
+	if len(threads) != 2 || threads[0].QuestionID != ids[2] || threads[1].QuestionID != ids[0] {
+		t.Errorf("expected questions %d and %d in position order, got %+v", ids[2], ids[0], threads)
+	}
+
+	// Clearing the set brings the filters back.
+	f.doForm(t, f.admin, http.MethodPost, "/admin/blueprint/questions", url.Values{"question_ids": {""}})
+	if rec := f.do(t, f.student, http.MethodPost, "/exam/start"); rec.Code != http.StatusBadRequest {
+		t.Errorf("start with no fixed set and no matching questions: expected 400, got %d", rec.Code)
+	}
+}
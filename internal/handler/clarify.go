@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	appI18n "github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/store"
+)
+
+// clarifyResponse is the JSON body returned by handleClarify to clients
+// asking for application/json.
+type clarifyResponse struct {
+	Clarification string `json:"clarification"`
+	Remaining     int    `json:"remaining"` // Clarifications still allowed on this question
+}
+
+// handleClarify answers a student's request to clarify a question they have
+// not answered yet. The LLM reply is neutral, stored with the request as a
+// clarification exchange, and left out of evaluation, grading and the
+// follow-up count. It is off unless --max-clarifications is set.
+func (h *Handler) handleClarify(w http.ResponseWriter, r *http.Request) {
+	limit := h.config.MaxClarifications
+	if limit <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	request := strings.TrimSpace(r.FormValue("clarification"))
+	if request == "" {
+		http.Error(w, "clarification request cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	a, ok := h.answerTarget(w, r)
+	if !ok {
+		return
+	}
+	messages, err := h.store.GetMessages(a.threadID)
+	if err != nil {
+		slog.Error("failed to get messages", "thread_id", a.threadID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(model.GradedMessages(messages)) > 0 {
+		rejectAnswer(w, r, appI18n.T(r.Context(), "ClarifyAfterAnswer"))
+		return
+	}
+	used := model.CountClarifications(messages)
+	if used >= limit {
+		rejectAnswer(w, r, appI18n.Td(r.Context(), "ClarificationsUsedUp", map[string]any{"Max": strconv.Itoa(limit)}))
+		return
+	}
+
+	ctx, cancel := h.llmContext(r.Context())
+	defer cancel()
+	reply, tokens, err := h.llm.Clarify(ctx, a.question, request, a.sessionID, a.threadID)
+	if timedOut(ctx, err) {
+		slog.Warn("LLM clarification timed out", "thread_id", a.threadID, "timeout", h.config.LLMTimeout)
+		h.writeLLMTimeout(w, r, a)
+		return
+	}
+	if err != nil {
+		slog.Error("LLM clarification failed", "error", err)
+		http.Error(w, "LLM clarification failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The checks above spare the LLM call; the store repeats them with the
+	// insert, in case a concurrent request got there first.
+	err = h.store.AddClarification(a.threadID, request, reply, tokens, limit)
+	switch {
+	case errors.Is(err, store.ErrThreadAnswered):
+		rejectAnswer(w, r, appI18n.T(r.Context(), "ClarifyAfterAnswer"))
+		return
+	case errors.Is(err, store.ErrClarificationsUsedUp):
+		rejectAnswer(w, r, appI18n.Td(r.Context(), "ClarificationsUsedUp", map[string]any{"Max": strconv.Itoa(limit)}))
+		return
+	case err != nil:
+		slog.Error("failed to store clarification", "thread_id", a.threadID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(clarifyResponse{Clarification: reply, Remaining: limit - used - 1})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.renderThread(r.Context(), w, a); err != nil {
+		slog.Error("render error", "error", err)
+	}
+}
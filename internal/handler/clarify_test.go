@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestHandleClarify(t *testing.T) {
+	f := newAnswerFixture(t, false)
+	f.clarify = true
+	f.text = "Does rotation count?"
+
+	if rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en"); rec.Code != http.StatusNotFound {
+		t.Fatalf("clarifications are off by default; expected 404, got %d", rec.Code)
+	}
+
+	cfg := model.ExamConfig{MaxFollowups: 3, MaxClarifications: 2}
+	rec := f.answer(t, cfg, "en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "Clarification request") || !strings.Contains(body, "Linear motion is enough.") || !strings.Contains(body, "message-clarification") {
+		t.Errorf("the thread should show the clarification exchange apart from graded messages:\n%s", body)
+	}
+	if !strings.Contains(body, "Left for this question: 1") {
+		t.Error("the thread should offer the one remaining clarification")
+	}
+	if !strings.Contains((*f.prompts)[0], "Does rotation count?") {
+		t.Errorf("the clarification prompt should carry the request, got %q", (*f.prompts)[0])
+	}
+	messages, _ := f.store.GetMessages(f.threadID)
+	if len(messages) != 2 || messages[0].Role != model.RoleClarifyRequest || messages[1].Role != model.RoleClarification || messages[1].TokenCount != 42 {
+		t.Fatalf("expected the request and reply stored as a clarification, got %+v", messages)
+	}
+	if thread, _ := f.store.GetThread(f.threadID); thread.Status != model.ThreadOpen {
+		t.Errorf("a clarification must leave the thread open, got %q", thread.Status)
+	}
+
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("second clarification: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = f.answer(t, cfg, "en")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "all 2 clarifications") {
+		t.Errorf("expected 400 once the clarifications are used up, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The answer is evaluated with the full follow-up budget.
+	f.clarify = false
+	f.text = ""
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("answer: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	eval := (*f.prompts)[len(*f.prompts)-1]
+	if !strings.Contains(eval, "MAY ask ONE follow-up") || strings.Contains(eval, "Does rotation count?") {
+		t.Errorf("clarifications must neither use up follow-ups nor reach the evaluator:\n%s", eval)
+	}
+
+	f.clarify = true
+	f.text = "One more thing?"
+	rec = f.answer(t, cfg, "ru")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "только до ответа") {
+		t.Errorf("expected a localized 400 after answering, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGradeSessionIgnoresClarifications(t *testing.T) {
+	f := newAnswerFixture(t, false)
+	f.clarify = true
+	f.text = "Does rotation count?"
+	cfg := model.ExamConfig{MaxFollowups: 3, MaxClarifications: 1}
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	h := &Handler{store: f.store, llm: f.llmClient, config: cfg}
+	if err := h.gradeSession(t.Context(), f.sessionID); err != nil {
+		t.Fatalf("gradeSession: %v", err)
+	}
+	if *f.llmCalls != 1 {
+		t.Errorf("a thread with only clarifications must not be sent for grading, got %d LLM calls", *f.llmCalls)
+	}
+	score, err := f.store.GetScore(f.threadID)
+	if err != nil || score == nil {
+		t.Fatalf("GetScore: %v (%v)", err, score)
+	}
+	if score.LLMScore != 0 || score.LLMFeedback != "No answer provided." {
+		t.Errorf("expected the unanswered-question score, got %+v", score)
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pavelanni/examiner/internal/handler/views"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// dashboardRecent is how many handed-in sessions the dashboard lists.
+const dashboardRecent = 10
+
+// handleDashboard renders the staff home page (--staff-dashboard): how many
+// sessions wait for review, are being graded or taken, and the latest ones
+// handed in.
+func (h *Handler) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	var d model.DashboardView
+	for _, c := range []struct {
+		n      *int
+		status model.SessionStatus
+	}{
+		{&d.PendingReview, model.StatusGraded},
+		{&d.Grading, model.StatusGrading},
+		{&d.InProgress, model.StatusInProgress},
+		{&d.Reviewed, model.StatusReviewed},
+	} {
+		n, err := h.store.CountSessions(model.SessionFilter{Statuses: []model.SessionStatus{c.status}})
+		if err != nil {
+			slog.Error("failed to count sessions for dashboard", "status", c.status, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		*c.n = n
+	}
+
+	recent, err := h.store.ListSessionsPaged(model.SessionFilter{
+		Statuses: []model.SessionStatus{model.StatusSubmitted, model.StatusGrading, model.StatusGraded, model.StatusReviewed},
+	}, dashboardRecent, 0)
+	if err != nil {
+		slog.Error("failed to list recent sessions for dashboard", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.Recent = recent
+
+	students, err := h.sessionStudents(recent)
+	if err != nil {
+		slog.Error("failed to get students for dashboard", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := views.DashboardPage(d, students, h.config.StudentIdentifier).Render(r.Context(), w); err != nil {
+		slog.Error("render error", "error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestIndexDashboardForStaff(t *testing.T) {
+	f := newRouterFixture(t)
+	f.handler.config.StaffDashboard = true
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	var sessions []int64
+	for _, status := range []model.SessionStatus{model.StatusGraded, model.StatusGraded, model.StatusInProgress} {
+		id, err := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		if status != model.StatusInProgress {
+			if err := f.store.UpdateSessionStatus(id, model.StatusSubmitted); err != nil {
+				t.Fatalf("UpdateSessionStatus: %v", err)
+			}
+		}
+		if err := f.store.UpdateSessionStatus(id, status); err != nil {
+			t.Fatalf("UpdateSessionStatus: %v", err)
+		}
+		sessions = append(sessions, id)
+	}
+
+	for _, u := range []*model.User{f.teacher, f.admin} {
+		body := f.do(t, u, http.MethodGet, "/").Body.String()
+		for _, want := range []string{
+			"Dashboard",
+			"Waiting for review</header><a href=\"/review\"><strong>2</strong>",
+			"In progress</header><strong>1</strong>",
+			"Recent submissions",
+			"/review/" + itoa(sessions[1]),
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: dashboard missing %q", u.Username, want)
+			}
+		}
+		// In-progress sessions are not submissions.
+		if strings.Contains(body, "/review/"+itoa(sessions[2])) {
+			t.Errorf("%s: the in-progress session should not be listed", u.Username)
+		}
+		if isAdmin := strings.Contains(body, "/admin/questions"); isAdmin != (u.Role == model.UserRoleAdmin) {
+			t.Errorf("%s: admin links shown = %v", u.Username, isAdmin)
+		}
+	}
+
+	body := f.do(t, f.student, http.MethodGet, "/").Body.String()
+	if strings.Contains(body, "Waiting for review") || !strings.Contains(body, "/exam/"+itoa(sessions[2])) {
+		t.Error("a student should see their own session list, not the dashboard")
+	}
+
+	f.handler.config.StaffDashboard = false
+	if body := f.do(t, f.teacher, http.MethodGet, "/").Body.String(); strings.Contains(body, "Waiting for review") {
+		t.Error("without --staff-dashboard teachers should get the session list")
+	}
+}
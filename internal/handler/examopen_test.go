@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestExamClosedBlocksStartsButNotReview(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, err := f.store.GetThreadsForSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetThreadsForSession: %v", err)
+	}
+
+	rec := f.doForm(t, f.admin, http.MethodPost, "/admin/exam/open", url.Values{"open": {"0"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("closing the exam: expected 200, got %d", rec.Code)
+	}
+	if open, err := f.store.ExamOpen(); err != nil || open {
+		t.Fatalf("expected the exam to be closed, got open=%v err=%v", open, err)
+	}
+
+	rec = f.do(t, f.student, http.MethodPost, "/exam/start")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "exam is closed") {
+		t.Errorf("starting a closed exam: expected 403 with the closed message, got %d %q", rec.Code, rec.Body.String())
+	}
+	answerPath := fmt.Sprintf("/exam/%d/answer/%d", sessionID, threads[0].ID)
+	rec = f.doForm(t, f.student, http.MethodPost, answerPath, url.Values{"answer": {"Inertia"}})
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "exam is closed") {
+		t.Errorf("answering a closed exam: expected 403 with the closed message, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := f.do(t, f.student, http.MethodGet, "/"); !strings.Contains(rec.Body.String(), "exam is closed") {
+		t.Error("the index page should say the exam is closed")
+	}
+
+	// Submitting, results and review stay available.
+	if rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", sessionID)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("submitting while closed: expected 303, got %d", rec.Code)
+	}
+	if rec := f.do(t, f.student, http.MethodGet, fmt.Sprintf("/results/%d", sessionID)); rec.Code != http.StatusOK {
+		t.Errorf("results while closed: expected 200, got %d", rec.Code)
+	}
+	if rec := f.do(t, f.teacher, http.MethodGet, fmt.Sprintf("/review/%d", sessionID)); rec.Code != http.StatusOK {
+		t.Errorf("review while closed: expected 200, got %d", rec.Code)
+	}
+
+	f.doForm(t, f.admin, http.MethodPost, "/admin/exam/open", url.Values{"open": {"1"}})
+	if rec := f.do(t, f.student, http.MethodPost, "/exam/start"); rec.Code != http.StatusSeeOther {
+		t.Errorf("starting after reopening: expected 303, got %d", rec.Code)
+	}
+}
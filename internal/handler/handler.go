@@ -1,20 +1,31 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	"io"
 	"log/slog"
-	"math/rand/v2"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pavelanni/examiner/internal/handler/views"
+	appI18n "github.com/pavelanni/examiner/internal/i18n"
 	"github.com/pavelanni/examiner/internal/llm"
+	"github.com/pavelanni/examiner/internal/metrics"
 	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/report"
 	"github.com/pavelanni/examiner/internal/store"
 	jsonschema "github.com/santhosh-tekuri/jsonschema/v5"
 )
@@ -25,6 +36,20 @@ type Handler struct {
 	llm            *llm.Client
 	config         model.ExamConfig
 	questionSchema *jsonschema.Schema
+
+	// impersonationKey signs "view as" tokens; it is regenerated on every
+	// start, so impersonation never outlives the process.
+	impersonationKey []byte
+
+	answerLimiter rateLimiter   // Per-student answer budget (--answer-rate-limit)
+	grading       gradingBroker // Grading progress for /grading-events
+
+	metrics *metrics.Metrics // Prometheus metrics (--metrics); nil when off
+
+	// reportFont draws PDF transcripts. It is loaded once in New;
+	// reportFontErr says why it is missing, for the PDF route to report.
+	reportFont    *report.Font
+	reportFontErr error
 }
 
 // New creates a new Handler.
@@ -33,7 +58,21 @@ func New(s *store.Store, l *llm.Client, cfg model.ExamConfig) (*Handler, error)
 	if err != nil {
 		return nil, fmt.Errorf("compile question schema: %w", err)
 	}
-	return &Handler{store: s, llm: l, config: cfg, questionSchema: schema}, nil
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate impersonation key: %w", err)
+	}
+	h := &Handler{store: s, llm: l, config: cfg, questionSchema: schema, impersonationKey: key}
+	h.reportFont, h.reportFontErr = report.LoadFont(cfg.ReportFont)
+	if h.reportFontErr != nil && cfg.ReportFont != "" {
+		slog.Warn("failed to load report font; PDF transcripts are unavailable", "path", cfg.ReportFont, "error", h.reportFontErr)
+	}
+	return h, nil
+}
+
+// SetMetrics makes the handler count exams in m and serve them on /metrics.
+func (h *Handler) SetMetrics(m *metrics.Metrics) {
+	h.metrics = m
 }
 
 func compileQuestionSchema() (*jsonschema.Schema, error) {
@@ -54,13 +93,13 @@ func compileQuestionSchema() (*jsonschema.Schema, error) {
 	return compiler.Compile(schemaURL)
 }
 
-// calculateTimeRemaining returns remaining exam time.
-// Returns -1 if no limit is set, 0 if the limit has been exceeded.
-func calculateTimeRemaining(session model.ExamSession, blueprint model.ExamBlueprint) time.Duration {
-	if blueprint.TimeLimit <= 0 {
+// calculateTimeRemaining returns remaining exam time under the effective
+// limit. Returns -1 if no limit is set, 0 if the limit has been exceeded.
+func calculateTimeRemaining(session model.ExamSession, blueprint model.ExamBlueprint, maxDuration time.Duration) time.Duration {
+	limit := model.EffectiveTimeLimit(blueprint, maxDuration)
+	if limit <= 0 {
 		return -1 // no limit
 	}
-	limit := time.Duration(blueprint.TimeLimit) * time.Minute
 	elapsed := time.Since(session.StartedAt)
 	remaining := limit - elapsed
 	if remaining < 0 {
@@ -69,6 +108,14 @@ func calculateTimeRemaining(session model.ExamSession, blueprint model.ExamBluep
 	return remaining
 }
 
+// pastExamCeiling reports whether an in-progress session has run past
+// --max-exam-duration and must be submitted automatically.
+func (h *Handler) pastExamCeiling(session model.ExamSession) bool {
+	return h.config.MaxExamDuration > 0 &&
+		session.Status == model.StatusInProgress &&
+		time.Since(session.StartedAt) >= h.config.MaxExamDuration
+}
+
 // BasePathMiddleware injects the base path into the request context.
 func (h *Handler) BasePathMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -77,6 +124,22 @@ func (h *Handler) BasePathMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// ownsSession reports whether user took sess. Ownership is decided by
+// student_id alone, so it survives a role change (e.g. a student promoted to
+// teacher mid-exam). Only the owner may answer or submit.
+func ownsSession(user *model.User, sess model.ExamSession) bool {
+	return user != nil && sess.StudentID == user.ID
+}
+
+// canViewSession reports whether user may open the exam page for sess:
+// its owner, or any teacher or admin.
+func canViewSession(user *model.User, sess model.ExamSession) bool {
+	if ownsSession(user, sess) {
+		return true
+	}
+	return user != nil && (user.Role == model.UserRoleTeacher || user.Role == model.UserRoleAdmin)
+}
+
 // path prepends the base path to the given path.
 func (h *Handler) path(p string) string {
 	return h.config.BasePath + p
@@ -84,6 +147,13 @@ func (h *Handler) path(p string) string {
 
 // Routes registers all HTTP routes.
 func (h *Handler) Routes(r chi.Router) {
+	// Deployment probes, outside auth and CSRF.
+	r.Get("/healthz", h.handleHealthz)
+	r.Get("/readyz", h.handleReadyz)
+	if h.metrics != nil {
+		r.Handle("/metrics", h.metrics.Handler())
+	}
+
 	// Public routes (login).
 	r.Group(func(r chi.Router) {
 		r.Use(h.csrfMiddleware)
@@ -97,49 +167,88 @@ func (h *Handler) Routes(r chi.Router) {
 		r.Use(h.csrfMiddleware)
 
 		r.Post("/logout", h.handleLogout)
-		r.Get("/", h.handleIndex)
-		r.Get("/exam/{sessionID}", h.handleExamPage)
-		r.Post("/exam/start", h.handleStartExam)
-		r.Post("/exam/{sessionID}/answer/{threadID}", h.handleAnswer)
-		r.Post("/exam/{sessionID}/submit", h.handleSubmit)
-		r.Get("/results/{sessionID}", h.handleStudentResults)
-
-		// Teacher + admin routes.
-		r.Group(func(r chi.Router) {
-			r.Use(requireRole(model.UserRoleTeacher, model.UserRoleAdmin))
-			r.Get("/review", h.handleReviewList)
-			r.Get("/review/{sessionID}", h.handleReviewPage)
-			r.Post("/review/{sessionID}/score/{threadID}", h.handleUpdateScore)
-			r.Post("/review/{sessionID}/finalize", h.handleFinalize)
-			r.Get("/teacher/me", h.handleTeacherMe)
-			r.Get("/teacher/profile", h.handleTeacherProfile)
-			r.Get("/teacher/create-test", h.handleTeacherCreateTest)
-			r.Post("/teacher/tests", h.handleTeacherUpload)
-			r.Get("/teacher/tests/file/{name}", h.handleTeacherDownload)
-		})
+		r.Post("/impersonate/stop", h.handleStopImpersonation)
 
-		// Admin-only routes.
+		// Everything below is read-only while an admin is impersonating.
 		r.Group(func(r chi.Router) {
-			r.Use(requireRole(model.UserRoleAdmin))
-			r.Get("/admin/users", h.handleAdminUsersPage)
-			r.Post("/admin/users", h.handleCreateUser)
-			r.Post("/admin/users/{userID}/toggle", h.handleToggleUserActive)
-			r.Get("/admin/questions", h.handleAdminQuestionsPage)
-			r.Post("/admin/questions", h.handleUploadQuestions)
+			r.Use(impersonationReadOnly)
+
+			r.Get("/", h.handleIndex)
+			r.Get("/exam/{sessionID}", h.handleExamPage)
+			r.Post("/exam/preview", h.handlePreviewExam)
+			r.Post("/exam/start", h.handleStartExam)
+			r.With(h.limitAnswers).Post("/exam/{sessionID}/answer/{threadID}", h.handleAnswer)
+			r.With(h.limitAnswers).Post("/exam/{sessionID}/answer/{threadID}/stream", h.handleAnswerStream)
+			r.With(h.limitAnswers).Post("/exam/{sessionID}/answer/{threadID}/evaluate", h.handleEvaluateAnswer)
+			r.With(h.limitAnswers).Post("/exam/{sessionID}/clarify/{threadID}", h.handleClarify)
+			r.Post("/exam/{sessionID}/submit", h.handleSubmit)
+			r.Get("/exam/{sessionID}/grading-events", h.handleGradingEvents)
+			r.Get("/results/{sessionID}", h.handleStudentResults)
+			r.Get("/verify/{code}", h.handleVerifyReceipt)
+			r.Get("/account/password", h.handlePasswordPage)
+			r.Post("/account/password", h.handleChangePassword)
+
+			// Teacher + admin routes.
+			r.Group(func(r chi.Router) {
+				r.Use(requireRole(model.UserRoleTeacher, model.UserRoleAdmin))
+				r.Get("/review", h.handleReviewList)
+				r.Get("/review/{sessionID}", h.handleReviewPage)
+				r.Get("/review/{sessionID}/transcript", h.handleTranscript)
+				r.Post("/review/{sessionID}/score/{threadID}", h.handleUpdateScore)
+				r.Post("/review/{sessionID}/finalize", h.handleFinalize)
+				r.Post("/review/{sessionID}/redeliver", h.handleRedeliver)
+				r.Post("/review/{sessionID}/regrade", h.handleRegrade)
+				r.Post("/review/{sessionID}/questions", h.handleAddQuestion)
+				r.Get("/teacher/me", h.handleTeacherMe)
+				r.Get("/teacher/profile", h.handleTeacherProfile)
+				r.Get("/teacher/create-test", h.handleTeacherCreateTest)
+				r.Post("/teacher/tests", h.handleTeacherUpload)
+				r.Get("/teacher/tests/file/{name}", h.handleTeacherDownload)
+			})
+
+			// JSON API for teachers and admins. Errors use the apiError envelope.
+			r.Group(func(r chi.Router) {
+				r.Use(requireAPIRole(model.UserRoleTeacher, model.UserRoleAdmin))
+				r.Get("/api/sessions", h.handleAPISessions)
+				r.Get("/api/sessions/{sessionID}", h.handleAPISession)
+			})
+
+			// Admin-only routes.
+			r.Group(func(r chi.Router) {
+				r.Use(requireRole(model.UserRoleAdmin))
+				r.Get("/admin/users", h.handleAdminUsersPage)
+				r.Post("/admin/users", h.handleCreateUser)
+				r.Get("/admin/users/{userID}", h.handleStudentHistory)
+				r.Post("/admin/users/{userID}/toggle", h.handleToggleUserActive)
+				r.Post("/admin/users/{userID}/cohort", h.handleSetUserCohort)
+				r.Post("/admin/users/{userID}/reset-password", h.handleResetPassword)
+				r.Post("/admin/users/{userID}/impersonate", h.handleStartImpersonation)
+				r.Post("/admin/sessions/purge", h.handlePurgeSessions)
+				r.Post("/admin/sessions/{sessionID}/delete", h.handleDeleteSession)
+				r.Post("/admin/prompts/reload", h.handleReloadPrompts)
+				r.Post("/admin/exam/open", h.handleSetExamOpen)
+				r.Post("/admin/blueprint/questions", h.handleSetBlueprintQuestions)
+				r.Get("/admin/questions", h.handleAdminQuestionsPage)
+				r.Post("/admin/questions", h.handleUploadQuestions)
+				r.Get("/admin/questions/{questionID}/edit", h.handleEditQuestionPage)
+				r.Post("/admin/questions/{questionID}", h.handleUpdateQuestion)
+			})
 		})
 	})
 }
 
 func (h *Handler) handleIndex(w http.ResponseWriter, r *http.Request) {
 	user := model.UserFromContext(r.Context())
+	if h.config.StaffDashboard && user.Role != model.UserRoleStudent {
+		h.handleDashboard(w, r)
+		return
+	}
 
-	var sessions []model.ExamSession
-	var err error
+	var filter model.SessionFilter
 	if user.Role == model.UserRoleStudent {
-		sessions, err = h.store.ListSessionsByUser(user.ID)
-	} else {
-		sessions, err = h.store.ListSessions()
+		filter.StudentID = user.ID
 	}
+	sessions, page, err := h.sessionPage(r, filter)
 	if err != nil {
 		slog.Error("failed to list sessions", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -168,7 +277,7 @@ func (h *Handler) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Count questions matching the configured filters.
-	filtered, err := h.store.ListQuestionsFiltered(h.config.Difficulty, h.config.Topic)
+	filtered, err := h.store.ListQuestionsFiltered(h.config.Difficulty, h.config.Topic, h.config.Tag)
 	if err != nil {
 		slog.Error("failed to list filtered questions", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -179,66 +288,231 @@ func (h *Handler) handleIndex(w http.ResponseWriter, r *http.Request) {
 	if h.config.NumQuestions > 0 && h.config.NumQuestions < availableCount {
 		examCount = h.config.NumQuestions
 	}
+	if total := h.config.DifficultyMix.Total(); total > 0 {
+		examCount = total
+	}
+	// A fixed blueprint question set replaces the filters.
+	fixed, err := h.store.BlueprintQuestions(1)
+	if err != nil {
+		slog.Error("failed to get blueprint questions", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(fixed) > 0 {
+		availableCount, examCount = len(fixed), len(fixed)
+	}
+
+	open, err := h.store.ExamOpen()
+	if err != nil {
+		slog.Error("failed to read exam open setting", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := views.IndexPage(sessions, availableCount, examCount, h.config, topics).Render(r.Context(), w); err != nil {
+	if err := views.IndexPage(sessions, page, availableCount, examCount, h.config, topics, open).Render(r.Context(), w); err != nil {
 		slog.Error("render error", "error", err)
 	}
 }
 
 func (h *Handler) handleStartExam(w http.ResponseWriter, r *http.Request) {
-	// Use topic from form (dropdown) if provided, otherwise fall back to CLI flag.
-	topic := r.FormValue("topic")
-	if topic == "" {
-		topic = h.config.Topic
+	user := model.UserFromContext(r.Context())
+	if !h.requireExamOpen(w, r) {
+		return
+	}
+
+	// With --confirm-start the question set was locked by handlePreviewExam.
+	var questionIDs []int64
+	if h.config.ConfirmStart {
+		preview, err := h.store.GetExamPreview(user.ID)
+		if err != nil {
+			slog.Error("failed to get exam preview", "user_id", user.ID, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if preview == nil {
+			http.Error(w, "Preview the exam before starting it.", http.StatusBadRequest)
+			return
+		}
+		questionIDs = preview.QuestionIDs
+	} else {
+		var ok bool
+		questionIDs, ok = h.selectExamQuestionIDs(w, user.ID, h.examTopic(r))
+		if !ok {
+			return
+		}
 	}
 
-	questions, err := h.store.ListQuestionsFiltered(h.config.Difficulty, topic)
+	sessionID, err := h.store.CreateSession(1, user.ID, questionIDs)
 	if err != nil {
-		slog.Error("failed to list questions for exam", "error", err)
+		slog.Error("failed to create session", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if len(questions) == 0 {
-		http.Error(w, "No questions match the configured filters.", http.StatusBadRequest)
+	h.metrics.ExamStarted()
+	if h.config.ConfirmStart {
+		if err := h.store.DeleteExamPreview(user.ID); err != nil {
+			slog.Warn("failed to delete exam preview", "user_id", user.ID, "error", err)
+		}
+	}
+
+	http.Redirect(w, r, h.path(fmt.Sprintf("/exam/%d", sessionID)), http.StatusSeeOther)
+}
+
+// handlePreviewExam locks the question set for the student's next exam and
+// shows how many questions it has. Reloading, even with another topic,
+// shows the same locked set; the session is only created when the student
+// confirms via handleStartExam.
+func (h *Handler) handlePreviewExam(w http.ResponseWriter, r *http.Request) {
+	user := model.UserFromContext(r.Context())
+	if !h.requireExamOpen(w, r) {
 		return
 	}
 
-	// Deduplicate questions by text (guards against legacy DB duplicates).
-	seen := make(map[string]bool, len(questions))
-	unique := questions[:0]
-	for _, q := range questions {
-		if !seen[q.Text] {
-			seen[q.Text] = true
-			unique = append(unique, q)
+	preview, err := h.store.GetExamPreview(user.ID)
+	if err != nil {
+		slog.Error("failed to get exam preview", "user_id", user.ID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if preview == nil {
+		topic := h.examTopic(r)
+		questionIDs, ok := h.selectExamQuestionIDs(w, user.ID, topic)
+		if !ok {
+			return
+		}
+		preview = &model.ExamPreview{UserID: user.ID, Topic: topic, QuestionIDs: questionIDs}
+		if err := h.store.SaveExamPreview(*preview); err != nil {
+			slog.Error("failed to save exam preview", "user_id", user.ID, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 	}
-	questions = unique
 
-	if h.config.Shuffle {
-		rand.Shuffle(len(questions), func(i, j int) {
-			questions[i], questions[j] = questions[j], questions[i]
-		})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := views.ExamPreviewPage(*preview).Render(r.Context(), w); err != nil {
+		slog.Error("render error", "error", err)
 	}
+}
 
-	if h.config.NumQuestions > 0 && h.config.NumQuestions < len(questions) {
-		questions = questions[:h.config.NumQuestions]
+// requireExamOpen writes a 403 with the localized "exam is closed" message
+// and returns false if an admin has closed the exam.
+func (h *Handler) requireExamOpen(w http.ResponseWriter, r *http.Request) bool {
+	open, err := h.store.ExamOpen()
+	if err != nil {
+		slog.Error("failed to read exam open setting", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
 	}
+	if !open {
+		http.Error(w, appI18n.T(r.Context(), "ExamClosed"), http.StatusForbidden)
+	}
+	return open
+}
 
-	var questionIDs []int64
-	for _, q := range questions {
-		questionIDs = append(questionIDs, q.ID)
+// examTopic returns the topic chosen in the start form, falling back to --topic.
+func (h *Handler) examTopic(r *http.Request) string {
+	if topic := r.FormValue("topic"); topic != "" {
+		return topic
 	}
+	return h.config.Topic
+}
 
-	user := model.UserFromContext(r.Context())
-	sessionID, err := h.store.CreateSession(1, user.ID, questionIDs)
+// selectExamQuestionIDs picks the questions for studentID's new exam on
+// topic. When the exam blueprint has a fixed question set, every student
+// gets exactly that set, in position order unless --shuffle is on, and the
+// filters and required topics are ignored. On failure it writes the error
+// response and returns false.
+func (h *Handler) selectExamQuestionIDs(w http.ResponseWriter, studentID int64, topic string) ([]int64, bool) {
+	questions, err := h.store.BlueprintQuestions(1)
 	if err != nil {
-		slog.Error("failed to create session", "error", err)
+		slog.Error("failed to get blueprint questions", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, false
+	}
+	if len(questions) > 0 {
+		if h.config.Shuffle {
+			shuffleQuestions(questions)
+		}
+		return questionIDs(questions), true
 	}
 
-	http.Redirect(w, r, h.path(fmt.Sprintf("/exam/%d", sessionID)), http.StatusSeeOther)
+	questions, err = h.store.ListQuestionsFiltered(h.config.Difficulty, topic, h.config.Tag)
+	if err != nil {
+		slog.Error("failed to list questions for exam", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if len(questions) == 0 {
+		http.Error(w, "No questions match the configured filters.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var repeats map[int64]bool
+	if h.config.AvoidRepeats {
+		if repeats, err = h.store.SeenQuestionIDs(studentID, 1); err != nil {
+			slog.Error("failed to get previously seen questions", "student_id", studentID, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+
+	var recentTopics map[string]int
+	if h.config.TopicVariety > 0 {
+		if recentTopics, err = h.store.RecentTopics(studentID, h.config.TopicVariety); err != nil {
+			slog.Error("failed to get recently practiced topics", "student_id", studentID, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+
+	if len(h.config.DifficultyMix) > 0 {
+		questions, err = selectByDifficultyMix(h.config.DifficultyMix, h.config.Shuffle, repeats, recentTopics, func(d model.Difficulty) ([]model.Question, error) {
+			return h.store.ListQuestionsFiltered(string(d), topic, h.config.Tag)
+		})
+	} else {
+		questions, err = selectQuestions(questions, h.config.NumQuestions, h.config.InsufficientQuestions, h.config.Shuffle, repeats, recentTopics, func() ([]model.Question, error) {
+			return h.store.ListQuestionsFiltered(h.config.Difficulty, "", h.config.Tag)
+		})
+	}
+	if errors.Is(err, errInsufficientQuestions) {
+		slog.Warn("refusing to start exam", "topic", topic, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("failed to select exam questions", "topic", topic, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if len(h.config.RequiredTopics) > 0 {
+		pool, err := h.store.ListQuestionsFiltered(h.config.Difficulty, "", h.config.Tag)
+		if err != nil {
+			slog.Error("failed to list questions for required topics", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		if h.config.Shuffle {
+			shuffleQuestions(pool)
+		}
+		questions, err = coverRequiredTopics(questions, h.config.NumQuestions, h.config.RequiredTopics, unseenFirst(pool, repeats))
+		if err != nil {
+			slog.Warn("refusing to start exam", "topic", topic, "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return questionIDs(questions), true
+}
+
+// questionIDs returns the IDs of questions in order.
+func questionIDs(questions []model.Question) []int64 {
+	ids := make([]int64, 0, len(questions))
+	for _, q := range questions {
+		ids = append(ids, q.ID)
+	}
+	return ids
 }
 
 func (h *Handler) handleExamPage(w http.ResponseWriter, r *http.Request) {
@@ -256,16 +530,25 @@ func (h *Handler) handleExamPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := model.UserFromContext(r.Context())
-	if user.Role == model.UserRoleStudent && view.Session.StudentID != user.ID {
+	if !canViewSession(user, view.Session) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
-	timeRemaining := calculateTimeRemaining(view.Session, view.Blueprint)
+	// A session past its ceiling renders as closed: a GET never submits it,
+	// so an admin viewing as the student cannot change it. The next answer
+	// or submit, or the overdue sweep, submits it.
+	timeRemaining := calculateTimeRemaining(view.Session, view.Blueprint, h.config.MaxExamDuration)
 	pageView := model.ExamPageView{
-		SessionView:   *view,
-		TimeRemaining: timeRemaining,
-		TimeExceeded:  timeRemaining == 0,
+		SessionView:    *view,
+		TimeRemaining:  timeRemaining,
+		TimeExceeded:   timeRemaining == 0,
+		HasTimeLimit:   timeRemaining >= 0,
+		Stream:         h.config.StreamFeedback && !h.config.NoFollowups && h.editWindow() == 0,
+		EditWindow:     h.editWindow(),
+		Clarifications: max(h.config.MaxClarifications, 0),
+		Grading: ownsSession(user, view.Session) &&
+			(view.Session.Status == model.StatusSubmitted || view.Session.Status == model.StatusGrading),
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -274,137 +557,442 @@ func (h *Handler) handleExamPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// answerResponse is the JSON body returned by handleAnswer when the client
+// asks for application/json instead of the HTML thread partial.
+type answerResponse struct {
+	ThreadStatus     model.ThreadStatus `json:"thread_status"`
+	Feedback         string             `json:"feedback"`
+	NeedFollowup     bool               `json:"need_followup"`
+	FollowupQuestion string             `json:"followup_question"`
+}
+
+// wantsJSON reports whether the request prefers a JSON response.
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// pendingAnswer is a stored student answer awaiting evaluation.
+type pendingAnswer struct {
+	sessionID int64
+	threadID  int64
+	answerID  int64 // The answer's message; set once it is stored
+	session   model.ExamSession
+	blueprint model.ExamBlueprint
+	question  model.Question
+}
+
 func (h *Handler) handleAnswer(w http.ResponseWriter, r *http.Request) {
-	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
-	threadID, _ := strconv.ParseInt(chi.URLParam(r, "threadID"), 10, 64)
+	a, ok := h.acceptAnswer(w, r)
+	if !ok {
+		return
+	}
 
+	// Within the edit window the answer waits; the thread partial lets the
+	// student fix it and asks for the evaluation once the window closes.
+	// JSON clients have no such timer and are evaluated at once.
+	if h.editWindow() > 0 && !wantsJSON(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := h.renderThread(r.Context(), w, a); err != nil {
+			slog.Error("render error", "error", err)
+		}
+		return
+	}
+	if !h.claimAnswer(w, a) {
+		return
+	}
+	if !h.evaluateAnswer(w, r, a) {
+		h.releaseAnswer(a)
+	}
+}
+
+// handleEvaluateAnswer evaluates a thread's answer once its edit window has
+// closed. If the answer was already evaluated it just renders the thread, so
+// a repeated request does not cost a second evaluation.
+func (h *Handler) handleEvaluateAnswer(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.answerTarget(w, r)
+	if !ok {
+		return
+	}
+	messages, err := h.store.GetMessages(a.threadID)
+	if err != nil {
+		slog.Error("failed to get messages", "thread_id", a.threadID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !model.AwaitingEvaluation(messages) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := h.renderThread(r.Context(), w, a); err != nil {
+			slog.Error("render error", "error", err)
+		}
+		return
+	}
+
+	a.answerID = messages[len(messages)-1].ID
+	if !h.claimAnswer(w, a) {
+		return
+	}
+	if !h.evaluateAnswer(w, r, a) {
+		h.releaseAnswer(a)
+	}
+}
+
+// claimAnswer claims a's answer for evaluation, so concurrent requests do
+// not evaluate it twice and the student can no longer edit it. If another
+// request holds the claim it answers 409 and returns false.
+func (h *Handler) claimAnswer(w http.ResponseWriter, a *pendingAnswer) bool {
+	staleBefore := time.Now().Add(-max(evaluationClaimTTL, 2*h.config.LLMTimeout))
+	claimed, err := h.store.ClaimEvaluation(a.answerID, staleBefore)
+	if err != nil {
+		slog.Error("failed to claim evaluation", "thread_id", a.threadID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !claimed {
+		http.Error(w, "answer is already being evaluated", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// releaseAnswer drops the claim on a's answer after a failed evaluation, so
+// the student's retry can evaluate it.
+func (h *Handler) releaseAnswer(a *pendingAnswer) {
+	if err := h.store.ReleaseEvaluation(a.answerID); err != nil {
+		slog.Error("failed to release evaluation", "thread_id", a.threadID, "error", err)
+	}
+}
+
+// evaluationClaimTTL is how long a claimed evaluation keeps other requests
+// away before it is assumed abandoned, e.g. by a restart mid-call.
+const evaluationClaimTTL = 5 * time.Minute
+
+// editWindow returns how long new answers stay editable. Single-answer mode
+// has no evaluation to hold back, so it has no window.
+func (h *Handler) editWindow() time.Duration {
+	if h.config.NoFollowups {
+		return 0
+	}
+	return h.config.AnswerEditWindow
+}
+
+// evaluateAnswer runs the LLM evaluation of the thread's latest answer,
+// stores it and writes the updated thread as HTML or JSON. It reports
+// whether the evaluation was stored.
+func (h *Handler) evaluateAnswer(w http.ResponseWriter, r *http.Request, a *pendingAnswer) bool {
+	// In single-answer mode the thread is completed without an evaluation
+	// call; it is scored by GradeThread when the exam is submitted.
+	var result *llm.GradeResult
+	if !h.config.NoFollowups {
+		messages, err := h.store.GetMessages(a.threadID)
+		if err != nil {
+			slog.Error("failed to get messages", "thread_id", a.threadID, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+
+		// The answer is already stored: finish its evaluation even if the
+		// client disconnects, bounded only by the LLM timeout.
+		ctx, cancel := h.llmContext(context.WithoutCancel(r.Context()))
+		defer cancel()
+		result, _, err = h.llm.EvaluateAnswer(ctx, a.question, messages, a.question.FollowupLimit(a.blueprint.MaxFollowups), a.sessionID, a.threadID)
+		if timedOut(ctx, err) {
+			slog.Warn("LLM evaluation timed out", "thread_id", a.threadID, "timeout", h.config.LLMTimeout)
+			h.writeLLMTimeout(w, r, a)
+			return false
+		}
+		if err != nil {
+			slog.Error("LLM evaluation failed", "error", err)
+			http.Error(w, "LLM evaluation failed: "+err.Error(), http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	resp, err := h.finishAnswer(a.threadID, result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.renderThread(r.Context(), w, a); err != nil {
+		slog.Error("render error", "error", err)
+	}
+	return true
+}
+
+// llmContext derives the context for one LLM call from parent, bounded by
+// the configured LLM timeout when one is set.
+func (h *Handler) llmContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if h.config.LLMTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, h.config.LLMTimeout)
+}
+
+// timedOut reports whether an LLM call failed because ctx hit its deadline.
+func timedOut(ctx context.Context, err error) bool {
+	return err != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded))
+}
+
+// writeLLMTimeout tells the student that the evaluation took too long. htmx
+// requests get the thread partial under the notice, whose button retries the
+// evaluation of the stored answer; other clients get a 504 with the same
+// message and can retry through the evaluate endpoint.
+func (h *Handler) writeLLMTimeout(w http.ResponseWriter, r *http.Request, a *pendingAnswer) {
+	msg := appI18n.T(r.Context(), "LLMTimeout")
+	if r.Header.Get("HX-Request") == "" || wantsJSON(r) {
+		http.Error(w, msg, http.StatusGatewayTimeout)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, `<p class="llm-timeout-error" role="alert">%s</p>`, html.EscapeString(msg))
+	if err := h.renderThread(r.Context(), w, a); err != nil {
+		slog.Error("render error", "error", err)
+	}
+}
+
+// acceptAnswer validates an answer submission and stores the student's
+// message. An answer still inside its edit window is replaced instead. On
+// failure it writes the error response and returns false.
+func (h *Handler) acceptAnswer(w http.ResponseWriter, r *http.Request) (*pendingAnswer, bool) {
 	answer := r.FormValue("answer")
 	if answer == "" {
 		http.Error(w, "answer cannot be empty", http.StatusBadRequest)
+		return nil, false
+	}
+	// Counted in runes so the limit means the same for Cyrillic as for Latin.
+	if n := h.config.MinAnswerChars; n > 0 && utf8.RuneCountInString(strings.TrimSpace(answer)) < n {
+		rejectAnswer(w, r, appI18n.Td(r.Context(), "AnswerTooShort", map[string]any{"Min": strconv.Itoa(n)}))
+		return nil, false
+	}
+
+	a, ok := h.answerTarget(w, r)
+	if !ok {
+		return nil, false
+	}
+	if limit := h.config.MaxQuestionSimilarity; limit > 0 && model.SimilarityAbove(answer, a.question.Text, limit) {
+		rejectAnswer(w, r, appI18n.T(r.Context(), "AnswerRepeatsQuestion"))
+		return nil, false
+	}
+
+	var editable model.Message
+	if window := h.editWindow(); window > 0 {
+		messages, err := h.store.GetMessages(a.threadID)
+		if err != nil {
+			slog.Error("failed to get messages", "thread_id", a.threadID, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		editable, _ = model.EditableAnswer(messages, window, time.Now())
+		// An answer past its window is evaluated as it stands; a second
+		// answer would reach the evaluator unseen.
+		if editable.ID == 0 && model.AwaitingEvaluation(messages) {
+			rejectAnswer(w, r, appI18n.T(r.Context(), "AnswerEditClosed"))
+			return nil, false
+		}
+	}
+	var err error
+	if editable.ID != 0 {
+		a.answerID = editable.ID
+		err = h.store.UpdateMessageContent(editable.ID, answer)
+		if errors.Is(err, sql.ErrNoRows) {
+			rejectAnswer(w, r, appI18n.T(r.Context(), "AnswerEditClosed"))
+			return nil, false
+		}
+	} else {
+		a.answerID, err = h.store.AddMessage(model.Message{
+			ThreadID: a.threadID,
+			Role:     model.RoleStudent,
+			Content:  answer,
+		})
+	}
+	if err != nil {
+		slog.Error("failed to store student message", "thread_id", a.threadID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return a, true
+}
+
+// rejectAnswer answers an invalid submission with 400 and msg, as an alert
+// above the form for htmx and as plain text for JSON and stream clients.
+func rejectAnswer(w http.ResponseWriter, r *http.Request, msg string) {
+	if wantsJSON(r) || wantsEventStream(r) {
+		http.Error(w, msg, http.StatusBadRequest)
 		return
 	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = fmt.Fprintf(w, `<p class="time-exceeded-error" role="alert">%s</p>`, html.EscapeString(msg))
+}
+
+// answerTarget checks that the student may answer the thread in the URL
+// right now: it is theirs, the exam is open and in progress, and time is
+// left. On failure it writes the error response and returns false.
+func (h *Handler) answerTarget(w http.ResponseWriter, r *http.Request) (*pendingAnswer, bool) {
+	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	threadID, _ := strconv.ParseInt(chi.URLParam(r, "threadID"), 10, 64)
 
 	sess, bp, err := h.store.GetSessionWithBlueprint(sessionID)
 	if err != nil {
 		slog.Error("failed to get session with blueprint", "session_id", sessionID, "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	user := model.UserFromContext(r.Context())
-	if user.Role == model.UserRoleStudent && sess.StudentID != user.ID {
+	if !ownsSession(user, sess) {
 		http.Error(w, "forbidden", http.StatusForbidden)
-		return
+		return nil, false
 	}
 
 	if sess.Status != model.StatusInProgress {
 		http.Error(w, "exam already submitted", http.StatusBadRequest)
-		return
+		return nil, false
+	}
+
+	open, err := h.store.ExamOpen()
+	if err != nil {
+		slog.Error("failed to read exam open setting", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !open {
+		msg := appI18n.T(r.Context(), "ExamClosed")
+		if wantsJSON(r) || wantsEventStream(r) {
+			http.Error(w, msg, http.StatusForbidden)
+			return nil, false
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, `<p class="time-exceeded-error">%s</p>`, html.EscapeString(msg))
+		return nil, false
+	}
+
+	if h.pastExamCeiling(sess) {
+		slog.Info("exam ceiling reached, auto-submitting", "session_id", sessionID)
+		if err := h.gradeSession(context.WithoutCancel(r.Context()), sessionID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		w.Header().Set("HX-Redirect", h.path(fmt.Sprintf("/results/%d", sessionID)))
+		http.Error(w, "exam time is over; the exam has been submitted", http.StatusForbidden)
+		return nil, false
 	}
 
 	// Check time limit.
-	if calculateTimeRemaining(sess, bp) == 0 {
+	if calculateTimeRemaining(sess, bp, h.config.MaxExamDuration) == 0 {
+		if wantsJSON(r) || wantsEventStream(r) {
+			http.Error(w, "time limit exceeded", http.StatusForbidden)
+			return nil, false
+		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusForbidden)
 		_, _ = fmt.Fprint(w, `<p class="time-exceeded-error">Time limit exceeded. Please submit your exam.</p>`)
-		return
+		return nil, false
 	}
 
 	thread, err := h.store.GetThread(threadID)
 	if err != nil {
 		slog.Error("failed to get thread", "thread_id", threadID, "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	if thread.SessionID != sessionID {
 		http.Error(w, "thread does not belong to session", http.StatusForbidden)
-		return
-	}
-
-	_, err = h.store.AddMessage(model.Message{
-		ThreadID: threadID,
-		Role:     model.RoleStudent,
-		Content:  answer,
-	})
-	if err != nil {
-		slog.Error("failed to add student message", "thread_id", threadID, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	question, err := h.store.GetQuestion(thread.QuestionID)
 	if err != nil {
 		slog.Error("failed to get question", "question_id", thread.QuestionID, "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	messages, err := h.store.GetMessages(threadID)
-	if err != nil {
-		slog.Error("failed to get messages", "thread_id", threadID, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
-	result, _, err := h.llm.EvaluateAnswer(context.Background(), question, messages, bp.MaxFollowups, sessionID, threadID)
-	if err != nil {
-		slog.Error("LLM evaluation failed", "error", err)
-		http.Error(w, "LLM evaluation failed: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+	return &pendingAnswer{sessionID: sessionID, threadID: threadID, session: sess, blueprint: bp, question: question}, true
+}
 
-	llmText := result.Feedback
-	if result.NeedFollowup && result.FollowupQ != "" {
-		llmText += "\n\n**Follow-up question:** " + result.FollowupQ
-	}
+// finishAnswer stores the LLM evaluation, if any, and advances the thread
+// status. A nil result completes the thread (single-answer mode).
+func (h *Handler) finishAnswer(threadID int64, result *llm.GradeResult) (answerResponse, error) {
+	resp := answerResponse{ThreadStatus: model.ThreadCompleted}
+	if result != nil {
+		llmMsg := model.Message{
+			ThreadID:   threadID,
+			Role:       model.RoleLLM,
+			Content:    result.Feedback,
+			TokenCount: result.TokenCount,
+		}
+		if result.NeedFollowup {
+			llmMsg.Followup = result.FollowupQ
+		}
 
-	_, err = h.store.AddMessage(model.Message{
-		ThreadID: threadID,
-		Role:     model.RoleLLM,
-		Content:  llmText,
-	})
-	if err != nil {
-		slog.Error("failed to add LLM message", "thread_id", threadID, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+		if _, err := h.store.AddMessage(llmMsg); err != nil {
+			slog.Error("failed to add LLM message", "thread_id", threadID, "error", err)
+			return resp, err
+		}
 
-	newStatus := model.ThreadAnswered
-	if !result.NeedFollowup {
-		newStatus = model.ThreadCompleted
+		if result.NeedFollowup {
+			resp.ThreadStatus = model.ThreadAnswered
+		}
+		resp.Feedback = llmMsg.Content
+		resp.NeedFollowup = result.NeedFollowup
+		resp.FollowupQuestion = llmMsg.Followup
 	}
-	if err := h.store.UpdateThreadStatus(threadID, newStatus); err != nil {
-		slog.Warn("failed to update thread status", "thread_id", threadID, "status", newStatus, "error", err)
+	if err := h.store.UpdateThreadStatus(threadID, resp.ThreadStatus); err != nil {
+		slog.Warn("failed to update thread status", "thread_id", threadID, "status", resp.ThreadStatus, "error", err)
 	}
+	return resp, nil
+}
 
-	updatedMessages, err := h.store.GetMessages(threadID)
+// renderThread writes the HTML partial for the answered thread.
+func (h *Handler) renderThread(ctx context.Context, w io.Writer, a *pendingAnswer) error {
+	updatedMessages, err := h.store.GetMessages(a.threadID)
 	if err != nil {
-		slog.Warn("failed to get updated messages", "thread_id", threadID, "error", err)
+		slog.Warn("failed to get updated messages", "thread_id", a.threadID, "error", err)
 	}
-	updatedThread, err := h.store.GetThread(threadID)
+	updatedThread, err := h.store.GetThread(a.threadID)
 	if err != nil {
-		slog.Warn("failed to get updated thread", "thread_id", threadID, "error", err)
+		slog.Warn("failed to get updated thread", "thread_id", a.threadID, "error", err)
 	}
 
-	allThreads, err := h.store.GetThreadsForSession(sessionID)
+	allThreads, err := h.store.GetThreadsForSession(a.sessionID)
 	if err != nil {
-		slog.Warn("failed to get threads for session", "session_id", sessionID, "error", err)
+		slog.Warn("failed to get threads for session", "session_id", a.sessionID, "error", err)
 	}
 	threadIndex := 0
 	for i, t := range allThreads {
-		if t.ID == threadID {
+		if t.ID == a.threadID {
 			threadIndex = i
 			break
 		}
 	}
 
 	// Recalculate time status for accurate UI rendering after LLM evaluation.
-	timeExceeded := calculateTimeRemaining(sess, bp) == 0
+	timeExceeded := calculateTimeRemaining(a.session, a.blueprint, h.config.MaxExamDuration) == 0
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := views.ThreadContent(updatedThread, question, updatedMessages, sessionID, threadIndex, sess, timeExceeded).Render(r.Context(), w); err != nil {
-		slog.Error("render error", "error", err)
+	if err := views.ThreadContent(updatedThread, a.question, updatedMessages, a.sessionID, threadIndex, a.session, timeExceeded, h.editWindow(), max(h.config.MaxClarifications, 0)).Render(ctx, w); err != nil {
+		return err
+	}
+	if len(allThreads) == 0 {
+		return nil
+	}
+
+	// The answer may have changed the thread's status, so refresh the
+	// page's progress along with it.
+	progress := model.SessionView{Threads: make([]model.ThreadView, len(allThreads))}
+	for i, t := range allThreads {
+		progress.Threads[i].Thread = t
 	}
+	return views.ExamProgressOOB(progress).Render(ctx, w)
 }
 
 func (h *Handler) handleSubmit(w http.ResponseWriter, r *http.Request) {
@@ -418,7 +1006,7 @@ func (h *Handler) handleSubmit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := model.UserFromContext(r.Context())
-	if user.Role == model.UserRoleStudent && sess.StudentID != user.ID {
+	if !ownsSession(user, sess) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
@@ -428,90 +1016,268 @@ func (h *Handler) handleSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.UpdateSessionStatus(sessionID, model.StatusSubmitted); err != nil {
-		slog.Error("failed to update session to submitted", "session_id", sessionID, "error", err)
+	if err := h.gradeSession(context.WithoutCancel(r.Context()), sessionID); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	http.Redirect(w, r, h.path(fmt.Sprintf("/results/%d", sessionID)), http.StatusSeeOther)
+}
+
+// gradeSession moves a session through submitted and grading, scores every
+// thread with the LLM and stores the overall grade. A session that is no
+// longer in progress is left alone: whoever submitted it grades it.
+func (h *Handler) gradeSession(ctx context.Context, sessionID int64) error {
+	submitted, err := h.store.SubmitSession(sessionID)
+	if err != nil {
+		slog.Error("failed to update session to submitted", "session_id", sessionID, "error", err)
+		return err
+	}
+	if !submitted {
+		slog.Info("session already submitted, not grading it again", "session_id", sessionID)
+		return nil
+	}
+	h.metrics.ExamSubmitted()
+	return h.gradeSubmittedSession(ctx, sessionID)
+}
+
+// gradeSubmittedSession grades a session that is already submitted. With
+// receipts enabled it first issues the session's submission receipt. It
+// always ends the session's grading events, with a failure if it returns
+// an error, so no student waits on a grading that has stopped. If ctx is
+// done before grading finishes, the session stays in grading for
+// RecoverGradingSessions to finish.
+func (h *Handler) gradeSubmittedSession(ctx context.Context, sessionID int64) (err error) {
+	defer func() {
+		h.grading.publish(sessionID, gradingProgress{Done: true, Failed: err != nil})
+	}()
+	if h.config.SubmissionReceipts {
+		// A missing receipt must not cost the student their grade.
+		if _, err := h.store.IssueReceipt(sessionID); err != nil {
+			slog.Warn("failed to issue submission receipt", "session_id", sessionID, "error", err)
+		}
+	}
 	if err := h.store.UpdateSessionStatus(sessionID, model.StatusGrading); err != nil {
 		slog.Error("failed to update session to grading", "session_id", sessionID, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
+	}
+	progress := func(graded, total int) {
+		h.grading.publish(sessionID, gradingProgress{Graded: graded, Total: total})
+	}
+	if err := h.scoreSession(ctx, sessionID, progress); err != nil {
+		return err
 	}
+	if err := h.store.UpdateSessionStatus(sessionID, model.StatusGraded); err != nil {
+		slog.Warn("failed to update session to graded", "session_id", sessionID, "error", err)
+	}
+	h.metrics.ExamGraded()
+	return nil
+}
 
+// scoreSession scores every thread of a session with the LLM and stores the
+// overall LLM grade. It leaves the session status and any teacher scores
+// alone, so it can also regrade a session that was already graded. If
+// progress is not nil, it is called with the number of threads that have
+// their final score, first with 0 and then after each one. If ctx is done,
+// it stops between threads and returns ctx.Err() without storing a grade.
+func (h *Handler) scoreSession(ctx context.Context, sessionID int64, progress func(graded, total int)) error {
 	threads, err := h.store.GetThreadsForSession(sessionID)
 	if err != nil {
 		slog.Error("failed to get threads for grading", "session_id", sessionID, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	var totalScore float64
-	var totalMaxPoints int
+	// Unanswered and ungraded questions stay in the grade with 0 points.
+	var graded []model.GradedQuestion
+
+	// Threads whose grading call failed get up to GradeRetries more attempts
+	// after the first pass, so one transient error does not cost the points.
+	type pendingGrade struct {
+		thread   model.QuestionThread
+		question model.Question
+		messages []model.Message
+		index    int // Position in graded
+	}
+	var failed []pendingGrade
+
+	total, done := len(threads), 0
+	report := func() {
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+	report()
 
 	for _, t := range threads {
 		question, err := h.store.GetQuestion(t.QuestionID)
 		if err != nil {
+			total--
+			report()
 			continue
 		}
+		graded = append(graded, model.GradedQuestion{Question: question})
 		messages, err := h.store.GetMessages(t.ID)
-		if err != nil || len(messages) == 0 {
+		// Clarifications alone are not an answer.
+		if err != nil || len(model.GradedMessages(messages)) == 0 {
 			if err := h.store.UpsertScore(model.QuestionScore{
-				ThreadID:    t.ID,
-				LLMScore:    0,
-				LLMFeedback: "No answer provided.",
+				ThreadID:      t.ID,
+				LLMScore:      0,
+				LLMFeedback:   "No answer provided.",
+				LLMConfidence: model.DefaultConfidence,
 			}); err != nil {
 				slog.Warn("failed to upsert zero score", "thread_id", t.ID, "error", err)
 			}
-			totalMaxPoints += question.MaxPoints
+			done++
+			report()
 			continue
 		}
+		failed = append(failed, pendingGrade{thread: t, question: question, messages: messages, index: len(graded) - 1})
+	}
 
-		result, err := h.llm.GradeThread(context.Background(), question, messages, sessionID, t.ID)
-		if err != nil {
-			slog.Error("grading failed", "thread_id", t.ID, "error", err)
-			if err := h.store.UpsertScore(model.QuestionScore{
-				ThreadID:    t.ID,
-				LLMScore:    0,
-				LLMFeedback: "Grading error: " + err.Error(),
-			}); err != nil {
-				slog.Warn("failed to upsert error score", "thread_id", t.ID, "error", err)
+	retries := max(h.config.GradeRetries, 0)
+	for attempt := 0; attempt <= retries && len(failed) > 0; attempt++ {
+		var retry []pendingGrade
+		last := attempt == retries
+		for _, p := range failed {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			score, ok := h.gradeThread(ctx, sessionID, p.thread.ID, p.question, p.messages, attempt, last)
+			if !ok {
+				if last {
+					// Scored as a grading error; it will not be retried.
+					done++
+					report()
+				}
+				retry = append(retry, p)
+				continue
 			}
-			totalMaxPoints += question.MaxPoints
+			graded[p.index].Score = score
+			done++
+			report()
+		}
+		failed = retry
+	}
+	// A call cut short by ctx is not a grading failure to score.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := h.store.UpsertGrade(model.Grade{
+		SessionID: sessionID,
+		LLMGrade:  model.OverallGrade(graded, h.config.DifficultyWeights),
+	}); err != nil {
+		slog.Warn("failed to upsert grade", "session_id", sessionID, "error", err)
+	}
+	return nil
+}
+
+// SweepOverdueSessions submits and grades in-progress sessions whose time
+// limit has passed, e.g. because the student closed the browser. It stops
+// grading when ctx is done; RecoverGradingSessions finishes the rest on the
+// next start.
+func (h *Handler) SweepOverdueSessions(ctx context.Context) {
+	ids, err := h.store.ExpireOverdueSessions(h.config.MaxExamDuration)
+	if err != nil {
+		slog.Error("failed to expire overdue sessions", "error", err)
+	}
+	for _, id := range ids {
+		slog.Info("auto-submitting overdue session", "session_id", id)
+		h.metrics.ExamSubmitted()
+		if ctx.Err() != nil {
 			continue
 		}
+		if err := h.gradeSubmittedSession(ctx, id); err != nil {
+			slog.Error("failed to grade overdue session", "session_id", id, "error", err)
+		}
+	}
+}
 
-		if err := h.store.UpsertScore(model.QuestionScore{
-			ThreadID:    t.ID,
-			LLMScore:    result.Score,
-			LLMFeedback: result.Feedback,
-		}); err != nil {
-			slog.Warn("failed to upsert score", "thread_id", t.ID, "error", err)
+// UngradedSessions returns the IDs of the sessions left submitted or in the
+// grading status, e.g. because the server stopped before or while grading
+// them. Call it once at startup, before serving requests: sessions
+// submitted afterwards are graded by whoever submitted them.
+func (h *Handler) UngradedSessions() ([]int64, error) {
+	var ids []int64
+	for _, status := range []model.SessionStatus{model.StatusSubmitted, model.StatusGrading} {
+		sessions, err := h.store.ListSessionsByStatus(status)
+		if err != nil {
+			return nil, err
 		}
-		if err := h.store.UpdateThreadStatus(t.ID, model.ThreadCompleted); err != nil {
-			slog.Warn("failed to update thread to completed", "thread_id", t.ID, "error", err)
+		for _, sess := range sessions {
+			ids = append(ids, sess.ID)
 		}
+	}
+	return ids, nil
+}
 
-		totalScore += result.Score
-		totalMaxPoints += question.MaxPoints
+// RecoverGradingSessions grades the sessions UngradedSessions returned at
+// startup. It stops between sessions when ctx is done.
+func (h *Handler) RecoverGradingSessions(ctx context.Context, ids []int64) {
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Info("recovering session stuck in grading", "session_id", id)
+		if err := h.gradeSubmittedSession(ctx, id); err != nil {
+			slog.Error("failed to regrade recovered session", "session_id", id, "error", err)
+		}
 	}
+}
 
-	overallGrade := 0.0
-	if totalMaxPoints > 0 {
-		overallGrade = (totalScore / float64(totalMaxPoints)) * 100
+// RunOverdueSweep calls SweepOverdueSessions every interval until ctx is done.
+func (h *Handler) RunOverdueSweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.SweepOverdueSessions(ctx)
+		}
 	}
+}
 
-	if err := h.store.UpsertGrade(model.Grade{
-		SessionID: sessionID,
-		LLMGrade:  overallGrade,
+// gradeThread grades one thread and stores its score. A failed attempt
+// records a zero score only when it is the last one, so a later retry can
+// still replace it; ok reports whether grading succeeded.
+func (h *Handler) gradeThread(parent context.Context, sessionID, threadID int64, question model.Question, messages []model.Message, attempt int, last bool) (float64, bool) {
+	// Each thread gets its own deadline so one slow question does not use up
+	// the time of the others.
+	ctx, cancel := h.llmContext(parent)
+	defer cancel()
+	result, err := h.llm.GradeThread(ctx, question, messages, sessionID, threadID)
+	if err != nil {
+		slog.Error("grading failed", "thread_id", threadID, "attempt", attempt+1, "error", err)
+		// A canceled parent is a shutdown, not a failed grading.
+		if !last || parent.Err() != nil {
+			return 0, false
+		}
+		if err := h.store.UpsertScore(model.QuestionScore{
+			ThreadID:      threadID,
+			LLMScore:      0,
+			LLMFeedback:   model.GradingErrorPrefix + err.Error(),
+			LLMConfidence: model.DefaultConfidence,
+		}); err != nil {
+			slog.Warn("failed to upsert error score", "thread_id", threadID, "error", err)
+		}
+		return 0, false
+	}
+
+	if err := h.store.UpsertScore(model.QuestionScore{
+		ThreadID:      threadID,
+		LLMScore:      result.Score,
+		LLMFeedback:   result.Feedback,
+		LLMTokenCount: result.TokenCount,
+		LLMConfidence: result.Confidence,
 	}); err != nil {
-		slog.Warn("failed to upsert grade", "session_id", sessionID, "error", err)
+		slog.Warn("failed to upsert score", "thread_id", threadID, "error", err)
 	}
-	if err := h.store.UpdateSessionStatus(sessionID, model.StatusGraded); err != nil {
-		slog.Warn("failed to update session to graded", "session_id", sessionID, "error", err)
+	if err := h.store.UpdateThreadStatus(threadID, model.ThreadCompleted); err != nil {
+		slog.Warn("failed to update thread to completed", "thread_id", threadID, "error", err)
 	}
-
-	http.Redirect(w, r, h.path(fmt.Sprintf("/results/%d", sessionID)), http.StatusSeeOther)
+	return result.Score, true
 }
 
 func (h *Handler) handleStudentResults(w http.ResponseWriter, r *http.Request) {
@@ -529,38 +1295,122 @@ func (h *Handler) handleStudentResults(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := model.UserFromContext(r.Context())
-	if view.Session.StudentID != user.ID {
+	if !ownsSession(user, view.Session) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := views.ResultsPage(*view).Render(r.Context(), w); err != nil {
+	if err := views.ResultsPage(*view, h.config).Render(r.Context(), w); err != nil {
+		slog.Error("render error", "error", err)
+	}
+}
+
+// handleVerifyReceipt tells whether a submission receipt code belongs to a
+// submitted session. Unknown codes get a 404 with the same page.
+func (h *Handler) handleVerifyReceipt(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	var found *model.ExamSession
+	sess, err := h.store.SessionByReceipt(code)
+	switch {
+	case err == nil:
+		found = &sess
+	case !errors.Is(err, sql.ErrNoRows):
+		slog.Error("failed to look up receipt", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if found == nil {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	if err := views.VerifyReceiptPage(code, found).Render(r.Context(), w); err != nil {
 		slog.Error("render error", "error", err)
 	}
 }
 
 func (h *Handler) handleReviewList(w http.ResponseWriter, r *http.Request) {
-	sessions, err := h.store.ListSessions()
+	cohort := r.URL.Query().Get("cohort")
+	sessions, page, err := h.sessionPage(r, model.SessionFilter{
+		Cohort:   cohort,
+		Statuses: []model.SessionStatus{model.StatusGraded, model.StatusReviewed},
+	})
 	if err != nil {
 		slog.Error("failed to list sessions for review", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	cohorts, err := h.store.ListCohorts()
+	if err != nil {
+		slog.Error("failed to list cohorts", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	students, err := h.sessionStudents(sessions)
+	if err != nil {
+		slog.Error("failed to get students for review list", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	var reviewable []model.ExamSession
-	for _, s := range sessions {
-		if s.Status == model.StatusGraded || s.Status == model.StatusReviewed {
-			reviewable = append(reviewable, s)
+	var lowConfidence map[int64]int
+	if h.config.LowConfidenceThreshold > 0 {
+		ids := make([]int64, 0, len(sessions))
+		for _, sess := range sessions {
+			ids = append(ids, sess.ID)
+		}
+		lowConfidence, err = h.store.LowConfidenceCounts(h.config.LowConfidenceThreshold, ids)
+		if err != nil {
+			slog.Error("failed to count low-confidence grades", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 	}
 
+	pairs, err := h.store.ScorePairs(cohort)
+	if err != nil {
+		slog.Error("failed to list LLM and teacher score pairs", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := views.ReviewListPage(reviewable).Render(r.Context(), w); err != nil {
+	if err := views.ReviewListPage(sessions, page, students, h.config.StudentIdentifier, cohorts, cohort, lowConfidence, model.ScoreAgreement(pairs)).Render(r.Context(), w); err != nil {
 		slog.Error("render error", "error", err)
 	}
 }
 
+// sessionStudents returns the students of sessions, keyed by user ID, for
+// labelling them with --student-identifier.
+func (h *Handler) sessionStudents(sessions []model.ExamSession) (map[int64]model.User, error) {
+	ids := make([]int64, 0, len(sessions))
+	for _, sess := range sessions {
+		ids = append(ids, sess.StudentID)
+	}
+	return h.store.GetUsersByIDs(ids)
+}
+
+// sessionPage returns the page of sessions matching f selected by the "page"
+// and "size" query parameters (see model.NewPage), newest first.
+func (h *Handler) sessionPage(r *http.Request, f model.SessionFilter) ([]model.ExamSession, model.Page, error) {
+	number, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+	page := model.NewPage(number, size)
+
+	total, err := h.store.CountSessions(f)
+	if err != nil {
+		return nil, page, err
+	}
+	page = page.WithTotal(total)
+	sessions, err := h.store.ListSessionsPaged(f, page.Size, page.Offset())
+	return sessions, page, err
+}
+
+// bankPickerLimit caps the bank questions offered on the review page.
+const bankPickerLimit = 25
+
 func (h *Handler) handleReviewPage(w http.ResponseWriter, r *http.Request) {
 	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
 
@@ -571,12 +1421,92 @@ func (h *Handler) handleReviewPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var student model.User
+	if u, err := h.store.GetUserByID(view.Session.StudentID); err != nil {
+		slog.Warn("failed to get student for review", "session_id", sessionID, "error", err)
+	} else if u != nil {
+		student = *u
+	}
+	audit, err := h.store.ListAuditLog(sessionID)
+	if err != nil {
+		slog.Warn("failed to get audit log for review", "session_id", sessionID, "error", err)
+	}
+	// Bank questions matching the teacher's search that they can still add
+	// to an exam in progress.
+	bankQuery := strings.TrimSpace(r.URL.Query().Get("bank_q"))
+	var bank []model.Question
+	if view.Session.Status == model.StatusInProgress && bankQuery != "" {
+		found, err := h.store.SearchQuestions(bankQuery)
+		if err != nil {
+			slog.Warn("failed to search questions for review", "session_id", sessionID, "error", err)
+		}
+		asked := make(map[int64]bool, len(view.Threads))
+		for _, tv := range view.Threads {
+			asked[tv.Question.ID] = true
+		}
+		for _, q := range found {
+			if !asked[q.ID] && len(bank) < bankPickerLimit {
+				bank = append(bank, q)
+			}
+		}
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := views.ReviewPage(*view).Render(r.Context(), w); err != nil {
+	if err := views.ReviewPage(*view, student, h.config.StudentIdentifier, h.config.DifficultyWeights, audit, bankQuery, bank).Render(r.Context(), w); err != nil {
 		slog.Error("render error", "error", err)
 	}
 }
 
+// handleTranscript serves a printable transcript of a session as
+// self-contained HTML or, with ?format=pdf, as the PDF `examiner report`
+// writes.
+func (h *Handler) handleTranscript(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+
+	view, err := h.store.GetSessionView(sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get session view for transcript", "session_id", sessionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var student model.User
+	if u, err := h.store.GetUserByID(view.Session.StudentID); err != nil {
+		slog.Warn("failed to get student for transcript", "session_id", sessionID, "error", err)
+	} else if u != nil {
+		student = *u
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := views.TranscriptPage(*view, student, h.config.StudentIdentifier).Render(r.Context(), w); err != nil {
+			slog.Error("render error", "error", err)
+		}
+	case "pdf":
+		if h.reportFontErr != nil {
+			slog.Error("no font for PDF transcript", "error", h.reportFontErr)
+			http.Error(w, fmt.Sprintf("PDF transcripts need a TrueType font: %v (see --report-font)", h.reportFontErr), http.StatusInternalServerError)
+			return
+		}
+		var buf bytes.Buffer
+		if err := report.WriteSessionPDF(r.Context(), &buf, h.reportFont, view, &student); err != nil {
+			slog.Error("failed to write PDF transcript", "session_id", sessionID, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="session-%d.pdf"`, sessionID))
+		_, _ = w.Write(buf.Bytes())
+	default:
+		http.Error(w, fmt.Sprintf("unknown transcript format %q (want html or pdf)", format), http.StatusBadRequest)
+	}
+}
+
 func (h *Handler) handleUpdateScore(w http.ResponseWriter, r *http.Request) {
 	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
 	threadID, _ := strconv.ParseInt(chi.URLParam(r, "threadID"), 10, 64)
@@ -590,8 +1520,59 @@ func (h *Handler) handleUpdateScore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.UpdateTeacherScore(threadID, score, comment); err != nil {
-		slog.Error("failed to update teacher score", "thread_id", threadID, "error", err)
+	// Each reviewer keeps their own review; the thread shows their average.
+	user := model.UserFromContext(r.Context())
+	review := model.ThreadReview{ThreadID: threadID, ReviewerID: user.ID, Score: score, Comment: comment}
+	if err := h.store.UpsertThreadReview(review); err != nil {
+		slog.Error("failed to save review", "thread_id", threadID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, h.path(fmt.Sprintf("/review/%d", sessionID)), http.StatusSeeOther)
+}
+
+// handleRedeliver starts a new session for the same student with the exact
+// question set and order of an existing session.
+func (h *Handler) handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+
+	newID, err := h.store.CloneSessionQuestions(sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to clone session", "session_id", sessionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, h.path(fmt.Sprintf("/review/%d", newID)), http.StatusSeeOther)
+}
+
+// handleRegrade re-runs LLM grading over a graded session's existing
+// answers, e.g. after a rubric or prompt change. Teacher scores and the
+// session status are kept.
+func (h *Handler) handleRegrade(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+
+	sess, err := h.store.GetSession(sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get session", "session_id", sessionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sess.Status != model.StatusGraded && sess.Status != model.StatusReviewed {
+		http.Error(w, "session is not graded", http.StatusConflict)
+		return
+	}
+
+	if err := h.scoreSession(context.WithoutCancel(r.Context()), sessionID, nil); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -599,6 +1580,107 @@ func (h *Handler) handleUpdateScore(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, h.path(fmt.Sprintf("/review/%d", sessionID)), http.StatusSeeOther)
 }
 
+// handleAddQuestion adds a question the teacher poses during an exam in
+// progress, e.g. in an oral exam: a bank question picked by question_id, or
+// else a new ad hoc question from the form. The student sees it the next
+// time the exam page loads, and it is graded with the others on submit.
+func (h *Handler) handleAddQuestion(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+
+	sess, err := h.store.GetSession(sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get session", "session_id", sessionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sess.Status != model.StatusInProgress {
+		http.Error(w, "session is not in progress", http.StatusConflict)
+		return
+	}
+	if r.FormValue("question_id") != "" {
+		h.addBankQuestion(w, r, sessionID)
+		return
+	}
+
+	q := model.Question{
+		Text:        strings.TrimSpace(r.FormValue("text")),
+		Difficulty:  model.Difficulty(r.FormValue("difficulty")),
+		Topic:       strings.TrimSpace(r.FormValue("topic")),
+		Rubric:      strings.TrimSpace(r.FormValue("rubric")),
+		ModelAnswer: strings.TrimSpace(r.FormValue("model_answer")),
+	}
+	q.MaxPoints, _ = strconv.Atoi(r.FormValue("max_points"))
+	var problems []string
+	for _, p := range model.ValidateQuestions([]model.QuestionImport{{
+		Text: q.Text, Difficulty: q.Difficulty, MaxPoints: q.MaxPoints,
+		Rubric: q.Rubric, ModelAnswer: q.ModelAnswer,
+	}}) {
+		if !p.Warning {
+			problems = append(problems, p.Message)
+		}
+	}
+	if len(problems) > 0 {
+		http.Error(w, strings.Join(problems, "; "), http.StatusBadRequest)
+		return
+	}
+
+	threadID, err := h.store.AddAdHocQuestion(sessionID, q)
+	if errors.Is(err, store.ErrQuestionExists) {
+		http.Error(w, "the question bank already has this question; add it from the bank instead", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to add question to session", "session_id", sessionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user := model.UserFromContext(r.Context())
+	slog.Info("teacher added question", "teacher_id", user.ID, "session_id", sessionID, "thread_id", threadID)
+
+	http.Redirect(w, r, h.path(fmt.Sprintf("/review/%d", sessionID)), http.StatusSeeOther)
+}
+
+// addBankQuestion adds the bank question named by the question_id form
+// value to an in-progress session, unless the session already has it.
+func (h *Handler) addBankQuestion(w http.ResponseWriter, r *http.Request, sessionID int64) {
+	questionID, err := strconv.ParseInt(r.FormValue("question_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid question ID", http.StatusBadRequest)
+		return
+	}
+	threads, err := h.store.GetThreadsForSession(sessionID)
+	if err != nil {
+		slog.Error("failed to get threads", "session_id", sessionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, th := range threads {
+		if th.QuestionID == questionID {
+			http.Error(w, "the session already has this question", http.StatusConflict)
+			return
+		}
+	}
+
+	threadID, err := h.store.AddThreadToSession(sessionID, questionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("no question with ID %d", questionID), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to add question to session", "session_id", sessionID, "question_id", questionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user := model.UserFromContext(r.Context())
+	slog.Info("teacher added bank question", "teacher_id", user.ID, "session_id", sessionID, "question_id", questionID, "thread_id", threadID)
+
+	http.Redirect(w, r, h.path(fmt.Sprintf("/review/%d", sessionID)), http.StatusSeeOther)
+}
+
 func (h *Handler) handleFinalize(w http.ResponseWriter, r *http.Request) {
 	sessionID, _ := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
 
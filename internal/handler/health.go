@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds each dependency check of GET /readyz, so a hung
+// LLM server fails the probe instead of stalling it.
+const readinessTimeout = 5 * time.Second
+
+// Component states reported by the health endpoints.
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// healthStatus is the JSON body of GET /healthz and GET /readyz. Components
+// maps each checked dependency to "ok" or "unavailable"; the probes are
+// unauthenticated, so error details only go to the log.
+type healthStatus struct {
+	Status     string            `json:"status"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// handleHealthz answers liveness probes: the process is up and serving.
+func (h *Handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, healthStatus{Status: healthOK})
+}
+
+// handleReadyz answers readiness probes. It pings the database and the LLM
+// endpoint and returns 503 if either fails.
+func (h *Handler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]func(context.Context) error{"database": h.store.Ping}
+	if h.llm != nil {
+		checks["llm"] = h.llm.Ping
+	}
+
+	status := healthStatus{Status: healthOK, Components: make(map[string]string)}
+	for name, check := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		err := check(ctx)
+		cancel()
+		if err != nil {
+			slog.Warn("readiness check failed", "component", name, "error", err)
+			status.Status = healthUnavailable
+			status.Components[name] = healthUnavailable
+			continue
+		}
+		status.Components[name] = healthOK
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if status.Status != healthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		slog.Error("failed to encode JSON response", "error", err)
+	}
+}
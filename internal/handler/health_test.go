@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	f := newRouterFixture(t)
+	up := true
+	f.handler.llm = newStubLLM(t, func(*http.Request, string) string {
+		if !up {
+			return ""
+		}
+		return "ok"
+	})
+
+	// Probes carry no session cookie or CSRF token.
+	probe := func(path string) (int, healthStatus) {
+		rec := httptest.NewRecorder()
+		f.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body healthStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode %q: %v", path, rec.Body.String(), err)
+		}
+		return rec.Code, body
+	}
+
+	if code, body := probe("/healthz"); code != http.StatusOK || body.Status != "ok" {
+		t.Errorf("healthz = %d %+v, want 200 ok", code, body)
+	}
+	code, body := probe("/readyz")
+	if code != http.StatusOK || body.Components["database"] != "ok" || body.Components["llm"] != "ok" {
+		t.Errorf("readyz = %d %+v, want 200 with both components ok", code, body)
+	}
+
+	up = false
+	code, body = probe("/readyz")
+	if code != http.StatusServiceUnavailable || body.Status != "unavailable" {
+		t.Errorf("readyz with the LLM down = %d %+v, want 503", code, body)
+	}
+	if body.Components["database"] != "ok" || body.Components["llm"] != "unavailable" {
+		t.Errorf("only the LLM should be reported as failing, got %+v", body.Components)
+	}
+
+	f.store.Close()
+	if code, body = probe("/readyz"); code != http.StatusServiceUnavailable || body.Components["database"] == "ok" {
+		t.Errorf("readyz with the database closed = %d %+v, want 503", code, body)
+	}
+}
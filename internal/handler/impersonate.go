@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+const (
+	impersonationCookieName = "impersonate"
+	impersonationTTL        = 30 * time.Minute
+)
+
+// signImpersonation returns a token binding adminID to targetID until expires.
+// The token lives in its own cookie and never replaces the admin's auth session.
+func (h *Handler) signImpersonation(adminID, targetID int64, expires time.Time) string {
+	payload := fmt.Sprintf("%d:%d:%d", adminID, targetID, expires.Unix())
+	mac := hmac.New(sha256.New, h.impersonationKey)
+	mac.Write([]byte(payload))
+	return payload + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyImpersonation checks the token signature, expiry and that it was
+// issued to adminID. It returns the target user ID.
+func (h *Handler) verifyImpersonation(token string, adminID int64, now time.Time) (int64, bool) {
+	i := strings.LastIndex(token, ":")
+	if i < 0 {
+		return 0, false
+	}
+	payload, sig := token[:i], token[i+1:]
+	mac := hmac.New(sha256.New, h.impersonationKey)
+	mac.Write([]byte(payload))
+	want := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return 0, false
+	}
+
+	parts := strings.Split(payload, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	issuer, err1 := strconv.ParseInt(parts[0], 10, 64)
+	target, err2 := strconv.ParseInt(parts[1], 10, 64)
+	expires, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	if issuer != adminID || now.Unix() >= expires {
+		return 0, false
+	}
+	return target, true
+}
+
+// impersonationTarget resolves the student an admin is currently viewing as,
+// or nil when the request carries no valid impersonation token.
+func (h *Handler) impersonationTarget(r *http.Request, user *model.User) *model.User {
+	if user.Role != model.UserRoleAdmin {
+		return nil
+	}
+	cookie, err := r.Cookie(impersonationCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	targetID, ok := h.verifyImpersonation(cookie.Value, user.ID, time.Now())
+	if !ok {
+		slog.Warn("ignoring invalid impersonation token", "admin_id", user.ID)
+		return nil
+	}
+	target, err := h.store.GetUserByID(targetID)
+	if err != nil || target == nil || !target.Active || target.Role != model.UserRoleStudent {
+		return nil
+	}
+	return target
+}
+
+// impersonationReadOnly rejects state-changing requests made while an admin
+// is viewing the app as a student.
+func impersonationReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if model.ImpersonatorFromContext(r.Context()) != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "read-only while viewing as another user", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleStartImpersonation lets an admin view the app as a student.
+func (h *Handler) handleStartImpersonation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.store.GetUserByID(id)
+	if err != nil {
+		slog.Error("failed to get user", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if target == nil || !target.Active || target.Role != model.UserRoleStudent {
+		http.Error(w, "only active students can be viewed", http.StatusBadRequest)
+		return
+	}
+
+	admin := model.UserFromContext(r.Context())
+	slog.Info("admin started impersonation", "admin_id", admin.ID, "target_id", target.ID)
+
+	cookiePath := "/"
+	if h.config.BasePath != "" {
+		cookiePath = h.config.BasePath + "/"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     impersonationCookieName,
+		Value:    h.signImpersonation(admin.ID, target.ID, time.Now().Add(impersonationTTL)),
+		Path:     cookiePath,
+		MaxAge:   int(impersonationTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   h.config.SecureCookies,
+	})
+	http.Redirect(w, r, h.path("/"), http.StatusSeeOther)
+}
+
+// handleStopImpersonation clears the impersonation cookie.
+func (h *Handler) handleStopImpersonation(w http.ResponseWriter, r *http.Request) {
+	if admin := model.ImpersonatorFromContext(r.Context()); admin != nil {
+		slog.Info("admin stopped impersonation", "admin_id", admin.ID)
+	}
+
+	cookiePath := "/"
+	if h.config.BasePath != "" {
+		cookiePath = h.config.BasePath + "/"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     impersonationCookieName,
+		Value:    "",
+		Path:     cookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.config.SecureCookies,
+	})
+	http.Redirect(w, r, h.path("/admin/users"), http.StatusSeeOther)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestImpersonationOnlyAdminsCanStart(t *testing.T) {
+	f := newRouterFixture(t)
+	path := "/admin/users/" + itoa(f.student.ID) + "/impersonate"
+
+	for _, u := range []*model.User{f.teacher, f.student} {
+		rec := f.do(t, u, http.MethodPost, path)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", u.Role, rec.Code)
+		}
+		if impersonationCookie(rec) != nil {
+			t.Errorf("%s: impersonation cookie must not be issued", u.Role)
+		}
+	}
+
+	rec := f.do(t, f.admin, http.MethodPost, "/admin/users/"+itoa(f.teacher.ID)+"/impersonate")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("impersonating a non-student: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestImpersonationIsReadOnly(t *testing.T) {
+	f := newRouterFixture(t)
+
+	rec := f.do(t, f.admin, http.MethodPost, "/admin/users/"+itoa(f.student.ID)+"/impersonate")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("start: expected 303, got %d: %s", rec.Code, rec.Body.String())
+	}
+	cookie := impersonationCookie(rec)
+	if cookie == nil || cookie.Value == "" {
+		t.Fatal("expected impersonation cookie")
+	}
+
+	rec = f.do(t, f.admin, http.MethodGet, "/", cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("index: expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `id="impersonation-banner"`) || !strings.Contains(body, f.student.DisplayName) {
+		t.Error("index should show the impersonation banner for the student")
+	}
+
+	rec = f.do(t, f.admin, http.MethodGet, "/admin/users", cookie)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("admin pages should be hidden while viewing as a student, got %d", rec.Code)
+	}
+
+	rec = f.do(t, f.admin, http.MethodPost, "/exam/start", cookie)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("exam start should be rejected while impersonating, got %d", rec.Code)
+	}
+	sessions, err := f.store.ListSessionsByUser(f.student.ID)
+	if err != nil {
+		t.Fatalf("ListSessionsByUser: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("impersonation must not create sessions for the student, got %d", len(sessions))
+	}
+
+	rec = f.do(t, f.admin, http.MethodPost, "/impersonate/stop", cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("stop: expected 303, got %d", rec.Code)
+	}
+	if c := impersonationCookie(rec); c == nil || c.MaxAge >= 0 {
+		t.Error("stop should clear the impersonation cookie")
+	}
+}
+
+func TestImpersonationTokenBoundToAdmin(t *testing.T) {
+	f := newRouterFixture(t)
+	now := time.Now()
+	token := f.handler.signImpersonation(f.admin.ID, f.student.ID, now.Add(time.Minute))
+
+	if id, ok := f.handler.verifyImpersonation(token, f.admin.ID, now); !ok || id != f.student.ID {
+		t.Errorf("expected valid token for student %d, got %d %v", f.student.ID, id, ok)
+	}
+	if _, ok := f.handler.verifyImpersonation(token, f.teacher.ID, now); ok {
+		t.Error("token must not be usable by another user")
+	}
+	if _, ok := f.handler.verifyImpersonation(token, f.admin.ID, now.Add(2*time.Minute)); ok {
+		t.Error("expired token must be rejected")
+	}
+	tampered := strings.Replace(token, ":"+itoa(f.student.ID)+":", ":"+itoa(f.teacher.ID)+":", 1)
+	if _, ok := f.handler.verifyImpersonation(tampered, f.admin.ID, now); ok {
+		t.Error("tampered token must be rejected")
+	}
+
+	// A forged cookie leaves the admin with their own identity.
+	forged := &http.Cookie{Name: impersonationCookieName, Value: token + "x"}
+	rec := f.do(t, f.admin, http.MethodGet, "/admin/users", forged)
+	if rec.Code != http.StatusOK {
+		t.Errorf("forged token should be ignored, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pavelanni/examiner/internal/metrics"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestMetricsCountExams(t *testing.T) {
+	f := newRouterFixture(t)
+	if rec := f.do(t, f.admin, http.MethodGet, "/metrics"); rec.Code != http.StatusNotFound {
+		t.Errorf("/metrics without --metrics: expected 404, got %d", rec.Code)
+	}
+
+	// Routes only registers /metrics when metrics are set.
+	f.handler.SetMetrics(metrics.New())
+	r := chi.NewRouter()
+	r.Use(f.handler.BasePathMiddleware)
+	f.handler.Routes(r)
+	f.router = r
+
+	if _, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"}); err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	if _, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10}); err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	rec := f.do(t, f.student, http.MethodPost, "/exam/start")
+	var sessionID int64
+	if _, err := fmt.Sscanf(rec.Header().Get("Location"), "/exam/%d", &sessionID); err != nil {
+		t.Fatalf("start: unexpected redirect %q (%d)", rec.Header().Get("Location"), rec.Code)
+	}
+	if rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", sessionID)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("submit: expected 303, got %d", rec.Code)
+	}
+
+	// Scrapers carry no session cookie.
+	scrape := httptest.NewRecorder()
+	f.router.ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if scrape.Code != http.StatusOK {
+		t.Fatalf("/metrics: expected 200, got %d", scrape.Code)
+	}
+	body := scrape.Body.String()
+	for _, want := range []string{
+		"examiner_exams_started_total 1",
+		"examiner_exams_submitted_total 1",
+		"examiner_exams_graded_total 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics: missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestSessionOwnershipSurvivesRoleChange(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	own, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	others, err := f.store.CreateSession(bpID, f.admin.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	// Promote the student mid-exam.
+	if err := f.store.UpdateUserRole(f.student.ID, model.UserRoleTeacher); err != nil {
+		t.Fatalf("UpdateUserRole: %v", err)
+	}
+
+	if rec := f.do(t, f.student, http.MethodGet, fmt.Sprintf("/exam/%d", own)); rec.Code != http.StatusOK {
+		t.Errorf("promoted user should still open their own exam, got %d", rec.Code)
+	}
+	if rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", own)); rec.Code != http.StatusSeeOther {
+		t.Errorf("promoted user should still submit their own exam, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := f.do(t, f.student, http.MethodGet, fmt.Sprintf("/results/%d", own)); rec.Code != http.StatusOK {
+		t.Errorf("promoted user should still see their own results, got %d", rec.Code)
+	}
+
+	// Staff may view another user's exam but never answer or submit it.
+	if rec := f.do(t, f.student, http.MethodGet, fmt.Sprintf("/exam/%d", others)); rec.Code != http.StatusOK {
+		t.Errorf("teacher should be able to view another exam, got %d", rec.Code)
+	}
+	threads, _ := f.store.GetThreadsForSession(others)
+	if rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/answer/%d?answer=mine", others, threads[0].ID)); rec.Code != http.StatusForbidden {
+		t.Errorf("answering someone else's exam: expected 403, got %d", rec.Code)
+	}
+	if rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", others)); rec.Code != http.StatusForbidden {
+		t.Errorf("submitting someone else's exam: expected 403, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestExamPreviewLocksQuestionsUntilConfirm(t *testing.T) {
+	f := newRouterFixture(t)
+	f.handler.config = model.ExamConfig{NumQuestions: 2, Shuffle: true, ConfirmStart: true}
+	for _, text := range []string{"Q1", "Q2", "Q3", "Q4", "Q5"} {
+		if _, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10}); err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+	}
+	if _, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"}); err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+
+	rec := f.do(t, f.student, http.MethodPost, "/exam/start")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("confirm without preview: expected 400, got %d", rec.Code)
+	}
+
+	rec = f.do(t, f.student, http.MethodPost, "/exam/preview")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preview: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "You will be asked 2 questions.") {
+		t.Error("preview should show the locked question count")
+	}
+	preview, err := f.store.GetExamPreview(f.student.ID)
+	if err != nil || preview == nil {
+		t.Fatalf("GetExamPreview: %v, %v", preview, err)
+	}
+	locked := preview.QuestionIDs
+
+	// Previewing again, even with another topic, must not re-roll the
+	// question set.
+	for range 5 {
+		f.do(t, f.student, http.MethodPost, "/exam/preview")
+	}
+	f.doForm(t, f.student, http.MethodPost, "/exam/preview", url.Values{"topic": {"Mechanics"}})
+	preview, _ = f.store.GetExamPreview(f.student.ID)
+	if !reflect.DeepEqual(preview.QuestionIDs, locked) {
+		t.Errorf("preview re-rolled questions: %v, locked %v", preview.QuestionIDs, locked)
+	}
+
+	sessions, err := f.store.ListSessionsByUser(f.student.ID)
+	if err != nil {
+		t.Fatalf("ListSessionsByUser: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("previewing must not create a session, got %d", len(sessions))
+	}
+
+	rec = f.do(t, f.student, http.MethodPost, "/exam/start")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("confirm: expected 303, got %d: %s", rec.Code, rec.Body.String())
+	}
+	sessions, _ = f.store.ListSessionsByUser(f.student.ID)
+	if len(sessions) != 1 {
+		t.Fatalf("confirming should create one session, got %d", len(sessions))
+	}
+	threads, err := f.store.GetThreadsForSession(sessions[0].ID)
+	if err != nil {
+		t.Fatalf("GetThreadsForSession: %v", err)
+	}
+	var got []int64
+	for _, th := range threads {
+		got = append(got, th.QuestionID)
+	}
+	if !reflect.DeepEqual(got, locked) {
+		t.Errorf("session questions %v, want locked set %v", got, locked)
+	}
+	if p, _ := f.store.GetExamPreview(f.student.ID); p != nil {
+		t.Error("preview should be cleared once the exam starts")
+	}
+}
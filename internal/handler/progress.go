@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	appI18n "github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// gradingProgress is how far the grading of one session has come.
+type gradingProgress struct {
+	Graded int  `json:"graded"` // Threads with a final score
+	Total  int  `json:"total"`
+	Done   bool `json:"-"` // Grading has ended, successfully or not
+	Failed bool `json:"-"` // Grading stopped with an error; the session is not graded
+}
+
+// gradingBroker fans out grading progress to the students waiting for it.
+// The zero value is ready to use.
+type gradingBroker struct {
+	mu       sync.Mutex
+	sessions map[int64]*gradingSubscribers
+}
+
+type gradingSubscribers struct {
+	last gradingProgress
+	subs map[chan gradingProgress]struct{}
+}
+
+// publish records p for the session and sends it to its subscribers. A
+// subscriber that has not read the previous update only gets the newest.
+// Once p.Done is set the session is forgotten.
+func (b *gradingBroker) publish(sessionID int64, p gradingProgress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.session(sessionID)
+	s.last = p
+	for ch := range s.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- p
+	}
+	if p.Done {
+		delete(b.sessions, sessionID)
+	}
+}
+
+// subscribe returns a channel of progress updates for the session, the
+// latest update so far (zero if grading has not started), and a function
+// that ends the subscription.
+func (b *gradingBroker) subscribe(sessionID int64) (<-chan gradingProgress, gradingProgress, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.session(sessionID)
+	ch := make(chan gradingProgress, 1)
+	s.subs[ch] = struct{}{}
+	return ch, s.last, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if s, ok := b.sessions[sessionID]; ok {
+			delete(s.subs, ch)
+			if len(s.subs) == 0 && s.last.Total == 0 {
+				delete(b.sessions, sessionID)
+			}
+		}
+	}
+}
+
+// session returns the session's entry, creating it. b.mu must be held.
+func (b *gradingBroker) session(sessionID int64) *gradingSubscribers {
+	if b.sessions == nil {
+		b.sessions = make(map[int64]*gradingSubscribers)
+	}
+	s, ok := b.sessions[sessionID]
+	if !ok {
+		s = &gradingSubscribers{subs: make(map[chan gradingProgress]struct{})}
+		b.sessions[sessionID] = s
+	}
+	return s
+}
+
+// handleGradingEvents streams the grading progress of a submitted session
+// to its owner as server-sent events: "progress" carries {"graded", "total"}
+// after each scored question, "done" carries {"redirect"} with the results
+// page once the session is graded, and "failed" carries {"message"} if
+// grading stopped with an error.
+func (h *Handler) handleGradingEvents(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid session ID", http.StatusBadRequest)
+		return
+	}
+	sess, err := h.store.GetSession(sessionID)
+	if err != nil {
+		slog.Error("failed to get session", "session_id", sessionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ownsSession(model.UserFromContext(r.Context()), sess) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Subscribe before looking at the status again, so a session that
+	// finishes grading in between is not missed.
+	updates, last, cancel := h.grading.subscribe(sessionID)
+	defer cancel()
+	if sess, err = h.store.GetSession(sessionID); err != nil {
+		slog.Error("failed to get session", "session_id", sessionID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		slog.Debug("event stream flush failed", "error", err)
+	}
+
+	done := func() {
+		data, _ := json.Marshal(map[string]string{"redirect": h.path(fmt.Sprintf("/results/%d", sessionID))})
+		writeEvent(w, rc, "done", string(data))
+	}
+	if sess.Status == model.StatusGraded || sess.Status == model.StatusReviewed {
+		done()
+		return
+	}
+	if last.Total > 0 {
+		data, _ := json.Marshal(last)
+		writeEvent(w, rc, "progress", string(data))
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case p := <-updates:
+			if p.Failed {
+				data, _ := json.Marshal(map[string]string{"message": appI18n.T(r.Context(), "GradingFailed")})
+				writeEvent(w, rc, "failed", string(data))
+				return
+			}
+			if p.Done {
+				done()
+				return
+			}
+			data, _ := json.Marshal(p)
+			writeEvent(w, rc, "progress", string(data))
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// readEvent reads the next server-sent event from r.
+func readEvent(t *testing.T, r *bufio.Reader) (event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestGradingEvents(t *testing.T) {
+	f := newRouterFixture(t)
+	// The stub grader finishes one thread each time release is signaled.
+	release := make(chan struct{})
+	f.handler.llm = newStubLLM(t, func(*http.Request, string) string {
+		<-release
+		return `{"score": 8, "max_points": 10, "feedback": "good"}`
+	})
+
+	var ids []int64
+	for _, text := range []string{"Q1", "Q2"} {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, ids)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, _ := f.store.GetThreadsForSession(sessionID)
+	for _, th := range threads {
+		if _, err := f.store.AddMessage(model.Message{ThreadID: th.ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+
+	srv := httptest.NewServer(f.router)
+	t.Cleanup(srv.Close)
+	path := fmt.Sprintf("/exam/%d/grading-events", sessionID)
+	open := func(u *model.User) *http.Response {
+		t.Helper()
+		token, err := f.store.CreateAuthSession(u.ID)
+		if err != nil {
+			t.Fatalf("CreateAuthSession: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := open(f.teacher); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("only the owner may follow grading, teacher got %d", resp.StatusCode)
+	}
+
+	resp := open(f.student)
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", resp.StatusCode, ct)
+	}
+	events := bufio.NewReader(resp.Body)
+
+	graded := make(chan error, 1)
+	go func() { graded <- f.handler.gradeSession(t.Context(), sessionID) }()
+
+	for want := range 2 {
+		event, data := readEvent(t, events)
+		if wantData := fmt.Sprintf(`{"graded":%d,"total":2}`, want); event != "progress" || data != wantData {
+			t.Fatalf("event %d: got %s %s, want progress %s", want, event, data, wantData)
+		}
+		release <- struct{}{}
+	}
+	// The last progress update may be superseded by "done".
+	event, data := readEvent(t, events)
+	if event == "progress" {
+		event, data = readEvent(t, events)
+	}
+	if want := fmt.Sprintf(`{"redirect":"/results/%d"}`, sessionID); event != "done" || data != want {
+		t.Errorf("got %s %s, want done %s", event, data, want)
+	}
+	select {
+	case err := <-graded:
+		if err != nil {
+			t.Fatalf("gradeSession: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("grading did not finish")
+	}
+
+	// A session that is already graded says so at once.
+	event, _ = readEvent(t, bufio.NewReader(open(f.student).Body))
+	if event != "done" {
+		t.Errorf("graded session: got %s, want done", event)
+	}
+}
+
+// TestGradingEventsFailure ends the grading with a store error and expects
+// the student's event stream to report the failure instead of waiting.
+func TestGradingEventsFailure(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	token, err := f.store.CreateAuthSession(f.student.ID)
+	if err != nil {
+		t.Fatalf("CreateAuthSession: %v", err)
+	}
+
+	srv := httptest.NewServer(f.router)
+	t.Cleanup(srv.Close)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+fmt.Sprintf("/exam/%d/grading-events", sessionID), nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET grading-events: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected an event stream, got %d", resp.StatusCode)
+	}
+
+	// The stream is open; now make every store call fail.
+	f.store.Close()
+	if err := f.handler.gradeSubmittedSession(t.Context(), sessionID); err == nil {
+		t.Fatal("expected grading to fail on a closed store")
+	}
+
+	event, data := readEvent(t, bufio.NewReader(resp.Body))
+	if event != "failed" || !strings.Contains(data, "Grading stopped") {
+		t.Errorf("got %s %s, want a failed event", event, data)
+	}
+	f.handler.grading.mu.Lock()
+	defer f.handler.grading.mu.Unlock()
+	if _, ok := f.handler.grading.sessions[sessionID]; ok {
+		t.Error("the broker should forget a session whose grading failed")
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	appI18n "github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// rateLimiter is a set of in-memory token buckets keyed by user ID. Each
+// bucket holds up to perMinute tokens and refills at perMinute tokens a
+// minute, so a user can send a short burst but not a steady stream. The
+// zero value is ready to use.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[int64]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from key's bucket. If the bucket is empty it returns
+// false and how long until the next token.
+func (l *rateLimiter) allow(key int64, perMinute int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(perMinute)
+	rate := capacity / time.Minute.Seconds() // tokens per second
+	b, ok := l.buckets[key]
+	if !ok {
+		if l.buckets == nil {
+			l.buckets = make(map[int64]*tokenBucket)
+		}
+		b = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// limitAnswers rejects answer, evaluation and clarification requests beyond
+// --answer-rate-limit per user and minute with 429 and a Retry-After header,
+// so one student cannot flood a shared LLM server.
+func (h *Handler) limitAnswers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := model.UserFromContext(r.Context())
+		if h.config.AnswerRateLimit <= 0 || user == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, wait := h.answerLimiter.allow(user.ID, h.config.AnswerRateLimit, time.Now())
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		msg := appI18n.Td(r.Context(), "AnswerRateLimited", map[string]any{"Seconds": strconv.Itoa(seconds)})
+		if wantsJSON(r) || wantsEventStream(r) {
+			http.Error(w, msg, http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = fmt.Fprintf(w, `<p class="time-exceeded-error" role="alert">%s</p>`, html.EscapeString(msg))
+	})
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	var l rateLimiter
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := range 3 {
+		if ok, _ := l.allow(1, 3, now); !ok {
+			t.Fatalf("request %d of a full bucket should pass", i+1)
+		}
+	}
+	ok, wait := l.allow(1, 3, now)
+	if ok || wait != 20*time.Second {
+		t.Errorf("empty bucket: got ok=%v wait=%v, want false and 20s", ok, wait)
+	}
+	if ok, _ := l.allow(2, 3, now); !ok {
+		t.Error("another user has a bucket of their own")
+	}
+	if ok, _ := l.allow(1, 3, now.Add(20*time.Second)); !ok {
+		t.Error("one token should refill after 20s")
+	}
+}
+
+func TestAnswerRateLimit(t *testing.T) {
+	f := newRouterFixture(t)
+	f.handler.config = model.ExamConfig{NoFollowups: true, AnswerRateLimit: 2}
+	var ids []int64
+	for _, text := range []string{"Q1", "Q2", "Q3"} {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, ids)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, _ := f.store.GetThreadsForSession(sessionID)
+	answer := func(u *model.User, threadID int64) int {
+		path := fmt.Sprintf("/exam/%d/answer/%d", sessionID, threadID)
+		return f.doForm(t, u, http.MethodPost, path, url.Values{"answer": {"A"}}).Code
+	}
+
+	for _, th := range threads[:2] {
+		if code := answer(f.student, th.ID); code != http.StatusOK {
+			t.Fatalf("answers within the limit: expected 200, got %d", code)
+		}
+	}
+	path := fmt.Sprintf("/exam/%d/answer/%d", sessionID, threads[2].ID)
+	rec := f.doForm(t, f.student, http.MethodPost, path, url.Values{"answer": {"A"}})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 past the limit, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if !strings.Contains(rec.Body.String(), "too quickly") {
+		t.Errorf("expected a localized message, got %q", rec.Body.String())
+	}
+	if messages, _ := f.store.GetMessages(threads[2].ID); len(messages) != 0 {
+		t.Error("a rate-limited answer must not be stored")
+	}
+	evaluate := fmt.Sprintf("/exam/%d/answer/%d/evaluate", sessionID, threads[0].ID)
+	if rec := f.doForm(t, f.student, http.MethodPost, evaluate, url.Values{}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("evaluation requests count against the same limit, got %d", rec.Code)
+	}
+
+	// The limit is per user: the teacher is turned away for not owning the
+	// session, not for the student's spent budget.
+	if code := answer(f.teacher, threads[2].ID); code != http.StatusForbidden {
+		t.Errorf("other users are not limited by the student's budget, got %d", code)
+	}
+}
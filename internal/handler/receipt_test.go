@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestSubmissionReceipt(t *testing.T) {
+	f := newRouterFixture(t)
+	f.handler.config.SubmissionReceipts = true
+	f.handler.llm = newStubLLM(t, func(*http.Request, string) string {
+		return `{"score": 8, "max_points": 10, "feedback": "good"}`
+	})
+
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, err := f.store.GetThreadsForSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetThreadsForSession: %v", err)
+	}
+	if _, err := f.store.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "Inertia", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	if rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", sessionID)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("submit: expected 303, got %d", rec.Code)
+	}
+	sess, err := f.store.GetSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if model.NormalizeReceipt(sess.Receipt) != sess.Receipt || sess.Receipt == "" {
+		t.Fatalf("expected a receipt code on the submitted session, got %q", sess.Receipt)
+	}
+	rec := f.do(t, f.student, http.MethodGet, fmt.Sprintf("/results/%d", sessionID))
+	if !strings.Contains(rec.Body.String(), sess.Receipt) {
+		t.Error("the results page should show the receipt code")
+	}
+
+	// The code verifies however it is typed; another code does not.
+	typed := strings.ToLower(strings.ReplaceAll(sess.Receipt, "-", ""))
+	rec = f.do(t, f.teacher, http.MethodGet, "/verify/"+typed)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `id="receipt-valid"`) {
+		t.Errorf("valid receipt: expected 200 and the valid message, got %d", rec.Code)
+	}
+	other := "0000-0000-0000"
+	if sess.Receipt == other {
+		other = "FFFF-FFFF-FFFF"
+	}
+	for _, code := range []string{other, "not-a-receipt"} {
+		rec = f.do(t, f.teacher, http.MethodGet, "/verify/"+code)
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), `id="receipt-invalid"`) {
+			t.Errorf("receipt %q: expected 404 and the invalid message, got %d", code, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/report"
+)
+
+func TestReviewListStudentIdentifier(t *testing.T) {
+	f := newRouterFixture(t)
+	studentID, err := f.store.CreateUser(model.User{Username: "ivanov", ExternalID: "UNI-7", DisplayName: "Ivanov Alexei", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, err := f.store.CreateSession(bpID, studentID, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := f.store.UpdateSessionStatus(sessID, model.StatusGraded); err != nil {
+		t.Fatalf("UpdateSessionStatus: %v", err)
+	}
+
+	for _, tt := range []struct {
+		identifier    string
+		shown, hidden string
+	}{
+		{model.StudentIdentifierDisplayName, ">Ivanov Alexei<", ">UNI-7<"},
+		{model.StudentIdentifierExternalID, ">UNI-7<", ">Ivanov Alexei<"},
+		{model.StudentIdentifierUsername, ">ivanov<", ">UNI-7<"},
+	} {
+		t.Run(tt.identifier, func(t *testing.T) {
+			f.handler.config.StudentIdentifier = tt.identifier
+			rec := f.do(t, f.teacher, http.MethodGet, "/review")
+			body := rec.Body.String()
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, body)
+			}
+			if !strings.Contains(body, tt.shown) || strings.Contains(body, tt.hidden) {
+				t.Errorf("expected %s shown and %s hidden, got: %s", tt.shown, tt.hidden, body)
+			}
+			if !strings.Contains(body, `title="Ivanov Alexei · UNI-7 · ivanov"`) {
+				t.Error("the full student record should stay available in the tooltip")
+			}
+		})
+	}
+}
+
+func TestReviewListPagination(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	var ids []int64
+	for i := 0; i < 30; i++ {
+		id, err := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		if err := f.store.UpdateSessionStatus(id, model.StatusGraded); err != nil {
+			t.Fatalf("UpdateSessionStatus: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	// An in-progress session is not reviewable and must not count.
+	if _, err := f.store.CreateSession(bpID, f.student.ID, []int64{q}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	reviewLink := func(id int64) string { return `href="/review/` + itoa(id) + `"` }
+
+	body := f.do(t, f.teacher, http.MethodGet, "/review").Body.String()
+	if n := strings.Count(body, `href="/review/`); n != model.DefaultPageSize {
+		t.Errorf("first page should list %d sessions, got %d", model.DefaultPageSize, n)
+	}
+	if !strings.Contains(body, reviewLink(ids[29])) || strings.Contains(body, reviewLink(ids[4])) {
+		t.Error("first page should start with the newest session")
+	}
+	if !strings.Contains(body, "Page 1 of 2") || !strings.Contains(body, `href="/review?page=2"`) || strings.Contains(body, `rel="prev"`) {
+		t.Errorf("first page should link to the next page only: %s", body)
+	}
+
+	body = f.do(t, f.teacher, http.MethodGet, "/review?page=2").Body.String()
+	if n := strings.Count(body, `href="/review/`); n != 5 || !strings.Contains(body, reviewLink(ids[0])) {
+		t.Errorf("second page should hold the 5 oldest sessions, got %d", n)
+	}
+	if !strings.Contains(body, `href="/review?page=1"`) || strings.Contains(body, `rel="next"`) {
+		t.Error("last page should link back only")
+	}
+
+	body = f.do(t, f.teacher, http.MethodGet, "/review?size=10&page=3").Body.String()
+	if !strings.Contains(body, "Page 3 of 3") || !strings.Contains(body, `href="/review?page=2&amp;size=10"`) {
+		t.Errorf("custom page size should be kept on links: %s", body)
+	}
+
+	body = f.do(t, f.teacher, http.MethodGet, "/review?size=1000").Body.String()
+	if n := strings.Count(body, `href="/review/`); n != 30 || strings.Contains(body, "Page 1 of") {
+		t.Errorf("a capped large page should show all 30 sessions on one page, got %d", n)
+	}
+}
+
+func TestReviewListFlagsLowConfidence(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, _ := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	if err := f.store.UpdateSessionStatus(sessID, model.StatusGraded); err != nil {
+		t.Fatalf("UpdateSessionStatus: %v", err)
+	}
+	threads, _ := f.store.GetThreadsForSession(sessID)
+	if err := f.store.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5, LLMConfidence: 0.2}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+
+	f.handler.config.LowConfidenceThreshold = 0.5
+	if body := f.do(t, f.teacher, http.MethodGet, "/review").Body.String(); !strings.Contains(body, "1 low-confidence grade") {
+		t.Errorf("expected the session flagged for low confidence: %s", body)
+	}
+	f.handler.config.LowConfidenceThreshold = 0
+	if body := f.do(t, f.teacher, http.MethodGet, "/review").Body.String(); strings.Contains(body, "low-confidence") {
+		t.Error("a zero threshold should disable the flag")
+	}
+
+	f.handler.config.LowConfidenceThreshold = 0.5
+	if err := f.store.UpsertThreadReview(model.ThreadReview{ThreadID: threads[0].ID, ReviewerID: f.teacher.ID, Score: 6}); err != nil {
+		t.Fatalf("UpsertThreadReview: %v", err)
+	}
+	if body := f.do(t, f.teacher, http.MethodGet, "/review").Body.String(); strings.Contains(body, "low-confidence") {
+		t.Error("a reviewed answer should no longer be flagged")
+	}
+}
+
+func TestUpdateScoreCoGrading(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, _ := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	threads, _ := f.store.GetThreadsForSession(sessID)
+	threadID := threads[0].ID
+	if err := f.store.UpsertScore(model.QuestionScore{ThreadID: threadID, LLMScore: 5}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+
+	path := "/review/" + itoa(sessID) + "/score/" + itoa(threadID)
+	for _, r := range []struct {
+		user  *model.User
+		score string
+	}{{f.teacher, "6"}, {f.admin, "9"}, {f.teacher, "7"}} {
+		form := url.Values{"teacher_score": {r.score}, "teacher_comment": {"by " + r.user.Username}}
+		if rec := f.doForm(t, r.user, http.MethodPost, path, form); rec.Code != http.StatusSeeOther {
+			t.Fatalf("expected redirect, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	reviews, _ := f.store.ListThreadReviews(threadID)
+	if len(reviews) != 2 {
+		t.Fatalf("expected one review per teacher, got %+v", reviews)
+	}
+	score, _ := f.store.GetScore(threadID)
+	if score.TeacherScore == nil || *score.TeacherScore != 8 || score.TeacherComment != "by teacher\n\nby admin" {
+		t.Errorf("expected the reviews averaged, got %v %q", score.TeacherScore, score.TeacherComment)
+	}
+}
+
+func TestReviewPageShowsAuditLog(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, _ := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	threads, _ := f.store.GetThreadsForSession(sessID)
+	if err := f.store.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+	if err := f.store.UpsertGrade(model.Grade{SessionID: sessID, LLMGrade: 50}); err != nil {
+		t.Fatalf("UpsertGrade: %v", err)
+	}
+
+	reviewPath := "/review/" + itoa(sessID)
+	if body := f.do(t, f.teacher, http.MethodGet, reviewPath).Body.String(); strings.Contains(body, "Change history") {
+		t.Error("a session without changes should show no change history")
+	}
+
+	form := url.Values{"teacher_score": {"8"}, "teacher_comment": {""}}
+	if rec := f.doForm(t, f.teacher, http.MethodPost, reviewPath+"/score/"+itoa(threads[0].ID), form); rec.Code != http.StatusSeeOther {
+		t.Fatalf("score: expected redirect, got %d", rec.Code)
+	}
+	if rec := f.doForm(t, f.admin, http.MethodPost, reviewPath+"/finalize", url.Values{"final_grade": {"80"}}); rec.Code != http.StatusSeeOther {
+		t.Fatalf("finalize: expected redirect, got %d", rec.Code)
+	}
+
+	body := f.do(t, f.teacher, http.MethodGet, reviewPath).Body.String()
+	for _, want := range []string{"Change history (2)", "Score of question 1", "Final grade", ">teacher<", ">admin<"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("review page: missing %q", want)
+		}
+	}
+}
+
+func TestAddQuestionToLiveSession(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, _ := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	path := "/review/" + itoa(sessID) + "/questions"
+
+	form := url.Values{"text": {"Why does the Moon not fall?"}, "difficulty": {"hard"}, "topic": {"Gravity"}, "max_points": {"5"}}
+	rec := f.doForm(t, f.teacher, http.MethodPost, path, form)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect to the review page, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	view, err := f.store.GetSessionView(sessID)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	if len(view.Threads) != 2 {
+		t.Fatalf("expected the added thread in the session, got %d threads", len(view.Threads))
+	}
+	added := view.Threads[1]
+	if added.Question.Text != "Why does the Moon not fall?" || added.Question.MaxPoints != 5 || added.Thread.Status != model.ThreadOpen {
+		t.Errorf("unexpected added thread: %+v", added)
+	}
+	if body := f.do(t, f.student, http.MethodGet, "/exam/"+itoa(sessID)).Body.String(); !strings.Contains(body, "Why does the Moon not fall?") {
+		t.Error("the student's exam page should include the added question")
+	}
+	if pool, _ := f.store.ListQuestionsFiltered("", "", ""); len(pool) != 1 {
+		t.Errorf("the ad hoc question should stay out of the exam pool, got %d questions", len(pool))
+	}
+
+	form.Set("text", "Q1")
+	if rec := f.doForm(t, f.teacher, http.MethodPost, path, form); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for the text of a bank question, got %d", rec.Code)
+	}
+	if threads, _ := f.store.GetThreadsForSession(sessID); len(threads) != 2 {
+		t.Errorf("a conflicting question must not add a thread, got %d threads", len(threads))
+	}
+	if bank, _ := f.store.GetQuestion(q); bank.MaxPoints != 10 || bank.Difficulty != model.DifficultyEasy {
+		t.Errorf("the bank question must be left alone, got %+v", bank)
+	}
+
+	form.Set("text", " ")
+	if rec := f.doForm(t, f.teacher, http.MethodPost, path, form); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty question, got %d", rec.Code)
+	}
+	if rec := f.doForm(t, f.student, http.MethodPost, path, form); rec.Code != http.StatusForbidden {
+		t.Errorf("students should not add questions, got %d", rec.Code)
+	}
+	if err := f.store.UpdateSessionStatus(sessID, model.StatusGraded); err != nil {
+		t.Fatalf("UpdateSessionStatus: %v", err)
+	}
+	form.Set("text", "Another question")
+	if rec := f.doForm(t, f.teacher, http.MethodPost, path, form); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 once the session is submitted, got %d", rec.Code)
+	}
+}
+
+func TestAddBankQuestionToLiveSession(t *testing.T) {
+	f := newRouterFixture(t)
+	f.handler.llm = newStubLLM(t, func(*http.Request, string) string {
+		return `{"score": 8, "max_points": 10, "feedback": "good"}`
+	})
+
+	var qIDs []int64
+	for _, text := range []string{"Explain inertia", "Why does the Moon not fall?"} {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		qIDs = append(qIDs, id)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, _ := f.store.CreateSession(bpID, f.student.ID, qIDs[:1])
+	path := "/review/" + itoa(sessID) + "/questions"
+
+	// The picker lists nothing until the teacher searches, then offers only
+	// matching questions the session does not have.
+	body := f.do(t, f.teacher, http.MethodGet, "/review/"+itoa(sessID)).Body.String()
+	if !strings.Contains(body, `name="bank_q"`) || strings.Contains(body, `<option value="`+itoa(qIDs[1])+`"`) {
+		t.Error("the bank picker should show a search box and no questions before a search")
+	}
+	body = f.do(t, f.teacher, http.MethodGet, "/review/"+itoa(sessID)+"?bank_q=moon").Body.String()
+	if !strings.Contains(body, `<option value="`+itoa(qIDs[1])+`"`) || strings.Contains(body, `<option value="`+itoa(qIDs[0])+`"`) {
+		t.Error("the bank picker should offer only the matching question not yet asked")
+	}
+	body = f.do(t, f.teacher, http.MethodGet, "/review/"+itoa(sessID)+"?bank_q=inertia").Body.String()
+	if strings.Contains(body, `name="question_id"`) || !strings.Contains(body, "No questions match") {
+		t.Error("a search matching only asked questions should offer nothing")
+	}
+
+	add := func(id string) int {
+		return f.doForm(t, f.teacher, http.MethodPost, path, url.Values{"question_id": {id}}).Code
+	}
+	if code := add(itoa(qIDs[1])); code != http.StatusSeeOther {
+		t.Fatalf("expected redirect to the review page, got %d", code)
+	}
+	if code := add(itoa(qIDs[1])); code != http.StatusConflict {
+		t.Errorf("adding a question twice: expected 409, got %d", code)
+	}
+	if code := add("999"); code != http.StatusBadRequest {
+		t.Errorf("unknown question: expected 400, got %d", code)
+	}
+
+	threads, _ := f.store.GetThreadsForSession(sessID)
+	if len(threads) != 2 || threads[1].QuestionID != qIDs[1] || threads[1].Status != model.ThreadOpen {
+		t.Fatalf("expected an open thread for the added question, got %+v", threads)
+	}
+	if body := f.do(t, f.student, http.MethodGet, "/exam/"+itoa(sessID)).Body.String(); !strings.Contains(body, "Why does the Moon not fall?") {
+		t.Error("the student's exam page should include the added question")
+	}
+
+	// The added thread is graded with the others.
+	for _, th := range threads {
+		if _, err := f.store.AddMessage(model.Message{ThreadID: th.ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+	if rec := f.do(t, f.student, http.MethodPost, "/exam/"+itoa(sessID)+"/submit"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("submit: expected 303, got %d", rec.Code)
+	}
+	view, err := f.store.GetSessionView(sessID)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	if added := view.Threads[1]; added.Score == nil || added.Score.LLMScore != 8 {
+		t.Errorf("expected the added question graded 8, got %+v", added.Score)
+	}
+	if view.Grade == nil || view.Grade.LLMGrade != 80 {
+		t.Errorf("expected grade 80 over both questions, got %+v", view.Grade)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Explain inertia", Difficulty: model.DifficultyEasy, Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Physics final"})
+	sessID, _ := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	threads, _ := f.store.GetThreadsForSession(sessID)
+	f.store.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "Objects keep moving"})
+	f.store.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 7, LLMFeedback: "Mostly right"})
+	f.store.UpsertGrade(model.Grade{SessionID: sessID, LLMGrade: 70})
+	f.store.UpdateSessionStatus(sessID, model.StatusGraded)
+
+	path := "/review/" + itoa(sessID) + "/transcript"
+	rec := f.do(t, f.teacher, http.MethodGet, path)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Physics final", "Explain inertia", "Objects keep moving", "Mostly right", "<style>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("transcript should contain %q", want)
+		}
+	}
+	if strings.Contains(body, `<link rel="stylesheet"`) || strings.Contains(body, "<script src=") {
+		t.Error("transcript should not load external stylesheets or scripts")
+	}
+
+	if rec := f.do(t, f.student, http.MethodGet, path); rec.Code != http.StatusForbidden {
+		t.Errorf("students should get 403, got %d", rec.Code)
+	}
+	if rec := f.do(t, f.teacher, http.MethodGet, "/review/9999/transcript"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing session, got %d", rec.Code)
+	}
+	if rec := f.do(t, f.teacher, http.MethodGet, path+"?format=docx"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rec.Code)
+	}
+
+	font, err := report.LoadFont("")
+	if err != nil {
+		t.Skip(err)
+	}
+	f.handler.reportFont = font
+	rec = f.do(t, f.teacher, http.MethodGet, path+"?format=pdf")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" || !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Errorf("expected a PDF, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	f := newRouterFixture(t)
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: model.DifficultyEasy, Topic: "T", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, err := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	rec := f.do(t, f.teacher, http.MethodPost, "/review/"+itoa(sessID)+"/redeliver")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") == "/review/"+itoa(sessID) {
+		t.Fatalf("expected a redirect to the new session, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := f.do(t, f.teacher, http.MethodPost, "/review/9999/redeliver"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing session, got %d", rec.Code)
+	}
+}
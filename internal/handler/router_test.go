@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/llm"
+	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/store"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// routerFixture serves the full route tree over an in-memory store with
+// one user per role.
+type routerFixture struct {
+	store   *store.Store
+	handler *Handler
+	router  http.Handler
+	admin   *model.User
+	teacher *model.User
+	student *model.User
+}
+
+func newRouterFixture(t *testing.T) *routerFixture {
+	t.Helper()
+	if err := i18n.Init("en"); err != nil {
+		t.Fatalf("Init(en): %v", err)
+	}
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	f := &routerFixture{store: s}
+	create := func(username string, role model.UserRole) *model.User {
+		id, err := s.CreateUser(model.User{Username: username, DisplayName: "Name " + username, PasswordHash: "x", Role: role, Active: true})
+		if err != nil {
+			t.Fatalf("CreateUser(%s): %v", username, err)
+		}
+		u, err := s.GetUserByID(id)
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		return u
+	}
+	f.admin = create("admin", model.UserRoleAdmin)
+	f.teacher = create("teacher", model.UserRoleTeacher)
+	f.student = create("student", model.UserRoleStudent)
+
+	f.handler = &Handler{store: s, impersonationKey: []byte("test-key")}
+	r := chi.NewRouter()
+	r.Use(i18n.Middleware("en"))
+	r.Use(f.handler.BasePathMiddleware)
+	f.handler.Routes(r)
+	f.router = r
+	return f
+}
+
+// newStubLLM returns an LLM client backed by a test server that answers
+// every request with reply(r, body), body being the raw request body: chat
+// completions get the reply as the assistant message and model listings a
+// single "stub" model. An empty reply fails the request with 502.
+func newStubLLM(t *testing.T, reply func(r *http.Request, body string) string) *llm.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		content := reply(r, string(body))
+		if content == "" {
+			http.Error(w, "stub LLM failure", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/models") {
+			_ = json.NewEncoder(w).Encode(openai.ModelsList{Models: []openai.Model{{ID: "stub"}}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	c, err := llm.New(srv.URL, "test", "stub", "standard", llm.Options{})
+	if err != nil {
+		t.Fatalf("llm.New: %v", err)
+	}
+	return c
+}
+
+// do sends an authenticated request as u, with a valid CSRF token and any
+// extra cookies.
+func (f *routerFixture) do(t *testing.T, u *model.User, method, path string, extra ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	return f.doForm(t, u, method, path, nil, extra...)
+}
+
+// doForm is do with additional form fields in the request body.
+func (f *routerFixture) doForm(t *testing.T, u *model.User, method, path string, form url.Values, extra ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	token, err := f.store.CreateAuthSession(u.ID)
+	if err != nil {
+		t.Fatalf("CreateAuthSession: %v", err)
+	}
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("csrf_token", "csrf")
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "csrf"})
+	for _, c := range extra {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func impersonationCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == impersonationCookieName {
+			return c
+		}
+	}
+	return nil
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
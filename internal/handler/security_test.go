@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	serve := func(cfg model.ExamConfig) http.Header {
+		h := &Handler{config: cfg}
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		rec := httptest.NewRecorder()
+		h.SecurityHeaders(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Header()
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		hdr := serve(model.ExamConfig{
+			ContentSecurityPolicy: DefaultContentSecurityPolicy,
+			FrameAncestors:        DefaultFrameAncestors,
+		})
+		want := map[string]string{
+			"Content-Security-Policy": DefaultContentSecurityPolicy + "; frame-ancestors 'self'",
+			"X-Content-Type-Options":  "nosniff",
+			"X-Frame-Options":         "SAMEORIGIN",
+			"Referrer-Policy":         "strict-origin-when-cross-origin",
+		}
+		for k, v := range want {
+			if got := hdr.Get(k); got != v {
+				t.Errorf("%s = %q, want %q", k, got, v)
+			}
+		}
+	})
+
+	t.Run("LMS embedding", func(t *testing.T) {
+		hdr := serve(model.ExamConfig{
+			ContentSecurityPolicy: "default-src 'self';",
+			FrameAncestors:        "'self' https://lms.example.edu",
+		})
+		if got, want := hdr.Get("Content-Security-Policy"), "default-src 'self'; frame-ancestors 'self' https://lms.example.edu"; got != want {
+			t.Errorf("Content-Security-Policy = %q, want %q", got, want)
+		}
+		if got := hdr.Get("X-Frame-Options"); got != "" {
+			t.Errorf("X-Frame-Options should be omitted for an allowlist, got %q", got)
+		}
+	})
+
+	t.Run("CSP disabled", func(t *testing.T) {
+		hdr := serve(model.ExamConfig{FrameAncestors: "'none'"})
+		if got := hdr.Get("Content-Security-Policy"); got != "" {
+			t.Errorf("Content-Security-Policy should be unset, got %q", got)
+		}
+		if got := hdr.Get("X-Frame-Options"); got != "DENY" {
+			t.Errorf("X-Frame-Options = %q, want DENY", got)
+		}
+		if got := hdr.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// errInsufficientQuestions is returned by selectQuestions under the error policy.
+var errInsufficientQuestions = errors.New("not enough questions")
+
+// errRequiredTopic is returned by coverRequiredTopics when the required
+// topics cannot all be covered.
+var errRequiredTopic = errors.New("required topic not covered")
+
+// selectQuestions picks the questions for a new exam session from the
+// questions matching the exam filters. When fewer than n match, policy
+// decides whether to clamp, fail, or top up from pool (called lazily; it
+// returns questions from all topics). n <= 0 means all matching questions.
+// Questions in repeats (the student's earlier ones) are only picked once
+// the others run out; nil means no preference. Among the rest, questions on
+// topics with a lower count in recentTopics (how many of the student's
+// recent sessions covered the topic) are picked first; nil means no
+// preference either.
+func selectQuestions(matching []model.Question, n int, policy string, shuffle bool, repeats map[int64]bool, recentTopics map[string]int, pool func() ([]model.Question, error)) ([]model.Question, error) {
+	seen := make(map[string]bool, len(matching))
+	questions := dedupeQuestions(matching, seen)
+	if shuffle {
+		shuffleQuestions(questions)
+	}
+	questions = unseenFirst(freshTopicsFirst(questions, recentTopics), repeats)
+
+	if n <= 0 || len(questions) >= n {
+		if n > 0 {
+			questions = questions[:n]
+		}
+		return questions, nil
+	}
+
+	switch policy {
+	case model.InsufficientError:
+		return nil, fmt.Errorf("%w: only %d match the exam filters, %d required", errInsufficientQuestions, len(questions), n)
+	case model.InsufficientPad:
+		all, err := pool()
+		if err != nil {
+			return nil, err
+		}
+		extra := dedupeQuestions(all, seen)
+		if shuffle {
+			shuffleQuestions(extra)
+		}
+		extra = unseenFirst(freshTopicsFirst(extra, recentTopics), repeats)
+		if missing := n - len(questions); len(extra) > missing {
+			extra = extra[:missing]
+		}
+		return append(questions, extra...), nil
+	default:
+		return questions, nil
+	}
+}
+
+// selectByDifficultyMix draws mix[d] questions of each difficulty d, listing
+// each difficulty's candidates with list. Within a difficulty the same
+// shuffle, recent-topic and repeat preferences apply as in selectQuestions.
+// The set runs from easy to hard unless shuffle is on. It fails with
+// errInsufficientQuestions if a difficulty has too few questions.
+func selectByDifficultyMix(mix model.DifficultyMix, shuffle bool, repeats map[int64]bool, recentTopics map[string]int, list func(model.Difficulty) ([]model.Question, error)) ([]model.Question, error) {
+	seen := make(map[string]bool)
+	var questions []model.Question
+	for _, d := range []model.Difficulty{model.DifficultyEasy, model.DifficultyMedium, model.DifficultyHard} {
+		n := mix[d]
+		if n <= 0 {
+			continue
+		}
+		matching, err := list(d)
+		if err != nil {
+			return nil, err
+		}
+		bucket := dedupeQuestions(matching, seen)
+		if len(bucket) < n {
+			return nil, fmt.Errorf("%w: the difficulty mix asks for %d %s questions, only %d match", errInsufficientQuestions, n, d, len(bucket))
+		}
+		if shuffle {
+			shuffleQuestions(bucket)
+		}
+		bucket = unseenFirst(freshTopicsFirst(bucket, recentTopics), repeats)
+		questions = append(questions, bucket[:n]...)
+	}
+	if shuffle {
+		shuffleQuestions(questions)
+	}
+	return questions, nil
+}
+
+// coverRequiredTopics makes sure selected has at least one question on each
+// of the required topics. It takes the first question on each uncovered
+// topic from pool, which should already be in order of preference, and
+// then fills the rest of the n places (n <= 0 means no limit) from
+// selected. It fails if a required topic has no questions in pool, or if
+// there are more required topics than places.
+func coverRequiredTopics(selected []model.Question, n int, required []string, pool []model.Question) ([]model.Question, error) {
+	if n > 0 && len(required) > n {
+		return nil, fmt.Errorf("%w: %d required topics do not fit in %d questions", errRequiredTopic, len(required), n)
+	}
+	covered := make(map[string]bool, len(selected))
+	for _, q := range selected {
+		covered[q.Topic] = true
+	}
+
+	var must []model.Question
+	for _, topic := range required {
+		if covered[topic] {
+			continue
+		}
+		i := slices.IndexFunc(pool, func(q model.Question) bool { return q.Topic == topic })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: no questions on topic %q", errRequiredTopic, topic)
+		}
+		must = append(must, pool[i])
+		covered[topic] = true
+	}
+	// Make room by dropping the least preferred questions from selected,
+	// but never the last one on a required topic. The must questions are on
+	// topics selected lacks, so the two never overlap.
+	drop := 0
+	if n > 0 {
+		drop = len(selected) + len(must) - n
+	}
+	isRequired := make(map[string]bool, len(required))
+	for _, topic := range required {
+		isRequired[topic] = true
+	}
+	remaining := make(map[string]int)
+	for _, q := range selected {
+		remaining[q.Topic]++
+	}
+	rest := make([]model.Question, 0, len(selected))
+	for i := len(selected) - 1; i >= 0; i-- {
+		q := selected[i]
+		if drop > 0 && (!isRequired[q.Topic] || remaining[q.Topic] > 1) {
+			remaining[q.Topic]--
+			drop--
+			continue
+		}
+		rest = append(rest, q)
+	}
+	slices.Reverse(rest)
+	return append(must, rest...), nil
+}
+
+// dedupeQuestions returns the questions whose text is not yet in seen,
+// recording them (guards against legacy DB duplicates).
+func dedupeQuestions(questions []model.Question, seen map[string]bool) []model.Question {
+	unique := make([]model.Question, 0, len(questions))
+	for _, q := range questions {
+		if !seen[q.Text] {
+			seen[q.Text] = true
+			unique = append(unique, q)
+		}
+	}
+	return unique
+}
+
+// unseenFirst stably moves the questions in repeats behind the others.
+func unseenFirst(questions []model.Question, repeats map[int64]bool) []model.Question {
+	if len(repeats) == 0 {
+		return questions
+	}
+	ordered := make([]model.Question, 0, len(questions))
+	var again []model.Question
+	for _, q := range questions {
+		if repeats[q.ID] {
+			again = append(again, q)
+		} else {
+			ordered = append(ordered, q)
+		}
+	}
+	return append(ordered, again...)
+}
+
+// freshTopicsFirst stably orders questions by how many recent sessions
+// covered their topic, least practiced topics first.
+func freshTopicsFirst(questions []model.Question, recentTopics map[string]int) []model.Question {
+	if len(recentTopics) == 0 {
+		return questions
+	}
+	slices.SortStableFunc(questions, func(a, b model.Question) int {
+		return cmp.Compare(recentTopics[a.Topic], recentTopics[b.Topic])
+	})
+	return questions
+}
+
+func shuffleQuestions(questions []model.Question) {
+	rand.Shuffle(len(questions), func(i, j int) {
+		questions[i], questions[j] = questions[j], questions[i]
+	})
+}
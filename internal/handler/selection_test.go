@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestSelectQuestionsInsufficientPolicies(t *testing.T) {
+	optics := []model.Question{
+		{ID: 1, Text: "Q1", Topic: "Optics"},
+		{ID: 2, Text: "Q2", Topic: "Optics"},
+	}
+	bank := append([]model.Question{
+		{ID: 3, Text: "Q3", Topic: "Mechanics"},
+		{ID: 4, Text: "Q4", Topic: "Mechanics"},
+		{ID: 5, Text: "Q5", Topic: "Thermodynamics"},
+	}, optics...)
+	pool := func() ([]model.Question, error) { return bank, nil }
+
+	t.Run("clamp", func(t *testing.T) {
+		got, err := selectQuestions(optics, 4, model.InsufficientClamp, true, nil, nil, pool)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 {
+			t.Errorf("expected exam clamped to 2 questions, got %d", len(got))
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := selectQuestions(optics, 4, model.InsufficientError, true, nil, nil, pool)
+		if !errors.Is(err, errInsufficientQuestions) {
+			t.Errorf("expected errInsufficientQuestions, got %v", err)
+		}
+	})
+
+	t.Run("pad other topics", func(t *testing.T) {
+		got, err := selectQuestions(optics, 4, model.InsufficientPad, true, nil, nil, pool)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 4 {
+			t.Fatalf("expected 4 questions, got %d", len(got))
+		}
+		seen := map[int64]bool{}
+		optic := 0
+		for _, q := range got {
+			if seen[q.ID] {
+				t.Errorf("question %d selected twice", q.ID)
+			}
+			seen[q.ID] = true
+			if q.Topic == "Optics" {
+				optic++
+			}
+		}
+		if optic != 2 {
+			t.Errorf("expected both topic questions to be kept, got %d", optic)
+		}
+	})
+
+	t.Run("pad with small bank", func(t *testing.T) {
+		got, err := selectQuestions(optics, 10, model.InsufficientPad, false, nil, nil, pool)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != len(bank) {
+			t.Errorf("expected whole bank (%d), got %d", len(bank), len(got))
+		}
+	})
+
+	t.Run("enough questions ignores policy", func(t *testing.T) {
+		got, err := selectQuestions(bank, 3, model.InsufficientError, false, nil, nil, func() ([]model.Question, error) {
+			t.Fatal("pool should not be consulted")
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 3 {
+			t.Errorf("expected 3 questions, got %d", len(got))
+		}
+	})
+}
+
+func TestSelectQuestionsAvoidsRepeats(t *testing.T) {
+	bank := []model.Question{
+		{ID: 1, Text: "Q1"}, {ID: 2, Text: "Q2"}, {ID: 3, Text: "Q3"}, {ID: 4, Text: "Q4"}, {ID: 5, Text: "Q5"},
+	}
+	repeats := map[int64]bool{1: true, 3: true, 4: true}
+
+	for range 20 {
+		got, err := selectQuestions(bank, 2, model.InsufficientClamp, true, repeats, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 || repeats[got[0].ID] || repeats[got[1].ID] {
+			t.Fatalf("expected only unseen questions 2 and 5, got %+v", got)
+		}
+	}
+
+	// With too few unseen questions the earlier ones fill the gap.
+	got, err := selectQuestions(bank, 4, model.InsufficientClamp, false, repeats, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []int64
+	for _, q := range got {
+		ids = append(ids, q.ID)
+	}
+	if want := []int64{2, 5, 1, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected unseen questions first, got %v, want %v", ids, want)
+	}
+}
+
+func TestSelectByDifficultyMix(t *testing.T) {
+	var bank []model.Question
+	for i, d := range []model.Difficulty{"hard", "easy", "medium", "easy", "hard", "medium", "easy", "medium"} {
+		bank = append(bank, model.Question{ID: int64(i + 1), Text: "Q" + strconv.Itoa(i+1), Difficulty: d})
+	}
+	list := func(d model.Difficulty) ([]model.Question, error) {
+		var matching []model.Question
+		for _, q := range bank {
+			if q.Difficulty == d {
+				matching = append(matching, q)
+			}
+		}
+		return matching, nil
+	}
+
+	mix := model.DifficultyMix{model.DifficultyEasy: 2, model.DifficultyMedium: 3, model.DifficultyHard: 1}
+	for _, shuffle := range []bool{false, true} {
+		got, err := selectByDifficultyMix(mix, shuffle, nil, nil, list)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		counts := make(model.DifficultyMix)
+		for _, q := range got {
+			counts[q.Difficulty]++
+		}
+		if !reflect.DeepEqual(counts, mix) {
+			t.Errorf("shuffle=%v: expected %v per difficulty, got %v", shuffle, mix, counts)
+		}
+		if !shuffle {
+			if ids := questionIDs(got); !reflect.DeepEqual(ids, []int64{2, 4, 3, 6, 8, 1}) {
+				t.Errorf("expected easy to hard in bank order [2 4 3 6 8 1], got %v", ids)
+			}
+		}
+	}
+
+	// Repeats are only drawn when a difficulty runs out of fresh questions.
+	got, err := selectByDifficultyMix(model.DifficultyMix{model.DifficultyEasy: 2}, false, map[int64]bool{2: true}, nil, list)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := questionIDs(got); !reflect.DeepEqual(ids, []int64{4, 7}) {
+		t.Errorf("expected the unseen easy questions [4 7], got %v", ids)
+	}
+
+	_, err = selectByDifficultyMix(model.DifficultyMix{model.DifficultyHard: 3}, false, nil, nil, list)
+	if !errors.Is(err, errInsufficientQuestions) || !strings.Contains(err.Error(), "3 hard questions, only 2 match") {
+		t.Errorf("expected an insufficient-questions error naming the difficulty, got %v", err)
+	}
+}
+
+func TestCoverRequiredTopics(t *testing.T) {
+	bank := []model.Question{
+		{ID: 1, Text: "Q1", Topic: "Mechanics"},
+		{ID: 2, Text: "Q2", Topic: "Mechanics"},
+		{ID: 3, Text: "Q3", Topic: "Mechanics"},
+		{ID: 4, Text: "Q4", Topic: "Optics"},
+		{ID: 5, Text: "Q5", Topic: "Optics"},
+		{ID: 6, Text: "Q6", Topic: "Thermodynamics"},
+	}
+	required := []string{"Mechanics", "Optics", "Thermodynamics"}
+
+	for _, selected := range [][]model.Question{
+		bank[:3],                             // Only Mechanics drawn
+		{bank[3], bank[0], bank[4]},          // Optics and Mechanics drawn
+		{bank[0], bank[1], bank[2]},          // Crowded out by one topic
+		{bank[5], bank[3], bank[0]},          // Already covered
+		{bank[4], bank[3], bank[5], bank[1]}, // Extra question beyond n
+	} {
+		got, err := coverRequiredTopics(selected, 3, required, bank)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 3 {
+			t.Errorf("expected 3 questions, got %v", got)
+		}
+		topics := make(map[string]bool)
+		for _, q := range got {
+			topics[q.Topic] = true
+		}
+		for _, topic := range required {
+			if !topics[topic] {
+				t.Errorf("selection %v: chosen set %v lacks required topic %q", selected, got, topic)
+			}
+		}
+	}
+
+	// Without a limit, the required questions are added to the selection.
+	got, err := coverRequiredTopics(bank[:2], 0, required, bank)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := questionIDs(got); !reflect.DeepEqual(ids, []int64{4, 6, 1, 2}) {
+		t.Errorf("expected [4 6 1 2], got %v", ids)
+	}
+
+	if _, err := coverRequiredTopics(bank[:3], 3, []string{"Mechanics", "Acoustics"}, bank); !errors.Is(err, errRequiredTopic) {
+		t.Errorf("a required topic without questions should fail, got %v", err)
+	}
+	if _, err := coverRequiredTopics(bank[:2], 2, required, bank); !errors.Is(err, errRequiredTopic) {
+		t.Errorf("more required topics than questions should fail, got %v", err)
+	}
+}
+
+func TestTopicVarietyAvoidsRecentTopics(t *testing.T) {
+	f := newRouterFixture(t)
+	f.handler.config.NumQuestions = 3
+	f.handler.config.Shuffle = true
+
+	var concurrency []int64
+	for i := range 4 {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Concurrency " + itoa(int64(i)), Difficulty: "easy", Topic: "concurrency", MaxPoints: 10})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		concurrency = append(concurrency, id)
+	}
+	for i := range 4 {
+		if _, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Testing " + itoa(int64(i)), Difficulty: "easy", Topic: "testing", MaxPoints: 10}); err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	if _, err := f.store.CreateSession(bpID, f.student.ID, concurrency[:2]); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	// countConcurrency starts an exam and counts its concurrency questions.
+	countConcurrency := func() int {
+		rec := f.do(t, f.student, http.MethodPost, "/exam/start")
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("start exam: expected 303, got %d", rec.Code)
+		}
+		sessionID, _ := strconv.ParseInt(strings.TrimPrefix(rec.Header().Get("Location"), "/exam/"), 10, 64)
+		threads, err := f.store.GetThreadsForSession(sessionID)
+		if err != nil {
+			t.Fatalf("GetThreadsForSession: %v", err)
+		}
+		n := 0
+		for _, th := range threads {
+			if slices.Contains(concurrency, th.QuestionID) {
+				n++
+			}
+		}
+		// Keep the history at the one concurrency session.
+		if err := f.store.DeleteSession(sessionID); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		return n
+	}
+
+	f.handler.config.TopicVariety = 1
+	for range 10 {
+		if n := countConcurrency(); n != 0 {
+			t.Fatalf("with topic variety on, expected no concurrency questions after a concurrency session, got %d", n)
+		}
+	}
+
+	f.handler.config.TopicVariety = 0
+	total := 0
+	for range 10 {
+		total += countConcurrency()
+	}
+	if total == 0 {
+		t.Error("with topic variety off, concurrency questions should still be drawn")
+	}
+}
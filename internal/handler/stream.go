@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	appI18n "github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/llm"
+)
+
+// wantsEventStream reports whether the request asks for server-sent events.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// handleAnswerStream is handleAnswer for streaming clients. It responds with
+// server-sent events: "chunk" events carry feedback text as the LLM produces
+// it, "thread" carries the rendered thread partial, and "done" the same JSON
+// body handleAnswer returns to API clients. A failure after the stream has
+// started is reported as an "error" event. Without --stream-feedback the
+// route does not exist.
+func (h *Handler) handleAnswerStream(w http.ResponseWriter, r *http.Request) {
+	if !h.config.StreamFeedback {
+		http.NotFound(w, r)
+		return
+	}
+	a, ok := h.acceptAnswer(w, r)
+	if !ok {
+		return
+	}
+	if !h.claimAnswer(w, a) {
+		return
+	}
+	evaluated := false
+	defer func() {
+		if !evaluated {
+			h.releaseAnswer(a)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	var result *llm.GradeResult
+	if !h.config.NoFollowups {
+		messages, err := h.store.GetMessages(a.threadID)
+		if err != nil {
+			slog.Error("failed to get messages", "thread_id", a.threadID, "error", err)
+			writeEvent(w, rc, "error", err.Error())
+			return
+		}
+
+		// Like evaluateAnswer, finish the evaluation if the client goes
+		// away mid-stream, so the stored answer does not stay unevaluated.
+		ctx, cancel := h.llmContext(context.WithoutCancel(r.Context()))
+		defer cancel()
+		chunks := make(chan string)
+		errc := make(chan error, 1)
+		go func() {
+			var err error
+			result, _, err = h.llm.EvaluateAnswerStream(ctx, a.question, messages, a.question.FollowupLimit(a.blueprint.MaxFollowups), a.sessionID, a.threadID, chunks)
+			errc <- err
+		}()
+		for chunk := range chunks {
+			writeEvent(w, rc, "chunk", chunk)
+		}
+		err = <-errc
+		if timedOut(ctx, err) {
+			slog.Warn("LLM evaluation timed out", "thread_id", a.threadID, "timeout", h.config.LLMTimeout)
+			writeEvent(w, rc, "error", appI18n.T(r.Context(), "LLMTimeout"))
+			return
+		}
+		if err != nil {
+			slog.Error("LLM evaluation failed", "error", err)
+			writeEvent(w, rc, "error", "LLM evaluation failed: "+err.Error())
+			return
+		}
+	}
+
+	resp, err := h.finishAnswer(a.threadID, result)
+	if err != nil {
+		writeEvent(w, rc, "error", err.Error())
+		return
+	}
+	evaluated = true
+
+	var html bytes.Buffer
+	if err := h.renderThread(r.Context(), &html, a); err != nil {
+		slog.Error("render error", "error", err)
+	} else {
+		writeEvent(w, rc, "thread", html.String())
+	}
+
+	data, _ := json.Marshal(resp)
+	writeEvent(w, rc, "done", string(data))
+}
+
+// writeEvent writes one server-sent event and flushes it to the client.
+// Multi-line data is split across data fields as the SSE format requires.
+func writeEvent(w io.Writer, rc *http.ResponseController, event, data string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", event)
+	data = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		slog.Debug("event stream write failed", "event", event, "error", err)
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		slog.Debug("event stream flush failed", "error", err)
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// sseEvent is one parsed server-sent event.
+type sseEvent struct {
+	name, data string
+}
+
+func parseEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var ev sseEvent
+		var data []string
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = append(data, strings.TrimPrefix(line, "data: "))
+			}
+		}
+		ev.data = strings.Join(data, "\n")
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestHandleAnswerStream(t *testing.T) {
+	f := newAnswerFixture(t, true)
+	f.stream = true
+	f.accept = "text/event-stream"
+
+	rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected event stream, got %q", ct)
+	}
+
+	var chunks []string
+	var names []string
+	var thread string
+	var done answerResponse
+	for _, ev := range parseEvents(t, rec.Body.String()) {
+		names = append(names, ev.name)
+		switch ev.name {
+		case "chunk":
+			chunks = append(chunks, ev.data)
+		case "thread":
+			thread = ev.data
+		case "done":
+			if err := json.Unmarshal([]byte(ev.data), &done); err != nil {
+				t.Fatalf("decode done event: %v (%s)", err, ev.data)
+			}
+		}
+	}
+	if strings.Join(chunks, "") != "ok" || len(chunks) < 2 {
+		t.Errorf("expected feedback streamed in pieces, got %q", chunks)
+	}
+	if names[len(names)-1] != "done" || names[len(names)-2] != "thread" {
+		t.Errorf("expected thread then done events last, got %v", names)
+	}
+	if !strings.Contains(thread, "Why?") {
+		t.Error("thread partial should include the follow-up question")
+	}
+	want := answerResponse{ThreadStatus: model.ThreadAnswered, Feedback: "ok", NeedFollowup: true, FollowupQuestion: "Why?"}
+	if done != want {
+		t.Errorf("done = %+v, want %+v", done, want)
+	}
+
+	messages, err := f.store.GetMessages(f.threadID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 2 || messages[1].Content != "ok" || messages[1].Followup != "Why?" {
+		t.Errorf("evaluation should be persisted after the stream, got %+v", messages)
+	}
+}
+
+func TestHandleAnswerStreamDisabled(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, err := f.store.GetThreadsForSession(sessionID)
+	if err != nil || len(threads) != 1 {
+		t.Fatalf("GetThreadsForSession: %v, %v", threads, err)
+	}
+
+	path := fmt.Sprintf("/exam/%d/answer/%d/stream", sessionID, threads[0].ID)
+	rec := f.doForm(t, f.student, http.MethodPost, path, url.Values{"answer": {"An object keeps its state of motion."}})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without --stream-feedback, got %d", rec.Code)
+	}
+	if messages, _ := f.store.GetMessages(threads[0].ID); len(messages) != 0 {
+		t.Errorf("the answer must not be stored, got %+v", messages)
+	}
+}
+
+func TestHandleAnswerStreamOwnerOnly(t *testing.T) {
+	f := newAnswerFixture(t, true)
+	f.stream = true
+	f.user = &model.User{ID: f.user.ID + 100, Role: model.UserRoleStudent}
+
+	rec := f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-owner, got %d", rec.Code)
+	}
+	if *f.llmCalls != 0 {
+		t.Error("non-owner answers must not reach the LLM")
+	}
+}
+
+func TestExamPageStreamScript(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	for _, stream := range []bool{false, true} {
+		f.handler.config.StreamFeedback = stream
+		rec := f.do(t, f.student, http.MethodGet, fmt.Sprintf("/exam/%d", sessionID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("exam page: expected 200, got %d", rec.Code)
+		}
+		if got := strings.Contains(rec.Body.String(), "text/event-stream"); got != stream {
+			t.Errorf("StreamFeedback=%v: streaming script present = %v", stream, got)
+		}
+	}
+}
+
+func TestHandleAnswerStreamClientGone(t *testing.T) {
+	f := newAnswerFixture(t, false)
+	f.stream = true
+	f.accept = "text/event-stream"
+	f.gone = true
+
+	f.answer(t, model.ExamConfig{MaxFollowups: 3}, "en")
+	if *f.llmCalls != 1 {
+		t.Fatalf("expected the evaluation to run after the client left, got %d LLM calls", *f.llmCalls)
+	}
+	messages, err := f.store.GetMessages(f.threadID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if model.AwaitingEvaluation(messages) {
+		t.Errorf("the stored answer must not be left unevaluated, got %+v", messages)
+	}
+}
@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// TestHandleSubmitRetriesFailedGrading fails the grading call for one
+// question on the first pass and expects the retry pass to score it.
+func TestHandleSubmitRetriesFailedGrading(t *testing.T) {
+	f := newRouterFixture(t)
+
+	flakyFailures := 0
+	f.handler.llm = newStubLLM(t, func(_ *http.Request, body string) string {
+		if strings.Contains(body, "flaky question") && flakyFailures == 0 {
+			flakyFailures++
+			return "not json"
+		}
+		return `{"score": 8, "max_points": 10, "feedback": "good"}`
+	})
+
+	var qIDs []int64
+	for _, text := range []string{"steady question", "flaky question"} {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		qIDs = append(qIDs, id)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+
+	submit := func(retries int) *model.SessionView {
+		t.Helper()
+		flakyFailures = 0
+		sessionID, err := f.store.CreateSession(bpID, f.student.ID, qIDs)
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		threads, err := f.store.GetThreadsForSession(sessionID)
+		if err != nil {
+			t.Fatalf("GetThreadsForSession: %v", err)
+		}
+		for _, th := range threads {
+			if _, err := f.store.AddMessage(model.Message{ThreadID: th.ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+				t.Fatalf("AddMessage: %v", err)
+			}
+		}
+
+		f.handler.config.GradeRetries = retries
+		rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", sessionID))
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("submit: expected 303, got %d: %s", rec.Code, rec.Body.String())
+		}
+		view, err := f.store.GetSessionView(sessionID)
+		if err != nil {
+			t.Fatalf("GetSessionView: %v", err)
+		}
+		return view
+	}
+
+	view := submit(1)
+	if view.Grade == nil || view.Grade.LLMGrade != 80 {
+		t.Errorf("expected grade 80 after retry, got %+v", view.Grade)
+	}
+	for _, tv := range view.Threads {
+		if tv.Score == nil || tv.Score.LLMScore != 8 {
+			t.Errorf("thread %d: expected score 8, got %+v", tv.Thread.ID, tv.Score)
+		}
+	}
+
+	view = submit(0)
+	if view.Grade == nil || view.Grade.LLMGrade != 40 {
+		t.Errorf("without retries the failed thread should score zero, got %+v", view.Grade)
+	}
+}
+
+// TestHandleSubmitWeightsQuestions scores a weight-3 question full and a
+// weight-1 question zero, so the grade reflects the weights, not the counts.
+func TestHandleSubmitWeightsQuestions(t *testing.T) {
+	f := newRouterFixture(t)
+
+	f.handler.llm = newStubLLM(t, func(_ *http.Request, body string) string {
+		if strings.Contains(body, "heavy question") {
+			return `{"score": 10, "max_points": 10, "feedback": "right"}`
+		}
+		return `{"score": 0, "max_points": 10, "feedback": "wrong"}`
+	})
+
+	var qIDs []int64
+	for text, weight := range map[string]float64{"heavy question": 3, "light question": 0} {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10, Weight: weight})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		qIDs = append(qIDs, id)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, qIDs)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, err := f.store.GetThreadsForSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetThreadsForSession: %v", err)
+	}
+	for _, th := range threads {
+		if _, err := f.store.AddMessage(model.Message{ThreadID: th.ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+
+	rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", sessionID))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("submit: expected 303, got %d: %s", rec.Code, rec.Body.String())
+	}
+	view, err := f.store.GetSessionView(sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	// Unset weight defaults to 1: (3*10 + 1*0) / (3*10 + 1*10) = 75%.
+	if view.Grade == nil || view.Grade.LLMGrade != 75 {
+		t.Errorf("expected weighted grade 75, got %+v", view.Grade)
+	}
+}
+
+// TestHandleSubmitTimesOutPerThread stalls grading for one question and
+// expects only that question to lose its points.
+func TestHandleSubmitTimesOutPerThread(t *testing.T) {
+	f := newRouterFixture(t)
+
+	f.handler.llm = newStubLLM(t, func(r *http.Request, body string) string {
+		if strings.Contains(body, "slow question") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return ""
+		}
+		return `{"score": 10, "max_points": 10, "feedback": "good"}`
+	})
+	f.handler.config.LLMTimeout = 50 * time.Millisecond
+
+	var qIDs []int64
+	for _, text := range []string{"quick question", "slow question"} {
+		id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: text, Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+		if err != nil {
+			t.Fatalf("InsertQuestion: %v", err)
+		}
+		qIDs = append(qIDs, id)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, qIDs)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, err := f.store.GetThreadsForSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetThreadsForSession: %v", err)
+	}
+	for _, th := range threads {
+		if _, err := f.store.AddMessage(model.Message{ThreadID: th.ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+
+	rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", sessionID))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("submit: expected 303, got %d: %s", rec.Code, rec.Body.String())
+	}
+	view, err := f.store.GetSessionView(sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	if view.Grade == nil || view.Grade.LLMGrade != 50 {
+		t.Errorf("expected the quick question to count despite the slow one, got %+v", view.Grade)
+	}
+}
+
+// TestRegradeKeepsTeacherScores regrades a reviewed session after the LLM's
+// answers change and expects new LLM scores next to the teacher's.
+func TestRegradeKeepsTeacherScores(t *testing.T) {
+	f := newRouterFixture(t)
+
+	llmScore := 4
+	f.handler.llm = newStubLLM(t, func(*http.Request, string) string {
+		return fmt.Sprintf(`{"score": %d, "max_points": 10, "feedback": "score %d"}`, llmScore, llmScore)
+	})
+
+	q, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, _ := f.store.GetThreadsForSession(sessionID)
+	if _, err := f.store.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	regrade := fmt.Sprintf("/review/%d/regrade", sessionID)
+
+	if rec := f.do(t, f.teacher, http.MethodPost, regrade); rec.Code != http.StatusConflict {
+		t.Errorf("regrading an in-progress session: expected 409, got %d", rec.Code)
+	}
+	if rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", sessionID)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("submit: expected 303, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := f.store.UpsertThreadReview(model.ThreadReview{ThreadID: threads[0].ID, ReviewerID: f.teacher.ID, Score: 6, Comment: "fair"}); err != nil {
+		t.Fatalf("UpsertThreadReview: %v", err)
+	}
+	if err := f.store.FinalizeGrade(sessionID, 60, f.teacher.ID); err != nil {
+		t.Fatalf("FinalizeGrade: %v", err)
+	}
+	if err := f.store.UpdateSessionStatus(sessionID, model.StatusReviewed); err != nil {
+		t.Fatalf("UpdateSessionStatus: %v", err)
+	}
+
+	if rec := f.do(t, f.student, http.MethodPost, regrade); rec.Code != http.StatusForbidden {
+		t.Errorf("students must not regrade, got %d", rec.Code)
+	}
+	llmScore = 9
+	if rec := f.do(t, f.teacher, http.MethodPost, regrade); rec.Code != http.StatusSeeOther {
+		t.Fatalf("regrade: expected 303, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	view, err := f.store.GetSessionView(sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	if view.Session.Status != model.StatusReviewed {
+		t.Errorf("regrading should keep the status, got %q", view.Session.Status)
+	}
+	sc := view.Threads[0].Score
+	if sc == nil || sc.LLMScore != 9 || sc.LLMFeedback != "score 9" {
+		t.Errorf("expected the new LLM score, got %+v", sc)
+	}
+	if sc != nil && (sc.TeacherScore == nil || *sc.TeacherScore != 6 || sc.TeacherComment != "fair") {
+		t.Errorf("regrading must keep the teacher score, got %+v", sc)
+	}
+	if view.Grade == nil || view.Grade.LLMGrade != 90 || view.Grade.FinalGrade == nil || *view.Grade.FinalGrade != 60 {
+		t.Errorf("expected LLM grade 90 and final grade 60, got %+v", view.Grade)
+	}
+}
+
+// TestGradeSessionOnce submits the same session twice, as the page timer and
+// a manual submit can, and expects it to be graded once.
+func TestGradeSessionOnce(t *testing.T) {
+	f := newAnswerFixture(t, false)
+	cfg := model.ExamConfig{MaxFollowups: 3, NoFollowups: true}
+	if rec := f.answer(t, cfg, "en"); rec.Code != http.StatusOK {
+		t.Fatalf("answer: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	h := &Handler{store: f.store, llm: f.llmClient, config: cfg}
+	for range 2 {
+		if err := h.gradeSession(t.Context(), f.sessionID); err != nil {
+			t.Fatalf("gradeSession: %v", err)
+		}
+	}
+	if *f.llmCalls != 1 {
+		t.Errorf("expected one grading call, got %d", *f.llmCalls)
+	}
+	sess, err := f.store.GetSession(f.sessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if sess.Status != model.StatusGraded {
+		t.Errorf("expected the session graded, got %q", sess.Status)
+	}
+}
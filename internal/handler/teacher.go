@@ -234,13 +234,17 @@ func (h *Handler) handleTeacherUpload(w http.ResponseWriter, r *http.Request) {
 	for _, qi := range questions {
 		q := model.Question{
 			// TODO: derive course ID from context/config when multi-course support lands.
-			CourseID:    1,
-			Text:        qi.Text,
-			Difficulty:  qi.Difficulty,
-			Topic:       qi.Topic,
-			Rubric:      qi.Rubric,
-			ModelAnswer: qi.ModelAnswer,
-			MaxPoints:   qi.MaxPoints,
+			CourseID:     1,
+			Text:         qi.Text,
+			Difficulty:   qi.Difficulty,
+			Topic:        qi.Topic,
+			Rubric:       qi.Rubric,
+			ModelAnswer:  qi.ModelAnswer,
+			MaxPoints:    qi.MaxPoints,
+			Weight:       qi.Weight,
+			GradeModel:   qi.GradeModel,
+			Tags:         qi.Tags,
+			MaxFollowups: qi.MaxFollowups,
 		}
 		if err := h.store.UpdateQuestionByCourseAndText(q); err != nil {
 			if !errors.Is(err, sql.ErrNoRows) {
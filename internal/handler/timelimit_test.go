@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestEffectiveTimeLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		blueprint int // minutes
+		ceiling   time.Duration
+		want      time.Duration
+	}{
+		{"no limits", 0, 0, 0},
+		{"blueprint only", 60, 0, time.Hour},
+		{"ceiling only", 0, 45 * time.Minute, 45 * time.Minute},
+		{"ceiling stricter", 60, 30 * time.Minute, 30 * time.Minute},
+		{"blueprint stricter", 20, time.Hour, 20 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := model.EffectiveTimeLimit(model.ExamBlueprint{TimeLimit: tt.blueprint}, tt.ceiling)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxExamDurationClosesExamPage(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam", TimeLimit: 60})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	// The blueprint allows an hour, but the ceiling has already passed.
+	f.handler.config.MaxExamDuration = time.Nanosecond
+	time.Sleep(time.Millisecond)
+
+	// Viewing the exam renders it closed but does not submit it.
+	rec := f.do(t, f.student, http.MethodGet, fmt.Sprintf("/exam/%d", sessionID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the exam page, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "time-exceeded") {
+		t.Error("expected the exam page to show the time as exceeded")
+	}
+	sess, err := f.store.GetSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if sess.Status != model.StatusInProgress {
+		t.Errorf("viewing the exam page must not submit it, got %q", sess.Status)
+	}
+
+	if rec := f.do(t, f.student, http.MethodPost, fmt.Sprintf("/exam/%d/submit", sessionID)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect to results, got %d", rec.Code)
+	}
+	sess, err = f.store.GetSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if sess.Status != model.StatusGraded {
+		t.Errorf("expected session to be submitted and graded, got %q", sess.Status)
+	}
+}
+
+func TestSweepOverdueSessionsGrades(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	f.handler.config.MaxExamDuration = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	f.handler.SweepOverdueSessions(t.Context())
+
+	view, err := f.store.GetSessionView(sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	if view.Session.Status != model.StatusGraded || view.Grade == nil {
+		t.Errorf("overdue session should be graded by the sweep, got %q grade=%v", view.Session.Status, view.Grade)
+	}
+}
+
+func TestRecoverGradingSessions(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	stuck, _ := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	expired, _ := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	active, _ := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	// A crash between these updates leaves the session in grading.
+	f.store.UpdateSessionStatus(stuck, model.StatusSubmitted)
+	f.store.UpdateSessionStatus(stuck, model.StatusGrading)
+	// A sweep stopped by shutdown leaves the session submitted.
+	f.store.UpdateSessionStatus(expired, model.StatusSubmitted)
+
+	if sessions, err := f.store.ListSessionsByStatus(model.StatusGrading); err != nil || len(sessions) != 1 || sessions[0].ID != stuck {
+		t.Fatalf("expected only the stuck session in grading, got %+v, %v", sessions, err)
+	}
+
+	ungraded, err := f.handler.UngradedSessions()
+	if err != nil {
+		t.Fatalf("UngradedSessions: %v", err)
+	}
+	// Submitted once the server is up, so its own request grades it.
+	submitted, _ := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	f.store.UpdateSessionStatus(submitted, model.StatusSubmitted)
+
+	f.handler.RecoverGradingSessions(t.Context(), ungraded)
+
+	for _, id := range []int64{stuck, expired} {
+		view, err := f.store.GetSessionView(id)
+		if err != nil {
+			t.Fatalf("GetSessionView: %v", err)
+		}
+		if view.Session.Status != model.StatusGraded || view.Grade == nil {
+			t.Errorf("session %d should be graded, got %q grade=%v", id, view.Session.Status, view.Grade)
+		}
+	}
+	if sess, _ := f.store.GetSession(active); sess.Status != model.StatusInProgress {
+		t.Errorf("recovery should leave other sessions alone, got %q", sess.Status)
+	}
+	if sess, _ := f.store.GetSession(submitted); sess.Status != model.StatusSubmitted {
+		t.Errorf("recovery must not grade a session submitted after startup, got %q", sess.Status)
+	}
+}
+
+func TestGradingStopsWhenContextDone(t *testing.T) {
+	f := newRouterFixture(t)
+	qID, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Q1", Difficulty: "easy", Topic: "Mechanics", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	sessionID, err := f.store.CreateSession(bpID, f.student.ID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, err := f.store.GetThreadsForSession(sessionID)
+	if err != nil || len(threads) != 1 {
+		t.Fatalf("GetThreadsForSession: %v, %v", threads, err)
+	}
+	if _, err := f.store.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "an answer"}); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	f.store.UpdateSessionStatus(sessionID, model.StatusSubmitted)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := f.handler.gradeSubmittedSession(ctx, sessionID); err == nil {
+		t.Fatal("expected grading to stop with the context")
+	}
+
+	view, err := f.store.GetSessionView(sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	if view.Session.Status != model.StatusGrading || view.Grade != nil {
+		t.Errorf("session should stay in grading for recovery, got %q grade=%v", view.Session.Status, view.Grade)
+	}
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// uploadQuestions posts data as the admin questions file named filename.
+func uploadQuestions(t *testing.T, h *Handler, filename, data string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("questions_file", filename)
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	fw.Write([]byte(data))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/questions", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	ctx := i18n.WithLocalizer(req.Context(), i18n.NewLocalizer("en"))
+	rec := httptest.NewRecorder()
+	h.handleUploadQuestions(rec, req.WithContext(ctx))
+	return rec
+}
+
+func TestUploadQuestionsCSV(t *testing.T) {
+	f := newRouterFixture(t)
+	csv := "text,difficulty,topic,rubric,model_answer,max_points\n" +
+		"What is inertia?,easy,Mechanics,Mentions mass,An object keeps its state,10\n" +
+		"State Ohm's law,medium,Electricity,Relates V and I,V = IR,5\n"
+
+	rec := uploadQuestions(t, f.handler, "bank.csv", csv)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Successfully imported 2 questions") {
+		t.Fatalf("expected 2 questions imported, got %d: %s", rec.Code, rec.Body.String())
+	}
+	questions, err := f.store.ListQuestions()
+	if err != nil {
+		t.Fatalf("ListQuestions: %v", err)
+	}
+	if len(questions) != 2 || questions[1].Text != "State Ohm's law" || questions[1].MaxPoints != 5 || questions[1].Difficulty != model.DifficultyMedium {
+		t.Errorf("unexpected imported questions: %+v", questions)
+	}
+
+	rec = uploadQuestions(t, f.handler, "bank.csv", csv)
+	if !strings.Contains(rec.Body.String(), "already been imported") {
+		t.Errorf("re-uploading the same CSV should be reported as a duplicate, got: %s", rec.Body.String())
+	}
+	if n, _ := f.store.QuestionCount(); n != 2 {
+		t.Errorf("duplicate upload should not insert questions, have %d", n)
+	}
+}
+
+func TestUploadQuestionsBOM(t *testing.T) {
+	f := newRouterFixture(t)
+	data := "\xef\xbb\xbf[{\"text\": \"Q1\", \"difficulty\": \"easy\", \"topic\": \"Basics\\r\", \"max_points\": 5}]\r\n"
+
+	rec := uploadQuestions(t, f.handler, "bank.json", data)
+	if !strings.Contains(rec.Body.String(), "Successfully imported 1 question") {
+		t.Fatalf("a BOM-prefixed file should import, got: %s", rec.Body.String())
+	}
+	if topics, _ := f.store.ListDistinctTopics(); len(topics) != 1 || topics[0] != "Basics" {
+		t.Errorf("expected the topic trimmed, got %q", topics)
+	}
+}
+
+func TestUploadQuestionsStrictTopics(t *testing.T) {
+	f := newRouterFixture(t)
+	f.handler.config.StrictTopics = true
+	data := `[
+		{"text": "Q1", "difficulty": "easy", "topic": "Basics", "max_points": 5},
+		{"text": "Q2", "difficulty": "easy", "topic": "basics", "max_points": 5}
+	]`
+
+	rec := uploadQuestions(t, f.handler, "bank.json", data)
+	if !strings.Contains(rec.Body.String(), "Import rejected") || !strings.Contains(rec.Body.String(), "use &#34;Basics&#34;") {
+		t.Errorf("expected the inconsistent topic to be rejected, got: %s", rec.Body.String())
+	}
+	if n, _ := f.store.QuestionCount(); n != 0 {
+		t.Errorf("rejected upload should not insert questions, have %d", n)
+	}
+}
+
+func TestEditQuestion(t *testing.T) {
+	f := newRouterFixture(t)
+	id, err := f.store.InsertQuestion(model.Question{CourseID: 1, Text: "Waht is inertia?", Difficulty: model.DifficultyEasy, Topic: "Mechanics", Rubric: "Mentions mass", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	path := "/admin/questions/" + itoa(id)
+
+	rec := f.do(t, f.admin, http.MethodGet, path+"/edit")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Waht is inertia?") || !strings.Contains(rec.Body.String(), "Mentions mass") {
+		t.Fatalf("edit form should be prefilled, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "already used") {
+		t.Error("an unused question should not show the in-use warning")
+	}
+	if rec := f.do(t, f.teacher, http.MethodGet, path+"/edit"); rec.Code != http.StatusForbidden {
+		t.Errorf("teachers should not reach the admin edit form, got %d", rec.Code)
+	}
+
+	bpID, _ := f.store.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if _, err := f.store.CreateSession(bpID, f.student.ID, []int64{id}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	form := url.Values{
+		"text":         {"What is inertia?"},
+		"difficulty":   {"medium"},
+		"topic":        {"Mechanics"},
+		"rubric":       {"Mentions mass and motion"},
+		"model_answer": {"An object keeps its state of motion."},
+		"max_points":   {"8"},
+	}
+	rec = f.doForm(t, f.admin, http.MethodPost, path, form)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "Question saved.") {
+		t.Fatalf("expected the question saved, got %d: %s", rec.Code, body)
+	}
+	if !strings.Contains(body, "already used in 1 exam thread") {
+		t.Error("a question used by a session should show the in-use warning")
+	}
+	q, _ := f.store.GetQuestion(id)
+	if q.Text != "What is inertia?" || q.Difficulty != model.DifficultyMedium || q.MaxPoints != 8 || q.ModelAnswer != "An object keeps its state of motion." {
+		t.Errorf("unexpected saved question: %+v", q)
+	}
+
+	form.Set("max_points", "0")
+	rec = f.doForm(t, f.admin, http.MethodPost, path, form)
+	if !strings.Contains(rec.Body.String(), "max_points must be positive") {
+		t.Errorf("invalid edits should be rejected, got: %s", rec.Body.String())
+	}
+	if q, _ := f.store.GetQuestion(id); q.MaxPoints != 8 {
+		t.Errorf("rejected edit should not be saved, max points %d", q.MaxPoints)
+	}
+
+	form.Set("max_points", "8")
+	form.Set("weight", "heavy")
+	if rec := f.doForm(t, f.admin, http.MethodPost, path, form); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unparsable weight, got %d", rec.Code)
+	}
+	if q, _ := f.store.GetQuestion(id); q.Weight != 1 {
+		t.Errorf("an unparsable weight should not be saved, got %v", q.Weight)
+	}
+
+	if rec := f.do(t, f.admin, http.MethodGet, "/admin/questions/9999/edit"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing question, got %d", rec.Code)
+	}
+}
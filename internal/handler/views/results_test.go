@@ -0,0 +1,138 @@
+package views
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestResultsPagePassFailMessage(t *testing.T) {
+	if err := i18n.Init("en"); err != nil {
+		t.Fatalf("Init(en): %v", err)
+	}
+	ctx := i18n.WithLocalizer(context.Background(), i18n.NewLocalizer("en"))
+
+	cfg := model.ExamConfig{
+		PassThreshold: 60,
+		PassMessage:   "Well done, download your certificate.",
+		PassLink:      "https://example.com/certificate",
+		FailLink:      "https://example.com/office-hours",
+	}
+
+	render := func(t *testing.T, grade float64, cfg model.ExamConfig) string {
+		t.Helper()
+		view := model.SessionView{
+			Session: model.ExamSession{ID: 1, Status: model.StatusGraded},
+			Grade:   &model.Grade{SessionID: 1, LLMGrade: grade},
+		}
+		var buf bytes.Buffer
+		if err := ResultsPage(view, cfg).Render(ctx, &buf); err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		return buf.String()
+	}
+
+	t.Run("passing grade", func(t *testing.T) {
+		html := render(t, 75, cfg)
+		if !strings.Contains(html, cfg.PassMessage) {
+			t.Error("expected custom pass message")
+		}
+		if !strings.Contains(html, cfg.PassLink) {
+			t.Error("expected pass link")
+		}
+		if strings.Contains(html, cfg.FailLink) {
+			t.Error("fail link should not be shown for a passing grade")
+		}
+	})
+
+	t.Run("failing grade", func(t *testing.T) {
+		html := render(t, 40, cfg)
+		if !strings.Contains(html, "You did not reach the passing grade") {
+			t.Error("expected localized default fail message")
+		}
+		if !strings.Contains(html, cfg.FailLink) {
+			t.Error("expected fail link")
+		}
+		if strings.Contains(html, cfg.PassMessage) {
+			t.Error("pass message should not be shown for a failing grade")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		html := render(t, 75, model.ExamConfig{})
+		if strings.Contains(html, "result-outcome") {
+			t.Error("no outcome message expected when pass threshold is unset")
+		}
+	})
+}
+
+func TestResultsPageLocalizedNumbers(t *testing.T) {
+	if err := i18n.Init("ru"); err != nil {
+		t.Fatalf("Init(ru): %v", err)
+	}
+	t.Cleanup(func() { _ = i18n.Init("en") })
+
+	final := 81.25
+	view := model.SessionView{
+		Session: model.ExamSession{ID: 1, Status: model.StatusReviewed},
+		Grade:   &model.Grade{SessionID: 1, LLMGrade: 72.5, FinalGrade: &final},
+	}
+	for _, tt := range []struct {
+		lang, want, notWant string
+	}{
+		{"ru", "72,5", "72.5"},
+		{"en", "72.5", "72,5"},
+	} {
+		var buf bytes.Buffer
+		ctx := i18n.WithLanguage(context.Background(), tt.lang)
+		if err := ResultsPage(view, model.ExamConfig{}).Render(ctx, &buf); err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		html := buf.String()
+		if !strings.Contains(html, tt.want) || strings.Contains(html, tt.notWant) {
+			t.Errorf("%s: expected grade rendered as %q, not %q", tt.lang, tt.want, tt.notWant)
+		}
+	}
+}
+
+func TestResultsPageGradeScaleAndPoints(t *testing.T) {
+	if err := i18n.Init("en"); err != nil {
+		t.Fatalf("Init(en): %v", err)
+	}
+	ctx := i18n.WithLocalizer(context.Background(), i18n.NewLocalizer("en"))
+	scale, err := model.ParseGradeScale("90:A,80:B,0:F")
+	if err != nil {
+		t.Fatalf("ParseGradeScale: %v", err)
+	}
+	view := model.SessionView{
+		Session: model.ExamSession{ID: 1, Status: model.StatusGraded},
+		Threads: []model.ThreadView{
+			{Question: model.Question{MaxPoints: 10}, Score: &model.QuestionScore{LLMScore: 8.5}},
+			{Question: model.Question{MaxPoints: 10}, Score: &model.QuestionScore{LLMScore: 8}},
+		},
+		Grade: &model.Grade{SessionID: 1, LLMGrade: 82.5},
+	}
+
+	var buf bytes.Buffer
+	if err := ResultsPage(view, model.ExamConfig{GradeScale: scale}).Render(ctx, &buf); err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{"LLM suggested grade: 82.5%", "Points (unweighted): 16.5 of 20", "Grade: B"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q on the results page", want)
+		}
+	}
+
+	buf.Reset()
+	if err := ResultsPage(view, model.ExamConfig{}).Render(ctx, &buf); err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if strings.Contains(buf.String(), `id="scaled-grade"`) {
+		t.Error("no scaled grade should be shown without a grade scale")
+	}
+}
@@ -0,0 +1,28 @@
+package views
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestTranscriptPageLanguage(t *testing.T) {
+	if err := i18n.Init("en"); err != nil {
+		t.Fatalf("Init(en): %v", err)
+	}
+	view := model.SessionView{Session: model.ExamSession{ID: 1, Status: model.StatusGraded}}
+	for lang, want := range map[string]string{"en": `<html lang="en">`, "ru": `<html lang="ru">`} {
+		var buf bytes.Buffer
+		ctx := i18n.WithLanguage(context.Background(), lang)
+		if err := TranscriptPage(view, model.User{}, "").Render(ctx, &buf); err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("transcript in %s should start with %s", lang, want)
+		}
+	}
+}
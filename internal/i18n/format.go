@@ -0,0 +1,64 @@
+package i18n
+
+import (
+	"context"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+type langKey struct{}
+
+// dateTimeLayouts maps a base language to its date-time layout. Languages
+// not listed use ISO-style dates.
+var dateTimeLayouts = map[string]string{
+	"ru": "02.01.2006 15:04",
+}
+
+const defaultDateTimeLayout = "2006-01-02 15:04"
+
+// WithLanguage stores the localizer for lang and the language used to
+// format numbers and dates in the context.
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return withLanguage(ctx, NewLocalizer(lang), formatTag(lang))
+}
+
+func withLanguage(ctx context.Context, loc *i18n.Localizer, tag language.Tag) context.Context {
+	return context.WithValue(WithLocalizer(ctx, loc), langKey{}, tag)
+}
+
+// formatTag parses lang for formatting, falling back to English.
+func formatTag(lang string) language.Tag {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return language.English
+	}
+	return tag
+}
+
+// Language returns the formatting language stored by WithLanguage, or
+// English if none was set.
+func Language(ctx context.Context) language.Tag {
+	if tag, ok := ctx.Value(langKey{}).(language.Tag); ok {
+		return tag
+	}
+	return language.English
+}
+
+// FormatNumber formats v with the given number of fraction digits using the
+// decimal and grouping separators of the context language.
+func FormatNumber(ctx context.Context, v float64, decimals int) string {
+	return message.NewPrinter(Language(ctx)).Sprint(number.Decimal(v, number.Scale(decimals)))
+}
+
+// FormatDateTime formats t as a date and time in the context language.
+func FormatDateTime(ctx context.Context, t time.Time) string {
+	base, _ := Language(ctx).Base()
+	if layout, ok := dateTimeLayouts[base.String()]; ok {
+		return t.Format(layout)
+	}
+	return t.Format(defaultDateTimeLayout)
+}
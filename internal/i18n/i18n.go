@@ -20,6 +20,15 @@ type ctxKey struct{}
 
 var bundle *i18n.Bundle
 
+// loaded holds the languages that have a locale file in the bundle.
+var loaded []language.Tag
+
+// Fallback policies for a requested UI language without a locale file.
+const (
+	FallbackEnglish = "en"    // warn and serve English
+	FallbackError   = "error" // refuse to start
+)
+
 // Init loads the translation bundle for the given language tag.
 func Init(lang string) error {
 	tag, err := language.Parse(lang)
@@ -29,6 +38,7 @@ func Init(lang string) error {
 
 	bundle = i18n.NewBundle(tag)
 	bundle.RegisterUnmarshalFunc("json", jsonUnmarshal)
+	loaded = nil
 
 	// Load all locale files from embedded FS.
 	entries, err := localeFS.ReadDir("locales")
@@ -43,13 +53,55 @@ func Init(lang string) error {
 		if err != nil {
 			return fmt.Errorf("read locale file %s: %w", e.Name(), err)
 		}
-		bundle.MustParseMessageFileBytes(data, e.Name())
+		mf, err := bundle.ParseMessageFileBytes(data, e.Name())
+		if err != nil {
+			return fmt.Errorf("parse locale file %s: %w", e.Name(), err)
+		}
+		loaded = append(loaded, mf.Tag)
 		slog.Info("loaded locale file", "file", e.Name())
 	}
 
 	return nil
 }
 
+// HasLanguage reports whether a locale file was loaded for the base
+// language of lang (e.g. "ru-RU" is served by the "ru" file).
+func HasLanguage(lang string) bool {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return false
+	}
+	base, _ := tag.Base()
+	for _, t := range loaded {
+		if b, _ := t.Base(); b == base {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the UI language to serve for lang. Without a locale file
+// for lang, FallbackError fails and FallbackEnglish logs a warning and
+// reinitializes the bundle for English, so pages are not a mix of message
+// IDs and per-key fallbacks.
+func Resolve(lang, fallback string) (string, error) {
+	if HasLanguage(lang) {
+		return lang, nil
+	}
+	switch fallback {
+	case FallbackError:
+		return "", fmt.Errorf("no locale file for language %q", lang)
+	case FallbackEnglish:
+		slog.Warn("no translations for requested language, falling back to English", "lang", lang)
+		if err := Init("en"); err != nil {
+			return "", err
+		}
+		return "en", nil
+	default:
+		return "", fmt.Errorf("unknown language fallback %q (want %s or %s)", fallback, FallbackEnglish, FallbackError)
+	}
+}
+
 // NewLocalizer creates a localizer for the given language.
 func NewLocalizer(lang string) *i18n.Localizer {
 	return i18n.NewLocalizer(bundle, lang)
@@ -3,6 +3,7 @@ package i18n
 import (
 	"context"
 	"testing"
+	"time"
 )
 
 func initLang(t *testing.T, lang string) context.Context {
@@ -73,3 +74,59 @@ func TestMissingKey(t *testing.T) {
 		t.Errorf("T(NonExistentKey) = %q, want 'NonExistentKey'", got)
 	}
 }
+
+func TestResolveUnsupportedLanguage(t *testing.T) {
+	if err := Init("fr"); err != nil {
+		t.Fatalf("Init(fr): %v", err)
+	}
+	if HasLanguage("fr") {
+		t.Fatal("fr has no locale file")
+	}
+	if !HasLanguage("ru-RU") {
+		t.Error("ru-RU should be served by the ru locale file")
+	}
+
+	if _, err := Resolve("fr", FallbackError); err == nil {
+		t.Error("expected an error with the error fallback")
+	}
+
+	lang, err := Resolve("fr", FallbackEnglish)
+	if err != nil {
+		t.Fatalf("Resolve(fr, en): %v", err)
+	}
+	if lang != "en" {
+		t.Errorf("expected fallback to en, got %q", lang)
+	}
+	ctx := WithLocalizer(context.Background(), NewLocalizer(lang))
+	if got := T(ctx, "StartExam"); got != "Start Exam" {
+		t.Errorf("T(StartExam) after fallback = %q, want 'Start Exam'", got)
+	}
+
+	if lang, err := Resolve("ru", FallbackError); err != nil || lang != "ru" {
+		t.Errorf("Resolve(ru) = %q, %v; want ru", lang, err)
+	}
+}
+
+func TestFormatByLanguage(t *testing.T) {
+	ts := time.Date(2026, 3, 7, 14, 5, 0, 0, time.UTC)
+	tests := []struct {
+		lang, number, date string
+	}{
+		{"en", "1,234.5", "2026-03-07 14:05"},
+		{"ru", "1 234,5", "07.03.2026 14:05"},
+		{"ru-RU", "1 234,5", "07.03.2026 14:05"},
+	}
+	for _, tt := range tests {
+		ctx := WithLanguage(context.Background(), tt.lang)
+		if got := FormatNumber(ctx, 1234.5, 1); got != tt.number {
+			t.Errorf("%s: FormatNumber = %q, want %q", tt.lang, got, tt.number)
+		}
+		if got := FormatDateTime(ctx, ts); got != tt.date {
+			t.Errorf("%s: FormatDateTime = %q, want %q", tt.lang, got, tt.date)
+		}
+	}
+
+	if got := FormatNumber(context.Background(), 0.5, 1); got != "0.5" {
+		t.Errorf("without a language: FormatNumber = %q, want English %q", got, "0.5")
+	}
+}
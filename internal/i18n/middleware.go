@@ -2,12 +2,13 @@ package i18n
 
 import "net/http"
 
-// Middleware injects the localizer for the given language into every request context.
+// Middleware injects the localizer and formatting language for the given
+// language into every request context.
 func Middleware(lang string) func(http.Handler) http.Handler {
-	loc := NewLocalizer(lang)
+	loc, tag := NewLocalizer(lang), formatTag(lang)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := WithLocalizer(r.Context(), loc)
+			ctx := withLanguage(r.Context(), loc, tag)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// ModelSpec is the parsed value of --llm-model: a default model and
+// optional per-difficulty overrides.
+type ModelSpec struct {
+	Default      string
+	ByDifficulty map[model.Difficulty]string
+}
+
+// ParseModelSpec parses a model name such as "llama3.2", or a mapping such
+// as "easy=llama3.2,hard=qwen2.5:14b". In a mapping, a bare name or a
+// "default=" entry sets the model for difficulties not listed; without one,
+// the first model listed is the default.
+func ParseModelSpec(spec string) (ModelSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if !strings.Contains(spec, "=") && !strings.Contains(spec, ",") {
+		if spec == "" {
+			return ModelSpec{}, fmt.Errorf("empty model name")
+		}
+		return ModelSpec{Default: spec}, nil
+	}
+
+	ms := ModelSpec{ByDifficulty: make(map[model.Difficulty]string)}
+	var first string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, name, found := strings.Cut(entry, "=")
+		if !found {
+			key, name = "default", key
+		}
+		key, name = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(name)
+		if name == "" {
+			return ModelSpec{}, fmt.Errorf("model entry %q has no model name", entry)
+		}
+		if first == "" {
+			first = name
+		}
+		if key == "default" {
+			if ms.Default != "" {
+				return ModelSpec{}, fmt.Errorf("model spec %q has more than one default", spec)
+			}
+			ms.Default = name
+			continue
+		}
+		d := model.Difficulty(key)
+		if !model.IsValidDifficulty(d) {
+			return ModelSpec{}, fmt.Errorf("unknown difficulty %q in model spec (want easy, medium or hard)", key)
+		}
+		if _, dup := ms.ByDifficulty[d]; dup {
+			return ModelSpec{}, fmt.Errorf("model spec %q lists %s twice", spec, d)
+		}
+		ms.ByDifficulty[d] = name
+	}
+	if first == "" {
+		return ModelSpec{}, fmt.Errorf("empty model name")
+	}
+	if ms.Default == "" {
+		ms.Default = first
+	}
+	return ms, nil
+}
+
+// For returns the model that handles questions of difficulty d.
+func (ms ModelSpec) For(d model.Difficulty) string {
+	if name, ok := ms.ByDifficulty[d]; ok {
+		return name
+	}
+	return ms.Default
+}
+
+// Names returns every distinct model in the spec, the default first.
+func (ms ModelSpec) Names() []string {
+	names := []string{ms.Default}
+	for _, d := range []model.Difficulty{model.DifficultyEasy, model.DifficultyMedium, model.DifficultyHard} {
+		if name, ok := ms.ByDifficulty[d]; ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
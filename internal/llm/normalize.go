@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pavelanni/examiner/internal/model"
+	"golang.org/x/text/unicode/norm"
+)
+
+// quoteReplacer straightens typographic quotes and apostrophes.
+var quoteReplacer = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`,
+	"«", `"`, "»", `"`,
+)
+
+// NormalizeAnswer returns s in a canonical form for grading: Unicode NFC,
+// straight quotes, runs of spaces and tabs inside a line collapsed to one
+// space, trailing space dropped, and at most one blank line between
+// paragraphs. Leading indentation is kept, so code keeps its structure.
+func NormalizeAnswer(s string) string {
+	s = quoteReplacer.Replace(norm.NFC.String(s))
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	var out []string
+	blank := false
+	for _, line := range strings.Split(s, "\n") {
+		text := strings.TrimLeftFunc(line, unicode.IsSpace)
+		indent := line[:len(line)-len(text)]
+		line = strings.Join(strings.FieldsFunc(text, unicode.IsSpace), " ")
+		if line == "" {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		out = append(out, indent+line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// normalizeMessages returns a copy of messages with student answers
+// normalized. The stored messages keep the raw text for audit.
+func normalizeMessages(messages []model.Message) []model.Message {
+	out := make([]model.Message, len(messages))
+	for i, m := range messages {
+		if m.Role == model.RoleStudent {
+			m.Content = NormalizeAnswer(m.Content)
+		}
+		out[i] = m
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"already clean", "F = ma", "F = ma"},
+		{"collapse spaces and tabs", "  F  =\tm a   ", "  F = m a"},
+		{"keep indentation", "def f(x):\n    return  x *\t2\n\tpass", "def f(x):\n    return x * 2\n\tpass"},
+		{"smart quotes", "“Newton’s” «law»", `"Newton's" "law"`},
+		{"NFC composition", "e\u0301nergie \u0438\u0306", "\u00e9nergie \u0439"},
+		{"CRLF and blank lines", "first\r\n\r\n\r\n  second  \n\n", "first\n\n  second"},
+		{"leading blank lines", "\n\n 9.8 m/s²", " 9.8 m/s²"},
+		{"whitespace-only lines are blank", "a\n   \t\nb", "a\n\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeAnswer(tt.in); got != tt.want {
+				t.Errorf("NormalizeAnswer(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeMessagesKeepsOriginal(t *testing.T) {
+	raw := "“forty two”"
+	messages := []model.Message{
+		{Role: model.RoleStudent, Content: raw},
+		{Role: model.RoleLLM, Content: "“ok”"},
+	}
+	got := normalizeMessages(messages)
+	if got[0].Content != `"forty two"` {
+		t.Errorf("student answer not normalized: %q", got[0].Content)
+	}
+	if got[1].Content != "“ok”" {
+		t.Errorf("LLM messages should be left as is, got %q", got[1].Content)
+	}
+	if messages[0].Content != raw {
+		t.Error("normalization must not modify the stored messages")
+	}
+}
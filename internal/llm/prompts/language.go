@@ -0,0 +1,67 @@
+package prompts
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// englishWords are common English words that other languages written in
+// Latin letters rarely use, so one of them marks a text as English.
+var englishWords = map[string]bool{
+	"the": true, "is": true, "are": true, "was": true, "of": true, "and": true,
+	"to": true, "it": true, "that": true, "this": true, "with": true,
+	"for": true, "be": true, "not": true, "by": true, "when": true,
+}
+
+// DetectLanguage guesses the language of text from the script of its
+// letters: "Russian" when most are Cyrillic, "English" when most are
+// Latin, none carries a diacritic and some words are common English
+// ones. Otherwise, e.g. for a bare formula or a French answer, it returns
+// "" and the prompt gives no language instruction.
+func DetectLanguage(text string) string {
+	var cyrillic, latin int
+	accented := false // é, ü, ñ...: Latin, but not English
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+			accented = accented || r > unicode.MaxASCII
+		}
+	}
+	switch {
+	case cyrillic > latin:
+		return "Russian"
+	case latin > cyrillic && !accented && hasEnglishWord(text):
+		return "English"
+	default:
+		return ""
+	}
+}
+
+// hasEnglishWord reports whether text contains one of englishWords.
+func hasEnglishWord(text string) bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, w := range words {
+		if englishWords[w] {
+			return true
+		}
+	}
+	return false
+}
+
+// studentText joins everything the student wrote in a conversation.
+func studentText(messages []model.Message) string {
+	var parts []string
+	for _, m := range messages {
+		if m.Role == model.RoleStudent {
+			parts = append(parts, m.Content)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
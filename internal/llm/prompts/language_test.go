@@ -0,0 +1,82 @@
+package prompts
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestMain(m *testing.M) {
+	if err := Load(os.DirFS(".")); err != nil {
+		fmt.Fprintf(os.Stderr, "Load failed: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"russian", "Инерция — это свойство тела сохранять скорость (F = ma).", "Russian"},
+		{"english", "Inertia is the tendency of a body to keep its velocity (инерция).", "English"},
+		{"no letters", "42 = 6 * 7", ""},
+		{"formula only", "F = ma", ""},
+		{"french", "L'inertie est la tendance d'un corps à conserver sa vitesse.", ""},
+		{"spanish", "La inercia es la tendencia de un cuerpo a mantener su velocidad", ""},
+		{"german", "Die Trägheit ist das Bestreben eines Körpers", ""},
+		{"even mix", "inertia инерция", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectLanguage(tt.text); got != tt.want {
+				t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchLanguageInstruction(t *testing.T) {
+	q := model.Question{Text: "Explain inertia", Rubric: "mentions mass", MaxPoints: 10}
+	tests := []struct {
+		name, answer, want string
+	}{
+		{"russian", "Инерция — это свойство тела сохранять скорость (F = ma).", "The student answered in Russian. Write the feedback and any follow-up question in Russian."},
+		{"english", "Inertia is the tendency of a body to keep its velocity (инерция).", "The student answered in English. Write the feedback and any follow-up question in English."},
+		{"no letters", "42 = 6 * 7", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := []model.Message{{Role: model.RoleStudent, Content: tt.answer}}
+			for _, match := range []bool{false, true} {
+				prompt, err := BuildEvalPrompt(PromptStandard, "en", q, messages, 3, Options{MatchLanguage: match})
+				if err != nil {
+					t.Fatalf("BuildEvalPrompt: %v", err)
+				}
+				want := match && tt.want != ""
+				if got := strings.Contains(prompt, "The student answered in"); got != want {
+					t.Fatalf("MatchLanguage=%v: instruction present = %v, want %v", match, got, want)
+				}
+				if want && !strings.Contains(prompt, tt.want) {
+					t.Errorf("expected %q in prompt:\n%s", tt.want, prompt)
+				}
+			}
+		})
+	}
+
+	messages := []model.Message{
+		{Role: model.RoleStudent, Content: "Инерция — свойство тела"},
+		{Role: model.RoleLLM, Content: "Good start. Can you give an example?", Followup: "What about a moving bus?"},
+		{Role: model.RoleStudent, Content: "Пассажиры наклоняются вперёд при торможении"},
+	}
+	grade, err := BuildGradePrompt(PromptStrict, "en", q, messages, Options{MatchLanguage: true})
+	if err != nil {
+		t.Fatalf("BuildGradePrompt: %v", err)
+	}
+	if !strings.Contains(grade, "Write the feedback in Russian.") {
+		t.Errorf("grading should follow the student's messages, not the English follow-ups:\n%s", grade)
+	}
+}
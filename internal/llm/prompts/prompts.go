@@ -37,11 +37,43 @@ var validVariants = map[PromptVariant]bool{
 	PromptLenient:  true,
 }
 
+// templateKey identifies one template of a kind: its variant and language.
+// The English templates, which every variant must have, use an empty lang.
+type templateKey struct {
+	variant PromptVariant
+	lang    string
+}
+
+// templateSet is one loaded copy of every prompt template.
+type templateSet struct {
+	eval  map[templateKey]*template.Template
+	grade map[templateKey]*template.Template
+
+	// clarify holds clarify.txt and its translations under an empty
+	// variant; it is empty when the source has no clarify.txt.
+	clarify map[templateKey]*template.Template
+}
+
+// lookup returns the template of variant in lang from m, or the English one
+// when lang has none. lang is a language tag such as "ru" or "ru-RU"; only
+// its primary subtag is used.
+func lookup(m map[templateKey]*template.Template, variant PromptVariant, lang string) (*template.Template, bool) {
+	lang, _, _ = strings.Cut(strings.ToLower(lang), "-")
+	if tmpl, ok := m[templateKey{variant, lang}]; ok {
+		return tmpl, true
+	}
+	tmpl, ok := m[templateKey{variant, ""}]
+	return tmpl, ok
+}
+
 var (
-	loadOnce       sync.Once
-	loadErr        error
-	evalTemplates  map[PromptVariant]*template.Template
-	gradeTemplates map[PromptVariant]*template.Template
+	loadOnce sync.Once
+	loadErr  error
+
+	// mu guards current, which Reload replaces as a whole so a prompt is
+	// always built from one consistent set.
+	mu      sync.RWMutex
+	current *templateSet
 )
 
 // IsValidVariant checks if a prompt variant name is valid.
@@ -49,6 +81,17 @@ func IsValidVariant(v string) bool {
 	return validVariants[PromptVariant(v)]
 }
 
+// Options toggles optional instructions shared by all prompt variants.
+type Options struct {
+	// CiteRubric asks the model to tie its feedback to specific rubric
+	// criteria, naming the ones the answer missed.
+	CiteRubric bool
+
+	// MatchLanguage detects the language of the student's answer and asks
+	// the model to write its feedback in that language.
+	MatchLanguage bool
+}
+
 // EvalData holds template data for evaluation prompts.
 type EvalData struct {
 	QuestionText string
@@ -57,6 +100,11 @@ type EvalData struct {
 	ModelAnswer  string
 	Answer       string
 	CanFollowup  bool
+	CiteRubric   bool
+
+	// FeedbackLanguage is the detected answer language the feedback must be
+	// written in; empty leaves the language to the model.
+	FeedbackLanguage string
 }
 
 // GradeData holds template data for grading prompts.
@@ -66,61 +114,145 @@ type GradeData struct {
 	Rubric       string
 	ModelAnswer  string
 	Answer       string
+	CiteRubric   bool
+
+	// FeedbackLanguage is as in EvalData.
+	FeedbackLanguage string
+}
+
+// ClarifyData holds template data for clarification prompts. It leaves out
+// the rubric and model answer so the reply cannot give them away.
+type ClarifyData struct {
+	QuestionText string
+	Request      string
 }
 
-// Load loads prompt templates from the embedded filesystem.
-// It uses sync.Once to ensure templates are loaded only once.
+// Load loads prompt templates from fsys, which holds eval_<variant>.txt
+// and grade_<variant>.txt for every variant, in English, and optionally
+// clarify.txt. Translations are optional files named with a language
+// suffix, e.g. eval_standard_ru.txt or clarify_ru.txt.
+// It uses sync.Once to ensure templates are loaded only once; use Reload to
+// load them again.
 func Load(fsys fs.FS) error {
 	loadOnce.Do(func() {
-		evalTemplates = make(map[PromptVariant]*template.Template)
-		gradeTemplates = make(map[PromptVariant]*template.Template)
+		loadErr = Reload(fsys)
+	})
+	return loadErr
+}
 
-		variants := []PromptVariant{PromptStrict, PromptStandard, PromptLenient}
+// Reload parses the templates in fsys again and swaps them in. Prompts
+// being built keep the set they started with. If any template fails to
+// read or parse, the current set stays in place and the error is returned.
+func Reload(fsys fs.FS) error {
+	set, err := parseTemplates(fsys)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current = set
+	mu.Unlock()
+	return nil
+}
 
-		for _, v := range variants {
-			evalFile := "prompts/eval_" + string(v) + ".txt"
-			gradeFile := "prompts/grade_" + string(v) + ".txt"
+// templates returns the current template set, or nil before Load.
+func templates() *templateSet {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
 
-			evalContent, err := fs.ReadFile(fsys, evalFile)
-			if err != nil {
-				loadErr = errors.New("failed to read prompt file " + evalFile + ": " + err.Error())
-				return
+func parseTemplates(fsys fs.FS) (*templateSet, error) {
+	set := &templateSet{
+		eval:    make(map[templateKey]*template.Template),
+		grade:   make(map[templateKey]*template.Template),
+		clarify: make(map[templateKey]*template.Template),
+	}
+	for _, v := range []PromptVariant{PromptStrict, PromptStandard, PromptLenient} {
+		for _, name := range []string{"eval", "grade"} {
+			dst := set.eval
+			if name == "grade" {
+				dst = set.grade
 			}
-
-			evalTmpl, err := template.New("eval").Parse(string(evalContent))
-			if err != nil {
-				loadErr = errors.New("failed to parse prompt template " + evalFile + ": " + err.Error())
-				return
+			if err := parseTranslated(fsys, dst, v, name, name+"_"+string(v)); err != nil {
+				return nil, err
 			}
-			evalTemplates[v] = evalTmpl
+		}
+	}
+	if _, err := fs.Stat(fsys, "clarify.txt"); err == nil {
+		if err := parseTranslated(fsys, set.clarify, "", "clarify", "clarify"); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
 
-			gradeContent, err := fs.ReadFile(fsys, gradeFile)
-			if err != nil {
-				loadErr = errors.New("failed to read prompt file " + gradeFile + ": " + err.Error())
-				return
-			}
+// OverrideFS is a template source that layers customized templates over the
+// built-in ones. Overrides reports whether file comes from the customized
+// layer.
+type OverrideFS interface {
+	fs.FS
+	Overrides(file string) bool
+}
 
-			gradeTmpl, err := template.New("grade").Parse(string(gradeContent))
-			if err != nil {
-				loadErr = errors.New("failed to parse prompt template " + gradeFile + ": " + err.Error())
-				return
-			}
-			gradeTemplates[v] = gradeTmpl
+// overrides reports whether file is a customized template in fsys.
+func overrides(fsys fs.FS, file string) bool {
+	o, ok := fsys.(OverrideFS)
+	return ok && o.Overrides(file)
+}
+
+// parseTranslated parses base.txt and its translations base_<lang>.txt into
+// dst under variant. When base.txt is customized, built-in translations of
+// it are skipped, so every language keeps using the customized template
+// unless it has a customized translation too.
+func parseTranslated(fsys fs.FS, dst map[templateKey]*template.Template, variant PromptVariant, name, base string) error {
+	tmpl, err := parseTemplate(fsys, name, base+".txt")
+	if err != nil {
+		return err
+	}
+	dst[templateKey{variant, ""}] = tmpl
+	custom := overrides(fsys, base+".txt")
+
+	translations, err := fs.Glob(fsys, base+"_*.txt")
+	if err != nil {
+		return errors.New("failed to list prompt translations " + base + "_*.txt: " + err.Error())
+	}
+	for _, file := range translations {
+		if custom && !overrides(fsys, file) {
+			continue
 		}
-	})
-	return loadErr
+		lang := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(file, base+"_"), ".txt"))
+		if tmpl, err = parseTemplate(fsys, name, file); err != nil {
+			return err
+		}
+		dst[templateKey{variant, lang}] = tmpl
+	}
+	return nil
 }
 
-// BuildEvalPrompt builds an evaluation prompt using the specified variant.
-func BuildEvalPrompt(variant PromptVariant, question model.Question, messages []model.Message, maxFollowups int) (string, error) {
-	if evalTemplates == nil {
-		return "", errors.New("templates not initialized: call Load first")
+func parseTemplate(fsys fs.FS, name, file string) (*template.Template, error) {
+	content, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, errors.New("failed to read prompt file " + file + ": " + err.Error())
 	}
-	tmpl, ok := evalTemplates[variant]
-	if !ok {
+	tmpl, err := template.New(name).Parse(string(content))
+	if err != nil {
+		return nil, errors.New("failed to parse prompt template " + file + ": " + err.Error())
+	}
+	return tmpl, nil
+}
+
+// BuildEvalPrompt builds an evaluation prompt using the specified variant,
+// in lang if it has its own templates and in English otherwise.
+func BuildEvalPrompt(variant PromptVariant, lang string, question model.Question, messages []model.Message, maxFollowups int, opts Options) (string, error) {
+	set := templates()
+	if set == nil {
 		if loadErr != nil {
 			return "", fmt.Errorf("templates load failed: %w", loadErr)
 		}
+		return "", errors.New("templates not initialized: call Load first")
+	}
+	tmpl, ok := lookup(set.eval, variant, lang)
+	if !ok {
 		return "", errors.New("invalid prompt variant: " + string(variant))
 	}
 
@@ -134,6 +266,10 @@ func BuildEvalPrompt(variant PromptVariant, question model.Question, messages []
 		ModelAnswer:  question.ModelAnswer,
 		Answer:       sanitizeAnswer(answer),
 		CanFollowup:  canFollowup,
+		CiteRubric:   opts.CiteRubric,
+	}
+	if opts.MatchLanguage {
+		data.FeedbackLanguage = DetectLanguage(answer)
 	}
 
 	var buf bytes.Buffer
@@ -144,16 +280,18 @@ func BuildEvalPrompt(variant PromptVariant, question model.Question, messages []
 	return buf.String(), nil
 }
 
-// BuildGradePrompt builds a final grading prompt using the specified variant.
-func BuildGradePrompt(variant PromptVariant, question model.Question, messages []model.Message) (string, error) {
-	if gradeTemplates == nil {
-		return "", errors.New("templates not initialized: call Load first")
-	}
-	tmpl, ok := gradeTemplates[variant]
-	if !ok {
+// BuildGradePrompt builds a final grading prompt using the specified
+// variant, in lang if it has its own templates and in English otherwise.
+func BuildGradePrompt(variant PromptVariant, lang string, question model.Question, messages []model.Message, opts Options) (string, error) {
+	set := templates()
+	if set == nil {
 		if loadErr != nil {
 			return "", fmt.Errorf("templates load failed: %w", loadErr)
 		}
+		return "", errors.New("templates not initialized: call Load first")
+	}
+	tmpl, ok := lookup(set.grade, variant, lang)
+	if !ok {
 		return "", errors.New("invalid prompt variant: " + string(variant))
 	}
 
@@ -166,6 +304,39 @@ func BuildGradePrompt(variant PromptVariant, question model.Question, messages [
 		Rubric:       question.Rubric,
 		ModelAnswer:  question.ModelAnswer,
 		Answer:       answer,
+		CiteRubric:   opts.CiteRubric,
+	}
+	if opts.MatchLanguage {
+		data.FeedbackLanguage = DetectLanguage(studentText(messages))
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// BuildClarifyPrompt builds the prompt that answers a student's request to
+// clarify question before answering it, in lang if it has its own template
+// and in English otherwise.
+func BuildClarifyPrompt(lang string, question model.Question, request string) (string, error) {
+	set := templates()
+	if set == nil {
+		if loadErr != nil {
+			return "", fmt.Errorf("templates load failed: %w", loadErr)
+		}
+		return "", errors.New("templates not initialized: call Load first")
+	}
+	tmpl, ok := lookup(set.clarify, "", lang)
+	if !ok {
+		return "", errors.New("no clarification prompt template (clarify.txt)")
+	}
+
+	data := ClarifyData{
+		QuestionText: question.Text,
+		Request:      sanitizeAnswer(request),
 	}
 
 	var buf bytes.Buffer
@@ -193,7 +364,7 @@ func extractConversation(messages []model.Message) string {
 		if m.Role == model.RoleLLM {
 			role = "Assistant"
 		}
-		sb.WriteString(role + ": " + m.Content + "\n\n")
+		sb.WriteString(role + ": " + m.Transcript() + "\n\n")
 	}
 	return sb.String()
 }
@@ -1,6 +1,79 @@
 package llm
 
-import "embed"
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
 
 //go:embed prompts/*.txt
 var promptsFS embed.FS
+
+// embeddedPrompts returns the built-in prompt templates.
+func embeddedPrompts() fs.FS {
+	sub, err := fs.Sub(promptsFS, "prompts")
+	if err != nil {
+		panic(err) // "prompts" is a valid path, so Sub cannot fail
+	}
+	return sub
+}
+
+// promptSource returns the templates to load: those in dir, falling back to
+// the built-in ones for any file dir does not have. An empty dir means only
+// the built-in templates.
+func promptSource(dir string) fs.FS {
+	if dir == "" {
+		return embeddedPrompts()
+	}
+	return overlayFS{top: os.DirFS(dir), base: embeddedPrompts()}
+}
+
+// overlayFS opens files from top, or from base when top does not have them.
+// Its directory listings merge both, so fs.Glob finds files in either. It
+// implements prompts.OverrideFS, so a template customized in top is not
+// hidden by a built-in translation of it.
+type overlayFS struct {
+	top, base fs.FS
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(o.top, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	baseEntries, baseErr := fs.ReadDir(o.base, name)
+	if baseErr != nil && !errors.Is(baseErr, fs.ErrNotExist) {
+		return nil, baseErr
+	}
+	if err != nil && baseErr != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		seen[e.Name()] = true
+	}
+	for _, e := range baseEntries {
+		if !seen[e.Name()] {
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}
+
+// Overrides reports whether name is served from top.
+func (o overlayFS) Overrides(name string) bool {
+	_, err := fs.Stat(o.top, name)
+	return err == nil
+}
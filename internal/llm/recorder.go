@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// interaction is one recorded LLM call, stored as a line of JSON.
+type interaction struct {
+	Key         string `json:"key"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// requestKey identifies a request by its method, path and body, so that the
+// same prompt sent to the same model with the same settings replays the same
+// response.
+func requestKey(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.Path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readRequestBody returns the body of r and restores it for the next reader.
+func readRequestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// recorder is an HTTP client that forwards requests to the backend and
+// appends each response to a file. Streamed responses are read to the end
+// before being returned, so they arrive all at once while recording.
+type recorder struct {
+	next *http.Client
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newRecorder(path string) (*recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open LLM recording: %w", err)
+	}
+	return &recorder{next: &http.Client{}, file: f}, nil
+}
+
+func (rec *recorder) Do(r *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := rec.next.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	line, err := json.Marshal(interaction{
+		Key:         requestKey(r, body),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(respBody),
+	})
+	if err != nil {
+		return nil, err
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if _, err := rec.file.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("write LLM recording: %w", err)
+	}
+	return resp, nil
+}
+
+// replayer is an HTTP client that answers requests from a recording made by
+// recorder and never contacts the backend. A request that was not recorded
+// fails.
+type replayer struct {
+	responses map[string]interaction
+}
+
+func newReplayer(path string) (*replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open LLM recording: %w", err)
+	}
+	defer f.Close()
+
+	responses := make(map[string]interaction)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var in interaction
+		if err := json.Unmarshal(sc.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("LLM recording line %d: %w", n, err)
+		}
+		responses[in.Key] = in // a later recording of the same request wins
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read LLM recording: %w", err)
+	}
+	return &replayer{responses: responses}, nil
+}
+
+func (rp *replayer) Do(r *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(r)
+	if err != nil {
+		return nil, err
+	}
+	in, ok := rp.responses[requestKey(r, body)]
+	if !ok {
+		return nil, fmt.Errorf("no recorded LLM response for %s %s", r.Method, r.URL.Path)
+	}
+	header := make(http.Header)
+	if in.ContentType != "" {
+		header.Set("Content-Type", in.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(in.Body))),
+		ContentLength: int64(len(in.Body)),
+		Request:       r,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/llm/prompts"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	q := model.Question{Text: "Explain inertia", MaxPoints: 10}
+	messages := []model.Message{{Role: model.RoleStudent, Content: "Objects keep their motion"}}
+	recording := filepath.Join(t.TempDir(), "llm.jsonl")
+
+	url, requests := newStubServer(t, 7)
+	rec, err := New(url, "test", "stub", string(prompts.PromptStandard), Options{RecordFile: recording})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	recorded, err := rec.GradeThread(context.Background(), q, messages, 1, 1)
+	if err != nil {
+		t.Fatalf("GradeThread while recording: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("recording should reach the backend once, got %d calls", len(*requests))
+	}
+
+	rp, err := New("http://127.0.0.1:1", "test", "stub", string(prompts.PromptStandard), Options{ReplayFile: recording})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	replayed, err := rp.GradeThread(context.Background(), q, messages, 1, 1)
+	if err != nil {
+		t.Fatalf("GradeThread while replaying: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Errorf("replay should not reach the backend, got %d calls", len(*requests))
+	}
+	if replayed.Score != 7 || replayed.Score != recorded.Score || replayed.Feedback != recorded.Feedback {
+		t.Errorf("expected the recorded grade %+v, got %+v", recorded, replayed)
+	}
+
+	other := []model.Message{{Role: model.RoleStudent, Content: "A different answer"}}
+	if _, err := rp.GradeThread(context.Background(), q, other, 1, 1); err == nil {
+		t.Error("an unrecorded request should fail")
+	}
+
+	if _, err := New("", "test", "stub", "standard", Options{RecordFile: recording, ReplayFile: recording}); err == nil {
+		t.Error("recording and replaying at once should be rejected")
+	}
+}
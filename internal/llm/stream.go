@@ -0,0 +1,184 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/llm/prompts"
+	"github.com/pavelanni/examiner/internal/model"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// EvaluateAnswerStream is EvaluateAnswer with streaming: while the completion
+// arrives, each new piece of the feedback text is sent on chunks. chunks is
+// closed before the method returns. Once the stream ends, the full JSON is
+// parsed and validated exactly as in EvaluateAnswer.
+func (c *Client) EvaluateAnswerStream(ctx context.Context, question model.Question, messages []model.Message, maxFollowups int, sessionID, threadID int64, chunks chan<- string) (*GradeResult, string, error) {
+	defer close(chunks)
+
+	messages = c.prepareMessages(messages)
+	systemPrompt, err := prompts.BuildEvalPrompt(c.promptVariant, c.opts.PromptLanguage, question, messages, maxFollowups, c.promptOptions())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to build eval prompt: %w", err)
+	}
+	chatMsgs := buildChatMessages(systemPrompt, messages)
+
+	const op = "evaluate"
+	modelName := c.modelFor(question)
+	raw, tokens, err := c.stream(ctx, op, modelName, chatMsgs, c.opts.EvalTemperature, sessionID, threadID, chunks)
+	if err != nil {
+		return nil, raw, err
+	}
+
+	result := &GradeResult{Confidence: model.DefaultConfidence}
+	if err := json.Unmarshal([]byte(raw), result); err != nil {
+		return nil, raw, fmt.Errorf("parse LLM response (%s): %w (raw: %s)", op, err, raw)
+	}
+	result.TokenCount = tokens
+	if c.isWildlyOutOfRange(result.Score, question.MaxPoints) {
+		// The streamed feedback is superseded by the non-streaming retry.
+		result, raw, err = c.retryOutOfRange(ctx, op, modelName, chatMsgs, c.opts.EvalTemperature, question.MaxPoints, sessionID, threadID, result)
+		if err != nil {
+			return nil, raw, err
+		}
+	}
+
+	validateGradeResult(result, question.MaxPoints)
+
+	return result, raw, nil
+}
+
+// stream sends a streaming chat completion request, forwards feedback text to
+// chunks as it arrives, and returns the complete response content with the
+// total tokens reported in the final usage chunk.
+func (c *Client) stream(ctx context.Context, op, modelName string, chatMsgs []openai.ChatCompletionMessage, temperature float32, sessionID, threadID int64, chunks chan<- string) (string, int, error) {
+	start := time.Now()
+	stream, err := withRetry(ctx, c.opts, op, func() (*openai.ChatCompletionStream, error) {
+		return c.api.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+			Model:    modelName,
+			Messages: chatMsgs,
+			ResponseFormat: &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+			},
+			Temperature:   requestTemperature(temperature),
+			Stream:        true,
+			StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+		})
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("LLM API call (%s): %w", op, err)
+	}
+	defer stream.Close()
+
+	var fe feedbackExtractor
+	var tokens int
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fe.raw.String(), tokens, fmt.Errorf("LLM stream (%s): %w", op, err)
+		}
+		if resp.Usage != nil {
+			tokens = resp.Usage.TotalTokens
+			slog.Info("LLM token usage",
+				"op", op,
+				"model", modelName,
+				"session_id", sessionID,
+				"thread_id", threadID,
+				"prompt_tokens", resp.Usage.PromptTokens,
+				"completion_tokens", resp.Usage.CompletionTokens,
+				"total_tokens", resp.Usage.TotalTokens,
+			)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		delta := fe.feed(resp.Choices[0].Delta.Content)
+		if delta == "" {
+			continue
+		}
+		select {
+		case chunks <- delta:
+		case <-ctx.Done():
+			return fe.raw.String(), tokens, ctx.Err()
+		}
+	}
+
+	raw := fe.raw.String()
+	slog.Debug("LLM response", "op", op, "raw", raw)
+	c.observe(op, modelName, time.Since(start), tokens)
+	return raw, tokens, nil
+}
+
+// feedbackExtractor follows a streamed JSON grade and decodes the value of
+// its "feedback" field as far as it has arrived.
+type feedbackExtractor struct {
+	raw  strings.Builder
+	sent int // bytes of decoded feedback already returned
+}
+
+// feed appends a piece of the response and returns the feedback text that
+// became available with it.
+func (fe *feedbackExtractor) feed(piece string) string {
+	fe.raw.WriteString(piece)
+	feedback := partialStringField(fe.raw.String(), "feedback")
+	if len(feedback) <= fe.sent {
+		return ""
+	}
+	delta := feedback[fe.sent:]
+	fe.sent = len(feedback)
+	return delta
+}
+
+// partialStringField returns the decoded value of the string field key in a
+// possibly incomplete JSON object, stopping before a truncated escape.
+func partialStringField(s, key string) string {
+	i := strings.Index(s, `"`+key+`"`)
+	if i < 0 {
+		return ""
+	}
+	rest := strings.TrimLeft(s[i+len(key)+2:], " \t\r\n")
+	if !strings.HasPrefix(rest, ":") {
+		return ""
+	}
+	rest = strings.TrimLeft(rest[1:], " \t\r\n")
+	if !strings.HasPrefix(rest, `"`) {
+		return ""
+	}
+	rest = rest[1:]
+
+	end := 0
+	for end < len(rest) && rest[end] != '"' {
+		if rest[end] != '\\' {
+			end++
+			continue
+		}
+		n := 2 // \n, \", ...
+		if end+1 < len(rest) && rest[end+1] == 'u' {
+			n = 6
+			// A high surrogate is only decodable together with its pair.
+			if end+6 <= len(rest) && strings.ContainsAny(rest[end+2:end+3], "dD") && strings.ContainsAny(rest[end+3:end+4], "89abAB") {
+				n = 12
+			}
+		}
+		if end+n > len(rest) {
+			break
+		}
+		end += n
+	}
+
+	var out string
+	if err := json.Unmarshal([]byte(`"`+rest[:end]+`"`), &out); err != nil {
+		return ""
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/llm/prompts"
+	"github.com/pavelanni/examiner/internal/model"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// streamPieces splits content into pieces of size runes to mimic token
+// streaming.
+func streamPieces(content string, size int) []string {
+	var pieces []string
+	runes := []rune(content)
+	for len(runes) > size {
+		pieces = append(pieces, string(runes[:size]))
+		runes = runes[size:]
+	}
+	return append(pieces, string(runes))
+}
+
+func TestEvaluateAnswerStream(t *testing.T) {
+	content := `{"score": 7, "max_points": 10, "feedback": "Good \"start\",\nbut énergie?", "need_followup": true, "followup_question": "Why?"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream {
+			t.Errorf("expected a streaming request, got stream=%v err=%v", req.Stream, err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range streamPieces(content, 3) {
+			chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+				Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: piece}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, "test", "stub", string(prompts.PromptStandard), Options{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	chunks := make(chan string)
+	var streamed []string
+	done := make(chan struct{})
+	go func() {
+		for c := range chunks {
+			streamed = append(streamed, c)
+		}
+		close(done)
+	}()
+
+	q := model.Question{Text: "Explain energy", MaxPoints: 10}
+	result, raw, err := c.EvaluateAnswerStream(context.Background(), q, []model.Message{{Role: model.RoleStudent, Content: "E = mc2"}}, 3, 1, 1, chunks)
+	<-done
+	if err != nil {
+		t.Fatalf("EvaluateAnswerStream: %v", err)
+	}
+	if raw != content {
+		t.Errorf("raw = %q, want the full streamed content", raw)
+	}
+	want := "Good \"start\",\nbut énergie?"
+	if result.Feedback != want || result.Score != 7 || !result.NeedFollowup || result.FollowupQ != "Why?" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(streamed) < 2 || strings.Join(streamed, "") != want {
+		t.Errorf("expected feedback streamed in several chunks, got %q", streamed)
+	}
+}
+
+func TestPartialStringField(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"key not yet seen", `{"score": 5, "feed`, ""},
+		{"value not started", `{"feedback" :`, ""},
+		{"partial value", `{"feedback": "Good wo`, "Good wo"},
+		{"complete value", `{"feedback": "Done", "need_followup": false}`, "Done"},
+		{"truncated escape", `{"feedback": "a\`, "a"},
+		{"escapes", `{"feedback": "a\"b\nc`, "a\"b\nc"},
+		{"truncated unicode escape", `{"feedback": "x\u00`, "x"},
+		{"split surrogate pair", `{"feedback": "x\ud83d\ude`, "x"},
+		{"surrogate pair", `{"feedback": "x😀`, "x😀"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partialStringField(tt.in, "feedback"); got != tt.want {
+				t.Errorf("partialStringField(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
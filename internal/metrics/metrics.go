@@ -0,0 +1,95 @@
+// Package metrics exports Prometheus metrics for capacity planning: exams
+// started, submitted and graded, LLM call latency and token usage.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the collectors of one server. All methods do nothing on a
+// nil *Metrics, so callers need not check whether --metrics is set.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	examsStarted   prometheus.Counter
+	examsSubmitted prometheus.Counter
+	examsGraded    prometheus.Counter
+	llmLatency     *prometheus.HistogramVec
+	llmTokens      *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them, together with the Go
+// runtime and process collectors, in a registry of their own.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		examsStarted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "examiner_exams_started_total",
+			Help: "Exam sessions started.",
+		}),
+		examsSubmitted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "examiner_exams_submitted_total",
+			Help: "Exam sessions submitted for grading, by the student or when their time ran out.",
+		}),
+		examsGraded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "examiner_exams_graded_total",
+			Help: "Exam sessions graded by the LLM.",
+		}),
+		llmLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "examiner_llm_call_duration_seconds",
+			Help:    "Latency of successful LLM calls, including retries.",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+		}, []string{"op", "model"}),
+		llmTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "examiner_llm_tokens_total",
+			Help: "Tokens consumed by LLM calls, as reported by the backend.",
+		}, []string{"op", "model"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.examsStarted, m.examsSubmitted, m.examsGraded, m.llmLatency, m.llmTokens,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ExamStarted counts a new exam session.
+func (m *Metrics) ExamStarted() {
+	if m != nil {
+		m.examsStarted.Inc()
+	}
+}
+
+// ExamSubmitted counts a session submitted for grading.
+func (m *Metrics) ExamSubmitted() {
+	if m != nil {
+		m.examsSubmitted.Inc()
+	}
+}
+
+// ExamGraded counts a session whose grading finished.
+func (m *Metrics) ExamGraded() {
+	if m != nil {
+		m.examsGraded.Inc()
+	}
+}
+
+// ObserveLLMCall records the latency and token usage of one LLM call. op is
+// "evaluate", "grade" or "clarify". It implements llm.CallObserver.
+func (m *Metrics) ObserveLLMCall(op, model string, latency time.Duration, tokens int) {
+	if m == nil {
+		return
+	}
+	m.llmLatency.WithLabelValues(op, model).Observe(latency.Seconds())
+	m.llmTokens.WithLabelValues(op, model).Add(float64(tokens))
+}
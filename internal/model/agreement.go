@@ -0,0 +1,66 @@
+package model
+
+import "math"
+
+// ScorePair is the LLM and teacher score of one reviewed question thread.
+type ScorePair struct {
+	LLMScore     float64
+	TeacherScore float64
+	MaxPoints    int
+}
+
+// Agreement summarizes how closely LLM scores match teacher scores. Scores
+// are compared as fractions of each question's max points, so questions
+// worth different points weigh the same.
+type Agreement struct {
+	Pairs int // Pairs compared
+
+	// MeanAbsError is the mean absolute difference between the LLM and the
+	// teacher score, in percent of max points.
+	MeanAbsError float64
+
+	// Pearson is the correlation between LLM and teacher scores, from -1 to
+	// 1. It is nil when undefined: with fewer than two pairs, or when either
+	// side gave every answer the same fraction of the points.
+	Pearson *float64
+}
+
+// ScoreAgreement compares LLM and teacher scores. Pairs without max points
+// are skipped.
+func ScoreAgreement(pairs []ScorePair) Agreement {
+	var llm, teacher []float64
+	for _, p := range pairs {
+		if p.MaxPoints <= 0 {
+			continue
+		}
+		llm = append(llm, p.LLMScore/float64(p.MaxPoints))
+		teacher = append(teacher, p.TeacherScore/float64(p.MaxPoints))
+	}
+
+	a := Agreement{Pairs: len(llm)}
+	if a.Pairs == 0 {
+		return a
+	}
+	var absErr, llmSum, teacherSum float64
+	for i := range llm {
+		absErr += math.Abs(llm[i] - teacher[i])
+		llmSum += llm[i]
+		teacherSum += teacher[i]
+	}
+	n := float64(a.Pairs)
+	a.MeanAbsError = absErr / n * 100
+
+	llmMean, teacherMean := llmSum/n, teacherSum/n
+	var cov, llmVar, teacherVar float64
+	for i := range llm {
+		dl, dt := llm[i]-llmMean, teacher[i]-teacherMean
+		cov += dl * dt
+		llmVar += dl * dl
+		teacherVar += dt * dt
+	}
+	if a.Pairs >= 2 && llmVar > 0 && teacherVar > 0 {
+		r := cov / math.Sqrt(llmVar*teacherVar)
+		a.Pearson = &r
+	}
+	return a
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreAgreement(t *testing.T) {
+	// As fractions of max points: LLM 0.8, 0.4, 0.6; teacher 0.9, 0.5, 0.5.
+	a := ScoreAgreement([]ScorePair{
+		{LLMScore: 8, TeacherScore: 9, MaxPoints: 10},
+		{LLMScore: 2, TeacherScore: 2.5, MaxPoints: 5},
+		{LLMScore: 12, TeacherScore: 10, MaxPoints: 20},
+		{LLMScore: 3, TeacherScore: 1, MaxPoints: 0}, // skipped
+	})
+	if a.Pairs != 3 {
+		t.Errorf("expected 3 pairs, got %d", a.Pairs)
+	}
+	if math.Abs(a.MeanAbsError-10) > 1e-9 {
+		t.Errorf("mean absolute error = %v, want 10", a.MeanAbsError)
+	}
+	// Deviations from the means (0.6 and 1.9/3): LLM 0.2, -0.2, 0; teacher
+	// 0.8/3, -0.4/3, -0.4/3. Covariance 0.08, variances 0.08 and 0.32/3.
+	want := 0.08 / math.Sqrt(0.08*0.32/3)
+	if a.Pearson == nil || math.Abs(*a.Pearson-want) > 1e-4 {
+		t.Errorf("pearson = %v, want %v", a.Pearson, want)
+	}
+
+	perfect := ScoreAgreement([]ScorePair{{1, 1, 10}, {5, 5, 10}, {9, 9, 10}})
+	if perfect.MeanAbsError != 0 || perfect.Pearson == nil || math.Abs(*perfect.Pearson-1) > 1e-9 {
+		t.Errorf("identical scores should agree perfectly, got %+v", perfect)
+	}
+
+	// The teacher gave full points everywhere, so correlation is undefined.
+	flat := ScoreAgreement([]ScorePair{{4, 10, 10}, {8, 10, 10}})
+	if flat.Pearson != nil || math.Abs(flat.MeanAbsError-40) > 1e-9 {
+		t.Errorf("expected no correlation and 40%% error, got %+v", flat)
+	}
+
+	if empty := ScoreAgreement(nil); empty.Pairs != 0 || empty.Pearson != nil {
+		t.Errorf("no pairs should give an empty agreement, got %+v", empty)
+	}
+}
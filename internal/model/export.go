@@ -1,6 +1,17 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// Conversation export formats.
+const (
+	// ConversationFlat exports messages as a single chronological list.
+	ConversationFlat = "flat"
+	// ConversationGrouped exports messages nested by follow-up round.
+	ConversationGrouped = "grouped"
+)
 
 // ExamExport is the top-level JSON structure for exam result export.
 type ExamExport struct {
@@ -16,25 +27,32 @@ type ExamExport struct {
 type StudentResult struct {
 	ExternalID    string           `json:"external_id"`
 	DisplayName   string           `json:"display_name"`
+	Label         string           `json:"label"` // Identifier chosen with --student-identifier
+	Cohort        string           `json:"cohort,omitempty"`
 	SessionNumber int              `json:"session_number"`
 	Status        SessionStatus    `json:"status"`
 	StartedAt     time.Time        `json:"started_at"`
 	SubmittedAt   *time.Time       `json:"submitted_at,omitempty"`
 	Questions     []QuestionResult `json:"questions"`
 	LLMGrade      float64          `json:"llm_grade"`
+	FinalGrade    *float64         `json:"final_grade,omitempty"`  // Set once a teacher has reviewed the session
+	ScaledGrade   string           `json:"scaled_grade,omitempty"` // Final (else LLM) grade on the --grade-scale, if one is set
+	TokenCount    int              `json:"token_count"`            // LLM tokens spent on the session
 }
 
 // QuestionResult holds per-question data for export.
 type QuestionResult struct {
-	Text         string            `json:"text"`
-	Topic        string            `json:"topic"`
-	Difficulty   Difficulty        `json:"difficulty"`
-	MaxPoints    int               `json:"max_points"`
-	Rubric       string            `json:"rubric"`
-	ModelAnswer  string            `json:"model_answer"`
-	Conversation []ConversationMsg `json:"conversation"`
-	LLMScore     float64           `json:"llm_score"`
-	LLMFeedback  string            `json:"llm_feedback"`
+	Text         string              `json:"text"`
+	Topic        string              `json:"topic"`
+	Difficulty   Difficulty          `json:"difficulty"`
+	MaxPoints    int                 `json:"max_points"`
+	Rubric       string              `json:"rubric"`
+	ModelAnswer  string              `json:"model_answer"`
+	Conversation []ConversationMsg   `json:"conversation,omitempty"`
+	Rounds       []ConversationRound `json:"rounds,omitempty"`
+	LLMScore     float64             `json:"llm_score"`
+	LLMFeedback  string              `json:"llm_feedback"`
+	TokenCount   *int                `json:"token_count,omitempty"` // LLM tokens spent on the question, evaluations and grading; see OmitTokenCounts
 }
 
 // ExamInfo holds exam metadata stored in the database.
@@ -63,7 +81,188 @@ type ExamManifest struct {
 
 // ConversationMsg is a single message in an exported conversation.
 type ConversationMsg struct {
-	Role    string    `json:"role"`
-	Content string    `json:"content"`
-	At      time.Time `json:"at"`
+	Role       string    `json:"role"`
+	Content    string    `json:"content"`
+	At         time.Time `json:"at"`
+	TokenCount *int      `json:"token_count,omitempty"` // LLM tokens spent producing the message; see OmitTokenCounts
+}
+
+// ConversationRound pairs an evaluator prompt with the student reply that
+// followed it. The first round has no prompt (the student answers the exam
+// question itself); a trailing round may have no reply.
+type ConversationRound struct {
+	Round  int              `json:"round"`
+	Prompt *ConversationMsg `json:"prompt,omitempty"`
+	Reply  *ConversationMsg `json:"reply,omitempty"`
+
+	// Clarifications are the ungraded clarification requests and replies
+	// exchanged before the reply, in order.
+	Clarifications []ConversationMsg `json:"clarifications,omitempty"`
+}
+
+// GroupConversation nests a chronological conversation by follow-up round:
+// each assistant message opens a new round and the next student message is
+// its reply. Clarifications go with the round whose reply they precede.
+func GroupConversation(msgs []ConversationMsg) []ConversationRound {
+	var rounds []ConversationRound
+	for i := range msgs {
+		m := msgs[i]
+		last := len(rounds) - 1
+		if m.Role == string(RoleLLM) || last < 0 || rounds[last].Reply != nil {
+			rounds = append(rounds, ConversationRound{Round: len(rounds) + 1})
+			last++
+		}
+		if Role(m.Role).IsClarification() {
+			rounds[last].Clarifications = append(rounds[last].Clarifications, m)
+		} else if m.Role == string(RoleLLM) {
+			rounds[last].Prompt = &m
+		} else {
+			rounds[last].Reply = &m
+		}
+	}
+	return rounds
+}
+
+// FlattenConversation is the inverse of GroupConversation.
+func FlattenConversation(rounds []ConversationRound) []ConversationMsg {
+	var msgs []ConversationMsg
+	for _, r := range rounds {
+		if r.Prompt != nil {
+			msgs = append(msgs, *r.Prompt)
+		}
+		msgs = append(msgs, r.Clarifications...)
+		if r.Reply != nil {
+			msgs = append(msgs, *r.Reply)
+		}
+	}
+	return msgs
+}
+
+// GradeCSVRows maps export results to the rows (header first) of a flat
+// per-session grade CSV. final_grade is blank until a teacher reviews the
+// session.
+func GradeCSVRows(results []StudentResult) [][]string {
+	rows := [][]string{{"student_id", "display_name", "llm_grade", "final_grade", "status"}}
+	for _, r := range results {
+		var final string
+		if r.FinalGrade != nil {
+			final = formatScore(*r.FinalGrade)
+		}
+		rows = append(rows, []string{r.ExternalID, r.DisplayName, formatScore(r.LLMGrade), final, string(r.Status)})
+	}
+	return rows
+}
+
+// ApplyConversationFormat rewrites each question's conversation in place
+// according to format (ConversationFlat or ConversationGrouped).
+func ApplyConversationFormat(results []StudentResult, format string) error {
+	switch format {
+	case "", ConversationFlat:
+		return nil
+	case ConversationGrouped:
+		for i := range results {
+			for j := range results[i].Questions {
+				q := &results[i].Questions[j]
+				q.Rounds = GroupConversation(q.Conversation)
+				q.Conversation = nil
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown conversation format %q (want %s or %s)", format, ConversationFlat, ConversationGrouped)
+	}
+}
+
+// OmitTokenCounts removes the per-question and per-message token counts
+// from results, which exports only include on request. Call it before
+// ApplyConversationFormat.
+func OmitTokenCounts(results []StudentResult) {
+	for i := range results {
+		for j := range results[i].Questions {
+			q := &results[i].Questions[j]
+			q.TokenCount = nil
+			for k := range q.Conversation {
+				q.Conversation[k].TokenCount = nil
+			}
+		}
+	}
+}
+
+// ScoreDelta is the change in one question's LLM score between two exports
+// of the same sessions. Before or After is nil when the question appears in
+// only one of them.
+type ScoreDelta struct {
+	ExternalID    string
+	SessionNumber int
+	Question      string
+	Before        *float64
+	After         *float64
+}
+
+// Delta returns After minus Before, treating a missing side as zero.
+func (d ScoreDelta) Delta() float64 {
+	var before, after float64
+	if d.Before != nil {
+		before = *d.Before
+	}
+	if d.After != nil {
+		after = *d.After
+	}
+	return after - before
+}
+
+// DiffExports compares the per-question LLM scores of two exports, matching
+// questions by student external ID, session number and question text. It
+// returns the questions whose score changed or that exist in only one
+// export, in the order of a followed by questions new in b, and the number
+// of questions found in both.
+func DiffExports(a, b ExamExport) (deltas []ScoreDelta, matched int) {
+	type key struct {
+		externalID    string
+		sessionNumber int
+		question      string
+	}
+	keyed := func(e ExamExport) ([]key, map[key]float64) {
+		var order []key
+		scores := make(map[key]float64)
+		for _, r := range e.Results {
+			for _, q := range r.Questions {
+				k := key{r.ExternalID, r.SessionNumber, q.Text}
+				if _, dup := scores[k]; !dup {
+					order = append(order, k)
+				}
+				scores[k] = q.LLMScore
+			}
+		}
+		return order, scores
+	}
+	orderA, scoresA := keyed(a)
+	orderB, scoresB := keyed(b)
+
+	delta := func(k key) ScoreDelta {
+		d := ScoreDelta{ExternalID: k.externalID, SessionNumber: k.sessionNumber, Question: k.question}
+		if s, ok := scoresA[k]; ok {
+			d.Before = &s
+		}
+		if s, ok := scoresB[k]; ok {
+			d.After = &s
+		}
+		return d
+	}
+	for _, k := range orderA {
+		after, ok := scoresB[k]
+		if ok {
+			matched++
+			if after == scoresA[k] {
+				continue
+			}
+		}
+		deltas = append(deltas, delta(k))
+	}
+	for _, k := range orderB {
+		if _, ok := scoresA[k]; !ok {
+			deltas = append(deltas, delta(k))
+		}
+	}
+	return deltas, matched
 }
@@ -0,0 +1,189 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupConversation(t *testing.T) {
+	msgs := []ConversationMsg{
+		{Role: "student", Content: "initial answer"},
+		{Role: "assistant", Content: "follow-up 1"},
+		{Role: "student", Content: "reply 1"},
+		{Role: "assistant", Content: "follow-up 2"},
+		{Role: "student", Content: "reply 2"},
+		{Role: "assistant", Content: "final feedback"},
+	}
+
+	rounds := GroupConversation(msgs)
+	if len(rounds) != 4 {
+		t.Fatalf("expected 4 rounds, got %d", len(rounds))
+	}
+
+	if rounds[0].Prompt != nil || rounds[0].Reply == nil || rounds[0].Reply.Content != "initial answer" {
+		t.Errorf("round 1 should hold only the initial answer, got %+v", rounds[0])
+	}
+	for i, want := range []struct{ prompt, reply string }{
+		{"follow-up 1", "reply 1"},
+		{"follow-up 2", "reply 2"},
+	} {
+		r := rounds[i+1]
+		if r.Round != i+2 {
+			t.Errorf("round number = %d, want %d", r.Round, i+2)
+		}
+		if r.Prompt == nil || r.Prompt.Content != want.prompt {
+			t.Errorf("round %d prompt = %+v, want %q", r.Round, r.Prompt, want.prompt)
+		}
+		if r.Reply == nil || r.Reply.Content != want.reply {
+			t.Errorf("round %d reply = %+v, want %q", r.Round, r.Reply, want.reply)
+		}
+	}
+	if last := rounds[3]; last.Prompt == nil || last.Prompt.Content != "final feedback" || last.Reply != nil {
+		t.Errorf("trailing round should hold only the final assistant message, got %+v", last)
+	}
+
+	if got := FlattenConversation(rounds); !reflect.DeepEqual(got, msgs) {
+		t.Errorf("FlattenConversation did not round-trip:\n got  %+v\n want %+v", got, msgs)
+	}
+}
+
+func TestGroupConversationClarifications(t *testing.T) {
+	msgs := []ConversationMsg{
+		{Role: "clarification_request", Content: "Is rotation included?"},
+		{Role: "clarification", Content: "Linear motion is enough."},
+		{Role: "student", Content: "initial answer"},
+		{Role: "assistant", Content: "feedback"},
+	}
+	rounds := GroupConversation(msgs)
+	if len(rounds) != 2 {
+		t.Fatalf("expected 2 rounds, got %d: %+v", len(rounds), rounds)
+	}
+	if r := rounds[0]; len(r.Clarifications) != 2 || r.Reply == nil || r.Reply.Content != "initial answer" {
+		t.Errorf("round 1 should hold the clarifications and the answer, got %+v", r)
+	}
+	if got := FlattenConversation(rounds); !reflect.DeepEqual(got, msgs) {
+		t.Errorf("FlattenConversation did not round-trip:\n got  %+v\n want %+v", got, msgs)
+	}
+}
+
+func TestApplyConversationFormat(t *testing.T) {
+	newResults := func() []StudentResult {
+		return []StudentResult{{Questions: []QuestionResult{{
+			Conversation: []ConversationMsg{
+				{Role: "student", Content: "a"},
+				{Role: "assistant", Content: "q"},
+			},
+		}}}}
+	}
+
+	flat := newResults()
+	if err := ApplyConversationFormat(flat, ConversationFlat); err != nil {
+		t.Fatalf("flat: %v", err)
+	}
+	if len(flat[0].Questions[0].Conversation) != 2 || flat[0].Questions[0].Rounds != nil {
+		t.Errorf("flat format should leave the conversation untouched")
+	}
+
+	grouped := newResults()
+	if err := ApplyConversationFormat(grouped, ConversationGrouped); err != nil {
+		t.Fatalf("grouped: %v", err)
+	}
+	if grouped[0].Questions[0].Conversation != nil || len(grouped[0].Questions[0].Rounds) != 2 {
+		t.Errorf("grouped format should replace conversation with rounds, got %+v", grouped[0].Questions[0])
+	}
+
+	if err := ApplyConversationFormat(newResults(), "nested"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestOmitTokenCounts(t *testing.T) {
+	msgTokens, questionTokens := 120, 170
+	results := []StudentResult{{TokenCount: 170, Questions: []QuestionResult{{
+		Conversation: []ConversationMsg{{Role: "assistant", Content: "q", TokenCount: &msgTokens}},
+		TokenCount:   &questionTokens,
+	}}}}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if n := strings.Count(string(data), `"token_count":`); n != 3 {
+		t.Errorf("expected token counts on the session, question and message, got %d in %s", n, data)
+	}
+
+	OmitTokenCounts(results)
+	data, err = json.Marshal(results)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if n := strings.Count(string(data), `"token_count":`); n != 1 {
+		t.Errorf("only the session total should remain, got %d in %s", n, data)
+	}
+}
+
+func TestDiffExports(t *testing.T) {
+	result := func(id string, session int, scores map[string]float64, order ...string) StudentResult {
+		r := StudentResult{ExternalID: id, SessionNumber: session}
+		for _, text := range order {
+			r.Questions = append(r.Questions, QuestionResult{Text: text, LLMScore: scores[text]})
+		}
+		return r
+	}
+	a := ExamExport{Results: []StudentResult{
+		result("S1", 1, map[string]float64{"Q1": 8, "Q2": 5}, "Q1", "Q2"),
+		result("S1", 2, map[string]float64{"Q1": 6}, "Q1"),
+		result("S2", 1, map[string]float64{"Q3": 4}, "Q3"),
+	}}
+	b := ExamExport{Results: []StudentResult{
+		result("S1", 1, map[string]float64{"Q1": 8, "Q2": 7.5}, "Q2", "Q1"),
+		result("S1", 2, map[string]float64{"Q1": 3}, "Q1"),
+		result("S2", 1, map[string]float64{"Q4": 9}, "Q4"),
+	}}
+
+	deltas, matched := DiffExports(a, b)
+	if matched != 3 {
+		t.Errorf("matched = %d, want 3", matched)
+	}
+
+	type row struct {
+		id      string
+		session int
+		text    string
+		before  *float64
+		after   *float64
+		delta   float64
+	}
+	f := func(v float64) *float64 { return &v }
+	want := []row{
+		{"S1", 1, "Q2", f(5), f(7.5), 2.5},
+		{"S1", 2, "Q1", f(6), f(3), -3},
+		{"S2", 1, "Q3", f(4), nil, -4},
+		{"S2", 1, "Q4", nil, f(9), 9},
+	}
+	var got []row
+	for _, d := range deltas {
+		got = append(got, row{d.ExternalID, d.SessionNumber, d.Question, d.Before, d.After, d.Delta()})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffExports:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestGradeCSVRows(t *testing.T) {
+	final := 92.5
+	results := []StudentResult{
+		{ExternalID: "S1", DisplayName: "Ann", LLMGrade: 88, FinalGrade: &final, Status: StatusReviewed},
+		{ExternalID: "S2", DisplayName: "Bob", LLMGrade: 70.25, Status: StatusGraded},
+	}
+	want := [][]string{
+		{"student_id", "display_name", "llm_grade", "final_grade", "status"},
+		{"S1", "Ann", "88", "92.5", "reviewed"},
+		{"S2", "Bob", "70.25", "", "graded"},
+	}
+	if got := GradeCSVRows(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
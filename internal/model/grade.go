@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DifficultyWeights scales how much each difficulty counts toward the
+// overall grade, on top of each question's own weight. A difficulty that is
+// not listed counts 1.
+type DifficultyWeights map[Difficulty]float64
+
+// ParseDifficultyWeights parses a mapping such as
+// "easy=1,medium=1.5,hard=2". An empty string means no scaling.
+func ParseDifficultyWeights(spec string) (DifficultyWeights, error) {
+	weights := make(DifficultyWeights)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("difficulty weight %q is not of the form difficulty=weight", entry)
+		}
+		d := Difficulty(strings.ToLower(strings.TrimSpace(key)))
+		if !IsValidDifficulty(d) {
+			return nil, fmt.Errorf("unknown difficulty %q in difficulty weights (want easy, medium or hard)", key)
+		}
+		if _, dup := weights[d]; dup {
+			return nil, fmt.Errorf("difficulty weights list %s twice", d)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("difficulty weight for %s must be a positive number, got %q", d, value)
+		}
+		weights[d] = w
+	}
+	return weights, nil
+}
+
+// For returns the weight of difficulty d.
+func (dw DifficultyWeights) For(d Difficulty) float64 {
+	if w, ok := dw[d]; ok {
+		return w
+	}
+	return 1
+}
+
+// GradedQuestion is one question's score as it enters the overall grade.
+type GradedQuestion struct {
+	Question Question
+	Score    float64
+}
+
+// OverallGrade returns the grade in percent for scored questions. Each
+// question's score and max_points are multiplied by its own weight and by
+// the weight of its difficulty; scores shown per question are unaffected
+// and stay out of max_points. No questions, or no points, give 0.
+func OverallGrade(questions []GradedQuestion, weights DifficultyWeights) float64 {
+	var total, totalMax float64
+	for _, gq := range questions {
+		w := gq.Question.EffectiveWeight() * weights.For(gq.Question.Difficulty)
+		total += w * gq.Score
+		totalMax += w * float64(gq.Question.MaxPoints)
+	}
+	if totalMax == 0 {
+		return 0
+	}
+	return total / totalMax * 100
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDifficultyWeights(t *testing.T) {
+	got, err := ParseDifficultyWeights(" easy=1, Medium=1.5,hard=2 ")
+	if err != nil {
+		t.Fatalf("ParseDifficultyWeights: %v", err)
+	}
+	want := DifficultyWeights{DifficultyEasy: 1, DifficultyMedium: 1.5, DifficultyHard: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, err := ParseDifficultyWeights(""); err != nil || len(got) != 0 {
+		t.Errorf("an empty spec should mean no scaling, got %v, %v", got, err)
+	}
+
+	for _, tt := range []struct{ spec, want string }{
+		{"hard", "not of the form"},
+		{"trivial=2", "unknown difficulty"},
+		{"hard=2,hard=3", "twice"},
+		{"hard=0", "positive"},
+		{"hard=x", "positive"},
+	} {
+		if _, err := ParseDifficultyWeights(tt.spec); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected error containing %q, got %v", tt.spec, tt.want, err)
+		}
+	}
+}
+
+func TestOverallGrade(t *testing.T) {
+	questions := []GradedQuestion{
+		{Question: Question{Difficulty: DifficultyEasy, MaxPoints: 10}, Score: 10},
+		{Question: Question{Difficulty: DifficultyHard, MaxPoints: 10}, Score: 0},
+		{Question: Question{Difficulty: DifficultyMedium, MaxPoints: 10, Weight: 2}, Score: 5},
+	}
+
+	tests := []struct {
+		name    string
+		weights DifficultyWeights
+		want    float64
+	}{
+		// (10 + 0 + 2×5) / (10 + 10 + 2×10)
+		{"unweighted", nil, 50},
+		// (10 + 0 + 2×1.5×5) / (10 + 2×10 + 2×1.5×10)
+		{"weighted", DifficultyWeights{DifficultyEasy: 1, DifficultyMedium: 1.5, DifficultyHard: 2}, 25.0 / 60 * 100},
+		// Unlisted difficulties count 1, so only the hard question changes.
+		{"hard only", DifficultyWeights{DifficultyHard: 3}, 20.0 / 60 * 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OverallGrade(questions, tt.weights); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := OverallGrade(nil, nil); got != 0 {
+		t.Errorf("no questions should give 0, got %v", got)
+	}
+}
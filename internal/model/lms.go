@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Supported LMS grade-import layouts.
+const (
+	LMSCanvas = "canvas"
+	LMSMoodle = "moodle"
+)
+
+// GradeRecord is the grade summary of one graded exam session.
+type GradeRecord struct {
+	SessionID   int64
+	Username    string
+	ExternalID  string
+	DisplayName string
+	LLMGrade    float64
+	FinalGrade  *float64
+}
+
+// Score returns the teacher's final grade, falling back to the LLM grade.
+func (g GradeRecord) Score() float64 {
+	if g.FinalGrade != nil {
+		return *g.FinalGrade
+	}
+	return g.LLMGrade
+}
+
+// LMSGradeRows maps grade records to the CSV rows (header first) expected by
+// the given LMS gradebook import. Only the latest session per student is
+// used; records must be ordered oldest first. Students are identified by
+// external ID, falling back to username. assignment names the grade column.
+func LMSGradeRows(records []GradeRecord, lms, assignment string) ([][]string, error) {
+	var header []string
+	var row func(id string, g GradeRecord) []string
+	switch lms {
+	case LMSCanvas:
+		header = []string{"Student", "SIS User ID", assignment}
+		row = func(id string, g GradeRecord) []string {
+			return []string{g.DisplayName, id, formatScore(g.Score())}
+		}
+	case LMSMoodle:
+		header = []string{"ID number", "Full name", assignment}
+		row = func(id string, g GradeRecord) []string {
+			return []string{id, g.DisplayName, formatScore(g.Score())}
+		}
+	default:
+		return nil, fmt.Errorf("unknown LMS %q (want %s or %s)", lms, LMSCanvas, LMSMoodle)
+	}
+
+	latest := make(map[string]GradeRecord)
+	var order []string
+	for _, g := range records {
+		id := g.ExternalID
+		if id == "" {
+			id = g.Username
+		}
+		if _, ok := latest[id]; !ok {
+			order = append(order, id)
+		}
+		latest[id] = g
+	}
+
+	rows := [][]string{header}
+	for _, id := range order {
+		rows = append(rows, row(id, latest[id]))
+	}
+	return rows, nil
+}
+
+// formatScore writes a grade with as many decimals as it needs, so the LMS
+// gets the exact value rather than one rounded to a tenth.
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
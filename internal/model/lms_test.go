@@ -0,0 +1,55 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLMSGradeRows(t *testing.T) {
+	final := 92.0
+	records := []GradeRecord{
+		{SessionID: 1, Username: "ivanov", ExternalID: "S001", DisplayName: "Ivan Ivanov", LLMGrade: 60},
+		{SessionID: 2, Username: "petrova", ExternalID: "S002", DisplayName: "Anna Petrova", LLMGrade: 75, FinalGrade: &final},
+		// A retake supersedes the first session.
+		{SessionID: 3, Username: "ivanov", ExternalID: "S001", DisplayName: "Ivan Ivanov", LLMGrade: 81.25},
+		{SessionID: 4, Username: "guest", DisplayName: "Guest", LLMGrade: 50},
+	}
+
+	t.Run("canvas", func(t *testing.T) {
+		rows, err := LMSGradeRows(records, LMSCanvas, "phys-2026")
+		if err != nil {
+			t.Fatalf("LMSGradeRows: %v", err)
+		}
+		want := [][]string{
+			{"Student", "SIS User ID", "phys-2026"},
+			{"Ivan Ivanov", "S001", "81.25"},
+			{"Anna Petrova", "S002", "92"},
+			{"Guest", "guest", "50"},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("canvas rows:\n got  %v\n want %v", rows, want)
+		}
+	})
+
+	t.Run("moodle", func(t *testing.T) {
+		rows, err := LMSGradeRows(records, LMSMoodle, "phys-2026")
+		if err != nil {
+			t.Fatalf("LMSGradeRows: %v", err)
+		}
+		want := [][]string{
+			{"ID number", "Full name", "phys-2026"},
+			{"S001", "Ivan Ivanov", "81.25"},
+			{"S002", "Anna Petrova", "92"},
+			{"guest", "Guest", "50"},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("moodle rows:\n got  %v\n want %v", rows, want)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := LMSGradeRows(records, "blackboard", "x"); err == nil {
+			t.Error("expected error for unknown LMS")
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DifficultyMix is how many questions of each difficulty an exam draws.
+type DifficultyMix map[Difficulty]int
+
+// ParseDifficultyMix parses a mapping such as "easy=2,medium=3,hard=1".
+// An empty string means no mix.
+func ParseDifficultyMix(spec string) (DifficultyMix, error) {
+	mix := make(DifficultyMix)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("difficulty mix entry %q is not of the form difficulty=count", entry)
+		}
+		d := Difficulty(strings.ToLower(strings.TrimSpace(key)))
+		if !IsValidDifficulty(d) {
+			return nil, fmt.Errorf("unknown difficulty %q in difficulty mix (want easy, medium or hard)", key)
+		}
+		if _, dup := mix[d]; dup {
+			return nil, fmt.Errorf("difficulty mix lists %s twice", d)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("difficulty mix count for %s must be a positive integer, got %q", d, value)
+		}
+		mix[d] = n
+	}
+	return mix, nil
+}
+
+// Total returns the number of questions the mix draws.
+func (m DifficultyMix) Total() int {
+	total := 0
+	for _, n := range m {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDifficultyMix(t *testing.T) {
+	got, err := ParseDifficultyMix(" easy=2, Medium=3,hard=1 ")
+	if err != nil {
+		t.Fatalf("ParseDifficultyMix: %v", err)
+	}
+	want := DifficultyMix{DifficultyEasy: 2, DifficultyMedium: 3, DifficultyHard: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got.Total() != 6 {
+		t.Errorf("expected a total of 6, got %d", got.Total())
+	}
+	if got, err := ParseDifficultyMix(""); err != nil || len(got) != 0 {
+		t.Errorf("an empty spec should mean no mix, got %v, %v", got, err)
+	}
+
+	for _, tt := range []struct{ spec, want string }{
+		{"hard", "not of the form"},
+		{"trivial=2", "unknown difficulty"},
+		{"hard=2,hard=3", "twice"},
+		{"hard=0", "positive integer"},
+		{"hard=1.5", "positive integer"},
+	} {
+		if _, err := ParseDifficultyMix(tt.spec); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected error containing %q, got %v", tt.spec, tt.want, err)
+		}
+	}
+}
@@ -23,12 +23,47 @@ type User struct {
 	Username     string
 	ExternalID   string
 	DisplayName  string
+	Cohort       string // Class section; copied onto sessions the user starts
+	Email        string // Optional, imported from a roster's email column
 	PasswordHash string
 	Role         UserRole
 	Active       bool
 	CreatedAt    time.Time
 }
 
+// Student identifiers selectable for teacher-facing pages and exports.
+const (
+	StudentIdentifierDisplayName = "display_name"
+	StudentIdentifierExternalID  = "external_id"
+	StudentIdentifierUsername    = "username"
+)
+
+// IsValidStudentIdentifier reports whether s is a known student identifier.
+func IsValidStudentIdentifier(s string) bool {
+	return s == StudentIdentifierDisplayName || s == StudentIdentifierExternalID || s == StudentIdentifierUsername
+}
+
+// Label returns the identifier of u selected by identifier. An empty value
+// falls back to the display name, then to the username.
+func (u User) Label(identifier string) string {
+	var label string
+	switch identifier {
+	case StudentIdentifierExternalID:
+		label = u.ExternalID
+	case StudentIdentifierUsername:
+		label = u.Username
+	default:
+		label = u.DisplayName
+	}
+	if label == "" {
+		label = u.DisplayName
+	}
+	if label == "" {
+		label = u.Username
+	}
+	return label
+}
+
 // AuthSession represents an authentication session.
 type AuthSession struct {
 	ID        string
@@ -50,6 +85,21 @@ func UserFromContext(ctx context.Context) *User {
 	return u
 }
 
+type impersonatorCtxKey struct{}
+
+// ContextWithImpersonator records the admin who is viewing the app as the
+// user stored by ContextWithUser.
+func ContextWithImpersonator(ctx context.Context, admin *User) context.Context {
+	return context.WithValue(ctx, impersonatorCtxKey{}, admin)
+}
+
+// ImpersonatorFromContext returns the impersonating admin, or nil when the
+// request is not impersonated.
+func ImpersonatorFromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(impersonatorCtxKey{}).(*User)
+	return u
+}
+
 type basePathCtxKey struct{}
 
 // ContextWithBasePath stores the base path prefix in context.
@@ -84,8 +134,34 @@ const (
 	RoleTeacher Role = "teacher"
 	RoleSystem  Role = "system"
 	RoleLLM     Role = "assistant"
+
+	// RoleClarifyRequest and RoleClarification are a student's request to
+	// clarify the question before answering and the LLM's reply. They are
+	// shown in the transcript but never graded.
+	RoleClarifyRequest Role = "clarification_request"
+	RoleClarification  Role = "clarification"
 )
 
+// IsClarification reports whether r belongs to a clarification exchange
+// rather than the graded conversation.
+func (r Role) IsClarification() bool {
+	return r == RoleClarifyRequest || r == RoleClarification
+}
+
+// Label returns the English speaker label of r in reports: "Examiner" for
+// the LLM, "Student" for the student's answers.
+func (r Role) Label() string {
+	switch r {
+	case RoleLLM:
+		return "Examiner"
+	case RoleClarifyRequest:
+		return "Clarification request"
+	case RoleClarification:
+		return "Clarification"
+	}
+	return "Student"
+}
+
 // SessionStatus represents the status of an exam session.
 type SessionStatus string
 
@@ -97,6 +173,15 @@ const (
 	StatusReviewed   SessionStatus = "reviewed"
 )
 
+// IsValidSessionStatus reports whether s is a known session status.
+func IsValidSessionStatus(s SessionStatus) bool {
+	switch s {
+	case StatusInProgress, StatusSubmitted, StatusGrading, StatusGraded, StatusReviewed:
+		return true
+	}
+	return false
+}
+
 // ThreadStatus represents the status of a question thread.
 type ThreadStatus string
 
@@ -125,6 +210,32 @@ type Question struct {
 	Rubric      string     `json:"rubric"`
 	ModelAnswer string     `json:"model_answer"`
 	MaxPoints   int        `json:"max_points"`
+	Weight      float64    `json:"weight"`                // Multiplier in the final grade; 1.0 counts MaxPoints as-is
+	GradeModel  string     `json:"grade_model,omitempty"` // Model that evaluates and grades answers; empty uses the configured one
+	Tags        []string   `json:"tags,omitempty"`        // Labels beyond the topic, lowercase (see NormalizeTags)
+	// MaxFollowups overrides the blueprint's follow-up limit for this
+	// question when set; 0 allows no follow-ups. nil uses the blueprint's.
+	MaxFollowups *int `json:"max_followups,omitempty"`
+}
+
+// DefaultQuestionWeight is used when a question file omits weight.
+const DefaultQuestionWeight = 1.0
+
+// EffectiveWeight returns q.Weight, or DefaultQuestionWeight when it is unset.
+func (q Question) EffectiveWeight() float64 {
+	if q.Weight <= 0 {
+		return DefaultQuestionWeight
+	}
+	return q.Weight
+}
+
+// FollowupLimit returns how many follow-up questions the LLM may ask about
+// q: the question's own limit if set, otherwise blueprintMax.
+func (q Question) FollowupLimit(blueprintMax int) int {
+	if q.MaxFollowups != nil {
+		return *q.MaxFollowups
+	}
+	return blueprintMax
 }
 
 // ExamBlueprint defines the structure of an exam.
@@ -136,6 +247,19 @@ type ExamBlueprint struct {
 	MaxFollowups int    `json:"max_followups"`
 }
 
+// EffectiveTimeLimit returns the stricter of the blueprint time limit and
+// the --max-exam-duration ceiling. Zero means no limit.
+func EffectiveTimeLimit(blueprint ExamBlueprint, ceiling time.Duration) time.Duration {
+	limit := time.Duration(blueprint.TimeLimit) * time.Minute
+	if blueprint.TimeLimit <= 0 {
+		limit = 0
+	}
+	if ceiling > 0 && (limit == 0 || ceiling < limit) {
+		limit = ceiling
+	}
+	return limit
+}
+
 // ExamSession represents a student's exam session.
 type ExamSession struct {
 	ID          int64         `json:"id"`
@@ -144,6 +268,8 @@ type ExamSession struct {
 	Status      SessionStatus `json:"status"`
 	StartedAt   time.Time     `json:"started_at"`
 	SubmittedAt *time.Time    `json:"submitted_at,omitempty"`
+	Cohort      string        `json:"cohort,omitempty"`
+	Receipt     string        `json:"receipt,omitempty"` // Submission receipt code; empty when none was issued
 }
 
 // QuestionThread represents a thread for a single question in an exam session.
@@ -160,10 +286,64 @@ type Message struct {
 	ThreadID   int64     `json:"thread_id"`
 	Role       Role      `json:"role"`
 	Content    string    `json:"content"`
+	Followup   string    `json:"followup,omitempty"` // LLM follow-up question, kept apart from the feedback in Content
 	CreatedAt  time.Time `json:"created_at"`
 	TokenCount int       `json:"token_count"`
 }
 
+// Transcript returns the message as plain text for LLM context and exports,
+// appending the follow-up question (if any) to the content.
+func (m Message) Transcript() string {
+	if m.Followup == "" {
+		return m.Content
+	}
+	return m.Content + "\n\nFollow-up question: " + m.Followup
+}
+
+// GradedMessages returns messages without the clarification exchanges, as
+// the evaluator and the grader see the thread.
+func GradedMessages(messages []Message) []Message {
+	var graded []Message
+	for _, m := range messages {
+		if !m.Role.IsClarification() {
+			graded = append(graded, m)
+		}
+	}
+	return graded
+}
+
+// CountClarifications returns the number of clarifications the student has
+// requested in a thread.
+func CountClarifications(messages []Message) int {
+	n := 0
+	for _, m := range messages {
+		if m.Role == RoleClarifyRequest {
+			n++
+		}
+	}
+	return n
+}
+
+// AwaitingEvaluation reports whether the last message of a thread is a
+// student answer the LLM has not replied to yet.
+func AwaitingEvaluation(messages []Message) bool {
+	return len(messages) > 0 && messages[len(messages)-1].Role == RoleStudent
+}
+
+// EditableAnswer returns the answer still awaiting evaluation and how much of
+// the edit window is left at now. left is 0 once the window has passed, when
+// window is 0, or when no answer is awaiting evaluation.
+func EditableAnswer(messages []Message, window time.Duration, now time.Time) (answer Message, left time.Duration) {
+	if window <= 0 || !AwaitingEvaluation(messages) {
+		return Message{}, 0
+	}
+	answer = messages[len(messages)-1]
+	if left = window - now.Sub(answer.CreatedAt); left <= 0 {
+		return Message{}, 0
+	}
+	return answer, left
+}
+
 // QuestionScore holds the score for a question thread.
 type QuestionScore struct {
 	ID             int64    `json:"id"`
@@ -172,6 +352,21 @@ type QuestionScore struct {
 	LLMFeedback    string   `json:"llm_feedback"`
 	TeacherScore   *float64 `json:"teacher_score,omitempty"`
 	TeacherComment string   `json:"teacher_comment,omitempty"`
+	LLMTokenCount  int      `json:"llm_token_count"`
+	LLMConfidence  float64  `json:"llm_confidence"` // 0-1; use DefaultConfidence when there is no LLM grade
+}
+
+// ThreadReview is one reviewer's score and comment on a question thread.
+// When several teachers co-grade a thread, their reviews are aggregated into
+// the thread's QuestionScore: the scores are averaged.
+type ThreadReview struct {
+	ID         int64     `json:"id"`
+	ThreadID   int64     `json:"thread_id"`
+	ReviewerID int64     `json:"reviewer_id"` // 0 for legacy scores with no known reviewer
+	Score      float64   `json:"score"`
+	Comment    string    `json:"comment,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Legacy     bool      `json:"legacy,omitempty"` // Carried over from a score set before reviews existed
 }
 
 // Grade holds the final grade for an exam session.
@@ -184,16 +379,141 @@ type Grade struct {
 	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
 }
 
+// Audit log actions.
+const (
+	AuditScoreChanged   = "score_changed"   // A reviewer set a question's score
+	AuditGradeFinalized = "grade_finalized" // A reviewer set the session's final grade
+)
+
+// AuditEntry records one change of a score or grade, for settling disputes.
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username,omitempty"` // Empty if the user was deleted
+	Action    string    `json:"action"`
+	SessionID int64     `json:"session_id"`
+	ThreadID  int64     `json:"thread_id,omitempty"` // 0 for session-level actions
+	OldValue  *float64  `json:"old_value,omitempty"` // nil if there was no score before
+	NewValue  float64   `json:"new_value"`
+}
+
+// GradingErrorPrefix starts the LLM feedback recorded for a thread whose
+// final grading call failed; such a thread scores zero.
+const GradingErrorPrefix = "Grading error: "
+
+// DefaultConfidence is the grading confidence assumed when the LLM gives
+// none, including for scores stored before confidence was recorded. It
+// never falls below a low-confidence threshold, so such answers are not
+// flagged for review.
+const DefaultConfidence = 1.0
+
+// UngradedSession is a finished session whose grade cannot be trusted: it
+// has no grades row, or some questions failed to grade and no teacher has
+// scored them since.
+type UngradedSession struct {
+	Session      ExamSession
+	MissingGrade bool // No grades row exists
+	ErrorScores  int  // Threads still scored with a grading error
+}
+
+// OrphanCounts is how many rows of each kind point at a parent row that no
+// longer exists, directly or through an orphaned thread.
+type OrphanCounts struct {
+	Threads  int // Threads whose session is gone
+	Messages int // Messages whose thread is gone or orphaned
+	Scores   int // Question scores whose thread is gone or orphaned
+	Reviews  int // Thread reviews whose thread is gone or orphaned
+	Grades   int // Grades whose session is gone
+}
+
+// Total returns the number of orphaned rows of all kinds.
+func (o OrphanCounts) Total() int {
+	return o.Threads + o.Messages + o.Scores + o.Reviews + o.Grades
+}
+
+// ArchiveCounts is how many rows ArchiveExam copied.
+type ArchiveCounts struct {
+	Questions int
+	Users     int
+	Sessions  int
+}
+
+// Policies for when fewer questions match the filters than NumQuestions requests.
+const (
+	InsufficientClamp = "clamp"            // Use only the matching questions
+	InsufficientError = "error"            // Refuse to start the exam
+	InsufficientPad   = "pad-other-topics" // Top up from other topics
+)
+
+// IsValidInsufficientPolicy reports whether p is a known insufficient-questions policy.
+func IsValidInsufficientPolicy(p string) bool {
+	return p == InsufficientClamp || p == InsufficientError || p == InsufficientPad
+}
+
 // ExamConfig holds runtime exam parameters set via CLI flags.
 type ExamConfig struct {
 	NumQuestions  int    // 0 means all available
 	Difficulty    string // empty means all difficulties
 	Topic         string // empty means all topics
+	Tag           string // empty means questions with any tags
 	MaxFollowups  int
+	NoFollowups   bool // Single-answer mode: skip per-answer evaluation and complete threads after one answer
 	Shuffle       bool
+	ConfirmStart  bool   // Show a preview with the locked question count before creating the session
+	GradeRetries  int    // Extra grading passes for threads whose grading call failed on submit
 	BasePath      string // URL prefix for sub-path deployments (e.g. "/ru")
 	SecureCookies bool   // Set Secure flag on cookies (disable for local dev)
 	PromptVariant string // Grading prompt variant (strict, standard, lenient)
+
+	MaxExamDuration time.Duration // Hard ceiling on any exam; the stricter of this and the blueprint limit applies (0 = none)
+	LLMTimeout      time.Duration // Deadline for each LLM call made by a handler or the grading loop (0 = none)
+
+	StreamFeedback bool // Show LLM feedback on the exam page as it is generated (server-sent events)
+
+	AnswerEditWindow time.Duration // Hold each answer this long so the student can fix it before evaluation (0 = evaluate at once)
+
+	AnswerRateLimit int // Answer submissions allowed per student and minute (0 = unlimited)
+	MinAnswerChars  int // Shortest accepted answer in characters after trimming whitespace (0 = off)
+
+	MaxQuestionSimilarity float64 // Reject answers whose TextSimilarity to the question exceeds this (0 = off)
+
+	MaxClarifications int // Clarification requests allowed per question before the first answer (0 = off)
+
+	ContentSecurityPolicy string // CSP header value without frame-ancestors (empty disables the header)
+	FrameAncestors        string // CSP frame-ancestors sources, e.g. "'self' https://lms.example.edu"
+
+	InsufficientQuestions string // Policy when the topic has fewer than NumQuestions (clamp, error, pad-other-topics)
+
+	AvoidRepeats bool // On a retake, prefer questions the student has not been given before
+
+	TopicVariety int // Prefer topics absent from the student's last N sessions (0 = off)
+
+	RequiredTopics []string // Topics every exam must include at least one question on
+
+	DifficultyMix DifficultyMix // Questions drawn per difficulty; replaces Difficulty and NumQuestions when set
+
+	StrictTopics bool // Reject question imports with empty or inconsistently spelled topics instead of warning
+
+	StudentIdentifier string // How teacher pages label students (display_name, external_id, username)
+
+	StaffDashboard bool // Show teachers and admins a review dashboard on the home page instead of the exam start page
+
+	ReportFont string // TrueType font for PDF transcripts (empty = search the common paths)
+
+	SubmissionReceipts bool // Issue a receipt code on submit that /verify/{code} can check
+
+	LowConfidenceThreshold float64 // Review list flags sessions with LLM grades less confident than this (0 disables)
+
+	DifficultyWeights DifficultyWeights // Scales each difficulty's share of the overall grade (nil counts all as 1)
+
+	GradeScale GradeScale // Maps percentage grades to the institution's grades on the results page (nil shows percentages only)
+
+	PassThreshold float64 // Grade percentage required to pass (0 disables pass/fail messages)
+	PassMessage   string  // Shown on the results page when passing (empty uses the localized default)
+	FailMessage   string  // Shown on the results page when failing (empty uses the localized default)
+	PassLink      string  // Optional next-steps URL for passing students
+	FailLink      string  // Optional next-steps URL for failing students
 }
 
 // QuestionImport is used for loading questions from JSON.
@@ -204,27 +524,118 @@ type QuestionImport struct {
 	Rubric      string     `json:"rubric"`
 	ModelAnswer string     `json:"model_answer"`
 	MaxPoints   int        `json:"max_points"`
+	Weight      float64    `json:"weight,omitempty"`      // Optional; 0 (absent) means DefaultQuestionWeight
+	GradeModel  string     `json:"grade_model,omitempty"` // Optional; empty uses the configured model
+	Tags        []string   `json:"tags,omitempty"`        // Optional labels beyond the topic
+	// MaxFollowups optionally overrides the blueprint's follow-up limit;
+	// absent uses the blueprint's, 0 allows none.
+	MaxFollowups *int `json:"max_followups,omitempty"`
 }
 
 // ThreadView combines thread data with question and messages for display.
 type ThreadView struct {
-	Thread   QuestionThread
-	Question Question
-	Messages []Message
-	Score    *QuestionScore
+	Thread   QuestionThread `json:"thread"`
+	Question Question       `json:"question"`
+	Messages []Message      `json:"messages"`
+	Score    *QuestionScore `json:"score,omitempty"`
 }
 
 // SessionView combines session data with threads for display.
 type SessionView struct {
+	Session   ExamSession   `json:"session"`
+	Blueprint ExamBlueprint `json:"blueprint"`
+	Threads   []ThreadView  `json:"threads"`
+	Grade     *Grade        `json:"grade,omitempty"`
+}
+
+// Progress returns how many threads the student has answered (status
+// answered or completed) out of all threads in the session.
+func (v SessionView) Progress() (answered, total int) {
+	for _, tv := range v.Threads {
+		if tv.Thread.Status == ThreadAnswered || tv.Thread.Status == ThreadCompleted {
+			answered++
+		}
+	}
+	return answered, len(v.Threads)
+}
+
+// Points returns the points the student earned and the session's maximum
+// points. A thread earns its teacher score if it has one, else its LLM
+// score; unscored threads earn nothing but still count toward the maximum.
+// The sums are unweighted: question and difficulty weights apply only to
+// the percentage grade (see OverallGrade).
+func (v SessionView) Points() (earned float64, maxPoints int) {
+	for _, tv := range v.Threads {
+		maxPoints += tv.Question.MaxPoints
+		if tv.Score == nil {
+			continue
+		}
+		if tv.Score.TeacherScore != nil {
+			earned += *tv.Score.TeacherScore
+		} else {
+			earned += tv.Score.LLMScore
+		}
+	}
+	return earned, maxPoints
+}
+
+// ExamPreview is a question set locked for a student before the exam starts.
+// Confirming it creates the session with exactly these questions.
+type ExamPreview struct {
+	UserID      int64
+	Topic       string
+	QuestionIDs []int64
+	CreatedAt   time.Time
+}
+
+// StudentHistory aggregates one student's sessions and per-topic results
+// for advising.
+type StudentHistory struct {
+	Student  User
+	Sessions []SessionSummary   // oldest first
+	Topics   []TopicPerformance // sorted by topic
+}
+
+// SessionSummary is one session in a StudentHistory.
+type SessionSummary struct {
 	Session   ExamSession
 	Blueprint ExamBlueprint
-	Threads   []ThreadView
 	Grade     *Grade
 }
 
+// TopicPerformance holds a student's scored results for one topic.
+// Percentages use the teacher score when set, otherwise the LLM score.
+type TopicPerformance struct {
+	Topic      string
+	Questions  int
+	AvgPercent float64
+	Trend      []TopicPoint // one point per session, oldest first
+}
+
+// TopicPoint is a topic's average percentage within a single session.
+type TopicPoint struct {
+	SessionID  int64
+	AvgPercent float64
+}
+
+// DashboardView is what the staff home page shows: session counts by
+// status and the latest sessions handed in.
+type DashboardView struct {
+	PendingReview int // Graded sessions waiting for a teacher
+	Grading       int // Submitted sessions the LLM is still grading
+	InProgress    int
+	Reviewed      int
+	Recent        []ExamSession // Latest handed-in sessions, newest first
+}
+
 // ExamPageView extends SessionView with time limit display fields.
 type ExamPageView struct {
 	SessionView
-	TimeRemaining time.Duration
-	TimeExceeded  bool
+	TimeRemaining  time.Duration
+	TimeExceeded   bool
+	HasTimeLimit   bool          // A blueprint limit or --max-exam-duration applies
+	Stream         bool          // Submit answers to the streaming endpoint (--stream-feedback)
+	EditWindow     time.Duration // How long a new answer stays editable before evaluation (0 = evaluate at once)
+	Clarifications int           // Clarification requests allowed per question (0 = off)
+	Grading        bool          // The viewer's own session is being graded; the page follows its grading events
 }
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuestionEffectiveWeight(t *testing.T) {
+	for _, tt := range []struct {
+		weight, want float64
+	}{
+		{0, DefaultQuestionWeight},
+		{-1, DefaultQuestionWeight},
+		{2.5, 2.5},
+	} {
+		if got := (Question{Weight: tt.weight}).EffectiveWeight(); got != tt.want {
+			t.Errorf("weight %v: got %v, want %v", tt.weight, got, tt.want)
+		}
+	}
+}
+
+func TestUserLabel(t *testing.T) {
+	full := User{Username: "ivanov", ExternalID: "UNI-1", DisplayName: "Ivanov Alexei"}
+	noExternal := User{Username: "petrov", DisplayName: "Petrov Ivan"}
+	bare := User{Username: "sidorov"}
+	tests := []struct {
+		u          User
+		identifier string
+		want       string
+	}{
+		{full, StudentIdentifierDisplayName, "Ivanov Alexei"},
+		{full, StudentIdentifierExternalID, "UNI-1"},
+		{full, StudentIdentifierUsername, "ivanov"},
+		{full, "", "Ivanov Alexei"},
+		{noExternal, StudentIdentifierExternalID, "Petrov Ivan"},
+		{bare, StudentIdentifierDisplayName, "sidorov"},
+	}
+	for _, tt := range tests {
+		if got := tt.u.Label(tt.identifier); got != tt.want {
+			t.Errorf("%+v.Label(%q) = %q, want %q", tt.u, tt.identifier, got, tt.want)
+		}
+	}
+}
+
+func TestSessionViewProgress(t *testing.T) {
+	view := SessionView{Threads: []ThreadView{
+		{Thread: QuestionThread{Status: ThreadOpen}},
+		{Thread: QuestionThread{Status: ThreadAnswered}},
+		{Thread: QuestionThread{Status: ThreadCompleted}},
+	}}
+	if answered, total := view.Progress(); answered != 2 || total != 3 {
+		t.Errorf("Progress() = %d, %d; want 2, 3", answered, total)
+	}
+	if answered, total := (SessionView{}).Progress(); answered != 0 || total != 0 {
+		t.Errorf("empty session: Progress() = %d, %d; want 0, 0", answered, total)
+	}
+}
+
+func TestSessionViewPoints(t *testing.T) {
+	teacher := 4.0
+	view := SessionView{Threads: []ThreadView{
+		{Question: Question{MaxPoints: 10}, Score: &QuestionScore{LLMScore: 7.5}},
+		{Question: Question{MaxPoints: 5}, Score: &QuestionScore{LLMScore: 2, TeacherScore: &teacher}},
+		{Question: Question{MaxPoints: 10}},
+	}}
+	if earned, maxPoints := view.Points(); earned != 11.5 || maxPoints != 25 {
+		t.Errorf("Points() = %v, %d; want 11.5, 25", earned, maxPoints)
+	}
+}
+
+func TestEditableAnswer(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	answer := Message{ID: 2, Role: RoleStudent, CreatedAt: now.Add(-10 * time.Second)}
+	pending := []Message{{ID: 1, Role: RoleStudent}, {ID: 1, Role: RoleLLM}, answer}
+
+	if got, left := EditableAnswer(pending, 30*time.Second, now); got.ID != 2 || left != 20*time.Second {
+		t.Errorf("got %d with %v left; want 2 with 20s", got.ID, left)
+	}
+	if _, left := EditableAnswer(pending, 5*time.Second, now); left != 0 {
+		t.Errorf("window has passed, got %v left", left)
+	}
+	if _, left := EditableAnswer(pending, 0, now); left != 0 {
+		t.Errorf("no window configured, got %v left", left)
+	}
+	if _, left := EditableAnswer(pending[:2], time.Minute, now); left != 0 {
+		t.Errorf("evaluated answer must not be editable, got %v left", left)
+	}
+}
+
+func TestGradedMessages(t *testing.T) {
+	messages := []Message{
+		{ID: 1, Role: RoleClarifyRequest},
+		{ID: 2, Role: RoleClarification},
+		{ID: 3, Role: RoleClarifyRequest},
+		{ID: 4, Role: RoleClarification},
+		{ID: 5, Role: RoleStudent},
+		{ID: 6, Role: RoleLLM},
+	}
+	graded := GradedMessages(messages)
+	if len(graded) != 2 || graded[0].ID != 5 || graded[1].ID != 6 {
+		t.Errorf("GradedMessages = %+v, want messages 5 and 6", graded)
+	}
+	if n := CountClarifications(messages); n != 2 {
+		t.Errorf("CountClarifications = %d, want 2", n)
+	}
+	if graded := GradedMessages(messages[:4]); len(graded) != 0 {
+		t.Errorf("clarifications alone left %d graded messages", len(graded))
+	}
+}
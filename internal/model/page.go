@@ -0,0 +1,66 @@
+package model
+
+// Page sizes for paginated lists.
+const (
+	DefaultPageSize = 25
+	MaxPageSize     = 100
+)
+
+// SessionFilter selects exam sessions for a paginated list. Zero-value
+// fields do not filter.
+type SessionFilter struct {
+	StudentID int64
+	Cohort    string
+	Statuses  []SessionStatus
+}
+
+// Page is one page of a list: Number is 1-based, Total the number of items
+// across all pages.
+type Page struct {
+	Number int
+	Size   int
+	Total  int
+}
+
+// NewPage returns page number of size items, with out-of-range values
+// replaced by the first page, DefaultPageSize and MaxPageSize.
+func NewPage(number, size int) Page {
+	if number < 1 {
+		number = 1
+	}
+	if size < 1 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+	return Page{Number: number, Size: size}
+}
+
+// Pages returns the number of pages, at least 1.
+func (p Page) Pages() int {
+	if p.Total <= p.Size {
+		return 1
+	}
+	return (p.Total + p.Size - 1) / p.Size
+}
+
+// WithTotal sets Total and moves Number back to the last page if it is past it.
+func (p Page) WithTotal(total int) Page {
+	p.Total = total
+	if p.Number > p.Pages() {
+		p.Number = p.Pages()
+	}
+	return p
+}
+
+// Offset returns the number of items before this page.
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// HasPrev reports whether there is a page before this one.
+func (p Page) HasPrev() bool { return p.Number > 1 }
+
+// HasNext reports whether there is a page after this one.
+func (p Page) HasNext() bool { return p.Number < p.Pages() }
@@ -0,0 +1,22 @@
+package model
+
+import "testing"
+
+func TestPage(t *testing.T) {
+	p := NewPage(0, 0)
+	if p.Number != 1 || p.Size != DefaultPageSize {
+		t.Errorf("NewPage(0, 0) = %+v, want page 1 of %d", p, DefaultPageSize)
+	}
+	if p := NewPage(2, 500); p.Size != MaxPageSize {
+		t.Errorf("size should be capped at %d, got %d", MaxPageSize, p.Size)
+	}
+
+	p = NewPage(9, 25).WithTotal(60)
+	if p.Number != 3 || p.Pages() != 3 || p.Offset() != 50 || !p.HasPrev() || p.HasNext() {
+		t.Errorf("page past the end should clamp to the last of 3, got %+v (pages %d, offset %d)", p, p.Pages(), p.Offset())
+	}
+	p = NewPage(1, 25).WithTotal(0)
+	if p.Pages() != 1 || p.HasPrev() || p.HasNext() || p.Offset() != 0 {
+		t.Errorf("empty list should be a single page, got %+v", p)
+	}
+}
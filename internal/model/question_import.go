@@ -0,0 +1,114 @@
+package model
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// questionCSVColumns are the header names a questions CSV file must have.
+// The "weight", "grade_model", "tags" and "max_followups" columns are
+// optional; tags are comma-separated within the cell.
+var questionCSVColumns = []string{"text", "difficulty", "topic", "rubric", "model_answer", "max_points"}
+
+// ParseQuestions decodes a question file. Files named *.csv are read as CSV
+// with a header row; anything else is read as a JSON array. A leading UTF-8
+// BOM and Windows line endings, as saved by some editors, are removed first,
+// and surrounding whitespace is trimmed from topics and difficulties. Tags
+// are normalized with NormalizeTags.
+func ParseQuestions(filename string, data []byte) ([]QuestionImport, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	var questions []QuestionImport
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		var err error
+		if questions, err = parseQuestionsCSV(data); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(data, &questions); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	for i := range questions {
+		questions[i].Topic = strings.TrimSpace(questions[i].Topic)
+		questions[i].Difficulty = Difficulty(strings.TrimSpace(string(questions[i].Difficulty)))
+		questions[i].Tags = NormalizeTags(questions[i].Tags)
+	}
+	return questions, nil
+}
+
+// parseQuestionsCSV reads questions from CSV. Columns are matched by header
+// name, so their order does not matter.
+func parseQuestionsCSV(data []byte) ([]QuestionImport, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid CSV: missing header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range questionCSVColumns {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("invalid CSV: missing column %q", name)
+		}
+	}
+
+	var questions []QuestionImport
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			i, ok := col[name]
+			if !ok {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+
+		q := QuestionImport{
+			Text:        field("text"),
+			Difficulty:  Difficulty(field("difficulty")),
+			Topic:       field("topic"),
+			Rubric:      field("rubric"),
+			ModelAnswer: field("model_answer"),
+			GradeModel:  field("grade_model"),
+			Tags:        ParseTags(field("tags")),
+		}
+		if v := field("max_points"); v != "" {
+			if q.MaxPoints, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid CSV: line %d: max_points %q is not an integer", line, v)
+			}
+		}
+		if v := field("weight"); v != "" {
+			if q.Weight, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("invalid CSV: line %d: weight %q is not a number", line, v)
+			}
+		}
+		if v := field("max_followups"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CSV: line %d: max_followups %q is not an integer", line, v)
+			}
+			q.MaxFollowups = &n
+		}
+		questions = append(questions, q)
+	}
+	return questions, nil
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseQuestionsCSV(t *testing.T) {
+	data := "\xef\xbb\xbfmax_points,text,difficulty,topic,rubric,model_answer,weight,grade_model,tags\n" +
+		"10,\"Explain inertia, briefly\",easy,Mechanics,\"Mentions mass\nand motion\",An object keeps its state,,,\n" +
+		"5,State Ohm's law,medium,Electricity,,V = IR,2,physics-7b,\"Circuits, intro,circuits\"\n"
+
+	got, err := ParseQuestions("bank.CSV", []byte(data))
+	if err != nil {
+		t.Fatalf("ParseQuestions: %v", err)
+	}
+	want := []QuestionImport{
+		{Text: "Explain inertia, briefly", Difficulty: DifficultyEasy, Topic: "Mechanics", Rubric: "Mentions mass\nand motion", ModelAnswer: "An object keeps its state", MaxPoints: 10},
+		{Text: "State Ohm's law", Difficulty: DifficultyMedium, Topic: "Electricity", ModelAnswer: "V = IR", MaxPoints: 5, Weight: 2, GradeModel: "physics-7b", Tags: []string{"circuits", "intro"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseQuestionsBOMAndCRLF(t *testing.T) {
+	data := "\xef\xbb\xbf[\r\n" +
+		"  {\"text\": \"What is inertia?\", \"difficulty\": \" easy\", \"topic\": \"Mechanics \", \"max_points\": 10},\r\n" +
+		"  {\"text\": \"State Ohm's law\", \"difficulty\": \"medium\", \"topic\": \"\\tElectricity\", \"max_points\": 5}\r\n" +
+		"]\r\n"
+
+	got, err := ParseQuestions("bank.json", []byte(data))
+	if err != nil {
+		t.Fatalf("ParseQuestions: %v", err)
+	}
+	want := []QuestionImport{
+		{Text: "What is inertia?", Difficulty: DifficultyEasy, Topic: "Mechanics", MaxPoints: 10},
+		{Text: "State Ohm's law", Difficulty: DifficultyMedium, Topic: "Electricity", MaxPoints: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseQuestionsErrors(t *testing.T) {
+	tests := []struct {
+		name, filename, data, want string
+	}{
+		{"missing column", "q.csv", "text,difficulty,topic\nQ,easy,T\n", `missing column "rubric"`},
+		{"bad max_points", "q.csv", "text,difficulty,topic,rubric,model_answer,max_points\nQ,easy,T,r,a,ten\n", "line 2: max_points"},
+		{"empty csv", "q.csv", "", "missing header row"},
+		{"bad json", "q.json", "{", "invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseQuestions(tt.filename, []byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseQuestionsJSONTags(t *testing.T) {
+	data := `[{"text": "Explain TLS", "difficulty": "medium", "topic": "net", "max_points": 10, "tags": [" Networking", "security", "", "SECURITY"]}]`
+	got, err := ParseQuestions("bank.json", []byte(data))
+	if err != nil {
+		t.Fatalf("ParseQuestions: %v", err)
+	}
+	if want := []string{"networking", "security"}; !reflect.DeepEqual(got[0].Tags, want) {
+		t.Errorf("tags = %q, want %q", got[0].Tags, want)
+	}
+}
+
+func TestParseQuestionsMaxFollowups(t *testing.T) {
+	data := "text,difficulty,topic,rubric,model_answer,max_points,max_followups\n" +
+		"Explain inertia,easy,Mechanics,,,10,\n" +
+		"State Ohm's law,easy,Electricity,,,5,0\n" +
+		"Derive Kepler's laws,hard,Gravity,,,20,5\n"
+	got, err := ParseQuestions("bank.csv", []byte(data))
+	if err != nil {
+		t.Fatalf("ParseQuestions: %v", err)
+	}
+	var limits []any
+	for _, q := range got {
+		if q.MaxFollowups == nil {
+			limits = append(limits, nil)
+		} else {
+			limits = append(limits, *q.MaxFollowups)
+		}
+	}
+	if want := []any{nil, 0, 5}; !reflect.DeepEqual(limits, want) {
+		t.Errorf("max_followups = %v, want %v", limits, want)
+	}
+
+	if _, err := ParseQuestions("bank.csv", []byte("text,difficulty,topic,rubric,model_answer,max_points,max_followups\nQ,easy,T,,,10,many\n")); err == nil || !strings.Contains(err.Error(), "max_followups") {
+		t.Errorf("a non-integer max_followups should be rejected, got %v", err)
+	}
+
+	got, err = ParseQuestions("bank.json", []byte(`[{"text": "Q", "difficulty": "easy", "max_points": 10, "max_followups": 0}]`))
+	if err != nil || got[0].MaxFollowups == nil || *got[0].MaxFollowups != 0 {
+		t.Errorf("JSON max_followups 0 should be kept as an explicit limit, got %+v (err %v)", got, err)
+	}
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// receiptLength is the number of hex digits in a receipt code, shown in
+// groups of four.
+const receiptLength = 12
+
+// ReceiptCode returns the submission receipt for a session: a short hash
+// over the session ID, the submission time and the student's answers in
+// order. The same submission always gives the same code.
+func ReceiptCode(sessionID int64, submittedAt time.Time, answers []string) string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatInt(sessionID, 10) + "\n"))
+	h.Write([]byte(submittedAt.UTC().Format(time.RFC3339Nano) + "\n"))
+	for _, a := range answers {
+		// Length-prefix each answer so moving text between answers changes the hash.
+		h.Write([]byte(strconv.Itoa(len(a)) + ":" + a + "\n"))
+	}
+	return formatReceipt(strings.ToUpper(hex.EncodeToString(h.Sum(nil))[:receiptLength]))
+}
+
+// NormalizeReceipt turns a receipt code as a person typed it (any case,
+// with or without dashes and spaces) into the stored form. It returns ""
+// if the input cannot be a receipt code.
+func NormalizeReceipt(code string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		switch {
+		case r == '-' || r == ' ':
+		case (r >= '0' && r <= '9') || (r >= 'A' && r <= 'F'):
+			b.WriteRune(r)
+		default:
+			return ""
+		}
+	}
+	if b.Len() != receiptLength {
+		return ""
+	}
+	return formatReceipt(b.String())
+}
+
+func formatReceipt(digits string) string {
+	var groups []string
+	for i := 0; i < len(digits); i += 4 {
+		groups = append(groups, digits[i:i+4])
+	}
+	return strings.Join(groups, "-")
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReceiptCode(t *testing.T) {
+	at := time.Date(2026, 5, 4, 10, 30, 0, 0, time.UTC)
+	code := ReceiptCode(7, at, []string{"first", "second"})
+	if len(code) != 14 || NormalizeReceipt(code) != code {
+		t.Fatalf("expected a 12-digit code in groups of four, got %q", code)
+	}
+	if again := ReceiptCode(7, at.In(time.FixedZone("X", 3600)), []string{"first", "second"}); again != code {
+		t.Errorf("the same submission gave %q and %q", code, again)
+	}
+	for name, other := range map[string]string{
+		"session":  ReceiptCode(8, at, []string{"first", "second"}),
+		"time":     ReceiptCode(7, at.Add(time.Second), []string{"first", "second"}),
+		"answers":  ReceiptCode(7, at, []string{"firsts", "econd"}),
+		"no extra": ReceiptCode(7, at, []string{"first"}),
+	} {
+		if other == code {
+			t.Errorf("changing the %s should change the code", name)
+		}
+	}
+}
+
+func TestNormalizeReceipt(t *testing.T) {
+	for in, want := range map[string]string{
+		"ABCD-EF01-2345":   "ABCD-EF01-2345",
+		"abcdef012345":     "ABCD-EF01-2345",
+		" abcd ef01 2345 ": "ABCD-EF01-2345",
+		"ABCD-EF01-234":    "",
+		"ABCD-EF01-234G":   "",
+		"":                 "",
+	} {
+		if got := NormalizeReceipt(in); got != want {
+			t.Errorf("NormalizeReceipt(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// GradeStep is one band of a grade scale: percentages from Min up to the
+// next band's Min get Label.
+type GradeStep struct {
+	Min   float64
+	Label string
+}
+
+// GradeScale maps percentage grades to an institution's grades, such as
+// letters (A–F) or numbers (1–5). Steps are ordered from the highest Min
+// down, and the last one starts at 0.
+type GradeScale []GradeStep
+
+// ParseGradeScale parses a scale such as "90:A,80:B,70:C,60:D,0:F" or
+// "85:5,70:4,50:3,0:2". Each entry is a minimum percentage and the grade
+// from there on; one entry must start at 0 so every percentage maps. An
+// empty string means no scale.
+func ParseGradeScale(spec string) (GradeScale, error) {
+	var scale GradeScale
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		minText, label, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("grade scale entry %q is not of the form percent:grade", entry)
+		}
+		label = strings.TrimSpace(label)
+		if label == "" {
+			return nil, fmt.Errorf("grade scale entry %q has no grade", entry)
+		}
+		from, err := strconv.ParseFloat(strings.TrimSpace(minText), 64)
+		if err != nil || from < 0 || from > 100 {
+			return nil, fmt.Errorf("grade scale minimum for %s must be a percentage from 0 to 100, got %q", label, minText)
+		}
+		if slices.ContainsFunc(scale, func(s GradeStep) bool { return s.Min == from }) {
+			return nil, fmt.Errorf("grade scale lists %s%% twice", strconv.FormatFloat(from, 'f', -1, 64))
+		}
+		scale = append(scale, GradeStep{Min: from, Label: label})
+	}
+	if len(scale) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(scale, func(a, b GradeStep) int { return cmp.Compare(b.Min, a.Min) })
+	if scale[len(scale)-1].Min != 0 {
+		return nil, fmt.Errorf("grade scale needs an entry starting at 0, e.g. 0:F")
+	}
+	return scale, nil
+}
+
+// For returns the grade for a percentage, or "" if the scale is empty.
+func (s GradeScale) For(percent float64) string {
+	for _, step := range s {
+		if percent >= step.Min {
+			return step.Label
+		}
+	}
+	return ""
+}
+
+// ApplyGradeScale sets each result's ScaledGrade from its final grade, or
+// from the LLM grade before a teacher has reviewed it.
+func ApplyGradeScale(results []StudentResult, scale GradeScale) {
+	for i := range results {
+		grade := results[i].LLMGrade
+		if results[i].FinalGrade != nil {
+			grade = *results[i].FinalGrade
+		}
+		results[i].ScaledGrade = scale.For(grade)
+	}
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGradeScale(t *testing.T) {
+	scale, err := ParseGradeScale("60:D, 90:A,0:F,80:B,70:C")
+	if err != nil {
+		t.Fatalf("ParseGradeScale: %v", err)
+	}
+	for percent, want := range map[float64]string{100: "A", 90: "A", 89.9: "B", 75: "C", 60: "D", 59.5: "F", 0: "F"} {
+		if got := scale.For(percent); got != want {
+			t.Errorf("For(%v) = %q, want %q", percent, got, want)
+		}
+	}
+	numeric, err := ParseGradeScale("85:5,70:4,50:3,0:2")
+	if err != nil {
+		t.Fatalf("ParseGradeScale: %v", err)
+	}
+	if got := numeric.For(72); got != "4" {
+		t.Errorf("numeric scale: For(72) = %q, want 4", got)
+	}
+	if scale, err := ParseGradeScale(""); err != nil || scale != nil || scale.For(50) != "" {
+		t.Errorf("an empty spec should mean no scale, got %v, %v", scale, err)
+	}
+
+	for _, tt := range []struct{ spec, want string }{
+		{"90", "not of the form"},
+		{"90:,0:F", "no grade"},
+		{"x:A,0:F", "from 0 to 100"},
+		{"101:A,0:F", "from 0 to 100"},
+		{"90:A,90:B,0:F", "twice"},
+		{"90:A,50:B", "starting at 0"},
+	} {
+		if _, err := ParseGradeScale(tt.spec); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected error containing %q, got %v", tt.spec, tt.want, err)
+		}
+	}
+}
+
+func TestApplyGradeScale(t *testing.T) {
+	scale, err := ParseGradeScale("80:pass,0:fail")
+	if err != nil {
+		t.Fatalf("ParseGradeScale: %v", err)
+	}
+	final := 85.0
+	results := []StudentResult{{LLMGrade: 70}, {LLMGrade: 70, FinalGrade: &final}}
+	ApplyGradeScale(results, scale)
+	if results[0].ScaledGrade != "fail" || results[1].ScaledGrade != "pass" {
+		t.Errorf("expected fail from the LLM grade and pass from the final grade, got %q and %q", results[0].ScaledGrade, results[1].ScaledGrade)
+	}
+}
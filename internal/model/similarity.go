@@ -0,0 +1,77 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TextSimilarity returns how alike a and b are, from 0 (nothing in common)
+// to 1 (the same text), as one minus their Levenshtein distance divided by
+// the longer length. Both are compared by rune after lowercasing, dropping
+// punctuation and collapsing whitespace, so a question pasted back with a
+// changed question mark or line break still scores 1.
+func TextSimilarity(a, b string) float64 {
+	return runeSimilarity(similarityRunes(a), similarityRunes(b))
+}
+
+// SimilarityAbove reports whether TextSimilarity(a, b) is above limit. The
+// similarity can never exceed the shorter length over the longer, so texts
+// of very different lengths, such as a long answer and its question, are
+// told apart without computing the edit distance.
+func SimilarityAbove(a, b string, limit float64) bool {
+	ra, rb := similarityRunes(a), similarityRunes(b)
+	if longest := max(len(ra), len(rb)); longest > 0 && float64(min(len(ra), len(rb)))/float64(longest) <= limit {
+		return false
+	}
+	return runeSimilarity(ra, rb) > limit
+}
+
+// runeSimilarity is TextSimilarity for already normalized runes.
+func runeSimilarity(ra, rb []rune) float64 {
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// similarityRunes normalizes s for TextSimilarity: lowercase letters and
+// digits, with each run of anything else reduced to a single space.
+func similarityRunes(s string) []rune {
+	var out []rune
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && len(out) > 0 {
+				out = append(out, ' ')
+			}
+			out = append(out, r)
+			space = false
+			continue
+		}
+		space = true
+	}
+	return out
+}
+
+// levenshtein returns the edit distance between a and b, keeping only two
+// rows of the table.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
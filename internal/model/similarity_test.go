@@ -0,0 +1,76 @@
+package model
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextSimilarity(t *testing.T) {
+	const question = "What is inertia? Give an everyday example."
+	for _, tt := range []struct {
+		name     string
+		a, b     string
+		min, max float64
+	}{
+		{"identical", question, question, 1, 1},
+		{"pasted with other punctuation and case", "what is inertia give an EVERYDAY example", question, 1, 1},
+		{"pasted with a typo", "What is inertia? Give an everyday exmple.", question, 0.95, 0.99},
+		{"own words", "Inertia is the tendency of a body to keep its state of motion, like a passenger lurching forward when a bus brakes.", question, 0, 0.4},
+		{"cyrillic", "Что такое инерция?", "что такое инерция", 1, 1},
+		{"both empty", "", "?!", 1, 1},
+		{"one empty", "", question, 0, 0},
+	} {
+		got := TextSimilarity(tt.a, tt.b)
+		if got < tt.min || got > tt.max {
+			t.Errorf("%s: TextSimilarity = %.3f, want between %.2f and %.2f", tt.name, got, tt.min, tt.max)
+		}
+		if rev := TextSimilarity(tt.b, tt.a); math.Abs(rev-got) > 1e-9 {
+			t.Errorf("%s: similarity is not symmetric: %.3f vs %.3f", tt.name, got, rev)
+		}
+	}
+}
+
+func TestSimilarityAbove(t *testing.T) {
+	const question = "What is inertia? Give an everyday example."
+	if !SimilarityAbove("what is inertia give an everyday exmple", question, 0.9) {
+		t.Error("a pasted question with a typo should be above 0.9")
+	}
+	if SimilarityAbove("Inertia keeps a body moving.", question, 0.9) {
+		t.Error("a short answer of its own should not be above 0.9")
+	}
+	if !SimilarityAbove("", "?!", 0.9) {
+		t.Error("two empty texts are the same text")
+	}
+
+	// The edit distance of these would take minutes; the length bound
+	// decides at once.
+	long := strings.Repeat("inertia ", 200_000)
+	done := make(chan bool, 1)
+	go func() { done <- SimilarityAbove(long, long[:len(long)/2], 0.9) }()
+	select {
+	case above := <-done:
+		if above {
+			t.Error("texts of half the length cannot be above 0.9")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SimilarityAbove computed the edit distance of texts that cannot match")
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"инерция", "инерции", 1},
+	} {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
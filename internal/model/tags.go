@@ -0,0 +1,26 @@
+package model
+
+import (
+	"slices"
+	"strings"
+)
+
+// NormalizeTags trims and lowercases tags and drops empty and repeated
+// ones, keeping the first occurrence's order. It returns nil when no tag
+// is left, so a question without tags compares equal to one never tagged.
+func NormalizeTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// ParseTags splits a comma-separated tag list, as typed into a form or a
+// CSV cell, e.g. "networking, security, intermediate".
+func ParseTags(s string) []string {
+	return NormalizeTags(strings.Split(s, ","))
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsValidDifficulty reports whether d is a known difficulty level.
+func IsValidDifficulty(d Difficulty) bool {
+	switch d {
+	case DifficultyEasy, DifficultyMedium, DifficultyHard:
+		return true
+	}
+	return false
+}
+
+// QuestionProblem is one issue found in a question file.
+type QuestionProblem struct {
+	Index   int    // Position of the question in the file's array
+	Message string // What is wrong
+	Warning bool   // Warnings are reported but do not make the question invalid
+}
+
+func (p QuestionProblem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("[%d] %s: %s", p.Index, level, p.Message)
+}
+
+// ValidateQuestions checks questions loaded from a JSON file and returns the
+// problems found, ordered by index. Missing text, an unknown difficulty or a
+// non-positive max_points or a negative max_followups make a question invalid;
+// an empty rubric or model answer only produces a warning.
+func ValidateQuestions(questions []QuestionImport) []QuestionProblem {
+	var problems []QuestionProblem
+	for i, q := range questions {
+		errorf := func(format string, args ...any) {
+			problems = append(problems, QuestionProblem{Index: i, Message: fmt.Sprintf(format, args...)})
+		}
+		warnf := func(format string, args ...any) {
+			problems = append(problems, QuestionProblem{Index: i, Message: fmt.Sprintf(format, args...), Warning: true})
+		}
+
+		if strings.TrimSpace(q.Text) == "" {
+			errorf("text is empty")
+		}
+		if !IsValidDifficulty(q.Difficulty) {
+			errorf("difficulty %q is not one of easy, medium, hard", q.Difficulty)
+		}
+		if q.MaxPoints <= 0 {
+			errorf("max_points must be positive, got %d", q.MaxPoints)
+		}
+		if q.MaxFollowups != nil && *q.MaxFollowups < 0 {
+			errorf("max_followups must not be negative, got %d", *q.MaxFollowups)
+		}
+		if strings.TrimSpace(q.Rubric) == "" {
+			warnf("rubric is empty")
+		}
+		if strings.TrimSpace(q.ModelAnswer) == "" {
+			warnf("model_answer is empty")
+		}
+	}
+	return problems
+}
+
+// InvalidQuestionCount returns how many distinct questions have at least one
+// error (not just warnings) among problems.
+func InvalidQuestionCount(problems []QuestionProblem) int {
+	invalid := make(map[int]bool)
+	for _, p := range problems {
+		if !p.Warning {
+			invalid[p.Index] = true
+		}
+	}
+	return len(invalid)
+}
+
+// topicKey folds the case and whitespace differences that make two topic
+// spellings name the same topic.
+func topicKey(topic string) string {
+	return strings.ToLower(strings.Join(strings.Fields(topic), " "))
+}
+
+// CheckTopics reports topic problems that break exam filtering by topic:
+// questions with an empty topic, and topics spelled differently (case or
+// whitespace) from the same topic elsewhere in questions or in bank, the
+// topics already stored. The suggested canonical spelling is the one in
+// bank if there is one, otherwise the one most questions use. Problems are
+// warnings unless strict is set.
+func CheckTopics(questions []QuestionImport, bank []string, strict bool) []QuestionProblem {
+	canonical := make(map[string]string)
+	for _, t := range bank {
+		if k := topicKey(t); k != "" && canonical[k] == "" {
+			canonical[k] = t
+		}
+	}
+	counts := make(map[string]map[string]int)
+	var seen []string
+	for _, q := range questions {
+		k := topicKey(q.Topic)
+		if k == "" || canonical[k] != "" {
+			continue
+		}
+		if counts[k] == nil {
+			counts[k] = make(map[string]int)
+		}
+		if counts[k][q.Topic] == 0 {
+			seen = append(seen, q.Topic)
+		}
+		counts[k][q.Topic]++
+	}
+	for _, t := range seen {
+		k := topicKey(t)
+		if best := canonical[k]; best == "" || counts[k][t] > counts[k][best] {
+			canonical[k] = t
+		}
+	}
+
+	var problems []QuestionProblem
+	for i, q := range questions {
+		k := topicKey(q.Topic)
+		switch {
+		case k == "":
+			problems = append(problems, QuestionProblem{Index: i, Message: "topic is empty", Warning: !strict})
+		case q.Topic != canonical[k]:
+			problems = append(problems, QuestionProblem{
+				Index:   i,
+				Message: fmt.Sprintf("topic %q is spelled inconsistently; use %q", q.Topic, canonical[k]),
+				Warning: !strict,
+			})
+		}
+	}
+	return problems
+}
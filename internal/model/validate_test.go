@@ -0,0 +1,81 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateQuestions(t *testing.T) {
+	questions := []QuestionImport{
+		{Text: "What is inertia?", Difficulty: DifficultyEasy, MaxPoints: 10, Rubric: "r", ModelAnswer: "a"},
+		{Text: "  ", Difficulty: "trivial", MaxPoints: 0, Rubric: "r", ModelAnswer: "a"},
+		{Text: "State Ohm's law", Difficulty: DifficultyMedium, MaxPoints: 5},
+	}
+
+	got := ValidateQuestions(questions)
+	want := []QuestionProblem{
+		{Index: 1, Message: "text is empty"},
+		{Index: 1, Message: `difficulty "trivial" is not one of easy, medium, hard`},
+		{Index: 1, Message: "max_points must be positive, got 0"},
+		{Index: 2, Message: "rubric is empty", Warning: true},
+		{Index: 2, Message: "model_answer is empty", Warning: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ValidateQuestions:\n got %+v\nwant %+v", got, want)
+	}
+	if n := InvalidQuestionCount(got); n != 1 {
+		t.Errorf("InvalidQuestionCount: got %d, want 1 (warnings do not invalidate)", n)
+	}
+	if s := got[3].String(); s != "[2] warning: rubric is empty" {
+		t.Errorf("String: got %q", s)
+	}
+}
+
+func TestValidateQuestionsMaxFollowups(t *testing.T) {
+	none, negative := 0, -1
+	questions := []QuestionImport{
+		{Text: "What is inertia?", Difficulty: DifficultyEasy, MaxPoints: 10, Rubric: "r", ModelAnswer: "a", MaxFollowups: &none},
+		{Text: "State Ohm's law", Difficulty: DifficultyEasy, MaxPoints: 5, Rubric: "r", ModelAnswer: "a", MaxFollowups: &negative},
+	}
+	want := []QuestionProblem{{Index: 1, Message: "max_followups must not be negative, got -1"}}
+	if got := ValidateQuestions(questions); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ValidateQuestions:\n got %+v\nwant %+v", got, want)
+	}
+
+	for _, tc := range []struct {
+		limit *int
+		want  int
+	}{{nil, 3}, {&none, 0}} {
+		if got := (Question{MaxFollowups: tc.limit}).FollowupLimit(3); got != tc.want {
+			t.Errorf("FollowupLimit(3) with question limit %v = %d, want %d", tc.limit, got, tc.want)
+		}
+	}
+}
+
+func TestCheckTopics(t *testing.T) {
+	questions := []QuestionImport{
+		{Topic: "Basics"},
+		{Topic: "basics"},
+		{Topic: "Basics"},
+		{Topic: ""},
+		{Topic: "Optics"},
+	}
+
+	got := CheckTopics(questions, nil, false)
+	want := []QuestionProblem{
+		{Index: 1, Message: `topic "basics" is spelled inconsistently; use "Basics"`, Warning: true},
+		{Index: 3, Message: "topic is empty", Warning: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("CheckTopics:\n got %+v\nwant %+v", got, want)
+	}
+
+	// A spelling already in the bank wins, and strict mode makes it an error.
+	got = CheckTopics(questions[:3], []string{"BASICS ", "Mechanics"}, true)
+	if len(got) != 3 || InvalidQuestionCount(got) != 3 {
+		t.Fatalf("expected every question reported as an error, got %+v", got)
+	}
+	if got[0].Message != `topic "Basics" is spelled inconsistently; use "BASICS "` {
+		t.Errorf("expected the bank spelling as canonical, got %q", got[0].Message)
+	}
+}
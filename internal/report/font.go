@@ -0,0 +1,67 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/signintech/gopdf"
+)
+
+// DefaultFontPaths lists TrueType fonts with Cyrillic coverage commonly
+// installed on Linux and macOS. FindFont returns the first that exists.
+var DefaultFontPaths = []string{
+	"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/TTF/DejaVuSans.ttf",
+	"/usr/share/fonts/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/truetype/liberation/LiberationSans-Regular.ttf",
+	"/Library/Fonts/Arial Unicode.ttf",
+	"/System/Library/Fonts/Supplemental/Arial.ttf",
+}
+
+// FindFont returns the first existing path from DefaultFontPaths.
+func FindFont() (string, error) {
+	for _, p := range DefaultFontPaths {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("no Unicode TrueType font found; pass the path to a .ttf file")
+}
+
+// LoadFont reads and checks the TrueType font at path, or the first font
+// FindFont finds when path is empty.
+func LoadFont(path string) (*Font, error) {
+	if path == "" {
+		var err error
+		if path, err = FindFont(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read font: %w", err)
+	}
+	font, err := ParseFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse font %s: %w", path, err)
+	}
+	return font, nil
+}
+
+// Font is a TrueType font for reports. Each document embeds the subset of
+// it that its text uses. A Font is not modified after parsing, so one can
+// be shared by concurrent writers.
+type Font struct {
+	data []byte
+}
+
+// ParseFont checks that data is a TrueType font the PDF writer can embed.
+func ParseFont(data []byte) (*Font, error) {
+	var pdf gopdf.GoPdf
+	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+	if err := pdf.AddTTFFontData(fontFamily, data); err != nil {
+		return nil, err
+	}
+	return &Font{data: data}, nil
+}
@@ -0,0 +1,113 @@
+package report
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/signintech/gopdf"
+)
+
+// A4 page geometry in points.
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	pageMargin   = 50.0
+	lineSpacing  = 1.35
+	contentWidth = pageWidth - 2*pageMargin
+)
+
+// fontFamily is the name the report font is registered under.
+const fontFamily = "report"
+
+// Document lays out wrapped text on A4 pages using a single embedded
+// TrueType font, so any script the font covers (e.g. Cyrillic) renders.
+// The first drawing error is kept and returned by WriteTo.
+type Document struct {
+	pdf gopdf.GoPdf
+	y   float64 // Baseline of the last line, from the top of the page
+	err error
+}
+
+// NewDocument returns an empty document that draws text with font.
+func NewDocument(font *Font) *Document {
+	d := &Document{}
+	d.pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+	d.err = d.pdf.AddTTFFontData(fontFamily, font.data)
+	d.newPage()
+	return d
+}
+
+func (d *Document) newPage() {
+	d.pdf.AddPage()
+	d.y = pageMargin
+}
+
+// Text writes text at the given size and gray level (0 = black), wrapping it
+// to the page width. Newlines start new lines; blank lines are kept.
+func (d *Document) Text(text string, size, gray float64) {
+	d.TextIndent(text, size, gray, 0)
+}
+
+// TextIndent is Text with a left indent in points.
+func (d *Document) TextIndent(text string, size, gray, indent float64) {
+	if d.err != nil {
+		return
+	}
+	if d.err = d.pdf.SetFont(fontFamily, "", size); d.err != nil {
+		return
+	}
+	level := uint8(gray * 255)
+	d.pdf.SetTextColor(level, level, level)
+	for _, para := range strings.Split(text, "\n") {
+		lines, err := d.pdf.SplitTextWithWordWrap(strings.TrimRight(para, "\r"), contentWidth-indent)
+		if err != nil && !errors.Is(err, gopdf.ErrEmptyString) {
+			d.err = err
+			return
+		}
+		if len(lines) == 0 {
+			lines = []string{""}
+		}
+		for _, line := range lines {
+			d.line(strings.TrimSpace(line), size, indent)
+		}
+	}
+}
+
+// Space adds vertical space in points.
+func (d *Document) Space(pt float64) {
+	d.y += pt
+	if d.y > pageHeight-pageMargin {
+		d.newPage()
+	}
+}
+
+// Rule draws a horizontal line across the content width.
+func (d *Document) Rule() {
+	d.Space(4)
+	d.pdf.SetLineWidth(0.5)
+	d.pdf.SetGrayStroke(0.7)
+	d.pdf.Line(pageMargin, d.y, pageWidth-pageMargin, d.y)
+	d.Space(10)
+}
+
+func (d *Document) line(text string, size, indent float64) {
+	lh := size * lineSpacing
+	if d.y+lh > pageHeight-pageMargin {
+		d.newPage()
+	}
+	d.y += lh
+	if text == "" || d.err != nil {
+		return
+	}
+	d.pdf.SetXY(pageMargin+indent, d.y)
+	d.err = d.pdf.Text(text)
+}
+
+// WriteTo serializes the document as PDF.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.pdf.WriteTo(w)
+}
@@ -0,0 +1,106 @@
+// Package report renders printable per-session exam reports as PDF.
+package report
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	appI18n "github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// WriteSessionPDF writes a PDF report for one exam session with every
+// question, the conversation, scores and the grade. Labels, numbers and
+// dates follow the language stored in ctx by appI18n.WithLanguage.
+func WriteSessionPDF(ctx context.Context, w io.Writer, font *Font, view *model.SessionView, student *model.User) error {
+	d := NewDocument(font)
+
+	d.Text(appI18n.Td(ctx, "TranscriptTitle", map[string]any{"ID": strconv.FormatInt(view.Session.ID, 10)}), 16, 0)
+	d.Space(4)
+	d.Text(view.Blueprint.Name, 10, 0)
+	if student != nil {
+		name := student.DisplayName
+		if name == "" {
+			name = student.Username
+		}
+		if student.ExternalID != "" {
+			name += " (" + student.ExternalID + ")"
+		}
+		d.Text(appI18n.T(ctx, "StudentLabel")+" "+name, 10, 0)
+	}
+	d.Text(appI18n.T(ctx, "StatusLabel")+" "+string(view.Session.Status), 10, 0)
+	d.Text(appI18n.T(ctx, "ColStarted")+": "+appI18n.FormatDateTime(ctx, view.Session.StartedAt), 10, 0)
+	if view.Session.SubmittedAt != nil {
+		d.Text(appI18n.T(ctx, "ColSubmitted")+": "+appI18n.FormatDateTime(ctx, *view.Session.SubmittedAt), 10, 0)
+	}
+	writeGrade(ctx, d, view.Grade)
+	d.Rule()
+
+	for i, tv := range view.Threads {
+		q := tv.Question
+		points := appI18n.Td(ctx, "Points", map[string]any{"Points": strconv.Itoa(q.MaxPoints)})
+		d.Text(appI18n.Td(ctx, "QuestionN", map[string]any{"N": strconv.Itoa(i + 1)}), 12, 0)
+		d.Text(fmt.Sprintf("%s (%s, %s)", q.Topic, q.Difficulty, points), 10, 0.4)
+		d.Space(2)
+		d.Text(q.Text, 10, 0)
+		d.Space(6)
+
+		for _, m := range tv.Messages {
+			d.Text(roleLabel(ctx, m.Role)+":", 9, 0.4)
+			d.TextIndent(m.Transcript(), 10, 0, 12)
+			d.Space(4)
+		}
+
+		if tv.Score != nil {
+			d.Text(scoreLine(ctx, "LLMScore", tv.Score.LLMScore, q.MaxPoints), 10, 0)
+			if tv.Score.LLMFeedback != "" {
+				d.TextIndent(tv.Score.LLMFeedback, 10, 0.25, 12)
+			}
+			if tv.Score.TeacherScore != nil {
+				d.Text(scoreLine(ctx, "TeacherScore", *tv.Score.TeacherScore, q.MaxPoints), 10, 0)
+				if tv.Score.TeacherComment != "" {
+					d.TextIndent(tv.Score.TeacherComment, 10, 0.25, 12)
+				}
+			}
+		} else {
+			d.Text(appI18n.T(ctx, "NotScored"), 10, 0.4)
+		}
+		d.Rule()
+	}
+
+	d.Text(appI18n.T(ctx, "ReportSummary"), 12, 0)
+	writeGrade(ctx, d, view.Grade)
+
+	_, err := d.WriteTo(w)
+	return err
+}
+
+// roleLabel names the author of a message the way the transcript page does.
+func roleLabel(ctx context.Context, role model.Role) string {
+	switch role {
+	case model.RoleStudent:
+		return appI18n.T(ctx, "Student")
+	case model.RoleClarifyRequest:
+		return appI18n.T(ctx, "ClarificationRequest")
+	case model.RoleClarification:
+		return appI18n.T(ctx, "Clarification")
+	}
+	return appI18n.T(ctx, "Evaluator")
+}
+
+func scoreLine(ctx context.Context, label string, score float64, maxPoints int) string {
+	return fmt.Sprintf("%s %s / %d", appI18n.T(ctx, label), appI18n.FormatNumber(ctx, score, 1), maxPoints)
+}
+
+func writeGrade(ctx context.Context, d *Document, g *model.Grade) {
+	if g == nil {
+		d.Text(appI18n.T(ctx, "NotGradedYet"), 10, 0)
+		return
+	}
+	d.Text(appI18n.Td(ctx, "LLMSuggestedGrade", map[string]any{"Grade": appI18n.FormatNumber(ctx, g.LLMGrade, 1)}), 10, 0)
+	if g.FinalGrade != nil {
+		d.Text(appI18n.Td(ctx, "FinalGrade", map[string]any{"Grade": appI18n.FormatNumber(ctx, *g.FinalGrade, 1)}), 10, 0)
+	}
+}
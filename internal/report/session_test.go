@@ -0,0 +1,106 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	appI18n "github.com/pavelanni/examiner/internal/i18n"
+	"github.com/pavelanni/examiner/internal/model"
+	"github.com/pavelanni/examiner/internal/store"
+)
+
+// loadTestFont loads a system font the way the server does and skips the
+// test when none is installed.
+func loadTestFont(t *testing.T) *Font {
+	t.Helper()
+	font, err := LoadFont("")
+	if err != nil {
+		t.Skip(err)
+	}
+	return font
+}
+
+// pageObject matches a page object, but not the page tree.
+var pageObject = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+func TestMain(m *testing.M) {
+	if err := appI18n.Init("en"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestWriteSessionPDF(t *testing.T) {
+	font := loadTestFont(t)
+
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer s.Close()
+
+	qID, err := s.InsertQuestion(model.Question{CourseID: 1, Text: "Сформулируйте второй закон Ньютона.", Difficulty: "easy", Topic: "Механика", MaxPoints: 10})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Физика"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	userID, err := s.CreateUser(model.User{Username: "ivanov", DisplayName: "Иван Иванов", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	sessionID, err := s.CreateSession(bpID, userID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, _ := s.GetThreadsForSession(sessionID)
+	long := strings.Repeat("Сила равна произведению массы на ускорение. ", 200)
+	for _, m := range []model.Message{
+		{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: long},
+		{ThreadID: threads[0].ID, Role: model.RoleLLM, Content: "Верно.", Followup: "А в неинерциальной системе?"},
+	} {
+		if _, err := s.AddMessage(m); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+	if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 8, LLMFeedback: "Хорошо"}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+	if err := s.UpsertGrade(model.Grade{SessionID: sessionID, LLMGrade: 80}); err != nil {
+		t.Fatalf("UpsertGrade: %v", err)
+	}
+
+	view, err := s.GetSessionView(sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	student, _ := s.GetUserByID(userID)
+
+	var buf bytes.Buffer
+	if err := WriteSessionPDF(appI18n.WithLanguage(context.Background(), "ru"), &buf, font, view, student); err != nil {
+		t.Fatalf("WriteSessionPDF: %v", err)
+	}
+	pdf := buf.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("output is not a complete PDF")
+	}
+	if n := len(pageObject.FindAll(pdf, -1)); n < 2 {
+		t.Errorf("expected the long answer to span several pages, got %d", n)
+	}
+	path, _ := FindFont()
+	if info, err := os.Stat(path); err == nil && int64(len(pdf)) > info.Size()/4 {
+		t.Errorf("the PDF (%d bytes) should embed a font subset, not the %d-byte font", len(pdf), info.Size())
+	}
+}
+
+func TestParseFontRejectsGarbage(t *testing.T) {
+	if _, err := ParseFont([]byte("not a font")); err == nil {
+		t.Error("ParseFont should reject data that is not a TrueType font")
+	}
+}
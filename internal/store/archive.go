@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// archiveTables lists the tables ArchiveExam copies, parents before
+// children so foreign keys hold while copying. Login sessions and exam
+// previews are short-lived and stay behind.
+var archiveTables = []string{
+	"exam_metadata",
+	"imported_files",
+	"questions",
+	"exam_blueprints",
+	"blueprint_questions",
+	"users",
+	"exam_sessions",
+	"question_threads",
+	"messages",
+	"question_scores",
+	"thread_reviews",
+	"grades",
+	"audit_log",
+}
+
+// sessionTables lists the tables holding session data, children before
+// parents, with the WHERE clause selecting all of their rows that belong to
+// a session. PruneSessions deletes from them in this order. The audit log
+// is left out: the trail must outlive the sessions it records.
+var sessionTables = []struct{ table, where string }{
+	{"messages", `thread_id IN (SELECT id FROM question_threads)`},
+	{"question_scores", `thread_id IN (SELECT id FROM question_threads)`},
+	{"thread_reviews", `thread_id IN (SELECT id FROM question_threads)`},
+	{"question_threads", `1`},
+	{"grades", `1`},
+	{"exam_sessions", `1`},
+}
+
+// ArchiveExam copies the exam in this database, with its metadata,
+// questions, users and sessions, into a new database at outPath. examID
+// must match the exam_id metadata, so the wrong database is not archived by
+// mistake. outPath must not exist yet.
+func (s *Store) ArchiveExam(examID, outPath string) (model.ArchiveCounts, error) {
+	stored, err := s.GetMetadata("exam_id")
+	if err != nil {
+		return model.ArchiveCounts{}, err
+	}
+	if stored != examID {
+		return model.ArchiveCounts{}, fmt.Errorf("database holds exam %q, not %q", stored, examID)
+	}
+	if _, err := os.Stat(outPath); err == nil {
+		return model.ArchiveCounts{}, fmt.Errorf("%s already exists", outPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return model.ArchiveCounts{}, err
+	}
+
+	// Create the archive with the current schema, then fill it from this
+	// database through ATTACH, which is per connection.
+	archive, err := New(outPath)
+	if err != nil {
+		return model.ArchiveCounts{}, fmt.Errorf("create archive: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return model.ArchiveCounts{}, err
+	}
+
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return model.ArchiveCounts{}, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS archive`, outPath); err != nil {
+		return model.ArchiveCounts{}, fmt.Errorf("attach archive: %w", err)
+	}
+	defer func() { _, _ = conn.ExecContext(ctx, `DETACH DATABASE archive`) }()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return model.ArchiveCounts{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var counts model.ArchiveCounts
+	for _, table := range archiveTables {
+		// Name the columns: migrations may have added them to the live
+		// database in a different order than the archive's fresh schema.
+		rows, err := tx.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+		if err != nil {
+			return model.ArchiveCounts{}, err
+		}
+		var cols []string
+		for rows.Next() {
+			var c string
+			if err := rows.Scan(&c); err != nil {
+				rows.Close()
+				return model.ArchiveCounts{}, err
+			}
+			cols = append(cols, c)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return model.ArchiveCounts{}, err
+		}
+
+		list := strings.Join(cols, ", ")
+		insert := `INSERT`
+		if table == "exam_metadata" {
+			// The archive's own migrations have already recorded their flags.
+			insert = `INSERT OR REPLACE`
+		}
+		res, err := tx.ExecContext(ctx, insert+` INTO archive.`+table+` (`+list+`) SELECT `+list+` FROM main.`+table)
+		if err != nil {
+			return model.ArchiveCounts{}, fmt.Errorf("copy %s: %w", table, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return model.ArchiveCounts{}, err
+		}
+		switch table {
+		case "questions":
+			counts.Questions = int(n)
+		case "users":
+			counts.Users = int(n)
+		case "exam_sessions":
+			counts.Sessions = int(n)
+		}
+	}
+	return counts, tx.Commit()
+}
+
+// PruneSessions deletes all exam sessions with their threads, messages,
+// scores, reviews and grades in one transaction, and returns how many
+// sessions were deleted. Questions, users, blueprints and the audit log are
+// kept, so the database can host the next exam.
+func (s *Store) PruneSessions() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var sessions int64
+	for _, t := range sessionTables {
+		res, err := tx.Exec(`DELETE FROM ` + t.table + ` WHERE ` + t.where)
+		if err != nil {
+			return 0, fmt.Errorf("delete %s: %w", t.table, err)
+		}
+		if t.table == "exam_sessions" {
+			if sessions, err = res.RowsAffected(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return int(sessions), tx.Commit()
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// insertAudit appends e to the audit log. It runs in the transaction that
+// makes the change, so a change is never stored without its entry.
+func insertAudit(tx *sql.Tx, e model.AuditEntry) error {
+	var threadID sql.NullInt64
+	if e.ThreadID != 0 {
+		threadID = sql.NullInt64{Int64: e.ThreadID, Valid: true}
+	}
+	_, err := tx.Exec(
+		`INSERT INTO audit_log (created_at, user_id, action, session_id, thread_id, old_value, new_value)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.CreatedAt, e.UserID, e.Action, e.SessionID, threadID, e.OldValue, e.NewValue,
+	)
+	return err
+}
+
+// ListAuditLog returns the audit entries of a session, oldest first.
+func (s *Store) ListAuditLog(sessionID int64) ([]model.AuditEntry, error) {
+	rows, err := s.db.Query(
+		`SELECT a.id, a.created_at, a.user_id, COALESCE(u.username, ''), a.action,
+		        a.session_id, COALESCE(a.thread_id, 0), a.old_value, a.new_value
+		 FROM audit_log a LEFT JOIN users u ON u.id = a.user_id
+		 WHERE a.session_id = ? ORDER BY a.id`, sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var e model.AuditEntry
+		var old sql.NullFloat64
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.UserID, &e.Username, &e.Action,
+			&e.SessionID, &e.ThreadID, &old, &e.NewValue); err != nil {
+			return nil, err
+		}
+		e.OldValue = nullFloat(old)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// nullFloat converts a nullable column to a pointer, nil for NULL.
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
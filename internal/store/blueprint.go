@@ -0,0 +1,51 @@
+package store
+
+import "github.com/pavelanni/examiner/internal/model"
+
+// SetBlueprintQuestions replaces the fixed question set of a blueprint with
+// questionIDs, in that order. An empty list removes the fixed set, so exams
+// go back to picking questions with the configured filters.
+func (s *Store) SetBlueprintQuestions(blueprintID int64, questionIDs []int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`DELETE FROM blueprint_questions WHERE blueprint_id = ?`, blueprintID); err != nil {
+		return err
+	}
+	for i, id := range questionIDs {
+		if _, err := tx.Exec(
+			`INSERT INTO blueprint_questions (blueprint_id, question_id, position) VALUES (?, ?, ?)`,
+			blueprintID, id, i,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// BlueprintQuestions returns the fixed question set of a blueprint in
+// position order, or nil if it has none.
+func (s *Store) BlueprintQuestions(blueprintID int64) ([]model.Question, error) {
+	rows, err := s.db.Query(`
+		SELECT q.id, q.course_id, q.text, q.difficulty, q.topic, q.rubric, q.model_answer, q.max_points, q.weight, q.grade_model, q.tags, q.max_followups
+		FROM blueprint_questions bq
+		JOIN questions q ON q.id = bq.question_id
+		WHERE bq.blueprint_id = ?
+		ORDER BY bq.position`, blueprintID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var questions []model.Question
+	for rows.Next() {
+		var q model.Question
+		if err := rows.Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints, &q.Weight, &q.GradeModel, (*tagList)(&q.Tags), &q.MaxFollowups); err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
@@ -6,8 +6,10 @@ import (
 	"github.com/pavelanni/examiner/internal/model"
 )
 
-// ExportAllSessions builds export-ready student results from all sessions.
-func (s *Store) ExportAllSessions() ([]model.StudentResult, error) {
+// ExportAllSessions builds export-ready student results from all sessions,
+// or only from one cohort's sessions when cohort is non-empty. Each result's
+// label is the student identifier selected by identifier (see User.Label).
+func (s *Store) ExportAllSessions(cohort, identifier string) ([]model.StudentResult, error) {
 	sessions, err := s.ListSessionsChronological()
 	if err != nil {
 		return nil, fmt.Errorf("list sessions: %w", err)
@@ -19,6 +21,9 @@ func (s *Store) ExportAllSessions() ([]model.StudentResult, error) {
 	var results []model.StudentResult
 	for _, sess := range sessions {
 		studentSessionCount[sess.StudentID]++
+		if cohort != "" && sess.Cohort != cohort {
+			continue
+		}
 
 		view, err := s.GetSessionView(sess.ID)
 		if err != nil {
@@ -30,20 +35,25 @@ func (s *Store) ExportAllSessions() ([]model.StudentResult, error) {
 			return nil, fmt.Errorf("get user %d: %w", sess.StudentID, err)
 		}
 
-		var externalID, displayName string
+		var externalID, displayName, label string
 		if user != nil {
 			externalID = user.ExternalID
 			displayName = user.DisplayName
+			label = user.Label(identifier)
 		}
 
 		var questions []model.QuestionResult
+		var tokens int
 		for _, tv := range view.Threads {
 			var conv []model.ConversationMsg
+			var questionTokens int
 			for _, m := range tv.Messages {
+				questionTokens += m.TokenCount
 				conv = append(conv, model.ConversationMsg{
-					Role:    string(m.Role),
-					Content: m.Content,
-					At:      m.CreatedAt,
+					Role:       string(m.Role),
+					Content:    m.Transcript(),
+					At:         m.CreatedAt,
+					TokenCount: &m.TokenCount,
 				})
 			}
 
@@ -59,26 +69,65 @@ func (s *Store) ExportAllSessions() ([]model.StudentResult, error) {
 			if tv.Score != nil {
 				qr.LLMScore = tv.Score.LLMScore
 				qr.LLMFeedback = tv.Score.LLMFeedback
+				questionTokens += tv.Score.LLMTokenCount
 			}
+			qr.TokenCount = &questionTokens
+			tokens += questionTokens
 			questions = append(questions, qr)
 		}
 
 		var llmGrade float64
+		var finalGrade *float64
 		if view.Grade != nil {
 			llmGrade = view.Grade.LLMGrade
+			finalGrade = view.Grade.FinalGrade
 		}
 
 		results = append(results, model.StudentResult{
 			ExternalID:    externalID,
 			DisplayName:   displayName,
+			Label:         label,
+			Cohort:        sess.Cohort,
 			SessionNumber: studentSessionCount[sess.StudentID],
 			Status:        sess.Status,
 			StartedAt:     sess.StartedAt,
 			SubmittedAt:   sess.SubmittedAt,
 			Questions:     questions,
 			LLMGrade:      llmGrade,
+			FinalGrade:    finalGrade,
+			TokenCount:    tokens,
 		})
 	}
 
 	return results, nil
 }
+
+// ListGradeRecords returns the grade of every graded session, oldest first.
+// A non-empty examID returns nothing unless it matches the exam_id
+// metadata, since every session in a database belongs to its exam; a
+// database without exam_id matches any examID. A non-empty cohort limits
+// the result to that cohort's sessions.
+func (s *Store) ListGradeRecords(examID, cohort string) ([]model.GradeRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT s.id, COALESCE(u.username, ''), COALESCE(u.external_id, ''), COALESCE(u.display_name, ''),
+		       g.llm_grade, g.final_grade
+		FROM exam_sessions s
+		JOIN grades g ON g.session_id = s.id
+		LEFT JOIN users u ON u.id = s.student_id
+		WHERE (? = '' OR COALESCE((SELECT value FROM exam_metadata WHERE key = 'exam_id'), '') IN ('', ?))
+		  AND (? = '' OR s.cohort = ?)
+		ORDER BY s.id`, examID, examID, cohort, cohort)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []model.GradeRecord
+	for rows.Next() {
+		var g model.GradeRecord
+		if err := rows.Scan(&g.SessionID, &g.Username, &g.ExternalID, &g.DisplayName, &g.LLMGrade, &g.FinalGrade); err != nil {
+			return nil, err
+		}
+		records = append(records, g)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// StudentHistory returns all of a student's sessions with grades, plus
+// per-topic averages and a per-session trend for each topic. It returns
+// an error wrapping sql.ErrNoRows when the user does not exist.
+func (s *Store) StudentHistory(userID int64) (*model.StudentHistory, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %d: %w", userID, sql.ErrNoRows)
+	}
+
+	sessions, err := s.ListSessionsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	hist := &model.StudentHistory{Student: *user}
+	// ListSessionsByUser is newest first; history reads oldest first.
+	for i := len(sessions) - 1; i >= 0; i-- {
+		sess := sessions[i]
+		bp, err := s.GetBlueprint(sess.BlueprintID)
+		if err != nil {
+			return nil, err
+		}
+		grade, err := s.GetGrade(sess.ID)
+		if err != nil {
+			return nil, err
+		}
+		hist.Sessions = append(hist.Sessions, model.SessionSummary{Session: sess, Blueprint: bp, Grade: grade})
+	}
+
+	rows, err := s.db.Query(
+		`SELECT t.session_id, q.topic, q.max_points, COALESCE(sc.teacher_score, sc.llm_score)
+		 FROM question_threads t
+		 JOIN exam_sessions es ON es.id = t.session_id
+		 JOIN questions q ON q.id = t.question_id
+		 JOIN question_scores sc ON sc.thread_id = t.id
+		 WHERE es.student_id = ? AND q.max_points > 0
+		 ORDER BY es.started_at, es.id, t.id`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query topic scores: %w", err)
+	}
+	defer rows.Close()
+
+	type acc struct {
+		sum   float64
+		count int
+	}
+	topics := map[string]*model.TopicPerformance{}
+	totals := map[string]*acc{}
+	perSession := map[string]*acc{}
+	for rows.Next() {
+		var sessionID int64
+		var topic string
+		var maxPoints int
+		var score float64
+		if err := rows.Scan(&sessionID, &topic, &maxPoints, &score); err != nil {
+			return nil, fmt.Errorf("scan topic score: %w", err)
+		}
+		pct := score / float64(maxPoints) * 100
+
+		tp, ok := topics[topic]
+		if !ok {
+			tp = &model.TopicPerformance{Topic: topic}
+			topics[topic] = tp
+			totals[topic] = &acc{}
+		}
+		tp.Questions++
+		totals[topic].sum += pct
+		totals[topic].count++
+
+		// Rows arrive in session order, so a topic's last trend point is
+		// the one for the current session if it exists.
+		key := fmt.Sprintf("%s\x00%d", topic, sessionID)
+		if n := len(tp.Trend); n == 0 || tp.Trend[n-1].SessionID != sessionID {
+			tp.Trend = append(tp.Trend, model.TopicPoint{SessionID: sessionID})
+			perSession[key] = &acc{}
+		}
+		a := perSession[key]
+		a.sum += pct
+		a.count++
+		tp.Trend[len(tp.Trend)-1].AvgPercent = a.sum / float64(a.count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for name, tp := range topics {
+		tp.AvgPercent = totals[name].sum / float64(totals[name].count)
+		hist.Topics = append(hist.Topics, *tp)
+	}
+	sort.Slice(hist.Topics, func(i, j int) bool { return hist.Topics[i].Topic < hist.Topics[j].Topic })
+	return hist, nil
+}
+
+// RecentTopics returns, for each topic covered by a student's last sessions
+// (at most limit of them), the number of those sessions that included it.
+func (s *Store) RecentTopics(studentID int64, limit int) (map[string]int, error) {
+	rows, err := s.db.Query(
+		`SELECT q.topic, COUNT(DISTINCT t.session_id) FROM question_threads t
+		 JOIN questions q ON q.id = t.question_id
+		 WHERE t.session_id IN (
+			SELECT id FROM exam_sessions WHERE student_id = ? ORDER BY id DESC LIMIT ?)
+		 GROUP BY q.topic`,
+		studentID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	topics := make(map[string]int)
+	for rows.Next() {
+		var topic string
+		var n int
+		if err := rows.Scan(&topic, &n); err != nil {
+			return nil, err
+		}
+		topics[topic] = n
+	}
+	return topics, rows.Err()
+}
+
+// SeenQuestionIDs returns the IDs of the questions a student was given in
+// any of their sessions for a blueprint, so a retake can avoid them.
+func (s *Store) SeenQuestionIDs(studentID, blueprintID int64) (map[int64]bool, error) {
+	rows, err := s.db.Query(
+		`SELECT DISTINCT t.question_id FROM question_threads t
+		 JOIN exam_sessions s ON s.id = t.session_id
+		 WHERE s.student_id = ? AND s.blueprint_id = ?`,
+		studentID, blueprintID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		seen[id] = true
+	}
+	return seen, rows.Err()
+}
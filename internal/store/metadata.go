@@ -28,6 +28,25 @@ func (s *Store) GetMetadata(key string) (string, error) {
 	return value, err
 }
 
+// examOpenKey is the metadata key of the exam open/closed setting.
+const examOpenKey = "exam_open"
+
+// ExamOpen reports whether students may start exams and submit answers.
+// The exam is open unless SetExamOpen closed it.
+func (s *Store) ExamOpen() (bool, error) {
+	v, err := s.GetMetadata(examOpenKey)
+	if err != nil || v == "" {
+		return true, err
+	}
+	return strconv.ParseBool(v)
+}
+
+// SetExamOpen opens or closes the exam for all students. The setting is
+// stored in the database, so it survives restarts.
+func (s *Store) SetExamOpen(open bool) error {
+	return s.SetMetadata(examOpenKey, strconv.FormatBool(open))
+}
+
 // SetExamInfo stores all ExamInfo fields as metadata rows.
 func (s *Store) SetExamInfo(info model.ExamInfo) error {
 	pairs := []struct{ k, v string }{
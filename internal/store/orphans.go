@@ -0,0 +1,60 @@
+package store
+
+import (
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// liveThreads selects the IDs of threads whose session still exists.
+const liveThreads = `SELECT t.id FROM question_threads t JOIN exam_sessions s ON s.id = t.session_id`
+
+// orphanKinds lists, per orphan kind, the WHERE clause selecting its orphaned
+// rows. Children come before their parents, so deleting in this order never
+// turns a row counted as live into an orphan.
+var orphanKinds = []struct {
+	table string
+	where string
+	count func(*model.OrphanCounts) *int
+}{
+	{"messages", `thread_id NOT IN (` + liveThreads + `)`, func(o *model.OrphanCounts) *int { return &o.Messages }},
+	{"question_scores", `thread_id NOT IN (` + liveThreads + `)`, func(o *model.OrphanCounts) *int { return &o.Scores }},
+	{"thread_reviews", `thread_id NOT IN (` + liveThreads + `)`, func(o *model.OrphanCounts) *int { return &o.Reviews }},
+	{"question_threads", `session_id NOT IN (SELECT id FROM exam_sessions)`, func(o *model.OrphanCounts) *int { return &o.Threads }},
+	{"grades", `session_id NOT IN (SELECT id FROM exam_sessions)`, func(o *model.OrphanCounts) *int { return &o.Grades }},
+}
+
+// FindOrphans counts rows whose parent row is gone. Foreign keys are now
+// enforced, but databases written before that can still hold such rows
+// from a crash or a partial delete.
+func (s *Store) FindOrphans() (model.OrphanCounts, error) {
+	var counts model.OrphanCounts
+	for _, k := range orphanKinds {
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM ` + k.table + ` WHERE ` + k.where).Scan(k.count(&counts)); err != nil {
+			return model.OrphanCounts{}, err
+		}
+	}
+	return counts, nil
+}
+
+// DeleteOrphans deletes the rows FindOrphans reports in one transaction and
+// returns how many of each kind were deleted.
+func (s *Store) DeleteOrphans() (model.OrphanCounts, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return model.OrphanCounts{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var counts model.OrphanCounts
+	for _, k := range orphanKinds {
+		res, err := tx.Exec(`DELETE FROM ` + k.table + ` WHERE ` + k.where)
+		if err != nil {
+			return model.OrphanCounts{}, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return model.OrphanCounts{}, err
+		}
+		*k.count(&counts) = int(n)
+	}
+	return counts, tx.Commit()
+}
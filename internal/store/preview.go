@@ -0,0 +1,50 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// SaveExamPreview stores the locked question set for a user's next exam,
+// replacing any previous preview.
+func (s *Store) SaveExamPreview(p model.ExamPreview) error {
+	ids, err := json.Marshal(p.QuestionIDs)
+	if err != nil {
+		return fmt.Errorf("marshal question ids: %w", err)
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO exam_previews (user_id, topic, question_ids, created_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(user_id) DO UPDATE SET topic = excluded.topic, question_ids = excluded.question_ids, created_at = excluded.created_at`,
+		p.UserID, p.Topic, string(ids), time.Now(),
+	)
+	return err
+}
+
+// GetExamPreview returns the user's pending preview, or nil if there is none.
+func (s *Store) GetExamPreview(userID int64) (*model.ExamPreview, error) {
+	p := model.ExamPreview{UserID: userID}
+	var ids string
+	err := s.db.QueryRow(
+		`SELECT topic, question_ids, created_at FROM exam_previews WHERE user_id = ?`, userID,
+	).Scan(&p.Topic, &ids, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(ids), &p.QuestionIDs); err != nil {
+		return nil, fmt.Errorf("unmarshal question ids: %w", err)
+	}
+	return &p, nil
+}
+
+// DeleteExamPreview removes the user's pending preview.
+func (s *Store) DeleteExamPreview(userID int64) error {
+	_, err := s.db.Exec(`DELETE FROM exam_previews WHERE user_id = ?`, userID)
+	return err
+}
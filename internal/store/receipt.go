@@ -0,0 +1,68 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// IssueReceipt stores the submission receipt of a submitted session and
+// returns it. A session that already has a receipt keeps it, so calling
+// this again (for example when grading is retried) is harmless.
+func (s *Store) IssueReceipt(sessionID int64) (string, error) {
+	sess, err := s.GetSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if sess.Receipt != "" {
+		return sess.Receipt, nil
+	}
+	if sess.SubmittedAt == nil {
+		return "", fmt.Errorf("session %d is not submitted", sessionID)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT m.content FROM messages m
+		JOIN question_threads t ON t.id = m.thread_id
+		WHERE t.session_id = ? AND m.role = ?
+		ORDER BY t.id, m.id`, sessionID, model.RoleStudent)
+	if err != nil {
+		return "", err
+	}
+	var answers []string
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			rows.Close()
+			return "", err
+		}
+		answers = append(answers, a)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return "", err
+	}
+
+	code := model.ReceiptCode(sessionID, *sess.SubmittedAt, answers)
+	if _, err := s.db.Exec(`UPDATE exam_sessions SET receipt = ? WHERE id = ?`, code, sessionID); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// SessionByReceipt returns the session a receipt code was issued for. The
+// code may be typed in any case, with or without dashes. It returns
+// sql.ErrNoRows if no session has that receipt.
+func (s *Store) SessionByReceipt(code string) (model.ExamSession, error) {
+	code = model.NormalizeReceipt(code)
+	if code == "" {
+		return model.ExamSession{}, sql.ErrNoRows
+	}
+	var id int64
+	if err := s.db.QueryRow(`SELECT id FROM exam_sessions WHERE receipt = ?`, code).Scan(&id); err != nil {
+		return model.ExamSession{}, err
+	}
+	return s.GetSession(id)
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// execQuerier is satisfied by both *sql.DB and *sql.Tx.
+type execQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// UpsertThreadReview records a reviewer's score and comment on a thread,
+// replacing that reviewer's earlier review, and refreshes the thread's
+// aggregated teacher score.
+func (s *Store) UpsertThreadReview(rv model.ThreadReview) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The score being replaced is the reviewer's earlier one or, on their
+	// first review, the LLM's.
+	var sessionID int64
+	var old sql.NullFloat64
+	err = tx.QueryRow(
+		`SELECT t.session_id, COALESCE(
+			(SELECT score FROM thread_reviews WHERE thread_id = t.id AND reviewer_id = ?),
+			(SELECT llm_score FROM question_scores WHERE thread_id = t.id))
+		 FROM question_threads t WHERE t.id = ?`, rv.ReviewerID, rv.ThreadID,
+	).Scan(&sessionID, &old)
+	if err != nil {
+		return err
+	}
+	err = insertAudit(tx, model.AuditEntry{
+		CreatedAt: time.Now(), UserID: rv.ReviewerID, Action: model.AuditScoreChanged,
+		SessionID: sessionID, ThreadID: rv.ThreadID, OldValue: nullFloat(old), NewValue: rv.Score,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO thread_reviews (thread_id, reviewer_id, score, comment, updated_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(thread_id, reviewer_id) DO UPDATE SET score = ?, comment = ?, updated_at = ?, legacy = 0`,
+		rv.ThreadID, rv.ReviewerID, rv.Score, rv.Comment, time.Now(),
+		rv.Score, rv.Comment, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if err := aggregateReviews(tx, `SELECT ?`, rv.ThreadID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListThreadReviews returns the reviews of a thread in the order they were
+// first made.
+func (s *Store) ListThreadReviews(threadID int64) ([]model.ThreadReview, error) {
+	rows, err := s.db.Query(
+		`SELECT id, thread_id, reviewer_id, score, comment, updated_at, legacy
+		 FROM thread_reviews WHERE thread_id = ? ORDER BY id`, threadID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []model.ThreadReview
+	for rows.Next() {
+		var rv model.ThreadReview
+		if err := rows.Scan(&rv.ID, &rv.ThreadID, &rv.ReviewerID, &rv.Score, &rv.Comment, &rv.UpdatedAt, &rv.Legacy); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, rv)
+	}
+	return reviews, rows.Err()
+}
+
+// legacyReviewsKey is the metadata key set once teacher scores from before
+// multi-reviewer support have been carried over as reviews.
+const legacyReviewsKey = "legacy_reviews_migrated"
+
+// migrateLegacyReviews carries scores set before multi-reviewer support over
+// as legacy reviews, credited to whoever finalized the session (0 if nobody
+// did). It runs once per database, so scores set later without a review are
+// not turned into reviews on the next start.
+func (s *Store) migrateLegacyReviews() error {
+	done, err := s.GetMetadata(legacyReviewsKey)
+	if err != nil || done != "" {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.Exec(`
+		INSERT INTO thread_reviews (thread_id, reviewer_id, score, comment, updated_at, legacy)
+		SELECT sc.thread_id, COALESCE(g.reviewed_by, 0), sc.teacher_score, sc.teacher_comment, COALESCE(g.reviewed_at, ?), 1
+		FROM question_scores sc
+		JOIN question_threads t ON t.id = sc.thread_id
+		LEFT JOIN grades g ON g.session_id = t.session_id
+		WHERE sc.teacher_score IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM thread_reviews r WHERE r.thread_id = sc.thread_id)
+	`, time.Now())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO exam_metadata (key, value) VALUES (?, '1')`, legacyReviewsKey); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// aggregateReviews sets the teacher score of every reviewed thread whose ID
+// is selected by threadQuery to the average of its review scores, and the
+// teacher comment to the non-empty review comments, one paragraph each.
+// A legacy review only counts until a teacher reviews the thread. Threads
+// without reviews keep their teacher score.
+func aggregateReviews(db execQuerier, threadQuery string, args ...any) error {
+	rows, err := db.Query(
+		`SELECT thread_id, score, comment FROM thread_reviews rv
+		 WHERE thread_id IN (`+threadQuery+`)
+		   AND (legacy = 0 OR NOT EXISTS (
+		       SELECT 1 FROM thread_reviews r WHERE r.thread_id = rv.thread_id AND r.legacy = 0))
+		 ORDER BY thread_id, id`, args...,
+	)
+	if err != nil {
+		return err
+	}
+	type aggregate struct {
+		sum      float64
+		n        int
+		comments []string
+	}
+	byThread := make(map[int64]*aggregate)
+	var order []int64
+	for rows.Next() {
+		var threadID int64
+		var score float64
+		var comment string
+		if err := rows.Scan(&threadID, &score, &comment); err != nil {
+			rows.Close()
+			return err
+		}
+		a := byThread[threadID]
+		if a == nil {
+			a = &aggregate{}
+			byThread[threadID] = a
+			order = append(order, threadID)
+		}
+		a.sum += score
+		a.n++
+		if comment = strings.TrimSpace(comment); comment != "" {
+			a.comments = append(a.comments, comment)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, threadID := range order {
+		a := byThread[threadID]
+		_, err := db.Exec(
+			`UPDATE question_scores SET teacher_score = ?, teacher_comment = ? WHERE thread_id = ?`,
+			a.sum/float64(a.n), strings.Join(a.comments, "\n\n"), threadID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScorePairs returns the LLM and teacher scores of every thread a teacher
+// has scored, in thread order, limited to sessions of cohort unless it is
+// empty. Threads whose LLM grading failed are left out, since their zero is
+// not the LLM's judgement.
+func (s *Store) ScorePairs(cohort string) ([]model.ScorePair, error) {
+	rows, err := s.db.Query(
+		`SELECT sc.llm_score, sc.teacher_score, q.max_points
+		 FROM question_scores sc
+		 JOIN question_threads t ON t.id = sc.thread_id
+		 JOIN questions q ON q.id = t.question_id
+		 JOIN exam_sessions s ON s.id = t.session_id
+		 WHERE sc.teacher_score IS NOT NULL AND substr(sc.llm_feedback, 1, ?) != ?
+		   AND (? = '' OR s.cohort = ?)
+		 ORDER BY sc.thread_id`,
+		len(model.GradingErrorPrefix), model.GradingErrorPrefix, cohort, cohort,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []model.ScorePair
+	for rows.Next() {
+		var p model.ScorePair
+		if err := rows.Scan(&p.LLMScore, &p.TeacherScore, &p.MaxPoints); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
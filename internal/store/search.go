@@ -0,0 +1,111 @@
+package store
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// migrateSearch creates the FTS5 index over questions and the triggers that
+// keep it in sync. If the SQLite build lacks FTS5, search falls back to LIKE.
+func (s *Store) migrateSearch() error {
+	var existing int
+	if err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'questions_fts'`,
+	).Scan(&existing); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS questions_fts USING fts5(
+		text, topic, rubric,
+		content='questions', content_rowid='id'
+	)`)
+	if err != nil {
+		slog.Warn("FTS5 unavailable, question search falls back to LIKE", "error", err)
+		return nil
+	}
+
+	_, err = s.db.Exec(`
+	CREATE TRIGGER IF NOT EXISTS questions_fts_ai AFTER INSERT ON questions BEGIN
+		INSERT INTO questions_fts(rowid, text, topic, rubric) VALUES (new.id, new.text, new.topic, new.rubric);
+	END;
+	CREATE TRIGGER IF NOT EXISTS questions_fts_ad AFTER DELETE ON questions BEGIN
+		INSERT INTO questions_fts(questions_fts, rowid, text, topic, rubric) VALUES ('delete', old.id, old.text, old.topic, old.rubric);
+	END;
+	CREATE TRIGGER IF NOT EXISTS questions_fts_au AFTER UPDATE ON questions BEGIN
+		INSERT INTO questions_fts(questions_fts, rowid, text, topic, rubric) VALUES ('delete', old.id, old.text, old.topic, old.rubric);
+		INSERT INTO questions_fts(rowid, text, topic, rubric) VALUES (new.id, new.text, new.topic, new.rubric);
+	END;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Index rows that existed before the FTS table was created.
+	if existing == 0 {
+		if _, err := s.db.Exec(`INSERT INTO questions_fts(questions_fts) VALUES ('rebuild')`); err != nil {
+			return err
+		}
+		slog.Info("built question search index")
+	}
+
+	s.fts = true
+	return nil
+}
+
+// SearchQuestionsLimit caps the number of questions SearchQuestions returns.
+const SearchQuestionsLimit = 200
+
+// SearchQuestions returns questions whose text, topic, or rubric match all
+// words in query (prefix matching, best matches first). An empty query
+// returns all questions in ID order. At most SearchQuestionsLimit questions
+// are returned.
+func (s *Store) SearchQuestions(query string) ([]model.Question, error) {
+	terms := strings.Fields(query)
+
+	var sqlQuery string
+	var args []any
+	if len(terms) == 0 {
+		sqlQuery = `SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups FROM questions ORDER BY id`
+	} else if s.fts {
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+		}
+		sqlQuery = `SELECT q.id, q.course_id, q.text, q.difficulty, q.topic, q.rubric, q.model_answer, q.max_points, q.weight, q.grade_model, q.tags, q.max_followups
+			FROM questions_fts f JOIN questions q ON q.id = f.rowid
+			WHERE questions_fts MATCH ? ORDER BY f.rank`
+		args = append(args, strings.Join(quoted, " "))
+	} else {
+		sqlQuery = `SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups FROM questions WHERE 1=1`
+		for _, term := range terms {
+			sqlQuery += ` AND (text LIKE ? ESCAPE '\' OR topic LIKE ? ESCAPE '\' OR rubric LIKE ? ESCAPE '\')`
+			pattern := "%" + escapeLike(term) + "%"
+			args = append(args, pattern, pattern, pattern)
+		}
+		sqlQuery += ` ORDER BY id`
+	}
+	sqlQuery += ` LIMIT ?`
+	args = append(args, SearchQuestionsLimit)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var questions []model.Question
+	for rows.Next() {
+		var q model.Question
+		if err := rows.Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints, &q.Weight, &q.GradeModel, (*tagList)(&q.Tags), &q.MaxFollowups); err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so the term matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
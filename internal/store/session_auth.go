@@ -1,17 +1,32 @@
 package store
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"log/slog"
 	"time"
 
 	"github.com/pavelanni/examiner/internal/model"
 )
 
-const authSessionTTL = 24 * time.Hour
+// DefaultAuthSessionTTL is how long a login lasts unless SetAuthSessionTTL
+// changes it.
+const DefaultAuthSessionTTL = 24 * time.Hour
 
-// CreateAuthSession creates a new auth session token for a user.
+// SetAuthSessionTTL sets how long sessions created from now on stay valid.
+// A zero or negative ttl restores DefaultAuthSessionTTL. Existing sessions
+// keep their expiry.
+func (s *Store) SetAuthSessionTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultAuthSessionTTL
+	}
+	s.authSessionTTL = ttl
+}
+
+// CreateAuthSession creates a new auth session token for a user that
+// expires after the configured TTL.
 func (s *Store) CreateAuthSession(userID int64) (string, error) {
 	token, err := generateToken()
 	if err != nil {
@@ -20,7 +35,7 @@ func (s *Store) CreateAuthSession(userID int64) (string, error) {
 	now := time.Now()
 	_, err = s.db.Exec(
 		`INSERT INTO auth_sessions (id, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)`,
-		token, userID, now, now.Add(authSessionTTL),
+		token, userID, now, now.Add(s.authSessionTTL),
 	)
 	if err != nil {
 		return "", err
@@ -53,12 +68,52 @@ func (s *Store) DeleteAuthSession(token string) error {
 	return err
 }
 
-// CleanupExpiredSessions removes all expired auth sessions.
-func (s *Store) CleanupExpiredSessions() error {
-	_, err := s.db.Exec(`DELETE FROM auth_sessions WHERE expires_at < ?`, time.Now())
+// DeleteOtherAuthSessions removes every session of a user except keepToken,
+// signing the user out on all other devices.
+func (s *Store) DeleteOtherAuthSessions(userID int64, keepToken string) error {
+	_, err := s.db.Exec(`DELETE FROM auth_sessions WHERE user_id = ? AND id != ?`, userID, keepToken)
 	return err
 }
 
+// DeleteUserAuthSessions removes every session of a user, signing them out
+// everywhere.
+func (s *Store) DeleteUserAuthSessions(userID int64) error {
+	_, err := s.db.Exec(`DELETE FROM auth_sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+// CleanupExpiredSessions removes all expired auth sessions and returns how
+// many it removed.
+func (s *Store) CleanupExpiredSessions() (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM auth_sessions WHERE expires_at < ?`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunSessionCleanup calls CleanupExpiredSessions every interval until ctx
+// is done, logging only the runs that deleted something.
+func (s *Store) RunSessionCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.CleanupExpiredSessions()
+			if err != nil {
+				slog.Error("failed to clean up expired auth sessions", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.Info("cleaned up expired auth sessions", "deleted", n)
+			}
+		}
+	}
+}
+
 func generateToken() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -14,25 +16,33 @@ import (
 
 // Store provides database access to the application.
 type Store struct {
-	db *sql.DB
+	db  *sql.DB
+	fts bool // questions_fts is available for SearchQuestions
+
+	authSessionTTL time.Duration // Lifetime of new login sessions
 }
 
 // New creates a new Store with the given database path.
 func New(dbPath string) (*Store, error) {
-	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_pragma=foreign_keys(1)")
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
-	s := &Store{db: db}
+	s := &Store{db: db, authSessionTTL: DefaultAuthSessionTTL}
 	if err := s.migrate(); err != nil {
 		return nil, fmt.Errorf("migrate: %w", err)
 	}
 	return s, nil
 }
 
+// Ping checks that the database can still be reached.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 // Close closes the database connection.
 func (s *Store) Close() error {
 	return s.db.Close()
@@ -48,7 +58,12 @@ func (s *Store) migrate() error {
 		topic TEXT NOT NULL,
 		rubric TEXT NOT NULL DEFAULT '',
 		model_answer TEXT NOT NULL DEFAULT '',
-		max_points INTEGER NOT NULL DEFAULT 10
+		max_points INTEGER NOT NULL DEFAULT 10,
+		weight REAL NOT NULL DEFAULT 1.0,
+		ad_hoc INTEGER NOT NULL DEFAULT 0,
+		grade_model TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '[]',
+		max_followups INTEGER
 	);
 
 	CREATE TABLE IF NOT EXISTS exam_blueprints (
@@ -59,6 +74,15 @@ func (s *Store) migrate() error {
 		max_followups INTEGER NOT NULL DEFAULT 3
 	);
 
+	CREATE TABLE IF NOT EXISTS blueprint_questions (
+		blueprint_id INTEGER NOT NULL,
+		question_id INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (blueprint_id, question_id),
+		FOREIGN KEY (blueprint_id) REFERENCES exam_blueprints(id),
+		FOREIGN KEY (question_id) REFERENCES questions(id)
+	);
+
 	CREATE TABLE IF NOT EXISTS exam_sessions (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		blueprint_id INTEGER NOT NULL,
@@ -95,6 +119,19 @@ func (s *Store) migrate() error {
 		llm_feedback TEXT NOT NULL DEFAULT '',
 		teacher_score REAL,
 		teacher_comment TEXT NOT NULL DEFAULT '',
+		llm_token_count INTEGER NOT NULL DEFAULT 0,
+		llm_confidence REAL NOT NULL DEFAULT 1.0,
+		FOREIGN KEY (thread_id) REFERENCES question_threads(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS thread_reviews (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		thread_id INTEGER NOT NULL,
+		reviewer_id INTEGER NOT NULL,
+		score REAL NOT NULL,
+		comment TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME NOT NULL,
+		UNIQUE (thread_id, reviewer_id),
 		FOREIGN KEY (thread_id) REFERENCES question_threads(id)
 	);
 
@@ -108,6 +145,19 @@ func (s *Store) migrate() error {
 		FOREIGN KEY (session_id) REFERENCES exam_sessions(id)
 	);
 
+	-- audit_log has no foreign keys: the trail must outlive a deleted
+	-- session or user.
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		user_id    INTEGER NOT NULL,
+		action     TEXT NOT NULL,
+		session_id INTEGER NOT NULL,
+		thread_id  INTEGER,
+		old_value  REAL,
+		new_value  REAL NOT NULL
+	);
+
 	CREATE TABLE IF NOT EXISTS imported_files (
 		path TEXT PRIMARY KEY,
 		hash TEXT NOT NULL,
@@ -119,6 +169,8 @@ func (s *Store) migrate() error {
 		username      TEXT NOT NULL UNIQUE,
 		external_id   TEXT NOT NULL DEFAULT '',
 		display_name  TEXT NOT NULL DEFAULT '',
+		cohort        TEXT NOT NULL DEFAULT '',
+		email         TEXT NOT NULL DEFAULT '',
 		password_hash TEXT NOT NULL,
 		role          TEXT NOT NULL DEFAULT 'student',
 		active        INTEGER NOT NULL DEFAULT 1,
@@ -132,6 +184,13 @@ func (s *Store) migrate() error {
 		expires_at DATETIME NOT NULL
 	);
 
+	CREATE TABLE IF NOT EXISTS exam_previews (
+		user_id      INTEGER PRIMARY KEY REFERENCES users(id),
+		topic        TEXT NOT NULL DEFAULT '',
+		question_ids TEXT NOT NULL,
+		created_at   DATETIME NOT NULL
+	);
+
 	CREATE TABLE IF NOT EXISTS exam_metadata (
 		key   TEXT PRIMARY KEY,
 		value TEXT NOT NULL
@@ -139,6 +198,9 @@ func (s *Store) migrate() error {
 
 	CREATE INDEX IF NOT EXISTS idx_auth_sessions_expires
 		ON auth_sessions(expires_at);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_session
+		ON audit_log(session_id);
 	`
 	_, err := s.db.Exec(schema)
 	if err != nil {
@@ -151,14 +213,110 @@ func (s *Store) migrate() error {
 		return err
 	}
 
+	// Store LLM follow-up questions separately from feedback (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE messages ADD COLUMN followup TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// Per-question grade weight (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE questions ADD COLUMN weight REAL NOT NULL DEFAULT 1.0`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// Questions a teacher added to one live session; they are kept out of
+	// the pool future exams draw from (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE questions ADD COLUMN ad_hoc INTEGER NOT NULL DEFAULT 0`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// Tokens spent on the final grading call (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE question_scores ADD COLUMN llm_token_count INTEGER NOT NULL DEFAULT 0`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// How sure the LLM was of its grade; older scores count as fully
+	// confident (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE question_scores ADD COLUMN llm_confidence REAL NOT NULL DEFAULT 1.0`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// Tag users and their sessions with a cohort (class section) so one
+	// database can serve several sections (no-op if columns already exist).
+	_, err = s.db.Exec(`ALTER TABLE users ADD COLUMN cohort TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+	_, err = s.db.Exec(`ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+	_, err = s.db.Exec(`ALTER TABLE exam_sessions ADD COLUMN cohort TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_exam_sessions_cohort ON exam_sessions(cohort)`)
+	if err != nil {
+		return err
+	}
+
+	// Submission receipt codes (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE exam_sessions ADD COLUMN receipt TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// Per-question model override for evaluation and grading (no-op if
+	// column already exists).
+	_, err = s.db.Exec(`ALTER TABLE questions ADD COLUMN grade_model TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// Tags beyond the topic, as a JSON array (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE questions ADD COLUMN tags TEXT NOT NULL DEFAULT '[]'`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// Per-question follow-up limit; NULL uses the blueprint's (no-op if
+	// column already exists).
+	_, err = s.db.Exec(`ALTER TABLE questions ADD COLUMN max_followups INTEGER`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// When the LLM started evaluating a student answer, so each answer is
+	// evaluated once and stops being editable (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE messages ADD COLUMN evaluation_started_at DATETIME`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+
+	// Reviews carried over from scores set before multi-reviewer support
+	// (no-op if column already exists).
+	_, err = s.db.Exec(`ALTER TABLE thread_reviews ADD COLUMN legacy INTEGER NOT NULL DEFAULT 0`)
+	if err != nil && !isAlterDuplicate(err) {
+		return err
+	}
+	if err := s.migrateLegacyReviews(); err != nil {
+		return err
+	}
+
 	// Ensure non-empty external_id values are unique.
 	_, err = s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id_nonempty ON users(external_id) WHERE external_id != ''`)
 	if err != nil {
 		return err
 	}
 
-	// Remove duplicate questions (keep lowest ID) and remap any threads that
-	// reference deleted duplicates to the canonical (MIN) question ID.
+	// Remove duplicate questions (keep lowest ID) and remap any threads and
+	// blueprint entries that reference deleted duplicates to the canonical
+	// (MIN) question ID. A blueprint that already has the canonical question
+	// keeps that entry and drops the duplicate's.
 	_, err = s.db.Exec(`
 		UPDATE question_threads SET question_id = (
 			SELECT MIN(q2.id) FROM questions q2
@@ -170,6 +328,21 @@ func (s *Store) migrate() error {
 	if err != nil {
 		return err
 	}
+	_, err = s.db.Exec(`
+		UPDATE OR IGNORE blueprint_questions SET question_id = (
+			SELECT MIN(q2.id) FROM questions q2
+			WHERE q2.course_id = (SELECT course_id FROM questions WHERE id = blueprint_questions.question_id)
+			  AND q2.text = (SELECT text FROM questions WHERE id = blueprint_questions.question_id)
+		)
+		WHERE question_id NOT IN (SELECT MIN(id) FROM questions GROUP BY course_id, text)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM blueprint_questions WHERE question_id NOT IN (SELECT MIN(id) FROM questions GROUP BY course_id, text)`)
+	if err != nil {
+		return err
+	}
 	_, err = s.db.Exec(`DELETE FROM questions WHERE id NOT IN (SELECT MIN(id) FROM questions GROUP BY course_id, text)`)
 	if err != nil {
 		return err
@@ -181,7 +354,7 @@ func (s *Store) migrate() error {
 		return err
 	}
 
-	return nil
+	return s.migrateSearch()
 }
 
 // isAlterDuplicate returns true if the error indicates the column already exists.
@@ -194,9 +367,9 @@ func isAlterDuplicate(err error) bool {
 func (s *Store) UpdateQuestionByCourseAndText(q model.Question) error {
 	res, err := s.db.Exec(
 		`UPDATE questions
-		 SET difficulty = ?, topic = ?, rubric = ?, model_answer = ?, max_points = ?
+		 SET difficulty = ?, topic = ?, rubric = ?, model_answer = ?, max_points = ?, weight = ?, grade_model = ?, tags = ?, max_followups = ?
 		 WHERE course_id = ? AND text = ?`,
-		q.Difficulty, q.Topic, q.Rubric, q.ModelAnswer, q.MaxPoints, q.CourseID, q.Text,
+		q.Difficulty, q.Topic, q.Rubric, q.ModelAnswer, q.MaxPoints, q.EffectiveWeight(), q.GradeModel, tagList(q.Tags), q.MaxFollowups, q.CourseID, q.Text,
 	)
 	if err != nil {
 		return err
@@ -212,7 +385,7 @@ func (s *Store) UpdateQuestionByCourseAndText(q model.Question) error {
 }
 
 // DeleteUnusedQuestionsByTexts deletes questions whose text is in oldTexts but not in keepTexts
-// and that are not referenced by any question_thread.
+// and that are not referenced by any question_thread or blueprint.
 func (s *Store) DeleteUnusedQuestionsByTexts(courseID int, oldTexts, keepTexts []string) error {
 	if len(oldTexts) == 0 {
 		return nil
@@ -233,6 +406,9 @@ func (s *Store) DeleteUnusedQuestionsByTexts(courseID int, oldTexts, keepTexts [
 		  ` + notInClause + `
 		  AND NOT EXISTS (
 		      SELECT 1 FROM question_threads WHERE question_threads.question_id = questions.id
+		  )
+		  AND NOT EXISTS (
+		      SELECT 1 FROM blueprint_questions WHERE blueprint_questions.question_id = questions.id
 		  )`
 
 	_, err := s.db.Exec(query, args...)
@@ -250,9 +426,9 @@ func stringsToAny(ss []string) []any {
 // InsertQuestion stores a question. Duplicate questions (same course_id + text) are silently skipped.
 func (s *Store) InsertQuestion(q model.Question) (int64, error) {
 	res, err := s.db.Exec(
-		`INSERT OR IGNORE INTO questions (course_id, text, difficulty, topic, rubric, model_answer, max_points)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		q.CourseID, q.Text, q.Difficulty, q.Topic, q.Rubric, q.ModelAnswer, q.MaxPoints,
+		`INSERT OR IGNORE INTO questions (course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		q.CourseID, q.Text, q.Difficulty, q.Topic, q.Rubric, q.ModelAnswer, q.MaxPoints, q.EffectiveWeight(), q.GradeModel, tagList(q.Tags), q.MaxFollowups,
 	)
 	if err != nil {
 		slog.Error("failed to insert question", "error", err)
@@ -270,9 +446,47 @@ func (s *Store) InsertQuestion(q model.Question) (int64, error) {
 	return id, nil
 }
 
+// InsertQuestions inserts questions in one transaction and returns how many
+// were new. Like InsertQuestion it skips duplicates; unlike it, it logs
+// nothing per question, so large banks import quickly and quietly. Any error
+// rolls back the whole batch.
+func (s *Store) InsertQuestions(questions []model.Question) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(
+		`INSERT OR IGNORE INTO questions (course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	inserted := 0
+	for _, q := range questions {
+		res, err := stmt.Exec(q.CourseID, q.Text, q.Difficulty, q.Topic, q.Rubric, q.ModelAnswer, q.MaxPoints, q.EffectiveWeight(), q.GradeModel, tagList(q.Tags), q.MaxFollowups)
+		if err != nil {
+			return 0, fmt.Errorf("insert question %q: %w", q.Text, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		inserted += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
 // ListQuestions returns all questions.
 func (s *Store) ListQuestions() ([]model.Question, error) {
-	rows, err := s.db.Query(`SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points FROM questions`)
+	rows, err := s.db.Query(`SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups FROM questions`)
 	if err != nil {
 		return nil, err
 	}
@@ -280,7 +494,7 @@ func (s *Store) ListQuestions() ([]model.Question, error) {
 	var questions []model.Question
 	for rows.Next() {
 		var q model.Question
-		if err := rows.Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints); err != nil {
+		if err := rows.Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints, &q.Weight, &q.GradeModel, (*tagList)(&q.Tags), &q.MaxFollowups); err != nil {
 			return nil, err
 		}
 		questions = append(questions, q)
@@ -288,11 +502,37 @@ func (s *Store) ListQuestions() ([]model.Question, error) {
 	return questions, rows.Err()
 }
 
-// ListQuestionsFiltered returns questions matching the given filters.
-// Empty strings mean no filtering on that field.
-// Difficulty supports comma-separated values (e.g. "easy,medium").
-func (s *Store) ListQuestionsFiltered(difficulty string, topic string) ([]model.Question, error) {
-	query := `SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points FROM questions WHERE 1=1`
+// UnusedQuestions returns questions that no exam session has drawn, i.e.
+// with no question_threads row, ordered by ID.
+func (s *Store) UnusedQuestions() ([]model.Question, error) {
+	rows, err := s.db.Query(`SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups
+		FROM questions
+		WHERE NOT EXISTS (
+		    SELECT 1 FROM question_threads WHERE question_threads.question_id = questions.id
+		)
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var questions []model.Question
+	for rows.Next() {
+		var q model.Question
+		if err := rows.Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints, &q.Weight, &q.GradeModel, (*tagList)(&q.Tags), &q.MaxFollowups); err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// ListQuestionsFiltered returns the questions exams can draw from that match
+// the given filters; questions added to a single session by
+// AddAdHocQuestion are left out. Empty strings mean no filtering on that
+// field. Difficulty supports comma-separated values (e.g. "easy,medium");
+// tag matches one of a question's tags, ignoring case.
+func (s *Store) ListQuestionsFiltered(difficulty, topic, tag string) ([]model.Question, error) {
+	query := `SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups FROM questions WHERE ad_hoc = 0`
 	var args []any
 	if difficulty != "" {
 		var levels []string
@@ -312,6 +552,10 @@ func (s *Store) ListQuestionsFiltered(difficulty string, topic string) ([]model.
 		query += ` AND topic = ?`
 		args = append(args, topic)
 	}
+	if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+		query += ` AND EXISTS (SELECT 1 FROM json_each(questions.tags) WHERE value = ?)`
+		args = append(args, tag)
+	}
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -320,7 +564,7 @@ func (s *Store) ListQuestionsFiltered(difficulty string, topic string) ([]model.
 	var questions []model.Question
 	for rows.Next() {
 		var q model.Question
-		if err := rows.Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints); err != nil {
+		if err := rows.Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints, &q.Weight, &q.GradeModel, (*tagList)(&q.Tags), &q.MaxFollowups); err != nil {
 			return nil, err
 		}
 		questions = append(questions, q)
@@ -328,15 +572,52 @@ func (s *Store) ListQuestionsFiltered(difficulty string, topic string) ([]model.
 	return questions, rows.Err()
 }
 
+// ListQuestionsByTag returns the questions exams can draw from that are
+// tagged with tag.
+func (s *Store) ListQuestionsByTag(tag string) ([]model.Question, error) {
+	return s.ListQuestionsFiltered("", "", tag)
+}
+
 // GetQuestion returns a question by ID.
 func (s *Store) GetQuestion(id int64) (model.Question, error) {
 	var q model.Question
 	err := s.db.QueryRow(
-		`SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points FROM questions WHERE id = ?`, id,
-	).Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints)
+		`SELECT id, course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups FROM questions WHERE id = ?`, id,
+	).Scan(&q.ID, &q.CourseID, &q.Text, &q.Difficulty, &q.Topic, &q.Rubric, &q.ModelAnswer, &q.MaxPoints, &q.Weight, &q.GradeModel, (*tagList)(&q.Tags), &q.MaxFollowups)
 	return q, err
 }
 
+// UpdateQuestion rewrites the question row with q's ID. Threads, messages and
+// scores that reference it are left as they are. It returns sql.ErrNoRows if
+// no such question exists.
+func (s *Store) UpdateQuestion(q model.Question) error {
+	res, err := s.db.Exec(
+		`UPDATE questions
+		 SET text = ?, difficulty = ?, topic = ?, rubric = ?, model_answer = ?, max_points = ?, weight = ?, grade_model = ?, tags = ?, max_followups = ?
+		 WHERE id = ?`,
+		q.Text, q.Difficulty, q.Topic, q.Rubric, q.ModelAnswer, q.MaxPoints, q.EffectiveWeight(), q.GradeModel, tagList(q.Tags), q.MaxFollowups, q.ID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	slog.Info("updated question", "id", q.ID, "topic", q.Topic)
+	return nil
+}
+
+// QuestionThreadCount returns how many exam threads reference a question.
+func (s *Store) QuestionThreadCount(questionID int64) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM question_threads WHERE question_id = ?`, questionID).Scan(&n)
+	return n, err
+}
+
 // CreateBlueprint creates an exam blueprint.
 func (s *Store) CreateBlueprint(bp model.ExamBlueprint) (int64, error) {
 	res, err := s.db.Exec(
@@ -391,9 +672,12 @@ func (s *Store) CreateSession(blueprintID int64, studentID int64, questionIDs []
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	// The session keeps the student's cohort at start time, so moving the
+	// student to another section later does not rewrite past results.
 	res, err := tx.Exec(
-		`INSERT INTO exam_sessions (blueprint_id, student_id, status, started_at) VALUES (?, ?, 'in_progress', ?)`,
-		blueprintID, studentID, time.Now(),
+		`INSERT INTO exam_sessions (blueprint_id, student_id, status, started_at, cohort)
+		 VALUES (?, ?, 'in_progress', ?, COALESCE((SELECT cohort FROM users WHERE id = ?), ''))`,
+		blueprintID, studentID, time.Now(), studentID,
 	)
 	if err != nil {
 		return 0, err
@@ -420,12 +704,226 @@ func (s *Store) CreateSession(blueprintID int64, studentID int64, questionIDs []
 	return sessionID, nil
 }
 
+// AddThreadToSession appends an open thread for the bank question
+// questionID to the session and returns the thread ID. It returns
+// sql.ErrNoRows if the question does not exist.
+func (s *Store) AddThreadToSession(sessionID, questionID int64) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT 1 FROM questions WHERE id = ?`, questionID).Scan(&exists); err != nil {
+		return 0, err
+	}
+	threadID, err := addThread(tx, sessionID, questionID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	slog.Info("added question to session", "session_id", sessionID, "question_id", questionID, "thread_id", threadID)
+	return threadID, nil
+}
+
+// addThread appends an open thread for a question to a session.
+func addThread(tx *sql.Tx, sessionID, questionID int64) (int64, error) {
+	res, err := tx.Exec(
+		`INSERT INTO question_threads (session_id, question_id, status) VALUES (?, ?, 'open')`,
+		sessionID, questionID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ErrQuestionExists is returned by AddAdHocQuestion when the course already
+// has a question with the same text.
+var ErrQuestionExists = errors.New("the course already has a question with this text")
+
+// AddAdHocQuestion stores q as a question of the session's course and
+// appends an open thread for it to the session, returning the thread ID.
+// The question is marked ad hoc so later exams do not draw it. If the bank
+// already has a question with the same text it returns ErrQuestionExists,
+// so a bank question is never added under the teacher's new rubric.
+func (s *Store) AddAdHocQuestion(sessionID int64, q model.Question) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = tx.QueryRow(
+		`SELECT b.course_id FROM exam_sessions s
+		 JOIN exam_blueprints b ON b.id = s.blueprint_id
+		 WHERE s.id = ?`, sessionID,
+	).Scan(&q.CourseID)
+	if err != nil {
+		return 0, err
+	}
+	var existing int64
+	err = tx.QueryRow(`SELECT id FROM questions WHERE course_id = ? AND text = ?`, q.CourseID, q.Text).Scan(&existing)
+	if err == nil {
+		return 0, ErrQuestionExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	res, err := tx.Exec(
+		`INSERT INTO questions (course_id, text, difficulty, topic, rubric, model_answer, max_points, weight, grade_model, tags, max_followups, ad_hoc)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`,
+		q.CourseID, q.Text, q.Difficulty, q.Topic, q.Rubric, q.ModelAnswer, q.MaxPoints, q.EffectiveWeight(), q.GradeModel, tagList(q.Tags), q.MaxFollowups,
+	)
+	if err != nil {
+		return 0, err
+	}
+	questionID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	threadID, err := addThread(tx, sessionID, questionID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return threadID, nil
+}
+
+// CloneSessionQuestions creates a new in-progress session for the same student
+// and blueprint as srcSessionID, with the same questions in the same order.
+// It is used to re-deliver an identical exam (e.g. a make-up attempt).
+func (s *Store) CloneSessionQuestions(srcSessionID int64) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var blueprintID, studentID int64
+	var cohort string
+	if err := tx.QueryRow(
+		`SELECT blueprint_id, student_id, cohort FROM exam_sessions WHERE id = ?`, srcSessionID,
+	).Scan(&blueprintID, &studentID, &cohort); err != nil {
+		return 0, fmt.Errorf("get source session %d: %w", srcSessionID, err)
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO exam_sessions (blueprint_id, student_id, status, started_at, cohort) VALUES (?, ?, 'in_progress', ?, ?)`,
+		blueprintID, studentID, time.Now(), cohort,
+	)
+	if err != nil {
+		return 0, err
+	}
+	sessionID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Thread IDs define question order, so copy them in source order.
+	res, err = tx.Exec(
+		`INSERT INTO question_threads (session_id, question_id, status)
+		 SELECT ?, question_id, 'open' FROM question_threads WHERE session_id = ? ORDER BY id`,
+		sessionID, srcSessionID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("source session %d has no questions", srcSessionID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	slog.Info("cloned session", "source", srcSessionID, "id", sessionID, "questions", n)
+	return sessionID, nil
+}
+
+// DeleteSessionsByStatus deletes every session with the given status along
+// with its threads, messages, scores and grade, in one transaction. It returns
+// the number of sessions removed.
+func (s *Store) DeleteSessionsByStatus(status model.SessionStatus) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	n, err := deleteSessions(tx, `SELECT id FROM exam_sessions WHERE status = ?`, status)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	slog.Info("deleted sessions", "status", status, "count", n)
+	return n, nil
+}
+
+// DeleteSession deletes one session with its threads, messages, scores and
+// grade, in one transaction. It returns sql.ErrNoRows if the session does
+// not exist.
+func (s *Store) DeleteSession(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	n, err := deleteSessions(tx, `SELECT ?`, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("deleted session", "id", id)
+	return nil
+}
+
+// deleteSessions deletes the sessions whose IDs the sessions query selects,
+// children first so no rows are left pointing at a deleted parent. arg is
+// the query's single parameter. It returns the number of sessions removed.
+func deleteSessions(tx *sql.Tx, sessions string, arg any) (int64, error) {
+	threads := `SELECT id FROM question_threads WHERE session_id IN (` + sessions + `)`
+	for _, q := range []string{
+		`DELETE FROM question_scores WHERE thread_id IN (` + threads + `)`,
+		`DELETE FROM thread_reviews WHERE thread_id IN (` + threads + `)`,
+		`DELETE FROM messages WHERE thread_id IN (` + threads + `)`,
+		`DELETE FROM question_threads WHERE session_id IN (` + sessions + `)`,
+		`DELETE FROM grades WHERE session_id IN (` + sessions + `)`,
+	} {
+		if _, err := tx.Exec(q, arg); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM exam_sessions WHERE id IN (`+sessions+`)`, arg)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 // GetSession returns a session by ID.
 func (s *Store) GetSession(id int64) (model.ExamSession, error) {
 	var sess model.ExamSession
 	err := s.db.QueryRow(
-		`SELECT id, blueprint_id, student_id, status, started_at, submitted_at FROM exam_sessions WHERE id = ?`, id,
-	).Scan(&sess.ID, &sess.BlueprintID, &sess.StudentID, &sess.Status, &sess.StartedAt, &sess.SubmittedAt)
+		`SELECT id, blueprint_id, student_id, status, started_at, submitted_at, cohort, receipt FROM exam_sessions WHERE id = ?`, id,
+	).Scan(&sess.ID, &sess.BlueprintID, &sess.StudentID, &sess.Status, &sess.StartedAt, &sess.SubmittedAt, &sess.Cohort, &sess.Receipt)
 	return sess, err
 }
 
@@ -447,6 +945,82 @@ func (s *Store) UpdateSessionStatus(id int64, status model.SessionStatus) error
 	return nil
 }
 
+// SubmitSession marks an in-progress session as submitted. It reports false
+// if the session was no longer in progress, e.g. because the page timer, a
+// manual submit or the overdue sweep got there first; only the caller that
+// submitted it should grade it.
+func (s *Store) SubmitSession(id int64) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE exam_sessions SET status = 'submitted', submitted_at = ? WHERE id = ? AND status = 'in_progress'`,
+		time.Now(), id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 1 {
+		slog.Info("updated session status", "id", id, "status", model.StatusSubmitted)
+	}
+	return n == 1, nil
+}
+
+// ExpireOverdueSessions marks in-progress sessions whose time is up as
+// submitted and returns their IDs so the caller can grade them. A session is
+// overdue once the stricter of its blueprint time limit and ceiling has
+// passed; sessions without either limit never expire.
+func (s *Store) ExpireOverdueSessions(ceiling time.Duration) ([]int64, error) {
+	rows, err := s.db.Query(`
+		SELECT s.id, s.started_at, b.time_limit
+		FROM exam_sessions s
+		JOIN exam_blueprints b ON b.id = s.blueprint_id
+		WHERE s.status = 'in_progress'`)
+	if err != nil {
+		return nil, err
+	}
+	var overdue []int64
+	now := time.Now()
+	for rows.Next() {
+		var id int64
+		var startedAt time.Time
+		var bp model.ExamBlueprint
+		if err := rows.Scan(&id, &startedAt, &bp.TimeLimit); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		limit := model.EffectiveTimeLimit(bp, ceiling)
+		if limit > 0 && now.Sub(startedAt) >= limit {
+			overdue = append(overdue, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []int64
+	for _, id := range overdue {
+		// The status guard skips sessions the student submitted meanwhile.
+		res, err := s.db.Exec(
+			`UPDATE exam_sessions SET status = 'submitted', submitted_at = ? WHERE id = ? AND status = 'in_progress'`,
+			now, id,
+		)
+		if err != nil {
+			return expired, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			expired = append(expired, id)
+		}
+	}
+	if len(expired) > 0 {
+		slog.Info("expired overdue sessions", "count", len(expired))
+	}
+	return expired, nil
+}
+
 // GetThreadsForSession returns all threads for a session.
 func (s *Store) GetThreadsForSession(sessionID int64) ([]model.QuestionThread, error) {
 	rows, err := s.db.Query(
@@ -482,11 +1056,55 @@ func (s *Store) UpdateThreadStatus(id int64, status model.ThreadStatus) error {
 	return err
 }
 
+// UpdateMessageContent replaces the content of a message, keeping its
+// creation time. It returns sql.ErrNoRows if the message does not exist or
+// its evaluation has already been claimed.
+func (s *Store) UpdateMessageContent(id int64, content string) error {
+	res, err := s.db.Exec(`UPDATE messages SET content = ? WHERE id = ? AND evaluation_started_at IS NULL`, content, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ClaimEvaluation marks a student answer as being evaluated. It reports
+// false if another request holds the claim; a claim older than staleBefore
+// (left by a crashed request) is taken over.
+func (s *Store) ClaimEvaluation(messageID int64, staleBefore time.Time) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE messages SET evaluation_started_at = ?
+		 WHERE id = ? AND (evaluation_started_at IS NULL OR evaluation_started_at < ?)`,
+		time.Now(), messageID, staleBefore,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseEvaluation drops the claim on an answer whose evaluation failed, so
+// the student's retry can evaluate it.
+func (s *Store) ReleaseEvaluation(messageID int64) error {
+	_, err := s.db.Exec(`UPDATE messages SET evaluation_started_at = NULL WHERE id = ?`, messageID)
+	return err
+}
+
 // AddMessage inserts a message into a thread.
 func (s *Store) AddMessage(msg model.Message) (int64, error) {
 	res, err := s.db.Exec(
-		`INSERT INTO messages (thread_id, role, content, created_at, token_count) VALUES (?, ?, ?, ?, ?)`,
-		msg.ThreadID, msg.Role, msg.Content, time.Now(), msg.TokenCount,
+		`INSERT INTO messages (thread_id, role, content, followup, created_at, token_count) VALUES (?, ?, ?, ?, ?, ?)`,
+		msg.ThreadID, msg.Role, msg.Content, msg.Followup, time.Now(), msg.TokenCount,
 	)
 	if err != nil {
 		slog.Error("failed to add message", "thread_id", msg.ThreadID, "role", msg.Role, "error", err)
@@ -500,10 +1118,60 @@ func (s *Store) AddMessage(msg model.Message) (int64, error) {
 	return id, nil
 }
 
+// Errors returned by AddClarification when the thread takes no more
+// clarification requests.
+var (
+	ErrClarificationsUsedUp = errors.New("the thread has no clarifications left")
+	ErrThreadAnswered       = errors.New("the thread already has an answer")
+)
+
+// AddClarification stores a student's clarification request and the LLM's
+// reply on a thread. The checks and both inserts run in one transaction, so
+// concurrent requests cannot exceed limit or slip in after an answer.
+func (s *Store) AddClarification(threadID int64, request, reply string, tokenCount, limit int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Insert first: the write takes the database lock, so the counts
+	// below cannot change before the commit.
+	now := time.Now()
+	if _, err := tx.Exec(
+		`INSERT INTO messages (thread_id, role, content, created_at) VALUES (?, ?, ?, ?)`,
+		threadID, model.RoleClarifyRequest, request, now,
+	); err != nil {
+		return err
+	}
+	var requests, answers int
+	err = tx.QueryRow(
+		`SELECT COUNT(*) FILTER (WHERE role = ?), COUNT(*) FILTER (WHERE role NOT IN (?, ?))
+		 FROM messages WHERE thread_id = ?`,
+		model.RoleClarifyRequest, model.RoleClarifyRequest, model.RoleClarification, threadID,
+	).Scan(&requests, &answers)
+	if err != nil {
+		return err
+	}
+	if answers > 0 {
+		return ErrThreadAnswered
+	}
+	if requests > limit {
+		return ErrClarificationsUsedUp
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO messages (thread_id, role, content, created_at, token_count) VALUES (?, ?, ?, ?, ?)`,
+		threadID, model.RoleClarification, reply, now, tokenCount,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // GetMessages returns all messages for a thread.
 func (s *Store) GetMessages(threadID int64) ([]model.Message, error) {
 	rows, err := s.db.Query(
-		`SELECT id, thread_id, role, content, created_at, token_count FROM messages WHERE thread_id = ? ORDER BY id`, threadID,
+		`SELECT id, thread_id, role, content, followup, created_at, token_count FROM messages WHERE thread_id = ? ORDER BY id`, threadID,
 	)
 	if err != nil {
 		return nil, err
@@ -512,7 +1180,7 @@ func (s *Store) GetMessages(threadID int64) ([]model.Message, error) {
 	var messages []model.Message
 	for rows.Next() {
 		var m model.Message
-		if err := rows.Scan(&m.ID, &m.ThreadID, &m.Role, &m.Content, &m.CreatedAt, &m.TokenCount); err != nil {
+		if err := rows.Scan(&m.ID, &m.ThreadID, &m.Role, &m.Content, &m.Followup, &m.CreatedAt, &m.TokenCount); err != nil {
 			return nil, err
 		}
 		messages = append(messages, m)
@@ -532,10 +1200,11 @@ func (s *Store) CountStudentMessages(threadID int64) (int, error) {
 // UpsertScore inserts or updates a score for a thread.
 func (s *Store) UpsertScore(score model.QuestionScore) error {
 	_, err := s.db.Exec(
-		`INSERT INTO question_scores (thread_id, llm_score, llm_feedback)
-		 VALUES (?, ?, ?)
-		 ON CONFLICT(thread_id) DO UPDATE SET llm_score = ?, llm_feedback = ?`,
-		score.ThreadID, score.LLMScore, score.LLMFeedback, score.LLMScore, score.LLMFeedback,
+		`INSERT INTO question_scores (thread_id, llm_score, llm_feedback, llm_token_count, llm_confidence)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(thread_id) DO UPDATE SET llm_score = ?, llm_feedback = ?, llm_token_count = ?, llm_confidence = ?`,
+		score.ThreadID, score.LLMScore, score.LLMFeedback, score.LLMTokenCount, score.LLMConfidence,
+		score.LLMScore, score.LLMFeedback, score.LLMTokenCount, score.LLMConfidence,
 	)
 	if err != nil {
 		slog.Error("failed to upsert score", "thread_id", score.ThreadID, "error", err)
@@ -549,16 +1218,52 @@ func (s *Store) UpsertScore(score model.QuestionScore) error {
 func (s *Store) GetScore(threadID int64) (*model.QuestionScore, error) {
 	var sc model.QuestionScore
 	err := s.db.QueryRow(
-		`SELECT id, thread_id, llm_score, llm_feedback, teacher_score, teacher_comment
+		`SELECT id, thread_id, llm_score, llm_feedback, teacher_score, teacher_comment, llm_token_count, llm_confidence
 		 FROM question_scores WHERE thread_id = ?`, threadID,
-	).Scan(&sc.ID, &sc.ThreadID, &sc.LLMScore, &sc.LLMFeedback, &sc.TeacherScore, &sc.TeacherComment)
+	).Scan(&sc.ID, &sc.ThreadID, &sc.LLMScore, &sc.LLMFeedback, &sc.TeacherScore, &sc.TeacherComment, &sc.LLMTokenCount, &sc.LLMConfidence)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return &sc, err
 }
 
-// UpdateTeacherScore updates the teacher's score and comment.
+// LowConfidenceCounts returns, for each of sessionIDs, how many of its
+// answers the LLM graded with a confidence below threshold and no teacher
+// has scored yet. Sessions without such answers are left out.
+func (s *Store) LowConfidenceCounts(threshold float64, sessionIDs []int64) (map[int64]int, error) {
+	counts := make(map[int64]int)
+	if len(sessionIDs) == 0 {
+		return counts, nil
+	}
+	args := []any{threshold}
+	for _, id := range sessionIDs {
+		args = append(args, id)
+	}
+	rows, err := s.db.Query(
+		`SELECT t.session_id, COUNT(*) FROM question_scores sc
+		 JOIN question_threads t ON t.id = sc.thread_id
+		 WHERE sc.llm_confidence < ? AND sc.teacher_score IS NULL
+		   AND t.session_id IN (`+placeholders(len(sessionIDs))+`)
+		 GROUP BY t.session_id`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sessionID int64
+		var n int
+		if err := rows.Scan(&sessionID, &n); err != nil {
+			return nil, err
+		}
+		counts[sessionID] = n
+	}
+	return counts, rows.Err()
+}
+
+// UpdateTeacherScore sets the teacher's score and comment directly, without
+// recording a review. Reviewers should use UpsertThreadReview.
 func (s *Store) UpdateTeacherScore(threadID int64, score float64, comment string) error {
 	_, err := s.db.Exec(
 		`UPDATE question_scores SET teacher_score = ?, teacher_comment = ? WHERE thread_id = ?`,
@@ -596,10 +1301,34 @@ func (s *Store) GetGrade(sessionID int64) (*model.Grade, error) {
 	return &g, err
 }
 
-// FinalizeGrade sets the final grade after teacher review.
+// FinalizeGrade sets the final grade after teacher review. Each reviewed
+// thread's teacher score is first recomputed from its reviews.
 func (s *Store) FinalizeGrade(sessionID int64, finalGrade float64, reviewerID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := aggregateReviews(tx, `SELECT id FROM question_threads WHERE session_id = ?`, sessionID); err != nil {
+		slog.Error("failed to aggregate reviews", "session_id", sessionID, "error", err)
+		return err
+	}
 	now := time.Now()
-	_, err := s.db.Exec(
+	// Before the first finalization the grade being replaced is the LLM's.
+	var old sql.NullFloat64
+	err = tx.QueryRow(`SELECT COALESCE(final_grade, llm_grade) FROM grades WHERE session_id = ?`, sessionID).Scan(&old)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	err = insertAudit(tx, model.AuditEntry{
+		CreatedAt: now, UserID: reviewerID, Action: model.AuditGradeFinalized,
+		SessionID: sessionID, OldValue: nullFloat(old), NewValue: finalGrade,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
 		`UPDATE grades SET final_grade = ?, reviewed_by = ?, reviewed_at = ? WHERE session_id = ?`,
 		finalGrade, reviewerID, now, sessionID,
 	)
@@ -607,6 +1336,9 @@ func (s *Store) FinalizeGrade(sessionID int64, finalGrade float64, reviewerID in
 		slog.Error("failed to finalize grade", "session_id", sessionID, "error", err)
 		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 	slog.Info("finalized grade", "session_id", sessionID, "final_grade", finalGrade)
 	return nil
 }
@@ -663,16 +1395,72 @@ func (s *Store) GetSessionView(sessionID int64) (*model.SessionView, error) {
 
 // ListSessions returns all sessions (newest first, for UI display).
 func (s *Store) ListSessions() ([]model.ExamSession, error) {
-	return s.listSessionsWithOrder("ORDER BY id DESC")
+	return s.listSessions("ORDER BY id DESC")
 }
 
 // ListSessionsChronological returns all sessions oldest-first (for export).
 func (s *Store) ListSessionsChronological() ([]model.ExamSession, error) {
-	return s.listSessionsWithOrder("ORDER BY id ASC")
+	return s.listSessions("ORDER BY id ASC")
 }
 
-func (s *Store) listSessionsWithOrder(orderClause string) ([]model.ExamSession, error) {
-	rows, err := s.db.Query(`SELECT id, blueprint_id, student_id, status, started_at, submitted_at FROM exam_sessions ` + orderClause)
+// ListSessionsByCohort returns the sessions of one cohort, newest first.
+func (s *Store) ListSessionsByCohort(cohort string) ([]model.ExamSession, error) {
+	return s.listSessions("WHERE cohort = ? ORDER BY id DESC", cohort)
+}
+
+// ListSessionsByUser returns sessions for a specific student.
+func (s *Store) ListSessionsByUser(userID int64) ([]model.ExamSession, error) {
+	return s.listSessions("WHERE student_id = ? ORDER BY id DESC", userID)
+}
+
+// ListSessionsByStatus returns the sessions with the given status, oldest
+// first.
+func (s *Store) ListSessionsByStatus(status model.SessionStatus) ([]model.ExamSession, error) {
+	return s.listSessions("WHERE status = ? ORDER BY id ASC", status)
+}
+
+// ListSessionsPaged returns at most limit sessions matching f, newest first,
+// skipping the first offset.
+func (s *Store) ListSessionsPaged(f model.SessionFilter, limit, offset int) ([]model.ExamSession, error) {
+	where, args := sessionFilterClause(f)
+	return s.listSessions(where+" ORDER BY id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+}
+
+// CountSessions returns the number of sessions matching f.
+func (s *Store) CountSessions(f model.SessionFilter) (int, error) {
+	where, args := sessionFilterClause(f)
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM exam_sessions `+where, args...).Scan(&n)
+	return n, err
+}
+
+// sessionFilterClause builds the WHERE clause shared by ListSessionsPaged
+// and CountSessions, so a page and its total always agree.
+func sessionFilterClause(f model.SessionFilter) (string, []any) {
+	var conds []string
+	var args []any
+	if f.StudentID != 0 {
+		conds = append(conds, "student_id = ?")
+		args = append(args, f.StudentID)
+	}
+	if f.Cohort != "" {
+		conds = append(conds, "cohort = ?")
+		args = append(args, f.Cohort)
+	}
+	if len(f.Statuses) > 0 {
+		conds = append(conds, "status IN ("+placeholders(len(f.Statuses))+")")
+		for _, st := range f.Statuses {
+			args = append(args, st)
+		}
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (s *Store) listSessions(clause string, args ...any) ([]model.ExamSession, error) {
+	rows, err := s.db.Query(`SELECT id, blueprint_id, student_id, status, started_at, submitted_at, cohort, receipt FROM exam_sessions `+clause, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -680,7 +1468,7 @@ func (s *Store) listSessionsWithOrder(orderClause string) ([]model.ExamSession,
 	var sessions []model.ExamSession
 	for rows.Next() {
 		var sess model.ExamSession
-		if err := rows.Scan(&sess.ID, &sess.BlueprintID, &sess.StudentID, &sess.Status, &sess.StartedAt, &sess.SubmittedAt); err != nil {
+		if err := rows.Scan(&sess.ID, &sess.BlueprintID, &sess.StudentID, &sess.Status, &sess.StartedAt, &sess.SubmittedAt, &sess.Cohort, &sess.Receipt); err != nil {
 			return nil, err
 		}
 		sessions = append(sessions, sess)
@@ -688,25 +1476,59 @@ func (s *Store) listSessionsWithOrder(orderClause string) ([]model.ExamSession,
 	return sessions, rows.Err()
 }
 
-// ListSessionsByUser returns sessions for a specific student.
-func (s *Store) ListSessionsByUser(userID int64) ([]model.ExamSession, error) {
-	rows, err := s.db.Query(
-		`SELECT id, blueprint_id, student_id, status, started_at, submitted_at
-		 FROM exam_sessions WHERE student_id = ? ORDER BY id DESC`, userID,
+// SessionsMissingGrades returns the sessions past the in_progress status
+// that have no grades row, or that have a thread scored with a grading error
+// and no teacher score, oldest first. Use it to make sure every finished
+// exam ends up with a usable grade.
+func (s *Store) SessionsMissingGrades() ([]model.UngradedSession, error) {
+	rows, err := s.db.Query(`
+		SELECT s.id, s.blueprint_id, s.student_id, s.status, s.started_at, s.submitted_at, s.cohort,
+			g.id IS NULL AS missing, COUNT(sc.id) AS errors
+		FROM exam_sessions s
+		LEFT JOIN grades g ON g.session_id = s.id
+		LEFT JOIN question_threads t ON t.session_id = s.id
+		LEFT JOIN question_scores sc ON sc.thread_id = t.id
+			AND sc.teacher_score IS NULL AND substr(sc.llm_feedback, 1, ?) = ?
+		WHERE s.status != ?
+		GROUP BY s.id
+		HAVING missing OR errors > 0
+		ORDER BY s.id`,
+		len(model.GradingErrorPrefix), model.GradingErrorPrefix, model.StatusInProgress,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var sessions []model.ExamSession
+
+	var result []model.UngradedSession
 	for rows.Next() {
-		var sess model.ExamSession
-		if err := rows.Scan(&sess.ID, &sess.BlueprintID, &sess.StudentID, &sess.Status, &sess.StartedAt, &sess.SubmittedAt); err != nil {
+		var u model.UngradedSession
+		sess := &u.Session
+		if err := rows.Scan(&sess.ID, &sess.BlueprintID, &sess.StudentID, &sess.Status, &sess.StartedAt, &sess.SubmittedAt, &sess.Cohort,
+			&u.MissingGrade, &u.ErrorScores); err != nil {
 			return nil, err
 		}
-		sessions = append(sessions, sess)
+		result = append(result, u)
 	}
-	return sessions, rows.Err()
+	return result, rows.Err()
+}
+
+// ListCohorts returns the distinct non-empty cohorts that have sessions.
+func (s *Store) ListCohorts() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT cohort FROM exam_sessions WHERE cohort != '' ORDER BY cohort`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cohorts []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		cohorts = append(cohorts, c)
+	}
+	return cohorts, rows.Err()
 }
 
 // QuestionCount returns the number of questions in the database.
@@ -773,13 +1595,13 @@ func (s *Store) GetSessionWithBlueprint(sessionID int64) (model.ExamSession, mod
 	var sess model.ExamSession
 	var bp model.ExamBlueprint
 	err := s.db.QueryRow(`
-		SELECT s.id, s.blueprint_id, s.student_id, s.status, s.started_at, s.submitted_at,
+		SELECT s.id, s.blueprint_id, s.student_id, s.status, s.started_at, s.submitted_at, s.cohort, s.receipt,
 		       b.id, b.course_id, b.name, b.time_limit, b.max_followups
 		FROM exam_sessions s
 		JOIN exam_blueprints b ON b.id = s.blueprint_id
 		WHERE s.id = ?`, sessionID,
 	).Scan(
-		&sess.ID, &sess.BlueprintID, &sess.StudentID, &sess.Status, &sess.StartedAt, &sess.SubmittedAt,
+		&sess.ID, &sess.BlueprintID, &sess.StudentID, &sess.Status, &sess.StartedAt, &sess.SubmittedAt, &sess.Cohort, &sess.Receipt,
 		&bp.ID, &bp.CourseID, &bp.Name, &bp.TimeLimit, &bp.MaxFollowups,
 	)
 	return sess, bp, err
@@ -1,9 +1,16 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/pavelanni/examiner/internal/model"
 )
@@ -96,6 +103,85 @@ func TestQuestionCRUD(t *testing.T) {
 	}
 }
 
+func TestQuestionGradeModel(t *testing.T) {
+	s := newTestStore(t)
+	id, err := s.InsertQuestion(model.Question{CourseID: 1, Text: "Write a loop", Difficulty: model.DifficultyHard, Topic: "code", MaxPoints: 10, GradeModel: "coder"})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	q, err := s.GetQuestion(id)
+	if err != nil || q.GradeModel != "coder" {
+		t.Fatalf("GetQuestion = %+v (err %v), want grade model coder", q, err)
+	}
+	if list, _ := s.ListQuestionsFiltered("hard", "", ""); len(list) != 1 || list[0].GradeModel != "coder" {
+		t.Errorf("ListQuestionsFiltered should carry the grade model, got %+v", list)
+	}
+
+	q.GradeModel = ""
+	if err := s.UpdateQuestion(q); err != nil {
+		t.Fatalf("UpdateQuestion: %v", err)
+	}
+	if q, _ = s.GetQuestion(id); q.GradeModel != "" {
+		t.Errorf("clearing the grade model should stick, got %q", q.GradeModel)
+	}
+}
+
+func largeQuestionBank(n int) []model.Question {
+	questions := make([]model.Question, n)
+	for i := range questions {
+		questions[i] = model.Question{CourseID: 1, Text: fmt.Sprintf("Question %d", i), Difficulty: "easy", Topic: "bank", MaxPoints: 10}
+	}
+	return questions
+}
+
+func TestInsertQuestions(t *testing.T) {
+	s := newTestStore(t)
+	bank := largeQuestionBank(5000)
+	n, err := s.InsertQuestions(bank)
+	if err != nil || n != len(bank) {
+		t.Fatalf("InsertQuestions = %d, %v; want %d", n, err, len(bank))
+	}
+	// Duplicates are skipped, not counted.
+	if n, err = s.InsertQuestions(bank[:10]); err != nil || n != 0 {
+		t.Errorf("reinserting = %d, %v; want 0", n, err)
+	}
+	if count, _ := s.QuestionCount(); count != len(bank) {
+		t.Errorf("QuestionCount = %d, want %d", count, len(bank))
+	}
+
+	// A failure late in the batch rolls back the rows before it.
+	if _, err := s.db.Exec(`CREATE TRIGGER reject_bad BEFORE INSERT ON questions WHEN NEW.text = 'bad'
+		BEGIN SELECT RAISE(ABORT, 'bad question'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	more := largeQuestionBank(6000)[5000:]
+	more[len(more)-1].Text = "bad"
+	if _, err := s.InsertQuestions(more); err == nil {
+		t.Fatal("expected the bad question to fail the batch")
+	}
+	if count, _ := s.QuestionCount(); count != len(bank) {
+		t.Errorf("after a failed batch QuestionCount = %d, want %d", count, len(bank))
+	}
+}
+
+func BenchmarkInsertQuestions(b *testing.B) {
+	bank := largeQuestionBank(10000)
+	for b.Loop() {
+		b.StopTimer()
+		s, err := New(":memory:")
+		if err != nil {
+			b.Fatalf("New: %v", err)
+		}
+		b.StartTimer()
+		if _, err := s.InsertQuestions(bank); err != nil {
+			b.Fatalf("InsertQuestions: %v", err)
+		}
+		b.StopTimer()
+		s.Close()
+		b.StartTimer()
+	}
+}
+
 func TestListQuestionsFiltered(t *testing.T) {
 	s := newTestStore(t)
 	insertTestQuestion(t, s, "Q1", "easy", "basics")
@@ -118,7 +204,7 @@ func TestListQuestionsFiltered(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			qs, err := s.ListQuestionsFiltered(tt.difficulty, tt.topic)
+			qs, err := s.ListQuestionsFiltered(tt.difficulty, tt.topic, "")
 			if err != nil {
 				t.Fatalf("ListQuestionsFiltered: %v", err)
 			}
@@ -129,6 +215,61 @@ func TestListQuestionsFiltered(t *testing.T) {
 	}
 }
 
+func TestQuestionTags(t *testing.T) {
+	s := newTestStore(t)
+	n, err := s.InsertQuestions([]model.Question{
+		{CourseID: 1, Text: "Explain TLS", Difficulty: "medium", Topic: "net", MaxPoints: 10, Tags: []string{"networking", "security"}},
+		{CourseID: 1, Text: "Explain hashing", Difficulty: "easy", Topic: "crypto", MaxPoints: 10, Tags: []string{"security"}},
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("InsertQuestions = %d, %v", n, err)
+	}
+	plain := insertTestQuestion(t, s, "Explain routing", "easy", "net")
+
+	for tag, want := range map[string]int{"security": 2, " Networking ": 1, "intermediate": 0, "": 3} {
+		qs, err := s.ListQuestionsByTag(tag)
+		if err != nil || len(qs) != want {
+			t.Errorf("ListQuestionsByTag(%q) = %d questions (err %v), want %d", tag, len(qs), err, want)
+		}
+	}
+	if qs, _ := s.ListQuestionsFiltered("easy", "", "security"); len(qs) != 1 || qs[0].Text != "Explain hashing" {
+		t.Errorf("difficulty and tag together should match only the easy security question, got %+v", qs)
+	}
+
+	q, err := s.GetQuestion(plain)
+	if err != nil || q.Tags != nil {
+		t.Fatalf("an untagged question should have nil tags, got %+v (err %v)", q, err)
+	}
+	q.Tags = []string{"routing"}
+	if err := s.UpdateQuestion(q); err != nil {
+		t.Fatalf("UpdateQuestion: %v", err)
+	}
+	if q, _ = s.GetQuestion(plain); !reflect.DeepEqual(q.Tags, []string{"routing"}) {
+		t.Errorf("updated tags = %v, want [routing]", q.Tags)
+	}
+}
+
+func TestQuestionMaxFollowups(t *testing.T) {
+	s := newTestStore(t)
+	none := 0
+	id, err := s.InsertQuestion(model.Question{CourseID: 1, Text: "Explain inertia", Difficulty: "easy", Topic: "m", MaxPoints: 10, MaxFollowups: &none})
+	if err != nil {
+		t.Fatalf("InsertQuestion: %v", err)
+	}
+	q, err := s.GetQuestion(id)
+	if err != nil || q.MaxFollowups == nil || *q.MaxFollowups != 0 {
+		t.Fatalf("a limit of 0 should round-trip, got %+v (err %v)", q, err)
+	}
+
+	q.MaxFollowups = nil
+	if err := s.UpdateQuestion(q); err != nil {
+		t.Fatalf("UpdateQuestion: %v", err)
+	}
+	if q, _ = s.GetQuestion(id); q.MaxFollowups != nil {
+		t.Errorf("clearing the limit should store NULL, got %d", *q.MaxFollowups)
+	}
+}
+
 func TestBlueprintCRUD(t *testing.T) {
 	s := newTestStore(t)
 
@@ -284,6 +425,36 @@ func TestThreadsAndMessages(t *testing.T) {
 	}
 }
 
+func TestAddClarification(t *testing.T) {
+	s := newTestStore(t)
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "T"})
+	q := insertTestQuestion(t, s, "Q1", "easy", "t")
+	sessID, _ := s.CreateSession(bpID, 1, []int64{q})
+	threads, _ := s.GetThreadsForSession(sessID)
+	threadID := threads[0].ID
+
+	if err := s.AddClarification(threadID, "Does rotation count?", "Linear motion is enough.", 42, 1); err != nil {
+		t.Fatalf("AddClarification: %v", err)
+	}
+	msgs, _ := s.GetMessages(threadID)
+	if len(msgs) != 2 || msgs[0].Role != model.RoleClarifyRequest || msgs[1].Role != model.RoleClarification || msgs[1].TokenCount != 42 {
+		t.Fatalf("expected the request and the reply, got %+v", msgs)
+	}
+
+	if err := s.AddClarification(threadID, "And friction?", "No.", 1, 1); !errors.Is(err, ErrClarificationsUsedUp) {
+		t.Errorf("expected ErrClarificationsUsedUp past the limit, got %v", err)
+	}
+	if _, err := s.AddMessage(model.Message{ThreadID: threadID, Role: model.RoleStudent, Content: "My answer"}); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	if err := s.AddClarification(threadID, "And friction?", "No.", 1, 5); !errors.Is(err, ErrThreadAnswered) {
+		t.Errorf("expected ErrThreadAnswered after an answer, got %v", err)
+	}
+	if msgs, _ := s.GetMessages(threadID); len(msgs) != 3 {
+		t.Errorf("rejected clarifications must store nothing, got %d messages", len(msgs))
+	}
+}
+
 func TestScores(t *testing.T) {
 	s := newTestStore(t)
 
@@ -351,6 +522,121 @@ func TestScores(t *testing.T) {
 	}
 }
 
+func TestLowConfidenceCounts(t *testing.T) {
+	s := newTestStore(t)
+
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "T"})
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "t")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "t")
+	unsure, _ := s.CreateSession(bpID, 1, []int64{q1, q2})
+	sure, _ := s.CreateSession(bpID, 1, []int64{q1})
+
+	threads, _ := s.GetThreadsForSession(unsure)
+	for i, c := range []float64{0.2, 0.4} {
+		if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[i].ID, LLMScore: 5, LLMConfidence: c}); err != nil {
+			t.Fatalf("UpsertScore: %v", err)
+		}
+	}
+	threads, _ = s.GetThreadsForSession(sure)
+	if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5, LLMConfidence: model.DefaultConfidence}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+	if score, _ := s.GetScore(threads[0].ID); score.LLMConfidence != model.DefaultConfidence {
+		t.Errorf("expected confidence %v to round-trip, got %v", model.DefaultConfidence, score.LLMConfidence)
+	}
+
+	both := []int64{unsure, sure}
+	counts, err := s.LowConfidenceCounts(0.3, both)
+	if err != nil {
+		t.Fatalf("LowConfidenceCounts: %v", err)
+	}
+	if len(counts) != 1 || counts[unsure] != 1 {
+		t.Errorf("expected one answer below 0.3 in session %d, got %v", unsure, counts)
+	}
+	counts, _ = s.LowConfidenceCounts(0.5, both)
+	if len(counts) != 1 || counts[unsure] != 2 {
+		t.Errorf("expected two answers below 0.5 in session %d, got %v", unsure, counts)
+	}
+	if counts, _ := s.LowConfidenceCounts(0.5, []int64{sure}); len(counts) != 0 {
+		t.Errorf("sessions outside the list should be left out, got %v", counts)
+	}
+
+	// A teacher's score clears the flag for that answer.
+	threads, _ = s.GetThreadsForSession(unsure)
+	if err := s.UpsertThreadReview(model.ThreadReview{ThreadID: threads[0].ID, ReviewerID: 3, Score: 6}); err != nil {
+		t.Fatalf("UpsertThreadReview: %v", err)
+	}
+	if counts, _ := s.LowConfidenceCounts(0.5, both); counts[unsure] != 1 {
+		t.Errorf("expected one unreviewed answer below 0.5, got %v", counts)
+	}
+}
+
+func TestScorePairs(t *testing.T) {
+	s := newTestStore(t)
+
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "T"})
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "t")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "t")
+	q3 := insertTestQuestion(t, s, "Q3", "easy", "t")
+	sessionID, _ := s.CreateSession(bpID, 1, []int64{q1, q2, q3})
+	threads, _ := s.GetThreadsForSession(sessionID)
+
+	for i, sc := range []model.QuestionScore{
+		{LLMScore: 7, LLMFeedback: "Good"},
+		{LLMScore: 4, LLMFeedback: "Partial"}, // not reviewed
+		{LLMScore: 0, LLMFeedback: model.GradingErrorPrefix + "timeout"},
+	} {
+		sc.ThreadID = threads[i].ID
+		if err := s.UpsertScore(sc); err != nil {
+			t.Fatalf("UpsertScore: %v", err)
+		}
+	}
+	for _, th := range []model.QuestionThread{threads[0], threads[2]} {
+		if err := s.UpdateTeacherScore(th.ID, 8, ""); err != nil {
+			t.Fatalf("UpdateTeacherScore: %v", err)
+		}
+	}
+
+	pairs, err := s.ScorePairs("")
+	if err != nil {
+		t.Fatalf("ScorePairs: %v", err)
+	}
+	want := []model.ScorePair{{LLMScore: 7, TeacherScore: 8, MaxPoints: 10}}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Errorf("expected only the reviewed, LLM-graded thread, got %+v", pairs)
+	}
+
+	// A cohort limits the pairs to its sessions.
+	student, err := s.CreateUser(model.User{Username: "anna", PasswordHash: "x", Role: model.UserRoleStudent, Active: true, Cohort: "A"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	cohortSession, err := s.CreateSession(bpID, student, []int64{q1})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	cohortThreads, err := s.GetThreadsForSession(cohortSession)
+	if err != nil {
+		t.Fatalf("GetThreadsForSession: %v", err)
+	}
+	if err := s.UpsertScore(model.QuestionScore{ThreadID: cohortThreads[0].ID, LLMScore: 3, LLMFeedback: "Weak"}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+	if err := s.UpdateTeacherScore(cohortThreads[0].ID, 5, ""); err != nil {
+		t.Fatalf("UpdateTeacherScore: %v", err)
+	}
+	pairs, err = s.ScorePairs("A")
+	if err != nil {
+		t.Fatalf("ScorePairs(A): %v", err)
+	}
+	if want := []model.ScorePair{{LLMScore: 3, TeacherScore: 5, MaxPoints: 10}}; !reflect.DeepEqual(pairs, want) {
+		t.Errorf("cohort A: got %+v, want %+v", pairs, want)
+	}
+	if pairs, err := s.ScorePairs(""); err != nil || len(pairs) != 2 {
+		t.Errorf("all cohorts: got %+v (err %v), want two pairs", pairs, err)
+	}
+}
+
 func TestGrades(t *testing.T) {
 	s := newTestStore(t)
 
@@ -453,6 +739,52 @@ func TestGetSessionView(t *testing.T) {
 	}
 }
 
+func TestExportTotalsTokenUsage(t *testing.T) {
+	s := newTestStore(t)
+
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Final"})
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "t1")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "t1")
+	sessID, _ := s.CreateSession(bpID, 1, []int64{q1, q2})
+	threads, _ := s.GetThreadsForSession(sessID)
+
+	for i, th := range threads {
+		if _, err := s.AddMessage(model.Message{ThreadID: th.ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+		if _, err := s.AddMessage(model.Message{ThreadID: th.ID, Role: model.RoleLLM, Content: "ok", TokenCount: 100 * (i + 1)}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+		if err := s.UpsertScore(model.QuestionScore{ThreadID: th.ID, LLMScore: 5, LLMTokenCount: 50}); err != nil {
+			t.Fatalf("UpsertScore: %v", err)
+		}
+	}
+
+	score, err := s.GetScore(threads[0].ID)
+	if err != nil || score == nil || score.LLMTokenCount != 50 {
+		t.Fatalf("GetScore: expected llm_token_count 50, got %+v (err %v)", score, err)
+	}
+
+	results, err := s.ExportAllSessions("", model.StudentIdentifierDisplayName)
+	if err != nil {
+		t.Fatalf("ExportAllSessions: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	// 100 + 200 for the evaluations, 2 × 50 for grading.
+	if results[0].TokenCount != 400 {
+		t.Errorf("expected session token total 400, got %d", results[0].TokenCount)
+	}
+	q := results[0].Questions[1]
+	if q.TokenCount == nil || *q.TokenCount != 250 {
+		t.Errorf("expected question token total 250, got %v", q.TokenCount)
+	}
+	if len(q.Conversation) != 2 || q.Conversation[1].TokenCount == nil || *q.Conversation[1].TokenCount != 200 {
+		t.Errorf("expected the evaluation message to carry 200 tokens, got %+v", q.Conversation)
+	}
+}
+
 func TestImportedFileHash(t *testing.T) {
 	s := newTestStore(t)
 
@@ -507,8 +839,17 @@ func TestUpdateQuestionByCourseAndText(t *testing.T) {
 		t.Fatal("expected inserted id")
 	}
 
+	inserted, err := s.GetQuestion(id)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if inserted.Weight != model.DefaultQuestionWeight {
+		t.Errorf("expected default weight, got %v", inserted.Weight)
+	}
+
 	q.Rubric = "updated"
 	q.MaxPoints = 10
+	q.Weight = 2
 	if err := s.UpdateQuestionByCourseAndText(q); err != nil {
 		t.Fatalf("update: %v", err)
 	}
@@ -517,7 +858,7 @@ func TestUpdateQuestionByCourseAndText(t *testing.T) {
 	if err != nil {
 		t.Fatalf("get: %v", err)
 	}
-	if updated.Rubric != "updated" || updated.MaxPoints != 10 {
+	if updated.Rubric != "updated" || updated.MaxPoints != 10 || updated.Weight != 2 {
 		t.Fatalf("unexpected updated values: %+v", updated)
 	}
 
@@ -527,6 +868,47 @@ func TestUpdateQuestionByCourseAndText(t *testing.T) {
 	}
 }
 
+func TestUpdateQuestion(t *testing.T) {
+	s := newTestStore(t)
+	id := insertTestQuestion(t, s, "Waht is inertia?", "easy", "Mechanics")
+
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	sessID, _ := s.CreateSession(bpID, 1, []int64{id})
+	threads, _ := s.GetThreadsForSession(sessID)
+	if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 4, LLMFeedback: "ok"}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+
+	n, err := s.QuestionThreadCount(id)
+	if err != nil || n != 1 {
+		t.Fatalf("QuestionThreadCount: got %d, %v; want 1", n, err)
+	}
+
+	q, _ := s.GetQuestion(id)
+	q.Text = "What is inertia?"
+	q.MaxPoints = 5
+	if err := s.UpdateQuestion(q); err != nil {
+		t.Fatalf("UpdateQuestion: %v", err)
+	}
+	updated, _ := s.GetQuestion(id)
+	if updated.Text != "What is inertia?" || updated.MaxPoints != 5 || updated.Topic != "Mechanics" {
+		t.Errorf("unexpected updated question: %+v", updated)
+	}
+	if results, _ := s.SearchQuestions("inertia"); len(results) != 1 {
+		t.Errorf("search index should follow the edit, got %d results", len(results))
+	}
+
+	score, err := s.GetScore(threads[0].ID)
+	if err != nil || score == nil || score.LLMScore != 4 {
+		t.Errorf("editing a question must not change stored scores, got %+v (err %v)", score, err)
+	}
+
+	q.ID = 9999
+	if err := s.UpdateQuestion(q); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing question, got %v", err)
+	}
+}
+
 func TestDeleteUnusedQuestionsByTexts(t *testing.T) {
 	s := newTestStore(t)
 
@@ -574,6 +956,41 @@ func TestDeleteUnusedQuestionsByTexts(t *testing.T) {
 	}
 }
 
+func TestUnusedQuestions(t *testing.T) {
+	s := newTestStore(t)
+
+	used := insertTestQuestion(t, s, "used", "easy", "go")
+	unusedA := insertTestQuestion(t, s, "unused A", "easy", "go")
+	alsoUsed := insertTestQuestion(t, s, "also used", "hard", "sql")
+	unusedB := insertTestQuestion(t, s, "unused B", "medium", "sql")
+
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	if _, err := s.CreateSession(bpID, 1, []int64{used}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := s.CreateSession(bpID, 2, []int64{alsoUsed, used}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	got, err := s.UnusedQuestions()
+	if err != nil {
+		t.Fatalf("UnusedQuestions: %v", err)
+	}
+	var ids []int64
+	for _, q := range got {
+		ids = append(ids, q.ID)
+	}
+	if want := []int64{unusedA, unusedB}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("UnusedQuestions = %v, want %v", ids, want)
+	}
+	if len(got) > 0 && got[0].Text != "unused A" {
+		t.Errorf("expected full question rows, got %+v", got[0])
+	}
+}
+
 func TestListDistinctTopics(t *testing.T) {
 	s := newTestStore(t)
 
@@ -606,3 +1023,1392 @@ func TestListDistinctTopics(t *testing.T) {
 		t.Errorf("expected [advanced basics concurrency], got %v", topics)
 	}
 }
+
+func TestSearchQuestions(t *testing.T) {
+	s := newTestStore(t)
+	insertTestQuestion(t, s, "Explain Newton's second law", "easy", "Mechanics")
+	insertTestQuestion(t, s, "Describe the photoelectric effect", "hard", "Quantum")
+	insertTestQuestion(t, s, "State Newton's third law", "medium", "Mechanics")
+
+	search := func(query string) []string {
+		t.Helper()
+		qs, err := s.SearchQuestions(query)
+		if err != nil {
+			t.Fatalf("SearchQuestions(%q): %v", query, err)
+		}
+		var texts []string
+		for _, q := range qs {
+			texts = append(texts, q.Text)
+		}
+		return texts
+	}
+
+	if got := search("newton"); len(got) != 2 {
+		t.Errorf("search newton: expected 2 results, got %v", got)
+	}
+	if got := search("photo"); len(got) != 1 || got[0] != "Describe the photoelectric effect" {
+		t.Errorf("prefix search photo: got %v", got)
+	}
+	if got := search("newton third"); len(got) != 1 || got[0] != "State Newton's third law" {
+		t.Errorf("multi-word search: got %v", got)
+	}
+	if got := search("quantum"); len(got) != 1 {
+		t.Errorf("topic search: expected 1 result, got %v", got)
+	}
+	if got := search(`"unbalanced`); len(got) != 0 {
+		t.Errorf("quoted search: expected no results, got %v", got)
+	}
+	if got := search("   "); len(got) != 3 || got[0] != "Explain Newton's second law" {
+		t.Errorf("blank search: expected all questions in ID order, got %v", got)
+	}
+
+	// Updates and deletes must be reflected in the index.
+	if err := s.UpdateQuestionByCourseAndText(model.Question{
+		CourseID: 1, Text: "Describe the photoelectric effect", Difficulty: "hard", Topic: "Optics", MaxPoints: 10,
+	}); err != nil {
+		t.Fatalf("UpdateQuestionByCourseAndText: %v", err)
+	}
+	if got := search("quantum"); len(got) != 0 {
+		t.Errorf("after update: expected no quantum results, got %v", got)
+	}
+	if got := search("optics"); len(got) != 1 {
+		t.Errorf("after update: expected 1 optics result, got %v", got)
+	}
+	if err := s.DeleteUnusedQuestionsByTexts(1, []string{"State Newton's third law"}, nil); err != nil {
+		t.Fatalf("DeleteUnusedQuestionsByTexts: %v", err)
+	}
+	if got := search("newton"); len(got) != 1 {
+		t.Errorf("after delete: expected 1 newton result, got %v", got)
+	}
+}
+
+func TestSearchQuestionsLimit(t *testing.T) {
+	s := newTestStore(t)
+	for i := range SearchQuestionsLimit + 1 {
+		insertTestQuestion(t, s, "Question "+strconv.Itoa(i)+" about inertia", "easy", "Mechanics")
+	}
+	for _, query := range []string{"", "inertia"} {
+		qs, err := s.SearchQuestions(query)
+		if err != nil {
+			t.Fatalf("SearchQuestions(%q): %v", query, err)
+		}
+		if len(qs) != SearchQuestionsLimit {
+			t.Errorf("SearchQuestions(%q): expected %d results, got %d", query, SearchQuestionsLimit, len(qs))
+		}
+	}
+}
+
+func TestBlueprintQuestions(t *testing.T) {
+	s := newTestStore(t)
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "Mechanics")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "Mechanics")
+	q3 := insertTestQuestion(t, s, "Q3", "hard", "Optics")
+
+	ids := func() []int64 {
+		t.Helper()
+		qs, err := s.BlueprintQuestions(bpID)
+		if err != nil {
+			t.Fatalf("BlueprintQuestions: %v", err)
+		}
+		var ids []int64
+		for _, q := range qs {
+			ids = append(ids, q.ID)
+		}
+		return ids
+	}
+
+	if got := ids(); got != nil {
+		t.Errorf("a new blueprint should have no fixed questions, got %v", got)
+	}
+	if err := s.SetBlueprintQuestions(bpID, []int64{q3, q1, q2}); err != nil {
+		t.Fatalf("SetBlueprintQuestions: %v", err)
+	}
+	if got := ids(); !reflect.DeepEqual(got, []int64{q3, q1, q2}) {
+		t.Errorf("expected the set in position order [%d %d %d], got %v", q3, q1, q2, got)
+	}
+	if err := s.SetBlueprintQuestions(bpID, []int64{q2}); err != nil {
+		t.Fatalf("SetBlueprintQuestions: %v", err)
+	}
+	if got := ids(); !reflect.DeepEqual(got, []int64{q2}) {
+		t.Errorf("setting again should replace the set, got %v", got)
+	}
+	if err := s.SetBlueprintQuestions(bpID, nil); err != nil {
+		t.Fatalf("SetBlueprintQuestions: %v", err)
+	}
+	if got := ids(); got != nil {
+		t.Errorf("an empty list should clear the set, got %v", got)
+	}
+}
+
+func TestSearchQuestionsIndexesExistingRows(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "search.db")
+	s, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	insertTestQuestion(t, s, "Explain Newton's second law", "easy", "Mechanics")
+
+	// Simulate a database created before the search index existed.
+	if _, err := s.db.Exec(`DROP TRIGGER questions_fts_ai; DROP TRIGGER questions_fts_ad; DROP TRIGGER questions_fts_au; DROP TABLE questions_fts`); err != nil {
+		t.Fatalf("drop search index: %v", err)
+	}
+	s.Close()
+
+	s, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+
+	qs, err := s.SearchQuestions("newton")
+	if err != nil {
+		t.Fatalf("SearchQuestions: %v", err)
+	}
+	if len(qs) != 1 {
+		t.Fatalf("expected pre-existing question to be indexed, got %d results", len(qs))
+	}
+}
+
+func TestListGradeRecords(t *testing.T) {
+	s := newTestStore(t)
+	qID := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	userID, err := s.CreateUser(model.User{Username: "ivanov", ExternalID: "S001", DisplayName: "Ivan", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	graded, err := s.CreateSession(bpID, userID, []int64{qID})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := s.CreateSession(bpID, userID, []int64{qID}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := s.UpsertGrade(model.Grade{SessionID: graded, LLMGrade: 70}); err != nil {
+		t.Fatalf("UpsertGrade: %v", err)
+	}
+	if err := s.FinalizeGrade(graded, 85, 1); err != nil {
+		t.Fatalf("FinalizeGrade: %v", err)
+	}
+
+	records, err := s.ListGradeRecords("phys", "")
+	if err != nil {
+		t.Fatalf("ListGradeRecords: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected only the graded session, got %d records", len(records))
+	}
+	r := records[0]
+	if r.ExternalID != "S001" || r.LLMGrade != 70 || r.FinalGrade == nil || *r.FinalGrade != 85 || r.Score() != 85 {
+		t.Errorf("unexpected record: %+v", r)
+	}
+
+	if err := s.SetExamInfo(model.ExamInfo{ExamID: "phys", Subject: "Physics", Date: "2026-03-15"}); err != nil {
+		t.Fatalf("SetExamInfo: %v", err)
+	}
+	for examID, want := range map[string]int{"": 1, "phys": 1, "chem": 0} {
+		records, err := s.ListGradeRecords(examID, "")
+		if err != nil {
+			t.Fatalf("ListGradeRecords(%q): %v", examID, err)
+		}
+		if len(records) != want {
+			t.Errorf("ListGradeRecords(%q) returned %d records, want %d", examID, len(records), want)
+		}
+	}
+}
+
+func TestCloneSessionQuestions(t *testing.T) {
+	s := newTestStore(t)
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "basics")
+	q3 := insertTestQuestion(t, s, "Q3", "hard", "advanced")
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+
+	// Deliberately not in ID order, as a shuffled exam would be.
+	order := []int64{q3, q1, q2}
+	src, err := s.CreateSession(bpID, 7, order)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, _ := s.GetThreadsForSession(src)
+	if err := s.UpdateThreadStatus(threads[0].ID, model.ThreadCompleted); err != nil {
+		t.Fatalf("UpdateThreadStatus: %v", err)
+	}
+
+	clone, err := s.CloneSessionQuestions(src)
+	if err != nil {
+		t.Fatalf("CloneSessionQuestions: %v", err)
+	}
+	if clone == src {
+		t.Fatal("clone should be a new session")
+	}
+
+	sess, err := s.GetSession(clone)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if sess.StudentID != 7 || sess.BlueprintID != bpID || sess.Status != model.StatusInProgress {
+		t.Errorf("unexpected cloned session: %+v", sess)
+	}
+
+	cloned, err := s.GetThreadsForSession(clone)
+	if err != nil {
+		t.Fatalf("GetThreadsForSession: %v", err)
+	}
+	if len(cloned) != len(order) {
+		t.Fatalf("expected %d threads, got %d", len(order), len(cloned))
+	}
+	for i, th := range cloned {
+		if th.QuestionID != order[i] {
+			t.Errorf("position %d: expected question %d, got %d", i, order[i], th.QuestionID)
+		}
+		if th.Status != model.ThreadOpen {
+			t.Errorf("position %d: expected open thread, got %q", i, th.Status)
+		}
+	}
+
+	if _, err := s.CloneSessionQuestions(9999); err == nil {
+		t.Error("expected error for missing source session")
+	}
+}
+
+func TestStudentHistory(t *testing.T) {
+	s := newTestStore(t)
+	mech1 := insertTestQuestion(t, s, "M1", "easy", "Mechanics")
+	mech2 := insertTestQuestion(t, s, "M2", "easy", "Mechanics")
+	optics := insertTestQuestion(t, s, "O1", "easy", "Optics")
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Physics"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	userID, err := s.CreateUser(model.User{Username: "ivanov", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	otherID, err := s.CreateUser(model.User{Username: "other", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	score := func(sessionID int64, scores ...float64) {
+		t.Helper()
+		threads, err := s.GetThreadsForSession(sessionID)
+		if err != nil {
+			t.Fatalf("GetThreadsForSession: %v", err)
+		}
+		for i, th := range threads {
+			if err := s.UpsertScore(model.QuestionScore{ThreadID: th.ID, LLMScore: scores[i]}); err != nil {
+				t.Fatalf("UpsertScore: %v", err)
+			}
+		}
+	}
+
+	// First attempt: Mechanics 4/10 and 6/10, Optics 2/10.
+	first, err := s.CreateSession(bpID, userID, []int64{mech1, mech2, optics})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	score(first, 4, 6, 2)
+	if err := s.UpsertGrade(model.Grade{SessionID: first, LLMGrade: 40}); err != nil {
+		t.Fatalf("UpsertGrade: %v", err)
+	}
+
+	// Second attempt: Mechanics 9/10, with the teacher overriding Optics to 8/10.
+	second, err := s.CreateSession(bpID, userID, []int64{mech1, optics})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	score(second, 9, 3)
+	threads, _ := s.GetThreadsForSession(second)
+	if err := s.UpdateTeacherScore(threads[1].ID, 8, "better"); err != nil {
+		t.Fatalf("UpdateTeacherScore: %v", err)
+	}
+
+	// Another student's session must not leak into the history.
+	other, err := s.CreateSession(bpID, otherID, []int64{mech1})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	score(other, 0)
+
+	hist, err := s.StudentHistory(userID)
+	if err != nil {
+		t.Fatalf("StudentHistory: %v", err)
+	}
+	if hist.Student.Username != "ivanov" {
+		t.Errorf("expected student ivanov, got %q", hist.Student.Username)
+	}
+	if len(hist.Sessions) != 2 || hist.Sessions[0].Session.ID != first || hist.Sessions[1].Session.ID != second {
+		t.Fatalf("expected sessions [%d %d] oldest first, got %+v", first, second, hist.Sessions)
+	}
+	if hist.Sessions[0].Grade == nil || hist.Sessions[0].Grade.LLMGrade != 40 || hist.Sessions[1].Grade != nil {
+		t.Errorf("unexpected grades: %+v, %+v", hist.Sessions[0].Grade, hist.Sessions[1].Grade)
+	}
+
+	if len(hist.Topics) != 2 {
+		t.Fatalf("expected 2 topics, got %+v", hist.Topics)
+	}
+	mech, opt := hist.Topics[0], hist.Topics[1]
+	if mech.Topic != "Mechanics" || mech.Questions != 3 || math.Abs(mech.AvgPercent-190.0/3) > 1e-9 {
+		t.Errorf("unexpected Mechanics aggregate: %+v", mech)
+	}
+	wantMech := []model.TopicPoint{{SessionID: first, AvgPercent: 50}, {SessionID: second, AvgPercent: 90}}
+	if !reflect.DeepEqual(mech.Trend, wantMech) {
+		t.Errorf("Mechanics trend = %+v, want %+v", mech.Trend, wantMech)
+	}
+	if opt.Topic != "Optics" || opt.Questions != 2 || opt.AvgPercent != 50 {
+		t.Errorf("unexpected Optics aggregate: %+v", opt)
+	}
+	wantOpt := []model.TopicPoint{{SessionID: first, AvgPercent: 20}, {SessionID: second, AvgPercent: 80}}
+	if !reflect.DeepEqual(opt.Trend, wantOpt) {
+		t.Errorf("Optics trend = %+v, want %+v", opt.Trend, wantOpt)
+	}
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	s := newTestStore(t)
+	var ids []int64
+	for _, name := range []string{"alice", "bob", "carol"} {
+		id, err := s.CreateUser(model.User{Username: name, PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+		if err != nil {
+			t.Fatalf("CreateUser(%s): %v", name, err)
+		}
+		ids = append(ids, id)
+	}
+
+	users, err := s.GetUsersByIDs([]int64{ids[0], ids[2], ids[2], 9999})
+	if err != nil {
+		t.Fatalf("GetUsersByIDs: %v", err)
+	}
+	if len(users) != 2 || users[ids[0]].Username != "alice" || users[ids[2]].Username != "carol" {
+		t.Errorf("GetUsersByIDs = %+v, want alice and carol", users)
+	}
+	if users, err := s.GetUsersByIDs(nil); err != nil || len(users) != 0 {
+		t.Errorf("GetUsersByIDs(nil) = %v, %v; want an empty map", users, err)
+	}
+}
+
+func TestListSessionsByCohort(t *testing.T) {
+	s := newTestStore(t)
+	q := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	newStudent := func(name, cohort string) int64 {
+		id, err := s.CreateUser(model.User{Username: name, PasswordHash: "x", Role: model.UserRoleStudent, Active: true, Cohort: cohort})
+		if err != nil {
+			t.Fatalf("CreateUser(%s): %v", name, err)
+		}
+		return id
+	}
+	alice := newStudent("alice", "A")
+	bob := newStudent("bob", "B")
+	carol := newStudent("carol", "")
+
+	a1, err := s.CreateSession(bpID, alice, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession(alice): %v", err)
+	}
+	b1, err := s.CreateSession(bpID, bob, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession(bob): %v", err)
+	}
+	if _, err := s.CreateSession(bpID, carol, []int64{q}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	// Moving alice to B affects only sessions she starts afterwards.
+	if err := s.SetUserCohort(alice, "B"); err != nil {
+		t.Fatalf("SetUserCohort: %v", err)
+	}
+	if err := s.SetUserCohort(9999, "B"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetUserCohort(unknown) = %v, want sql.ErrNoRows", err)
+	}
+	a2, err := s.CreateSession(bpID, alice, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession(alice again): %v", err)
+	}
+
+	ids := func(sessions []model.ExamSession) []int64 {
+		var out []int64
+		for _, sess := range sessions {
+			out = append(out, sess.ID)
+		}
+		return out
+	}
+
+	gotA, err := s.ListSessionsByCohort("A")
+	if err != nil {
+		t.Fatalf("ListSessionsByCohort(A): %v", err)
+	}
+	if want := []int64{a1}; !reflect.DeepEqual(ids(gotA), want) {
+		t.Errorf("cohort A: got %v, want %v", ids(gotA), want)
+	}
+	gotB, err := s.ListSessionsByCohort("B")
+	if err != nil {
+		t.Fatalf("ListSessionsByCohort(B): %v", err)
+	}
+	if want := []int64{a2, b1}; !reflect.DeepEqual(ids(gotB), want) {
+		t.Errorf("cohort B: got %v, want %v", ids(gotB), want)
+	}
+
+	cohorts, err := s.ListCohorts()
+	if err != nil {
+		t.Fatalf("ListCohorts: %v", err)
+	}
+	if want := []string{"A", "B"}; !reflect.DeepEqual(cohorts, want) {
+		t.Errorf("ListCohorts: got %v, want %v", cohorts, want)
+	}
+
+	results, err := s.ExportAllSessions("A", model.StudentIdentifierExternalID)
+	if err != nil {
+		t.Fatalf("ExportAllSessions: %v", err)
+	}
+	if len(results) != 1 || results[0].Cohort != "A" || results[0].SessionNumber != 1 || results[0].Label != "alice" {
+		t.Errorf("export for cohort A (label falls back to the username): got %+v", results)
+	}
+}
+
+func TestListSessionsPaged(t *testing.T) {
+	s := newTestStore(t)
+	q := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+
+	var graded []int64
+	for i := 0; i < 7; i++ {
+		id, err := s.CreateSession(bpID, int64(i%2+1), []int64{q})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		if i%3 != 0 {
+			if err := s.UpdateSessionStatus(id, model.StatusGraded); err != nil {
+				t.Fatalf("UpdateSessionStatus: %v", err)
+			}
+			graded = append([]int64{id}, graded...) // newest first
+		}
+	}
+
+	f := model.SessionFilter{Statuses: []model.SessionStatus{model.StatusGraded, model.StatusReviewed}}
+	total, err := s.CountSessions(f)
+	if err != nil || total != len(graded) {
+		t.Fatalf("CountSessions: got %d, %v; want %d", total, err, len(graded))
+	}
+
+	var got []int64
+	for offset := 0; offset < total; offset += 2 {
+		page, err := s.ListSessionsPaged(f, 2, offset)
+		if err != nil {
+			t.Fatalf("ListSessionsPaged: %v", err)
+		}
+		for _, sess := range page {
+			got = append(got, sess.ID)
+		}
+	}
+	if !reflect.DeepEqual(got, graded) {
+		t.Errorf("pages should cover the filtered sessions newest first: got %v, want %v", got, graded)
+	}
+
+	f.StudentID = 1
+	n, _ := s.CountSessions(f)
+	page, _ := s.ListSessionsPaged(f, 100, 0)
+	if n != len(page) || n == 0 {
+		t.Errorf("count (%d) and list (%d) should agree for a student filter", n, len(page))
+	}
+	for _, sess := range page {
+		if sess.StudentID != 1 || sess.Status != model.StatusGraded {
+			t.Errorf("session %d does not match the filter: %+v", sess.ID, sess)
+		}
+	}
+}
+
+func TestExpireOverdueSessions(t *testing.T) {
+	s := newTestStore(t)
+	q := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	timed, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Timed", TimeLimit: 30})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+	untimed, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Untimed"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+
+	overdue, _ := s.CreateSession(timed, 1, []int64{q})
+	fresh, _ := s.CreateSession(timed, 2, []int64{q})
+	noLimit, _ := s.CreateSession(untimed, 3, []int64{q})
+	submitted, _ := s.CreateSession(timed, 4, []int64{q})
+	if err := s.UpdateSessionStatus(submitted, model.StatusSubmitted); err != nil {
+		t.Fatalf("UpdateSessionStatus: %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	for _, id := range []int64{overdue, noLimit, submitted} {
+		if _, err := s.db.Exec(`UPDATE exam_sessions SET started_at = ? WHERE id = ?`, past, id); err != nil {
+			t.Fatalf("backdate session: %v", err)
+		}
+	}
+
+	got, err := s.ExpireOverdueSessions(0)
+	if err != nil {
+		t.Fatalf("ExpireOverdueSessions: %v", err)
+	}
+	if want := []int64{overdue}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expired %v, want %v", got, want)
+	}
+	sess, _ := s.GetSession(overdue)
+	if sess.Status != model.StatusSubmitted || sess.SubmittedAt == nil {
+		t.Errorf("overdue session should be submitted, got %+v", sess)
+	}
+	for _, id := range []int64{fresh, noLimit} {
+		if sess, _ := s.GetSession(id); sess.Status != model.StatusInProgress {
+			t.Errorf("session %d should still be in progress, got %q", id, sess.Status)
+		}
+	}
+
+	// A ceiling shorter than the elapsed time also expires untimed sessions.
+	got, err = s.ExpireOverdueSessions(45 * time.Minute)
+	if err != nil {
+		t.Fatalf("ExpireOverdueSessions: %v", err)
+	}
+	if want := []int64{noLimit}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with ceiling expired %v, want %v", got, want)
+	}
+}
+
+func TestDeleteSessionsByStatus(t *testing.T) {
+	s := newTestStore(t)
+	q := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	bpID, err := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	if err != nil {
+		t.Fatalf("CreateBlueprint: %v", err)
+	}
+
+	// Every session gets a message, a score and a grade so the children of
+	// both purged and kept sessions can be checked.
+	seed := func(status model.SessionStatus) int64 {
+		id, err := s.CreateSession(bpID, 1, []int64{q})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		threads, _ := s.GetThreadsForSession(id)
+		if _, err := s.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+		if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5}); err != nil {
+			t.Fatalf("UpsertScore: %v", err)
+		}
+		if err := s.UpsertGrade(model.Grade{SessionID: id, LLMGrade: 50}); err != nil {
+			t.Fatalf("UpsertGrade: %v", err)
+		}
+		if status != model.StatusInProgress {
+			if err := s.UpdateSessionStatus(id, status); err != nil {
+				t.Fatalf("UpdateSessionStatus: %v", err)
+			}
+		}
+		return id
+	}
+	junk1 := seed(model.StatusInProgress)
+	kept := seed(model.StatusGraded)
+	junk2 := seed(model.StatusInProgress)
+
+	n, err := s.DeleteSessionsByStatus(model.StatusInProgress)
+	if err != nil {
+		t.Fatalf("DeleteSessionsByStatus: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 sessions deleted, got %d", n)
+	}
+
+	for _, id := range []int64{junk1, junk2} {
+		if _, err := s.GetSession(id); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("session %d should be deleted, got err=%v", id, err)
+		}
+	}
+	count := func(query string) int {
+		var c int
+		if err := s.db.QueryRow(query).Scan(&c); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return c
+	}
+	for table, want := range map[string]int{
+		"question_threads": 1, "messages": 1, "question_scores": 1, "grades": 1,
+	} {
+		if got := count("SELECT COUNT(*) FROM " + table); got != want {
+			t.Errorf("%s: expected %d rows left, got %d", table, want, got)
+		}
+	}
+
+	view, err := s.GetSessionView(kept)
+	if err != nil {
+		t.Fatalf("GetSessionView(kept): %v", err)
+	}
+	if len(view.Threads) != 1 || len(view.Threads[0].Messages) != 1 || view.Threads[0].Score == nil || view.Grade == nil {
+		t.Errorf("kept session lost children: %+v", view)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	s := newTestStore(t)
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "basics")
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+
+	seed := func() int64 {
+		id, err := s.CreateSession(bpID, 1, []int64{q1, q2})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		threads, _ := s.GetThreadsForSession(id)
+		for _, th := range threads {
+			s.AddMessage(model.Message{ThreadID: th.ID, Role: model.RoleStudent, Content: "answer"})
+			s.UpsertScore(model.QuestionScore{ThreadID: th.ID, LLMScore: 5})
+			s.UpsertThreadReview(model.ThreadReview{ThreadID: th.ID, ReviewerID: 2, Score: 6})
+		}
+		s.UpsertGrade(model.Grade{SessionID: id, LLMGrade: 50})
+		return id
+	}
+	junk := seed()
+	kept := seed()
+
+	if err := s.DeleteSession(junk); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if _, err := s.GetSession(junk); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("session should be deleted, got err=%v", err)
+	}
+	for table, want := range map[string]int{
+		"exam_sessions": 1, "question_threads": 2, "messages": 2, "question_scores": 2, "thread_reviews": 2, "grades": 1,
+	} {
+		var got int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&got); err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %d rows left, got %d", table, want, got)
+		}
+	}
+	if view, err := s.GetSessionView(kept); err != nil || len(view.Threads) != 2 || view.Grade == nil {
+		t.Errorf("the other session should be intact, got %+v, %v", view, err)
+	}
+
+	if err := s.DeleteSession(junk); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleting a missing session should return sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestSessionsMissingGrades(t *testing.T) {
+	s := newTestStore(t)
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "basics")
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+
+	// seed creates a session in status whose threads get the given LLM
+	// feedback, and a grades row if graded is set.
+	seed := func(status model.SessionStatus, graded bool, feedback ...string) (int64, []model.QuestionThread) {
+		id, err := s.CreateSession(bpID, 1, []int64{q1, q2})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		threads, _ := s.GetThreadsForSession(id)
+		for i, fb := range feedback {
+			if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[i].ID, LLMFeedback: fb}); err != nil {
+				t.Fatalf("UpsertScore: %v", err)
+			}
+		}
+		if graded {
+			if err := s.UpsertGrade(model.Grade{SessionID: id, LLMGrade: 50}); err != nil {
+				t.Fatalf("UpsertGrade: %v", err)
+			}
+		}
+		if status != model.StatusInProgress {
+			if err := s.UpdateSessionStatus(id, status); err != nil {
+				t.Fatalf("UpdateSessionStatus: %v", err)
+			}
+		}
+		return id, threads
+	}
+	seed(model.StatusInProgress, false)              // still being taken: not flagged
+	seed(model.StatusGraded, true, "Good", "Fine")   // complete: not flagged
+	noGrade, _ := seed(model.StatusSubmitted, false) // grading never ran
+	failed, _ := seed(model.StatusGraded, true, "Good", model.GradingErrorPrefix+"timeout")
+	fixed, threads := seed(model.StatusReviewed, true, model.GradingErrorPrefix+"timeout")
+	if err := s.UpdateTeacherScore(threads[0].ID, 7, "graded by hand"); err != nil {
+		t.Fatalf("UpdateTeacherScore: %v", err)
+	}
+
+	got, err := s.SessionsMissingGrades()
+	if err != nil {
+		t.Fatalf("SessionsMissingGrades: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 flagged sessions, got %+v", got)
+	}
+	if got[0].Session.ID != noGrade || !got[0].MissingGrade || got[0].ErrorScores != 0 || got[0].Session.Status != model.StatusSubmitted {
+		t.Errorf("expected session %d flagged for its missing grade, got %+v", noGrade, got[0])
+	}
+	if got[1].Session.ID != failed || got[1].MissingGrade || got[1].ErrorScores != 1 {
+		t.Errorf("expected session %d flagged for one error score, got %+v", failed, got[1])
+	}
+	for _, u := range got {
+		if u.Session.ID == fixed {
+			t.Error("an error score the teacher replaced should not be flagged")
+		}
+	}
+}
+
+func TestPasswordAndAuthSessions(t *testing.T) {
+	s := newTestStore(t)
+	userID, err := s.CreateUser(model.User{Username: "student", PasswordHash: "old", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	otherID, _ := s.CreateUser(model.User{Username: "other", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+
+	if err := s.UpdatePassword(userID, "new"); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	if u, _ := s.GetUserByID(userID); u.PasswordHash != "new" {
+		t.Errorf("expected the new hash stored, got %q", u.PasswordHash)
+	}
+	if err := s.UpdatePassword(9999, "new"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing user, got %v", err)
+	}
+
+	current, _ := s.CreateAuthSession(userID)
+	laptop, _ := s.CreateAuthSession(userID)
+	unrelated, _ := s.CreateAuthSession(otherID)
+	if err := s.DeleteOtherAuthSessions(userID, current); err != nil {
+		t.Fatalf("DeleteOtherAuthSessions: %v", err)
+	}
+	for token, keep := range map[string]bool{current: true, laptop: false, unrelated: true} {
+		sess, err := s.GetAuthSession(token)
+		if err != nil {
+			t.Fatalf("GetAuthSession: %v", err)
+		}
+		if (sess != nil) != keep {
+			t.Errorf("session %s: kept=%v, want %v", token, sess != nil, keep)
+		}
+	}
+
+	if err := s.DeleteUserAuthSessions(userID); err != nil {
+		t.Fatalf("DeleteUserAuthSessions: %v", err)
+	}
+	if sess, _ := s.GetAuthSession(current); sess != nil {
+		t.Error("DeleteUserAuthSessions should remove the user's last session")
+	}
+	if sess, _ := s.GetAuthSession(unrelated); sess == nil {
+		t.Error("DeleteUserAuthSessions should not touch other users' sessions")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	s := newTestStore(t)
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "T"})
+	q := insertTestQuestion(t, s, "Q1", "easy", "t")
+	sessID, _ := s.CreateSession(bpID, 1, []int64{q})
+	threads, _ := s.GetThreadsForSession(sessID)
+	if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+	if err := s.UpsertGrade(model.Grade{SessionID: sessID, LLMGrade: 50}); err != nil {
+		t.Fatalf("UpsertGrade: %v", err)
+	}
+	teacher, err := s.CreateUser(model.User{Username: "teacher", PasswordHash: "x", Role: model.UserRoleTeacher, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	for _, score := range []float64{6, 7} {
+		if err := s.UpsertThreadReview(model.ThreadReview{ThreadID: threads[0].ID, ReviewerID: teacher, Score: score}); err != nil {
+			t.Fatalf("UpsertThreadReview: %v", err)
+		}
+	}
+	for _, grade := range []float64{70, 75} {
+		if err := s.FinalizeGrade(sessID, grade, teacher); err != nil {
+			t.Fatalf("FinalizeGrade: %v", err)
+		}
+	}
+
+	entries, err := s.ListAuditLog(sessID)
+	if err != nil {
+		t.Fatalf("ListAuditLog: %v", err)
+	}
+	type change struct {
+		action   string
+		threadID int64
+		old, new float64
+	}
+	var got []change
+	for _, e := range entries {
+		if e.UserID != teacher || e.Username != "teacher" || e.SessionID != sessID || e.OldValue == nil {
+			t.Fatalf("unexpected entry %+v", e)
+		}
+		got = append(got, change{e.Action, e.ThreadID, *e.OldValue, e.NewValue})
+	}
+	// The first edit of each replaces the LLM's value.
+	want := []change{
+		{model.AuditScoreChanged, threads[0].ID, 5, 6},
+		{model.AuditScoreChanged, threads[0].ID, 6, 7},
+		{model.AuditGradeFinalized, 0, 50, 70},
+		{model.AuditGradeFinalized, 0, 70, 75},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("audit log:\n got %+v\nwant %+v", got, want)
+	}
+
+	// The trail outlives the session.
+	if err := s.DeleteSession(sessID); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if entries, _ := s.ListAuditLog(sessID); len(entries) != len(want) {
+		t.Errorf("after deleting the session expected %d entries, got %d", len(want), len(entries))
+	}
+}
+
+func TestThreadReviews(t *testing.T) {
+	s := newTestStore(t)
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "T"})
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "t")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "t")
+	sessID, _ := s.CreateSession(bpID, 1, []int64{q1, q2})
+	threads, _ := s.GetThreadsForSession(sessID)
+	for _, th := range threads {
+		if err := s.UpsertScore(model.QuestionScore{ThreadID: th.ID, LLMScore: 5}); err != nil {
+			t.Fatalf("UpsertScore: %v", err)
+		}
+	}
+	if err := s.UpsertGrade(model.Grade{SessionID: sessID, LLMGrade: 50}); err != nil {
+		t.Fatalf("UpsertGrade: %v", err)
+	}
+
+	review := func(threadID, reviewerID int64, score float64, comment string) {
+		t.Helper()
+		if err := s.UpsertThreadReview(model.ThreadReview{ThreadID: threadID, ReviewerID: reviewerID, Score: score, Comment: comment}); err != nil {
+			t.Fatalf("UpsertThreadReview: %v", err)
+		}
+	}
+	review(threads[0].ID, 2, 6, "Misses friction")
+	review(threads[0].ID, 3, 9, "")
+	review(threads[0].ID, 2, 7, "Mentions friction only briefly") // replaces reviewer 2's review
+
+	reviews, err := s.ListThreadReviews(threads[0].ID)
+	if err != nil {
+		t.Fatalf("ListThreadReviews: %v", err)
+	}
+	if len(reviews) != 2 || reviews[0].ReviewerID != 2 || reviews[0].Score != 7 || reviews[1].ReviewerID != 3 {
+		t.Fatalf("expected one review per reviewer, got %+v", reviews)
+	}
+	score, _ := s.GetScore(threads[0].ID)
+	if score.TeacherScore == nil || *score.TeacherScore != 8 {
+		t.Errorf("expected the average 8 as teacher score, got %v", score.TeacherScore)
+	}
+	if score.TeacherComment != "Mentions friction only briefly" {
+		t.Errorf("expected only the non-empty comment, got %q", score.TeacherComment)
+	}
+
+	// A score set without a review is left alone when finalizing, while
+	// reviewed threads are recomputed from their reviews.
+	if err := s.UpdateTeacherScore(threads[1].ID, 4, "direct"); err != nil {
+		t.Fatalf("UpdateTeacherScore: %v", err)
+	}
+	if err := s.UpdateTeacherScore(threads[0].ID, 1, "overwritten"); err != nil {
+		t.Fatalf("UpdateTeacherScore: %v", err)
+	}
+	if err := s.FinalizeGrade(sessID, 60, 2); err != nil {
+		t.Fatalf("FinalizeGrade: %v", err)
+	}
+	score, _ = s.GetScore(threads[0].ID)
+	if *score.TeacherScore != 8 || score.TeacherComment != "Mentions friction only briefly" {
+		t.Errorf("finalize should aggregate the reviews again, got %v %q", *score.TeacherScore, score.TeacherComment)
+	}
+	score, _ = s.GetScore(threads[1].ID)
+	if *score.TeacherScore != 4 || score.TeacherComment != "direct" {
+		t.Errorf("an unreviewed thread should keep its teacher score, got %v %q", *score.TeacherScore, score.TeacherComment)
+	}
+	if g, _ := s.GetGrade(sessID); g.FinalGrade == nil || *g.FinalGrade != 60 {
+		t.Errorf("expected final grade 60, got %+v", g)
+	}
+}
+
+func TestMigrateTeacherScoresToReviews(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "examiner.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "T"})
+	qID := insertTestQuestion(t, s, "Q1", "easy", "t")
+	finalized, _ := s.CreateSession(bpID, 1, []int64{qID})
+	pending, _ := s.CreateSession(bpID, 1, []int64{qID})
+	var threadIDs []int64
+	for _, id := range []int64{finalized, pending} {
+		threads, _ := s.GetThreadsForSession(id)
+		threadIDs = append(threadIDs, threads[0].ID)
+		s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5})
+		s.UpsertGrade(model.Grade{SessionID: id, LLMGrade: 50})
+		// Scores written the old way, with no review rows.
+		s.UpdateTeacherScore(threads[0].ID, 6, "legacy")
+	}
+	s.FinalizeGrade(finalized, 60, 7)
+	// As in a database from before reviews existed.
+	if _, err := s.db.Exec(`DELETE FROM exam_metadata WHERE key = ?`, legacyReviewsKey); err != nil {
+		t.Fatalf("clear migration flag: %v", err)
+	}
+
+	// Open twice: the second migration must not duplicate the first's rows.
+	for range 2 {
+		s.Close()
+		if s, err = New(path); err != nil {
+			t.Fatalf("reopen: %v", err)
+		}
+	}
+	defer s.Close()
+	for i, wantReviewer := range []int64{7, 0} {
+		reviews, err := s.ListThreadReviews(threadIDs[i])
+		if err != nil {
+			t.Fatalf("ListThreadReviews: %v", err)
+		}
+		if len(reviews) != 1 || reviews[0].ReviewerID != wantReviewer || reviews[0].Score != 6 || reviews[0].Comment != "legacy" || !reviews[0].Legacy {
+			t.Errorf("thread %d: expected one legacy review by %d, got %+v", threadIDs[i], wantReviewer, reviews)
+		}
+	}
+
+	// A teacher's review replaces the legacy score instead of being
+	// averaged with it.
+	if err := s.UpsertThreadReview(model.ThreadReview{ThreadID: threadIDs[1], ReviewerID: 3, Score: 9}); err != nil {
+		t.Fatalf("UpsertThreadReview: %v", err)
+	}
+	if score, _ := s.GetScore(threadIDs[1]); score.TeacherScore == nil || *score.TeacherScore != 9 {
+		t.Errorf("expected the teacher's 9 to replace the legacy score, got %v", score.TeacherScore)
+	}
+	// Reviewing as the credited finalizer turns the legacy review into theirs.
+	if err := s.UpsertThreadReview(model.ThreadReview{ThreadID: threadIDs[0], ReviewerID: 7, Score: 8}); err != nil {
+		t.Fatalf("UpsertThreadReview: %v", err)
+	}
+	if reviews, _ := s.ListThreadReviews(threadIDs[0]); len(reviews) != 1 || reviews[0].Legacy || reviews[0].Score != 8 {
+		t.Errorf("expected the finalizer's review to replace the legacy one, got %+v", reviews)
+	}
+
+	// The migration ran once: a score set without a review later is not
+	// turned into a review on the next start.
+	later, _ := s.CreateSession(bpID, 1, []int64{qID})
+	laterThreads, _ := s.GetThreadsForSession(later)
+	s.UpsertScore(model.QuestionScore{ThreadID: laterThreads[0].ID, LLMScore: 5})
+	s.UpdateTeacherScore(laterThreads[0].ID, 4, "direct")
+	s.Close()
+	if s, err = New(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if reviews, _ := s.ListThreadReviews(laterThreads[0].ID); len(reviews) != 0 {
+		t.Errorf("the migration should not run again, got %+v", reviews)
+	}
+}
+
+func TestMigrateRemapsDuplicateQuestions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "examiner.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	canonical := insertTestQuestion(t, s, "Q1", "easy", "t")
+	other := insertTestQuestion(t, s, "Q2", "easy", "t")
+	// As in a database from before duplicates were rejected.
+	if _, err := s.db.Exec(`DROP INDEX idx_questions_course_text`); err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+	res, err := s.db.Exec(`INSERT INTO questions (course_id, text, difficulty, topic, max_points) SELECT course_id, text, difficulty, topic, max_points FROM questions WHERE id = ?`, canonical)
+	if err != nil {
+		t.Fatalf("insert duplicate: %v", err)
+	}
+	dup, _ := res.LastInsertId()
+	both, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Both"})
+	dupOnly, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Duplicate"})
+	if err := s.SetBlueprintQuestions(both, []int64{canonical, dup, other}); err != nil {
+		t.Fatalf("SetBlueprintQuestions: %v", err)
+	}
+	if err := s.SetBlueprintQuestions(dupOnly, []int64{dup}); err != nil {
+		t.Fatalf("SetBlueprintQuestions: %v", err)
+	}
+	sessID, err := s.CreateSession(both, 1, []int64{dup})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	s.Close()
+
+	if s, err = New(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	ids := func(bpID int64) []int64 {
+		questions, err := s.BlueprintQuestions(bpID)
+		if err != nil {
+			t.Fatalf("BlueprintQuestions: %v", err)
+		}
+		var out []int64
+		for _, q := range questions {
+			out = append(out, q.ID)
+		}
+		return out
+	}
+	if got, want := ids(both), []int64{canonical, other}; !reflect.DeepEqual(got, want) {
+		t.Errorf("blueprint with both copies = %v, want %v", got, want)
+	}
+	if got, want := ids(dupOnly), []int64{canonical}; !reflect.DeepEqual(got, want) {
+		t.Errorf("blueprint with the duplicate = %v, want %v", got, want)
+	}
+	if threads, _ := s.GetThreadsForSession(sessID); len(threads) != 1 || threads[0].QuestionID != canonical {
+		t.Errorf("thread should point at question %d, got %+v", canonical, threads)
+	}
+}
+
+func TestSeenQuestionIDs(t *testing.T) {
+	s := newTestStore(t)
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "basics")
+	q3 := insertTestQuestion(t, s, "Q3", "easy", "basics")
+	bp1, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	bp2, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Other"})
+
+	if _, err := s.CreateSession(bp1, 7, []int64{q1, q2}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := s.CreateSession(bp1, 8, []int64{q3}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := s.CreateSession(bp2, 7, []int64{q3}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	seen, err := s.SeenQuestionIDs(7, bp1)
+	if err != nil {
+		t.Fatalf("SeenQuestionIDs: %v", err)
+	}
+	if !reflect.DeepEqual(seen, map[int64]bool{q1: true, q2: true}) {
+		t.Errorf("expected only the student's questions for the blueprint, got %v", seen)
+	}
+	if seen, _ := s.SeenQuestionIDs(9, bp1); len(seen) != 0 {
+		t.Errorf("a new student should have seen nothing, got %v", seen)
+	}
+}
+
+func TestFindAndDeleteOrphans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "examiner.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Close()
+	q1 := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	q2 := insertTestQuestion(t, s, "Q2", "easy", "basics")
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+
+	seed := func() (int64, []model.QuestionThread) {
+		t.Helper()
+		id, err := s.CreateSession(bpID, 7, []int64{q1, q2})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		threads, _ := s.GetThreadsForSession(id)
+		if _, err := s.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+		if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5}); err != nil {
+			t.Fatalf("UpsertScore: %v", err)
+		}
+		if err := s.UpsertThreadReview(model.ThreadReview{ThreadID: threads[0].ID, ReviewerID: 2, Score: 6}); err != nil {
+			t.Fatalf("UpsertThreadReview: %v", err)
+		}
+		if err := s.UpsertGrade(model.Grade{SessionID: id, LLMGrade: 50}); err != nil {
+			t.Fatalf("UpsertGrade: %v", err)
+		}
+		return id, threads
+	}
+	kept, keptThreads := seed()
+	lost, _ := seed()
+
+	if counts, err := s.FindOrphans(); err != nil || counts.Total() != 0 {
+		t.Fatalf("a consistent database should have no orphans, got %+v (err %v)", counts, err)
+	}
+
+	// Simulate a crash halfway through deleting a session, plus a message
+	// whose thread never existed, written by a connection that does not
+	// enforce foreign keys, as older versions did not.
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec(`DELETE FROM exam_sessions WHERE id = ?`, lost); err != nil {
+		t.Fatalf("delete session: %v", err)
+	}
+	if _, err := raw.Exec(`INSERT INTO messages (thread_id, role, content, created_at) VALUES (9999, 'student', 'stray', ?)`, time.Now()); err != nil {
+		t.Fatalf("insert stray message: %v", err)
+	}
+
+	want := model.OrphanCounts{Threads: 2, Messages: 2, Scores: 1, Reviews: 1, Grades: 1}
+	counts, err := s.FindOrphans()
+	if err != nil {
+		t.Fatalf("FindOrphans: %v", err)
+	}
+	if counts != want {
+		t.Errorf("FindOrphans: got %+v, want %+v", counts, want)
+	}
+
+	deleted, err := s.DeleteOrphans()
+	if err != nil {
+		t.Fatalf("DeleteOrphans: %v", err)
+	}
+	if deleted != want {
+		t.Errorf("DeleteOrphans: got %+v, want %+v", deleted, want)
+	}
+	if counts, _ := s.FindOrphans(); counts.Total() != 0 {
+		t.Errorf("expected no orphans after repair, got %+v", counts)
+	}
+
+	view, err := s.GetSessionView(kept)
+	if err != nil {
+		t.Fatalf("GetSessionView: %v", err)
+	}
+	if len(view.Threads) != 2 || view.Grade == nil || view.Threads[0].Score == nil || len(view.Threads[0].Messages) != 1 {
+		t.Errorf("repair must not touch the intact session, got %+v", view)
+	}
+	if reviews, _ := s.ListThreadReviews(keptThreads[0].ID); len(reviews) != 1 {
+		t.Errorf("expected the intact session's review kept, got %d", len(reviews))
+	}
+}
+
+func TestForeignKeysEnforced(t *testing.T) {
+	s := newTestStore(t)
+	q := insertTestQuestion(t, s, "Q1", "easy", "basics")
+
+	if _, err := s.db.Exec(`INSERT INTO question_threads (session_id, question_id) VALUES (9999, ?)`, q); err == nil {
+		t.Error("inserting a thread for a missing session should fail")
+	}
+	if _, err := s.AddMessage(model.Message{ThreadID: 9999, Role: model.RoleStudent, Content: "stray"}); err == nil {
+		t.Error("adding a message to a missing thread should fail")
+	}
+	if _, err := s.CreateSession(9999, 7, []int64{q}); err == nil {
+		t.Error("creating a session for a missing blueprint should fail")
+	}
+
+	// Deleting a session with threads, messages, scores and a grade still
+	// works because the children go first.
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	id, err := s.CreateSession(bpID, 7, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, _ := s.GetThreadsForSession(id)
+	if _, err := s.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	if err := s.UpsertThreadReview(model.ThreadReview{ThreadID: threads[0].ID, ReviewerID: 2, Score: 6}); err != nil {
+		t.Fatalf("UpsertThreadReview: %v", err)
+	}
+	if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+	if err := s.UpsertGrade(model.Grade{SessionID: id, LLMGrade: 50}); err != nil {
+		t.Fatalf("UpsertGrade: %v", err)
+	}
+	if err := s.DeleteSession(id); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+}
+
+func TestAuthSessionTTL(t *testing.T) {
+	s := newTestStore(t)
+	userID, err := s.CreateUser(model.User{Username: "u", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	token, _ := s.CreateAuthSession(userID)
+	sess, err := s.GetAuthSession(token)
+	if err != nil || sess == nil {
+		t.Fatalf("GetAuthSession: %v, %v", sess, err)
+	}
+	if got := sess.ExpiresAt.Sub(sess.CreatedAt); got != DefaultAuthSessionTTL {
+		t.Errorf("expected the default TTL %v, got %v", DefaultAuthSessionTTL, got)
+	}
+
+	s.SetAuthSessionTTL(4 * time.Hour)
+	token, _ = s.CreateAuthSession(userID)
+	if sess, _ := s.GetAuthSession(token); sess == nil || sess.ExpiresAt.Sub(sess.CreatedAt) != 4*time.Hour {
+		t.Errorf("expected a 4h session, got %+v", sess)
+	}
+
+	s.SetAuthSessionTTL(time.Millisecond)
+	expired, _ := s.CreateAuthSession(userID)
+	time.Sleep(5 * time.Millisecond)
+	if sess, err := s.GetAuthSession(expired); err != nil || sess != nil {
+		t.Errorf("an expired session should be rejected, got %+v, %v", sess, err)
+	}
+	var n int
+	s.db.QueryRow(`SELECT COUNT(*) FROM auth_sessions WHERE id = ?`, expired).Scan(&n)
+	if n != 0 {
+		t.Error("an expired session should be deleted when it is looked up")
+	}
+
+	s.SetAuthSessionTTL(0)
+	token, _ = s.CreateAuthSession(userID)
+	if sess, _ := s.GetAuthSession(token); sess == nil || sess.ExpiresAt.Sub(sess.CreatedAt) != DefaultAuthSessionTTL {
+		t.Errorf("a zero TTL should restore the default, got %+v", sess)
+	}
+}
+
+func TestCleanupExpiredSessions(t *testing.T) {
+	s := newTestStore(t)
+	userID, err := s.CreateUser(model.User{Username: "u", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	s.SetAuthSessionTTL(time.Millisecond)
+	s.CreateAuthSession(userID)
+	s.CreateAuthSession(userID)
+	s.SetAuthSessionTTL(time.Hour)
+	live, _ := s.CreateAuthSession(userID)
+	time.Sleep(5 * time.Millisecond)
+
+	n, err := s.CleanupExpiredSessions()
+	if err != nil {
+		t.Fatalf("CleanupExpiredSessions: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 expired sessions deleted, got %d", n)
+	}
+	if sess, _ := s.GetAuthSession(live); sess == nil {
+		t.Error("a live session should survive the cleanup")
+	}
+
+	// The background job deletes sessions that expire later and stops
+	// when its context is cancelled.
+	s.SetAuthSessionTTL(time.Millisecond)
+	s.CreateAuthSession(userID)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.RunSessionCleanup(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var count int
+		s.db.QueryRow(`SELECT COUNT(*) FROM auth_sessions`).Scan(&count)
+		if count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("RunSessionCleanup did not delete the expired session, %d sessions left", count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunSessionCleanup did not stop after cancel")
+	}
+}
+
+func TestArchiveExam(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(filepath.Join(dir, "live.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Close()
+	if err := s.SetExamInfo(model.ExamInfo{ExamID: "phys-101", Subject: "Physics"}); err != nil {
+		t.Fatalf("SetExamInfo: %v", err)
+	}
+	q := insertTestQuestion(t, s, "Q1", "easy", "basics")
+	bpID, _ := s.CreateBlueprint(model.ExamBlueprint{CourseID: 1, Name: "Exam"})
+	userID, err := s.CreateUser(model.User{Username: "ann", PasswordHash: "x", Role: model.UserRoleStudent, Active: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	sessionID, err := s.CreateSession(bpID, userID, []int64{q})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	threads, _ := s.GetThreadsForSession(sessionID)
+	if _, err := s.AddMessage(model.Message{ThreadID: threads[0].ID, Role: model.RoleStudent, Content: "answer"}); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	if err := s.UpsertScore(model.QuestionScore{ThreadID: threads[0].ID, LLMScore: 5}); err != nil {
+		t.Fatalf("UpsertScore: %v", err)
+	}
+	if err := s.UpsertGrade(model.Grade{SessionID: sessionID, LLMGrade: 50}); err != nil {
+		t.Fatalf("UpsertGrade: %v", err)
+	}
+
+	out := filepath.Join(dir, "archive.db")
+	if _, err := s.ArchiveExam("chem-101", out); err == nil {
+		t.Error("archiving under the wrong exam ID should fail")
+	}
+	counts, err := s.ArchiveExam("phys-101", out)
+	if err != nil {
+		t.Fatalf("ArchiveExam: %v", err)
+	}
+	if want := (model.ArchiveCounts{Questions: 1, Users: 1, Sessions: 1}); counts != want {
+		t.Errorf("counts = %+v, want %+v", counts, want)
+	}
+	if _, err := s.ArchiveExam("phys-101", out); err == nil {
+		t.Error("archiving over an existing file should fail")
+	}
+
+	archive, err := New(out)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer archive.Close()
+	if info, _ := archive.GetExamInfo(); info.ExamID != "phys-101" || info.Subject != "Physics" {
+		t.Errorf("archive metadata = %+v", info)
+	}
+	view, err := archive.GetSessionView(sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionView in archive: %v", err)
+	}
+	if len(view.Threads) != 1 || len(view.Threads[0].Messages) != 1 || view.Threads[0].Score == nil || view.Grade == nil {
+		t.Errorf("archived session is incomplete: %+v", view)
+	}
+	if u, err := archive.GetUserByID(userID); err != nil || u.Username != "ann" {
+		t.Errorf("archived user = %+v (err %v)", u, err)
+	}
+
+	if _, err := s.db.Exec(`INSERT INTO audit_log (created_at, user_id, action, session_id, new_value) VALUES (?, ?, 'grade', ?, 70)`, time.Now(), userID, sessionID); err != nil {
+		t.Fatalf("insert audit entry: %v", err)
+	}
+	n, err := s.PruneSessions()
+	if err != nil || n != 1 {
+		t.Fatalf("PruneSessions = %d, %v; want 1", n, err)
+	}
+	if entries, err := s.ListAuditLog(sessionID); err != nil || len(entries) != 1 {
+		t.Errorf("pruning must keep the audit log, got %d entries (err %v)", len(entries), err)
+	}
+	if _, err := s.GetSession(sessionID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("pruned session should be gone, got %v", err)
+	}
+	if orphans, err := s.FindOrphans(); err != nil || orphans.Total() != 0 {
+		t.Errorf("pruning should leave no orphans, got %+v (err %v)", orphans, err)
+	}
+	if _, err := s.GetQuestion(q); err != nil {
+		t.Errorf("questions should survive pruning: %v", err)
+	}
+	if _, err := archive.GetSession(sessionID); err != nil {
+		t.Errorf("the archive should keep the pruned session: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// tagList stores a question's tags as a JSON array in the tags column, so
+// queries can match a single tag with json_each.
+type tagList []string
+
+// Value implements driver.Valuer. No tags are stored as "[]".
+func (t tagList) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(t))
+	return string(b), err
+}
+
+// Scan implements sql.Scanner. An empty array scans as nil.
+func (t *tagList) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case nil:
+		*t = nil
+		return nil
+	default:
+		return fmt.Errorf("scan tags: unsupported type %T", src)
+	}
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return fmt.Errorf("scan tags %q: %w", data, err)
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	*t = tags
+	return nil
+}
@@ -11,9 +11,9 @@ import (
 // CreateUser inserts a new user.
 func (s *Store) CreateUser(u model.User) (int64, error) {
 	res, err := s.db.Exec(
-		`INSERT INTO users (username, external_id, display_name, password_hash, role, active, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		u.Username, u.ExternalID, u.DisplayName, u.PasswordHash, u.Role, u.Active, time.Now(),
+		`INSERT INTO users (username, external_id, display_name, cohort, email, password_hash, role, active, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.Username, u.ExternalID, u.DisplayName, u.Cohort, u.Email, u.PasswordHash, u.Role, u.Active, time.Now(),
 	)
 	if err != nil {
 		slog.Error("failed to create user", "username", u.Username, "error", err)
@@ -31,9 +31,9 @@ func (s *Store) CreateUser(u model.User) (int64, error) {
 func (s *Store) GetUserByUsername(username string) (*model.User, error) {
 	var u model.User
 	err := s.db.QueryRow(
-		`SELECT id, username, external_id, display_name, password_hash, role, active, created_at
+		`SELECT id, username, external_id, display_name, cohort, email, password_hash, role, active, created_at
 		 FROM users WHERE username = ?`, username,
-	).Scan(&u.ID, &u.Username, &u.ExternalID, &u.DisplayName, &u.PasswordHash, &u.Role, &u.Active, &u.CreatedAt)
+	).Scan(&u.ID, &u.Username, &u.ExternalID, &u.DisplayName, &u.Cohort, &u.Email, &u.PasswordHash, &u.Role, &u.Active, &u.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -47,9 +47,9 @@ func (s *Store) GetUserByUsername(username string) (*model.User, error) {
 func (s *Store) GetUserByID(id int64) (*model.User, error) {
 	var u model.User
 	err := s.db.QueryRow(
-		`SELECT id, username, external_id, display_name, password_hash, role, active, created_at
+		`SELECT id, username, external_id, display_name, cohort, email, password_hash, role, active, created_at
 		 FROM users WHERE id = ?`, id,
-	).Scan(&u.ID, &u.Username, &u.ExternalID, &u.DisplayName, &u.PasswordHash, &u.Role, &u.Active, &u.CreatedAt)
+	).Scan(&u.ID, &u.Username, &u.ExternalID, &u.DisplayName, &u.Cohort, &u.Email, &u.PasswordHash, &u.Role, &u.Active, &u.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -62,7 +62,7 @@ func (s *Store) GetUserByID(id int64) (*model.User, error) {
 // ListUsers returns all users.
 func (s *Store) ListUsers() ([]model.User, error) {
 	rows, err := s.db.Query(
-		`SELECT id, username, external_id, display_name, password_hash, role, active, created_at
+		`SELECT id, username, external_id, display_name, cohort, email, password_hash, role, active, created_at
 		 FROM users ORDER BY id`,
 	)
 	if err != nil {
@@ -72,7 +72,7 @@ func (s *Store) ListUsers() ([]model.User, error) {
 	var users []model.User
 	for rows.Next() {
 		var u model.User
-		if err := rows.Scan(&u.ID, &u.Username, &u.ExternalID, &u.DisplayName, &u.PasswordHash, &u.Role, &u.Active, &u.CreatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Username, &u.ExternalID, &u.DisplayName, &u.Cohort, &u.Email, &u.PasswordHash, &u.Role, &u.Active, &u.CreatedAt); err != nil {
 			return nil, err
 		}
 		users = append(users, u)
@@ -80,12 +80,72 @@ func (s *Store) ListUsers() ([]model.User, error) {
 	return users, rows.Err()
 }
 
+// GetUsersByIDs returns the users with the given IDs, keyed by ID. IDs
+// without a user are left out.
+func (s *Store) GetUsersByIDs(ids []int64) (map[int64]model.User, error) {
+	users := make(map[int64]model.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := s.db.Query(
+		`SELECT id, username, external_id, display_name, cohort, email, password_hash, role, active, created_at
+		 FROM users WHERE id IN (`+placeholders(len(ids))+`)`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u model.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.ExternalID, &u.DisplayName, &u.Cohort, &u.Email, &u.PasswordHash, &u.Role, &u.Active, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users[u.ID] = u
+	}
+	return users, rows.Err()
+}
+
 // ToggleUserActive flips the active flag on a user.
 func (s *Store) ToggleUserActive(id int64) error {
 	_, err := s.db.Exec(`UPDATE users SET active = NOT active WHERE id = ?`, id)
 	return err
 }
 
+// UpdateUserRole changes a user's role. Sessions stay tied to the user by ID.
+func (s *Store) UpdateUserRole(id int64, role model.UserRole) error {
+	_, err := s.db.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	return err
+}
+
+// SetUserCohort assigns a user to a cohort (class section). Sessions started
+// afterwards are tagged with it; existing sessions keep their cohort.
+func (s *Store) SetUserCohort(id int64, cohort string) error {
+	res, err := s.db.Exec(`UPDATE users SET cohort = ? WHERE id = ?`, cohort, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdatePassword replaces a user's bcrypt password hash.
+func (s *Store) UpdatePassword(userID int64, hash string) error {
+	res, err := s.db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, hash, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // UserCount returns the total number of users.
 func (s *Store) UserCount() (int, error) {
 	var count int
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"os"
 	"strings"
 
 	"golang.org/x/crypto/bcrypt"
@@ -30,13 +31,23 @@ type Credential struct {
 type ImportConfig struct {
 	Role           model.UserRole // Role to assign (e.g. UserRoleStudent, UserRoleTeacher)
 	PasswordPrefix string         // Prefix for generated passwords (e.g. "phys", "teach")
+
+	// Existing lists users already in the database. Their usernames are not
+	// reused, and rows whose ID matches one of their external IDs are skipped.
+	Existing []model.User
+	// OnSkip, if set, is called with the ID of each row skipped because its
+	// user already exists.
+	OnSkip func(userID string)
 }
 
 // ImportCSV reads a CSV with columns user_id and display_name,
 // generates usernames and passwords, creates users via the store, and returns
-// the generated credentials.
+// the generated credentials. Columns are found by name in any order; an
+// optional email column is stored on the user, other columns are ignored, and
+// a leading UTF-8 BOM (as written by spreadsheet exports) is skipped.
 func ImportCSV(r io.Reader, store UserCreator, cfg ImportConfig) ([]Credential, error) {
 	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // short rows are skipped below
 	records, err := reader.ReadAll()
 	if err != nil {
 		return nil, fmt.Errorf("parse CSV: %w", err)
@@ -46,13 +57,18 @@ func ImportCSV(r io.Reader, store UserCreator, cfg ImportConfig) ([]Credential,
 	}
 
 	header := records[0]
-	idCol, nameCol := -1, -1
+	idCol, nameCol, emailCol := -1, -1, -1
 	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
 		switch strings.TrimSpace(strings.ToLower(h)) {
 		case "user_id", "student_id", "teacher_id":
 			idCol = i
 		case "display_name":
 			nameCol = i
+		case "email":
+			emailCol = i
 		}
 	}
 	if idCol < 0 {
@@ -63,6 +79,13 @@ func ImportCSV(r io.Reader, store UserCreator, cfg ImportConfig) ([]Credential,
 	}
 
 	usedUsernames := map[string]bool{"admin": true}
+	existingIDs := make(map[string]bool, len(cfg.Existing))
+	for _, u := range cfg.Existing {
+		usedUsernames[u.Username] = true
+		if u.ExternalID != "" {
+			existingIDs[u.ExternalID] = true
+		}
+	}
 	var creds []Credential
 
 	for _, row := range records[1:] {
@@ -74,6 +97,16 @@ func ImportCSV(r io.Reader, store UserCreator, cfg ImportConfig) ([]Credential,
 		if userID == "" {
 			continue
 		}
+		if existingIDs[userID] {
+			if cfg.OnSkip != nil {
+				cfg.OnSkip(userID)
+			}
+			continue
+		}
+		var email string
+		if emailCol >= 0 && emailCol < len(row) {
+			email = strings.TrimSpace(row[emailCol])
+		}
 
 		username := DeduplicateUsername(
 			UsernameFromDisplayName(displayName), usedUsernames)
@@ -93,6 +126,7 @@ func ImportCSV(r io.Reader, store UserCreator, cfg ImportConfig) ([]Credential,
 			Username:     username,
 			ExternalID:   userID,
 			DisplayName:  displayName,
+			Email:        email,
 			PasswordHash: string(hash),
 			Role:         cfg.Role,
 			Active:       true,
@@ -170,10 +204,35 @@ func RandomPassword(prefix string, length int) (string, error) {
 
 // WriteCredentialsCSV writes credentials to a CSV writer.
 func WriteCredentialsCSV(w io.Writer, creds []Credential) error {
-	cw := csv.NewWriter(w)
-	if err := cw.Write([]string{"user_id", "display_name", "username", "password"}); err != nil {
+	return writeCredentials(w, creds, true)
+}
+
+// AppendCredentialsCSV appends credentials to the CSV file at path, creating
+// it with a header row if it does not exist or is empty.
+func AppendCredentialsCSV(path string, creds []Credential) (err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
 		return err
 	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return writeCredentials(f, creds, info.Size() == 0)
+}
+
+func writeCredentials(w io.Writer, creds []Credential, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write([]string{"user_id", "display_name", "username", "password"}); err != nil {
+			return err
+		}
+	}
 	for _, c := range creds {
 		if err := cw.Write([]string{c.UserID, c.DisplayName, c.Username, c.Password}); err != nil {
 			return err
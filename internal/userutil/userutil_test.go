@@ -0,0 +1,148 @@
+package userutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/examiner/internal/model"
+)
+
+// fakeStore records created users in memory. CreateUser fails once failAt
+// users have been created, when failAt is positive.
+type fakeStore struct {
+	users  []model.User
+	failAt int
+}
+
+func (s *fakeStore) CreateUser(u model.User) (int64, error) {
+	if s.failAt > 0 && len(s.users) >= s.failAt {
+		return 0, fmt.Errorf("store full")
+	}
+	s.users = append(s.users, u)
+	return int64(len(s.users)), nil
+}
+
+func TestImportCSV(t *testing.T) {
+	rosters := map[string]string{
+		"bom": "\ufeffstudent_id,display_name,email,section\n" +
+			"S-001, Anna Smirnova ,  anna@example.edu ,A\n" +
+			"S-002,Boris Orlov,,B\n",
+		"reordered": "section,Email,Display_Name,Student_ID\n" +
+			"A, anna@example.edu ,Anna Smirnova,S-001\n" +
+			"B,,Boris Orlov, S-002 \n",
+	}
+	for name, data := range rosters {
+		t.Run(name, func(t *testing.T) {
+			s := &fakeStore{}
+			creds, err := ImportCSV(strings.NewReader(data), s, ImportConfig{
+				Role:           model.UserRoleStudent,
+				PasswordPrefix: "phys",
+			})
+			if err != nil {
+				t.Fatalf("ImportCSV: %v", err)
+			}
+			if len(creds) != 2 || creds[0].UserID != "S-001" || creds[1].UserID != "S-002" {
+				t.Fatalf("creds = %+v, want S-001 and S-002", creds)
+			}
+			if !strings.HasPrefix(creds[0].Password, "phys-") {
+				t.Errorf("password = %q, want the phys- prefix", creds[0].Password)
+			}
+			if len(s.users) != 2 {
+				t.Fatalf("created %d users, want 2", len(s.users))
+			}
+
+			u := s.users[0]
+			if u.Username != creds[0].Username || u.Role != model.UserRoleStudent || !u.Active {
+				t.Errorf("user = %+v, want an active student named %q", u, creds[0].Username)
+			}
+			if u.ExternalID != "S-001" || u.DisplayName != "Anna Smirnova" || u.Email != "anna@example.edu" {
+				t.Errorf("user = %q/%q/%q, want S-001/Anna Smirnova/anna@example.edu", u.ExternalID, u.DisplayName, u.Email)
+			}
+			if s.users[1].Email != "" {
+				t.Errorf("a blank email should be stored empty, got %q", s.users[1].Email)
+			}
+		})
+	}
+}
+
+func TestImportCSVErrors(t *testing.T) {
+	tests := map[string]string{
+		"header only":    "student_id,display_name\n",
+		"missing id":     "name,display_name\nS-001,Anna Smirnova\n",
+		"missing name":   "student_id,name\nS-001,Anna Smirnova\n",
+		"malformed file": "student_id,display_name\n\"S-001,Anna\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &fakeStore{}
+			if _, err := ImportCSV(strings.NewReader(data), s, ImportConfig{Role: model.UserRoleStudent}); err == nil {
+				t.Error("expected an error")
+			}
+			if len(s.users) != 0 {
+				t.Errorf("created %d users, want none", len(s.users))
+			}
+		})
+	}
+}
+
+func TestImportCSVPartialFailure(t *testing.T) {
+	s := &fakeStore{failAt: 1}
+	data := "student_id,display_name\nS-001,Anna Smirnova\nS-002,Boris Orlov\n"
+	creds, err := ImportCSV(strings.NewReader(data), s, ImportConfig{Role: model.UserRoleStudent, PasswordPrefix: "phys"})
+	if err == nil || !strings.Contains(err.Error(), "S-002") {
+		t.Fatalf("err = %v, want a failure naming S-002", err)
+	}
+	if len(creds) != 1 || creds[0].UserID != "S-001" {
+		t.Errorf("creds = %+v, want the user created before the failure", creds)
+	}
+}
+
+func TestImportCSVSkipsExisting(t *testing.T) {
+	s := &fakeStore{}
+	existing := []model.User{{Username: "asmirnov", ExternalID: "S-001", DisplayName: "Anna Smirnova"}}
+
+	var skipped []string
+	data := "student_id,display_name\nS-001,Anna Smirnova\nS-002,Alexei Smirnov\n"
+	creds, err := ImportCSV(strings.NewReader(data), s, ImportConfig{
+		Role:           model.UserRoleStudent,
+		PasswordPrefix: "phys",
+		Existing:       existing,
+		OnSkip:         func(id string) { skipped = append(skipped, id) },
+	})
+	if err != nil {
+		t.Fatalf("ImportCSV: %v", err)
+	}
+	if !reflect.DeepEqual(skipped, []string{"S-001"}) {
+		t.Errorf("skipped = %v, want [S-001]", skipped)
+	}
+	if len(creds) != 1 || creds[0].UserID != "S-002" || creds[0].Username != "asmirno2" {
+		t.Fatalf("creds = %+v, want only S-002 with a deduplicated username", creds)
+	}
+	if len(s.users) != 1 || s.users[0].ExternalID != "S-002" {
+		t.Errorf("created users = %+v, want only S-002", s.users)
+	}
+}
+
+func TestAppendCredentialsCSV(t *testing.T) {
+	creds := []Credential{{UserID: "S-002", DisplayName: "Alexei Smirnov", Username: "asmirno2", Password: "phys-abcde"}}
+	path := filepath.Join(t.TempDir(), "exam-creds.csv")
+	for range 2 {
+		if err := AppendCredentialsCSV(path, creds); err != nil {
+			t.Fatalf("AppendCredentialsCSV: %v", err)
+		}
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "user_id,display_name,username,password\n" +
+		"S-002,Alexei Smirnov,asmirno2,phys-abcde\n" +
+		"S-002,Alexei Smirnov,asmirno2,phys-abcde\n"
+	if string(got) != want {
+		t.Errorf("credentials file = %q, want one header and two rows", got)
+	}
+}